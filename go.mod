@@ -1,3 +1,8 @@
 module github.com/f3liz-dev/noraneko-winupdater
 
 go 1.24.11
+
+require (
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/sys v0.38.0
+)
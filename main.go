@@ -7,12 +7,16 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/tui"
 	"github.com/f3liz-dev/noraneko-winupdater/pkg/updater"
 )
 
@@ -21,16 +25,84 @@ const (
 	BrowserName = "Noraneko"
 )
 
+// hiddenFlags are test hooks left out of the usage message
+var hiddenFlags = map[string]bool{
+	"simulate-failure": true,
+}
+
+// usage prints the usage message without the hidden flags
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(out)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
+
 func main() {
 	// Parse command line flags
 	scheduled := flag.Bool("scheduled", false, "Run as scheduled task")
 	portable := flag.Bool("portable", false, "Run in portable mode")
 	createTask := flag.Bool("create-task", false, "Create scheduled task")
 	removeTask := flag.Bool("remove-task", false, "Remove scheduled task")
+	repairTask := flag.Bool("repair-scheduled-task", false, "Recreate the scheduled task if it is missing or runs another executable")
+	installService := flag.Bool("install-service", false, "Register and start a Windows service that checks for updates every CheckInterval minutes")
+	removeService := flag.Bool("remove-service", false, "Stop and remove the Windows service")
+	runService := flag.Bool("run-service", false, "Run as the Windows service (started by the service manager)")
 	checkOnly := flag.Bool("check-only", false, "Only check for updates, do not install")
+	onLaunch := flag.Bool("on-launch", false, "Quickly check for an update when the browser starts, without installing it")
+	stage := flag.Bool("stage", false, "Download and verify the update into StagingDir without installing it")
+	applyStaged := flag.Bool("apply-staged", false, "Install the update staged by -stage, without downloading")
+	forceReinstall := flag.Bool("force-reinstall", false, "Reinstall the latest release even if it is not newer")
+	reinstallIfCorrupt := flag.Bool("reinstall-if-corrupt", false, "Remove the files of a broken install (missing noraneko.exe or empty key files) listed in its manifest and install the latest release")
+	assetName := flag.String("asset", "", "Use the release asset with the given name or matching the given glob pattern instead of the best match")
+	allowFlavorFallback := flag.Bool("allow-flavor-fallback", false, "Install the installer in portable mode if the release has no portable asset")
+	status := flag.Bool("status", false, "Print install and updater status and exit")
+	jsonOutput := flag.Bool("json", false, "Print the status, configuration or run result as JSON")
+	dumpAssetMatch := flag.Bool("dump-asset-match", false, "Print how each release asset matches this platform and exit")
+	dumpReleaseJSON := flag.Bool("dump-release-json", false, "Print the latest release JSON received from the API and exit")
+	printURL := flag.Bool("print-url", false, "Print the download URL of the asset for this platform, and of its checksum file, then exit")
+	listReleases := flag.Bool("list-releases", false, "List available releases and exit")
+	format := flag.String("format", "table", "Output format of -list-releases: table, csv or json")
+	verifyInstall := flag.Bool("verify-install", false, "Verify installed files against the install manifest and exit")
+	selfTest := flag.Bool("selftest", false, "Check network access, write access, disk space, the browser and the scheduled task, then exit")
+	rollback := flag.Bool("rollback", false, "Restore the most recent backup of the install and exit")
+	skip := flag.String("skip", "", "Never offer the given version as an update")
+	unskip := flag.Bool("unskip", false, "Clear the skipped version")
+	exportConfig := flag.String("export-config", "", "Write the current settings to the given file and exit")
+	printConfig := flag.Bool("print-config", false, "Print each effective setting and where its value came from, then exit")
+	importConfig := flag.String("import-config", "", "Merge settings from the given file into the configuration and exit")
+	compactConfig := flag.Bool("compact-config", false, "Remove stale log and cache entries from the INI file and exit")
+	updateConfigSchema := flag.Bool("update-config-schema", false, "Add the settings missing from the INI file with their defaults and comments, then exit")
+	yes := flag.Bool("yes", false, "Install updates without asking for confirmation")
+	reboot := flag.Bool("reboot", false, "Reboot after an update that requires it (asks for confirmation unless scheduled)")
+	noColor := flag.Bool("no-color", false, "Do not use color in console output")
 	version := flag.Bool("version", false, "Print version and exit")
+	simulateFailure := flag.String("simulate-failure", "", "Make the given update phase fail, for testing")
+	flag.Usage = usage
 	flag.Parse()
 
+	if *simulateFailure != "" && !slices.Contains(updater.FailurePhases, *simulateFailure) {
+		fmt.Fprintf(os.Stderr, "Invalid -simulate-failure phase %q, expected one of %s\n", *simulateFailure, strings.Join(updater.FailurePhases, ", "))
+		os.Exit(2)
+	}
+
+	if !slices.Contains(updater.ReleaseFormats, *format) {
+		fmt.Fprintf(os.Stderr, "Invalid -format %q, expected one of %s\n", *format, strings.Join(updater.ReleaseFormats, ", "))
+		os.Exit(2)
+	}
+
+	if *stage && *applyStaged {
+		fmt.Fprintln(os.Stderr, "-stage and -apply-staged cannot be combined")
+		os.Exit(2)
+	}
+
 	if *version {
 		fmt.Printf("%s WinUpdater v%s\n", BrowserName, Version)
 		os.Exit(0)
@@ -48,18 +120,284 @@ func main() {
 	cfg, err := config.Load(exeDir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		if *onLaunch {
+			os.Exit(0)
+		}
 		os.Exit(1)
 	}
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", config.ConfigFileName, warning)
+	}
+	if cfg.Regenerated {
+		fmt.Fprintf(os.Stderr, "Warning: %s was empty or damaged and has been reset to the defaults\n", cfg.ConfigFile)
+		if cfg.DamagedBackup != "" {
+			fmt.Fprintf(os.Stderr, "The damaged file was saved as %s\n", cfg.DamagedBackup)
+		}
+	}
 
-	// Create updater instance
-	u := updater.New(cfg, updater.Options{
+	// Show the effective settings
+	if *printConfig {
+		settings := cfg.Effective()
+		if *jsonOutput {
+			printJSON(settings, "configuration")
+			return
+		}
+		for _, s := range settings {
+			fmt.Printf("%-28s %-40s %s\n", s.Key, s.Value, s.Source)
+		}
+		return
+	}
+
+	// Move settings between installs
+	if *exportConfig != "" {
+		if err := cfg.Export(*exportConfig); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting configuration: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Settings exported to %s\n", *exportConfig)
+		return
+	}
+	if *importConfig != "" {
+		replaced, err := cfg.Import(*importConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error importing configuration: %v\n", err)
+			os.Exit(1)
+		}
+		for _, r := range replaced {
+			fmt.Printf("Replaced %s\n", r)
+		}
+		fmt.Printf("Settings imported from %s\n", *importConfig)
+		return
+	}
+	if *compactConfig {
+		result, err := cfg.Compact()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error compacting configuration: %v\n", err)
+			os.Exit(1)
+		}
+		for _, r := range result.Removed {
+			fmt.Printf("Removed %s\n", r)
+		}
+		fmt.Printf("Compacted %s: %d -> %d bytes (%d saved), removed %d stale entries\n",
+			cfg.ConfigFile, result.Before, result.After, result.Before-result.After, len(result.Removed))
+		return
+	}
+	if *updateConfigSchema {
+		added, err := cfg.UpdateSchema()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error updating configuration: %v\n", err)
+			os.Exit(1)
+		}
+		for _, key := range added {
+			fmt.Printf("Added %s\n", key)
+		}
+		fmt.Printf("Added %d missing settings to %s\n", len(added), cfg.ConfigFile)
+		return
+	}
+
+	// Skip or unskip a version
+	if *skip != "" || *unskip {
+		if err := cfg.SetSkipVersion(*skip); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving skipped version: %v\n", err)
+			os.Exit(1)
+		}
+		if *skip != "" {
+			fmt.Printf("Version %s will be skipped, newer versions are still offered.\n", *skip)
+		} else {
+			fmt.Println("No version is skipped anymore.")
+		}
+		return
+	}
+
+	// Progress bar, prompts and progress messages. With -json they go to
+	// stderr so stdout only holds the JSON.
+	uiOut := os.Stdout
+	if *jsonOutput {
+		uiOut = os.Stderr
+	}
+	ui := tui.New(uiOut, os.Stdin, *scheduled, *yes)
+	if *noColor {
+		ui.DisableColor()
+	}
+
+	opts := updater.Options{
 		Scheduled:  *scheduled,
 		Portable:   *portable,
 		CheckOnly:  *checkOnly,
 		CreateTask: *createTask,
 		RemoveTask: *removeTask,
 		Version:    Version,
-	})
+
+		ForceReinstall:      *forceReinstall,
+		AllowFlavorFallback: *allowFlavorFallback,
+		ReinstallIfCorrupt:  *reinstallIfCorrupt,
+		Asset:               *assetName,
+		SimulateFailure:     *simulateFailure,
+		Stage:               *stage,
+		ApplyStaged:         *applyStaged,
+		Output:              uiOut,
+	}
+	if ui.Interactive() {
+		opts.Progress = ui.Progress
+		opts.InstallProgress = ui.Progress
+		opts.VerifyProgress = ui.FileProgress
+		opts.Confirm = ui.Confirm
+	}
+
+	// Create updater instance
+	u := updater.New(cfg, opts)
+
+	// Notify of an update when the browser starts. Nothing that goes wrong
+	// may fail the launch.
+	if *onLaunch {
+		result := u.OnLaunch()
+		if *jsonOutput {
+			printJSON(result, "result")
+		}
+		return
+	}
+
+	// Report status
+	if *status {
+		s := u.Status()
+		if *jsonOutput {
+			printJSON(s, "status")
+		} else {
+			s.Print(os.Stdout)
+		}
+		return
+	}
+
+	// Check the environment
+	if *selfTest {
+		result := u.SelfTest()
+		if *jsonOutput {
+			printJSON(result, "self-test result")
+		} else {
+			result.Print(os.Stdout)
+		}
+		if !result.Passed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Explain asset selection
+	if *dumpAssetMatch {
+		if err := u.DumpAssetMatch(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Print the raw release for bug reports
+	if *dumpReleaseJSON {
+		if err := u.DumpReleaseJSON(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Resolve the download without downloading
+	if *printURL {
+		if err := u.PrintURL(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// List releases
+	if *listReleases {
+		releases, err := u.ListReleases()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing releases: %v\n", err)
+			os.Exit(1)
+		}
+		if err := updater.WriteReleases(os.Stdout, releases, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing releases: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Verify installed files
+	if *verifyInstall {
+		mismatches, err := u.VerifyInstall()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error verifying install: %v\n", err)
+			os.Exit(1)
+		}
+		if len(mismatches) == 0 {
+			fmt.Println("All installed files match the install manifest.")
+			return
+		}
+		for _, m := range mismatches {
+			if m.Actual == "" {
+				fmt.Printf("MISSING   %s\n", m.Path)
+			} else {
+				fmt.Printf("MODIFIED  %s\n", m.Path)
+			}
+		}
+		fmt.Printf("%d file(s) do not match the install manifest.\n", len(mismatches))
+		os.Exit(1)
+	}
+
+	// Restore the previous install
+	if *rollback {
+		backup, err := u.Rollback()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error rolling back: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Restored version %s from %s\n", backup.Version, backup.Path)
+		return
+	}
+
+	// Repair the scheduled task
+	if *repairTask {
+		repaired, err := u.RepairScheduledTask()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error repairing scheduled task: %v\n", err)
+			os.Exit(1)
+		}
+		switch {
+		case !cfg.ScheduledTask:
+			fmt.Println("No scheduled task is configured, use -create-task to create one.")
+		case repaired:
+			fmt.Println("Scheduled task recreated.")
+		default:
+			fmt.Println("Scheduled task is up to date.")
+		}
+		return
+	}
+
+	// Windows service operations
+	if *runService {
+		if err := u.RunService(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error running service: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *installService {
+		if err := u.InstallService(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error installing service: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Service %s installed and started.\n", config.ServiceName)
+		return
+	}
+	if *removeService {
+		if err := u.RemoveService(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error removing service: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Service %s removed.\n", config.ServiceName)
+		return
+	}
 
 	// Handle scheduled task operations
 	if *createTask || *removeTask {
@@ -71,8 +409,43 @@ func main() {
 	}
 
 	// Run the updater
-	if err := u.Run(); err != nil {
+	result, err := u.Run()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if result == nil {
+			os.Exit(1)
+		}
+	}
+
+	if *jsonOutput {
+		printJSON(result, "result")
+	} else {
+		fmt.Println()
+		result.Print(os.Stdout)
+	}
+
+	// Reboot to complete the update. Passing -reboot to a scheduled run
+	// counts as consent, interactive runs ask first.
+	if *reboot && result.RebootRequired && (*scheduled || ui.Ask("Reboot now?", false)) {
+		if err := updater.Reboot(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error rebooting: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Some of the [Installs] failed
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// printJSON writes v to stdout as indented JSON, the output of -json.
+// what names v in the error if it cannot be encoded.
+func printJSON(v any, what string) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding %s: %v\n", what, err)
 		os.Exit(1)
 	}
 }
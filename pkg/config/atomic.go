@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// writeData writes data to the temporary file of atomicWriteFile. It is a
+// variable so tests can interrupt a write.
+var writeData = func(f *os.File, data []byte) error {
+	_, err := f.Write(data)
+	return err
+}
+
+// atomicWriteFile replaces path with data. The data is written and synced
+// to a temporary file in the same directory first and then renamed over
+// path, so a crash mid-write leaves either the old or the new file, never
+// a truncated one.
+func atomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := writeData(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestAtomicWriteSurvivesInterruptedWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.LogEntry("LastResult", "No new version found"); err != nil {
+		t.Fatalf("Failed to write log entry: %v", err)
+	}
+	original, err := os.ReadFile(cfg.ConfigFile)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	// Die after writing half of the new contents
+	orig := writeData
+	writeData = func(f *os.File, data []byte) error {
+		f.Write(data[:len(data)/2])
+		return errors.New("simulated crash")
+	}
+	defer func() { writeData = orig }()
+
+	if err := cfg.LogEntry("LastResult", "Updated from 1.0.0 to 2.0.0"); err == nil {
+		t.Fatal("Expected the interrupted LogEntry to fail")
+	}
+	if err := cfg.Save(); err == nil {
+		t.Fatal("Expected the interrupted Save to fail")
+	}
+
+	data, err := os.ReadFile(cfg.ConfigFile)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if string(data) != string(original) {
+		t.Errorf("Expected the original config to survive, got:\n%s", data)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	for _, entry := range entries {
+		if name := entry.Name(); name != ConfigFileName && name != ConfigFileName+".lock" {
+			t.Errorf("Expected no temporary files to be left behind, found %s", name)
+		}
+	}
+
+	// Once writes work again the update goes through
+	writeData = orig
+	if err := cfg.LogEntry("LastResult", "Updated from 1.0.0 to 2.0.0"); err != nil {
+		t.Fatalf("Failed to write log entry: %v", err)
+	}
+	if got := cfg.LogValue("LastResult"); got != "Updated from 1.0.0 to 2.0.0" {
+		t.Errorf("Expected the new result, got '%s'", got)
+	}
+}
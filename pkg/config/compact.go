@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// updaterKeys lists the entries the updater writes to the [Log] and
+// [Cache] sections, by lowercase section and key. Other entries of these
+// sections were left by older versions. Each of the [Installs] writes them
+// prefixed with its name, see stateKey.
+var updaterKeys = map[string]map[string]bool{
+	"log": {
+		"lastrun":               true,
+		"lastresult":            true,
+		"lastrebootrequired":    true,
+		"lastphases":            true,
+		"installedbranch":       true,
+		"nextmaintenancewindow": true,
+		"kepttempfiles":         true,
+		"lastlaunchcheck":       true,
+	},
+	"cache": {
+		"releaseurl":     true,
+		"releaseetag":    true,
+		"verifiedtag":    true,
+		"verifiedasset":  true,
+		"verifiedsha256": true,
+		"verifiedpath":   true,
+	},
+}
+
+// CompactResult describes what Compact changed in the INI file
+type CompactResult struct {
+	// File size before and after compacting, in bytes
+	Before int
+	After  int
+	// Removed lists the removed entries as Section.Key
+	Removed []string
+}
+
+// Compact rewrites the INI file without the [Log] and [Cache] entries this
+// version no longer writes and without repeated ones, which are never read,
+// and with single blank lines between sections. [Settings], the other
+// sections and comments are kept as they are.
+func (c *Config) Compact() (*CompactResult, error) {
+	unlock, err := lockConfigFile(c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock config file: %w", err)
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	compacted, removed := compactINI(string(data))
+	result := &CompactResult{Before: len(data), After: len(compacted), Removed: removed}
+	if compacted == string(data) {
+		return result, nil
+	}
+	if err := atomicWriteFile(c.ConfigFile, []byte(compacted), 0644); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// iniSection is a section of an INI file as written, for compactINI
+type iniSection struct {
+	// name is the lowercase section name, empty before the first header
+	name   string
+	header string
+	lines  []string
+}
+
+// compactINI returns INI data without stale or repeated [Log] and [Cache]
+// entries, and the entries removed. A repeated [Log] or [Cache] section is
+// merged into the first, which entry reads first.
+func compactINI(data string) (string, []string) {
+	var removed []string
+	current := &iniSection{}
+	sections := []*iniSection{current}
+	merged := map[string]*iniSection{}
+	seen := map[string]bool{}
+
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			name := strings.ToLower(trimmed[1 : len(trimmed)-1])
+			if first := merged[name]; first != nil {
+				current = first
+				continue
+			}
+			current = &iniSection{name: name, header: line}
+			sections = append(sections, current)
+			if updaterKeys[name] != nil {
+				merged[name] = current
+			}
+			continue
+		}
+
+		keys := updaterKeys[current.name]
+		if keys != nil && trimmed == "" {
+			// The updater writes [Log] and [Cache] without blank lines
+			continue
+		}
+		if keys != nil && !strings.HasPrefix(trimmed, ";") && !strings.HasPrefix(trimmed, "#") {
+			key, _, _ := strings.Cut(trimmed, "=")
+			key = strings.TrimSpace(key)
+			id := current.name + "." + strings.ToLower(key)
+			base := strings.ToLower(key)
+			if _, after, ok := strings.Cut(base, "."); ok {
+				base = after
+			}
+			if !keys[base] || seen[id] {
+				removed = append(removed, strings.Trim(strings.TrimSpace(current.header), "[]")+"."+key)
+				continue
+			}
+			seen[id] = true
+		}
+		current.lines = append(current.lines, line)
+	}
+
+	var out []string
+	for _, s := range sections {
+		lines := collapseBlankLines(s.lines)
+		if len(lines) == 0 && (s.header == "" || updaterKeys[s.name] != nil) {
+			continue
+		}
+		if s.header != "" {
+			out = append(out, s.header)
+		}
+		out = append(out, lines...)
+		out = append(out, "")
+	}
+	return strings.Join(out, "\n"), removed
+}
+
+// collapseBlankLines drops leading and trailing blank lines and keeps a
+// single blank line of every run of them
+func collapseBlankLines(lines []string) []string {
+	var out []string
+	blank := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return out
+}
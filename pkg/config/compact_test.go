@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	tmpDir := t.TempDir()
+	bloated := "; Noraneko updater settings\n" +
+		"[Settings]\n" +
+		"; keep the nightly\n" +
+		"Branch=nightly\n" +
+		"\n\n\n" +
+		"WorkDir=" + tmpDir + "\n" +
+		"\n" +
+		"[Log]\n" +
+		"LastRun=2024-03-01 12:00:00\n" +
+		"LastCheck=2023-01-01 08:00:00\n" +
+		"; last outcome\n" +
+		"LastResult=Updated to 2.0.0\n" +
+		"LastResult=Updated to 1.0.0\n" +
+		"\n\n" +
+		"[Cache]\n" +
+		"ReleaseETag=\"abc\"\n" +
+		"LatestJSON={\"tag_name\": \"v1.0.0\"}\n" +
+		"\n" +
+		"[Log]\n" +
+		"LastRun=2023-01-01 08:00:00\n" +
+		"LastError=timeout\n" +
+		"InstalledBranch=nightly\n" +
+		"\n\n"
+	cfgFile := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(cfgFile, []byte(bloated), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	result, err := cfg.Compact()
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+
+	wantRemoved := []string{"Log.LastCheck", "Log.LastResult", "Cache.LatestJSON", "Log.LastRun", "Log.LastError"}
+	if !reflect.DeepEqual(result.Removed, wantRemoved) {
+		t.Errorf("Expected removed %v, got %v", wantRemoved, result.Removed)
+	}
+
+	want := "; Noraneko updater settings\n" +
+		"\n" +
+		"[Settings]\n" +
+		"; keep the nightly\n" +
+		"Branch=nightly\n" +
+		"\n" +
+		"WorkDir=" + tmpDir + "\n" +
+		"\n" +
+		"[Log]\n" +
+		"LastRun=2024-03-01 12:00:00\n" +
+		"; last outcome\n" +
+		"LastResult=Updated to 2.0.0\n" +
+		"InstalledBranch=nightly\n" +
+		"\n" +
+		"[Cache]\n" +
+		"ReleaseETag=\"abc\"\n"
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if string(data) != want {
+		t.Errorf("Unexpected compacted config:\n%s\nwant:\n%s", data, want)
+	}
+	if result.Before != len(bloated) || result.After != len(data) || result.After >= result.Before {
+		t.Errorf("Expected sizes %d -> %d, got %d -> %d", len(bloated), len(data), result.Before, result.After)
+	}
+
+	// The settings and the entries read before are unchanged
+	cfg, err = Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load compacted config: %v", err)
+	}
+	if cfg.Branch != "nightly" || cfg.WorkDir != tmpDir {
+		t.Errorf("Expected the settings to be kept, got Branch %q, WorkDir %q", cfg.Branch, cfg.WorkDir)
+	}
+	if got := cfg.LogValue("LastRun"); got != "2024-03-01 12:00:00" {
+		t.Errorf("Expected the first LastRun to be kept, got %q", got)
+	}
+	if got := cfg.CacheValue("ReleaseETag"); got != `"abc"` {
+		t.Errorf("Expected the cached ETag to be kept, got %q", got)
+	}
+
+	// A tidy file is left alone
+	result, err = cfg.Compact()
+	if err != nil || len(result.Removed) != 0 || result.Before != result.After {
+		t.Errorf("Expected nothing to compact, got %+v (%v)", result, err)
+	}
+	if !strings.HasSuffix(string(data), "\n") {
+		t.Error("Expected the compacted config to end with a newline")
+	}
+}
@@ -3,21 +3,184 @@ package config
 
 import (
 	"bufio"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
-	BrowserName     = "Noraneko"
-	BrowserExe      = "noraneko.exe"
-	DefaultBranch   = "nightly"
-	ConfigFileName  = "Noraneko-WinUpdater.ini"
-	ReleaseAPIURL   = "https://api.github.com/repos/f3liz-dev/noraneko-runtime/releases"
-	ConnectCheckURL = "https://api.github.com"
+	BrowserName      = "Noraneko"
+	BrowserExe       = "noraneko.exe"
+	DefaultBranch    = "nightly"
+	ConfigFileName   = "Noraneko-WinUpdater.ini"
+	ManifestName     = "Noraneko-WinUpdater.manifest.json"
+	ReleaseCacheName = "Noraneko-WinUpdater.release.json"
+	JournalName      = "Noraneko-WinUpdater.journal"
+	ReleaseAPIURL    = "https://api.github.com/repos/f3liz-dev/noraneko-runtime/releases"
+	GitHubAPIURL     = "https://api.github.com"
+	GitHubURL        = "https://github.com"
+	ConnectCheckURL  = "https://api.github.com"
+	TaskTitle        = "Noraneko WinUpdater"
+	ServiceName      = "NoranekoWinUpdater"
+
+	DefaultVerifyConcurrency = 4
+	DefaultMaxReleasePages   = 10
+	DefaultCacheMaxSize      = 2048
+	DefaultCacheMaxAge       = 30
+
+	DefaultPostInstallWait    = 2
+	DefaultPostInstallRetries = 3
+
+	DefaultCheckInterval = 240
+
+	DefaultMinTLSVersion = "1.2"
+
+	DefaultCertExpiryWarnDays = 30
+
+	DefaultMinBatteryCharge = 50
+
+	// DefaultArchiveRootStrip copies from the first folder of a portable
+	// archive
+	DefaultArchiveRootStrip = -1
+
+	DefaultMsiInstallDirProperty = "INSTALLDIR"
+)
+
+// AssetWeights are the points a release asset scores for each property
+// when the download is selected. The asset with the highest score wins.
+type AssetWeights struct {
+	// A Windows build
+	Windows int
+	// Built for this architecture
+	Arch int
+	// Of the requested flavor, portable zip or installer
+	Flavor int
+	// Named like the official portable zip or setup of this architecture
+	CanonicalName int
+	// Points by extension
+	Zip int
+	Exe int
+	Msi int
+}
+
+// DefaultAssetWeights prefer the requested flavor over a matching
+// architecture, and the canonical name over everything else
+var DefaultAssetWeights = AssetWeights{
+	Windows:       10,
+	Arch:          20,
+	Flavor:        40,
+	CanonicalName: 80,
+}
+
+// assetWeightNames are the [AssetPreference] keys in the order they are
+// written
+var assetWeightNames = []string{"Windows", "Arch", "Flavor", "CanonicalName", "Zip", "Exe", "Msi"}
+
+// field returns the weight for a lowercase [AssetPreference] key, or nil
+// if the key is unknown
+func (w *AssetWeights) field(key string) *int {
+	switch key {
+	case "windows":
+		return &w.Windows
+	case "arch":
+		return &w.Arch
+	case "flavor":
+		return &w.Flavor
+	case "canonicalname":
+		return &w.CanonicalName
+	case "zip":
+		return &w.Zip
+	case "exe":
+		return &w.Exe
+	case "msi":
+		return &w.Msi
+	default:
+		return nil
+	}
+}
+
+// releaseRepoRe matches a GitHub owner/repo name
+var releaseRepoRe = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?/[A-Za-z0-9._-]+$`)
+
+// DefaultStableExcludePatterns keep release candidates published as
+// regular releases off the stable branch
+var DefaultStableExcludePatterns = []string{`-rc\d*\b`, `-candidate\b`}
+
+// tlsVersions maps the accepted MinTLSVersion values to TLS versions
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Overwrite policies for files already present in the install directory
+const (
+	OverwriteAll          = "all"
+	OverwriteSkipExisting = "skip-existing"
+	OverwriteSkipListed   = "skip-listed"
 )
 
+// Webhook events: a run that found or installed an update, a failed run
+// and a run that found nothing to do
+const (
+	WebhookUpdate   = "update"
+	WebhookFailure  = "failure"
+	WebhookNoUpdate = "no-update"
+)
+
+// DefaultWebhookEvents are the runs reported to WebhookURL by default
+var DefaultWebhookEvents = []string{WebhookUpdate, WebhookFailure}
+
+// Branches are the release branches that can be tracked
+var Branches = []string{"nightly", "beta", "stable"}
+
+var (
+	versionSchemesMu sync.RWMutex
+	versionSchemes   = []string{"auto", "semver", "date"}
+)
+
+// RegisterVersionScheme accepts name as a VersionScheme, for schemes whose
+// comparator is registered with the updater
+func RegisterVersionScheme(name string) {
+	versionSchemesMu.Lock()
+	defer versionSchemesMu.Unlock()
+	if name = strings.ToLower(name); !slices.Contains(versionSchemes, name) {
+		versionSchemes = append(versionSchemes, name)
+	}
+}
+
+// VersionSchemes returns the accepted VersionScheme values besides empty
+func VersionSchemes() []string {
+	versionSchemesMu.RLock()
+	defer versionSchemesMu.RUnlock()
+	return slices.Clone(versionSchemes)
+}
+
+// settingChoices returns the valid values of the [Settings] keys that take
+// one of a fixed set, by lowercased key
+func settingChoices(key string) []string {
+	switch key {
+	case "branch":
+		return Branches
+	case "versionscheme":
+		return VersionSchemes()
+	case "overwritepolicy":
+		return []string{OverwriteAll, OverwriteSkipExisting, OverwriteSkipListed}
+	case "webhookevents":
+		return []string{WebhookUpdate, WebhookFailure, WebhookNoUpdate}
+	}
+	return nil
+}
+
 // Config holds the updater configuration
 type Config struct {
 	// Path to the browser executable
@@ -26,6 +189,24 @@ type Config struct {
 	// Working directory for downloads/extraction
 	WorkDir string
 
+	// Whether a WorkDir that is the updater's own directory is replaced by
+	// the system temp folder for installs that are not portable
+	RedirectWorkDir bool
+
+	// Directory where verified downloads are kept by their SHA256, empty
+	// to disable the download cache
+	CacheDir string
+
+	// Size limit of the download cache in MB (0 = unlimited)
+	CacheMaxSize int
+
+	// Days a cached download is kept after its last use (0 = forever)
+	CacheMaxAge int
+
+	// Directory -stage downloads updates to for -apply-staged, empty for a
+	// folder in the user's local application data
+	StagingDir string
+
 	// Whether to update the updater itself
 	UpdateSelf bool
 
@@ -35,43 +216,438 @@ type Config struct {
 	// Release branch to track (nightly, beta, stable)
 	Branch string
 
+	// Regular expressions of release tags never installed on the stable
+	// branch, matched without regard to case
+	StableExcludePatterns []string
+
+	// Number of parallel connections used to download assets
+	DownloadConnections int
+
+	// Number of files hashed in parallel when verifying an install
+	VerifyConcurrency int
+
+	// Extra HTTP headers sent with download requests ([Headers] section)
+	Headers map[string]string
+
+	// Whether the extra headers are also sent with GitHub API requests
+	HeadersForAPI bool
+
+	// Points release assets score when the download is selected
+	// ([AssetPreference] section)
+	AssetWeights AssetWeights
+
+	// Maximum number of pages fetched when listing releases
+	MaxReleasePages int
+
+	// PEM file with the only CA trusted for TLS connections
+	PinnedCACert string
+
+	// Whether requests are limited to HTTP/1.1, for proxies that break
+	// HTTP/2
+	DisableHTTP2 bool
+
+	// Lowest TLS version accepted for connections, 1.2 or 1.3
+	MinTLSVersion string
+
+	// Whether an update goes ahead unverified when the release's checksum
+	// file cannot be downloaded, rather than failing
+	ChecksumOptional bool
+
+	// Whether downloads must have a valid GitHub build provenance
+	// attestation
+	VerifyAttestation bool
+
+	// PEM file with the Sigstore roots attestations must chain to
+	AttestationTrustedRoot string
+
+	// PEM file with the public key of the Rekor transparency log whose
+	// signed entry timestamps prove when a signature was logged
+	RekorPublicKey string
+
+	// Whether downloads must have a valid cosign signature, made with
+	// CosignPublicKey or by a certificate matching CosignIdentity
+	VerifyCosign bool
+
+	// PEM file with the public key of key-based cosign signatures
+	CosignPublicKey string
+
+	// Regular expression the identity (URI or email) of the signing
+	// certificate of keyless cosign signatures must match in full
+	CosignIdentity string
+
+	// Whether the signing certificate of installers is checked for
+	// expiry, with a warning if it expires within CertExpiryWarnDays
+	CheckCertExpiry    bool
+	CertExpiryWarnDays int
+
+	// Whether an installer without a valid, unexpired signing certificate
+	// is rejected rather than only reported
+	RequireValidCert bool
+
+	// Whether an auto-detected browser path is written back to Path
+	AutoSavePath bool
+
+	// URL probed before checking for updates
+	ConnectCheckURL string
+
+	// Seconds to wait before fetching a release without assets again,
+	// 0 fails right away
+	AssetRetryDelay int
+
+	// Seconds to wait before the installed version is read again after an
+	// install that does not report the new version yet
+	PostInstallWait int
+
+	// Number of times the installed version is read again before the
+	// install is reported as not taking effect
+	PostInstallRetries int
+
+	// Seconds to wait for a running browser to close before installing,
+	// 0 installs without checking
+	WaitForBrowserClose int
+
+	// Whether the install is also checked by running the browser with
+	// --version
+	VerifyByLaunch bool
+
+	// Install-relative, slash-separated paths of files compared with the
+	// downloaded archive after a portable update, empty to skip the check
+	PostInstallSentinels []string
+
+	// Seconds a run may take before it is aborted, 0 for no limit
+	MaxRunDuration int
+
+	// Minutes between update checks of the Windows service and of
+	// launch checks
+	CheckInterval int
+
+	// Whether a failed connection check is only a warning
+	OfflineTolerant bool
+
+	// Whether the latest release is read from the GitHub release pages
+	// when the API cannot be reached
+	AllowHTMLFallback bool
+
+	// MSI property that receives the install directory (empty = none)
+	MsiInstallDirProperty string
+
+	// Directory installers write their logs to (empty = no log)
+	InstallerLog string
+
+	// User-Agent sent with every request (empty = updater default)
+	UserAgent string
+
+	// URL the result of a run is POSTed to as JSON (empty = disabled)
+	WebhookURL string
+
+	// Runs that are POSTed to WebhookURL, of the Webhook events
+	WebhookEvents []string
+
+	// GitHub repository (owner/repo) releases are fetched from, empty for
+	// the official Noraneko releases
+	ReleaseRepo string
+
+	// Versioning scheme of releases (semver, date), empty to detect it
+	VersionScheme string
+
+	// Release version or tag that is never offered as an update
+	SkipVersion string
+
+	// Whether an installer that needs administrator rights is relaunched
+	// through a UAC prompt in interactive runs
+	AutoElevate bool
+
+	// Whether downloads and extracted files are kept after a failed install
+	KeepTempOnError bool
+
+	// Number of previous installs kept as Noraneko-<version>.bak next to
+	// the install for -rollback, 0 keeps none
+	BackupCount int
+
+	// Whether the duration of each phase of a run is written to the log
+	LogPhases bool
+
+	// Whether a scheduled task should exist, set by -create-task and
+	// -remove-task and checked by -repair-scheduled-task
+	ScheduledTask bool
+
+	// Which existing files an update may overwrite (Overwrite* constants)
+	OverwritePolicy string
+
+	// Glob patterns of files and directories kept by the skip-listed
+	// policy, relative to the install directory
+	PreserveFiles []string
+
+	// Folder of a portable archive whose content is installed, as a
+	// slash-separated path that may contain globs; empty to use
+	// ArchiveRootStrip
+	ArchiveRoot string
+
+	// Number of single folders a portable archive is descended into
+	// before its content is installed, -1 for its first folder
+	ArchiveRootStrip int
+
+	// Additional install directories or browser executables checked by
+	// GetBrowserPath, may contain %VARIABLE% references
+	ExtraSearchPaths []string
+
+	// File name of the browser executable, for renamed executables or
+	// launchers
+	BrowserExe string
+
+	// Other executable names GetBrowserPath looks for, after BrowserExe
+	BrowserExeCandidates []string
+
+	// Weekly periods in which scheduled runs install updates, empty to
+	// allow any time
+	MaintenanceWindows []MaintenanceWindow
+
+	// Whether scheduled runs defer updates while the computer runs on
+	// battery below MinBatteryCharge percent
+	SkipOnBattery    bool
+	MinBatteryCharge int
+
+	// Whether scheduled runs defer updates on a metered network connection
+	SkipOnMetered bool
+
+	// Browser installs updated one after the other by each run, instead
+	// of Path
+	Installs []Install
+
+	// Name of the install of Installs this configuration was made for by
+	// ForInstall, empty otherwise
+	InstallName string
+
 	// Executable directory
 	ExeDir string
 
 	// Config file path
 	ConfigFile string
+
+	// Whether Load replaced an empty or damaged INI file with the defaults
+	Regenerated bool
+
+	// Copy of the damaged INI file kept by Load, empty if nothing was kept
+	DamagedBackup string
+
+	// Settings Load ignored or clamped, as messages to show the user
+	Warnings []string
+
+	// Settings enforced by the policy file, as named there
+	Policies []string
+
+	// Lowercased keys of Policies, see Enforced
+	enforced map[string]bool
 }
 
-// Load reads the configuration from the INI file or creates defaults
+// Load reads the configuration from the INI file or creates defaults.
+// Settings of the policy file override both.
 func Load(exeDir string) (*Config, error) {
-	cfg := &Config{
-		Path:            "",
-		WorkDir:         os.TempDir(),
-		UpdateSelf:      true,
-		IgnoreCrlErrors: false,
-		Branch:          DefaultBranch,
-		ExeDir:          exeDir,
-		ConfigFile:      filepath.Join(exeDir, ConfigFileName),
-	}
+	cfg := defaults(exeDir)
 
 	// Check if config file exists
-	if _, err := os.Stat(cfg.ConfigFile); os.IsNotExist(err) {
+	data, err := os.ReadFile(cfg.ConfigFile)
+	switch {
+	case os.IsNotExist(err):
 		// Create default config file
 		if err := cfg.Save(); err != nil {
 			return nil, fmt.Errorf("failed to create config file: %w", err)
 		}
-		return cfg, nil
+	case err == nil && blankConfig(data):
+		if err := cfg.regenerate(data); err != nil {
+			return nil, err
+		}
+	default:
+		if err := cfg.read(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Read existing config
-	file, err := os.Open(cfg.ConfigFile)
+	if err := applyPolicies(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// read parses the existing INI file into the configuration
+func (c *Config) read() error {
+	file, err := os.Open(c.ConfigFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open config file: %w", err)
+		return fmt.Errorf("failed to open config file: %w", err)
 	}
 	defer file.Close()
 
+	invalid, err := parse(c, file)
+	if err != nil {
+		return err
+	}
+	for _, entry := range invalid {
+		key, _, _ := strings.Cut(entry, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if r, ok := settingRanges[key]; ok {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("ignoring invalid setting %s, expected %s", entry, r))
+		} else if choices := settingChoices(key); choices != nil {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("ignoring invalid setting %s, expected one of %s", entry, strings.Join(choices, ", ")))
+		} else {
+			c.Warnings = append(c.Warnings, fmt.Sprintf("ignoring invalid or unknown setting %s", entry))
+		}
+	}
+	return nil
+}
+
+// blankConfig reports whether INI data holds no section at all, as left
+// by an interrupted write: an empty file, NUL bytes or a cut-off first
+// line
+func blankConfig(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.Trim(line, "\x00"))
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			return false
+		}
+	}
+	return true
+}
+
+// regenerate replaces a blank INI file with the defaults. Anything else
+// in the file is kept next to it for inspection.
+func (c *Config) regenerate(data []byte) error {
+	if strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", "")) != "" {
+		backup := c.ConfigFile + ".damaged"
+		if err := os.WriteFile(backup, data, 0644); err != nil {
+			return fmt.Errorf("failed to back up damaged config file: %w", err)
+		}
+		c.DamagedBackup = backup
+	}
+
+	if err := c.Save(); err != nil {
+		return fmt.Errorf("failed to regenerate config file: %w", err)
+	}
+	c.Regenerated = true
+	return nil
+}
+
+// defaults returns the default configuration for an updater in exeDir
+func defaults(exeDir string) *Config {
+	return &Config{
+		Path:                  "",
+		WorkDir:               os.TempDir(),
+		RedirectWorkDir:       true,
+		UpdateSelf:            true,
+		IgnoreCrlErrors:       false,
+		Branch:                DefaultBranch,
+		StableExcludePatterns: DefaultStableExcludePatterns,
+		DownloadConnections:   1,
+		VerifyConcurrency:     DefaultVerifyConcurrency,
+		Headers:               map[string]string{},
+		AssetWeights:          DefaultAssetWeights,
+		MaxReleasePages:       DefaultMaxReleasePages,
+		CacheMaxSize:          DefaultCacheMaxSize,
+		CacheMaxAge:           DefaultCacheMaxAge,
+		PostInstallWait:       DefaultPostInstallWait,
+		PostInstallRetries:    DefaultPostInstallRetries,
+		CheckInterval:         DefaultCheckInterval,
+		MinTLSVersion:         DefaultMinTLSVersion,
+		CertExpiryWarnDays:    DefaultCertExpiryWarnDays,
+		MinBatteryCharge:      DefaultMinBatteryCharge,
+		AutoSavePath:          true,
+		ConnectCheckURL:       ConnectCheckURL,
+		MsiInstallDirProperty: DefaultMsiInstallDirProperty,
+		OverwritePolicy:       OverwriteAll,
+		WebhookEvents:         DefaultWebhookEvents,
+		ArchiveRootStrip:      DefaultArchiveRootStrip,
+		BrowserExe:            BrowserExe,
+		ExeDir:                exeDir,
+		ConfigFile:            filepath.Join(exeDir, ConfigFileName),
+	}
+}
+
+// cleanPath normalizes a path read from the INI file, so that forward
+// slashes, repeated separators and trailing separators do not break
+// comparisons with other paths. An empty value stays empty.
+func cleanPath(value string) string {
+	if value == "" {
+		return ""
+	}
+	return filepath.Clean(filepath.FromSlash(value))
+}
+
+// cleanArchiveRoot normalizes an ArchiveRoot to a slash-separated relative
+// path. Absolute paths, paths leaving the archive and invalid globs are
+// rejected.
+func cleanArchiveRoot(value string) (string, bool) {
+	slashed := strings.ReplaceAll(value, "\\", "/")
+	root := strings.TrimSuffix(path.Clean(slashed), "/")
+	if value == "" || root == "." {
+		return "", true
+	}
+	if filepath.IsAbs(value) || strings.HasPrefix(slashed, "/") || root == ".." || strings.HasPrefix(root, "../") {
+		return "", false
+	}
+	if _, err := path.Match(root, ""); err != nil {
+		return "", false
+	}
+	return root, true
+}
+
+// intRange is the valid range of a numeric setting, without an upper limit
+// if max is 0
+type intRange struct {
+	min, max int
+}
+
+func (r intRange) String() string {
+	if r.max == 0 {
+		return fmt.Sprintf("a number of at least %d", r.min)
+	}
+	return fmt.Sprintf("a number from %d to %d", r.min, r.max)
+}
+
+// settingRanges are the valid ranges of the numeric [Settings] keys, by
+// lowercased key. Values below the minimum are invalid, values above the
+// maximum are clamped to it.
+var settingRanges = map[string]intRange{
+	"cachemaxsize":        {0, 0},
+	"cachemaxage":         {0, 0},
+	"downloadconnections": {1, 16},
+	"verifyconcurrency":   {1, 64},
+	"assetretrydelay":     {0, 3600},
+	"backupcount":         {0, 50},
+	"postinstallwait":     {0, 600},
+	"postinstallretries":  {0, 100},
+	"waitforbrowserclose": {0, 86400},
+	"maxrunduration":      {0, 604800},
+	"checkinterval":       {1, 10080},
+	"certexpirywarndays":  {0, 365},
+	"maxreleasepages":     {1, 100},
+	"minbatterycharge":    {0, 100},
+	"archiverootstrip":    {-1, 16},
+}
+
+// intSetting parses the numeric setting name within its range, see
+// settingRanges. A value above the maximum is clamped with a warning. It
+// reports false for values that are not numbers or below the minimum.
+func (c *Config) intSetting(name, value string) (int, bool) {
+	name = strings.TrimSpace(name)
+	n, err := strconv.Atoi(value)
+	r := settingRanges[strings.ToLower(name)]
+	if err != nil || n < r.min {
+		return 0, false
+	}
+	if r.max > 0 && n > r.max {
+		c.Warnings = append(c.Warnings, fmt.Sprintf("%s=%d is above the maximum of %d, using %d", name, n, r.max, r.max))
+		n = r.max
+	}
+	return n, true
+}
+
+// parse reads INI settings from r into cfg. Settings that are unknown or
+// have invalid values are skipped and returned as "Key=value" entries.
+// Numbers clamped to their range are recorded in cfg.Warnings.
+func parse(cfg *Config, r io.Reader) ([]string, error) {
+	var invalid []string
+
 	section := ""
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 
@@ -99,24 +675,342 @@ func Load(exeDir string) (*Config, error) {
 			switch key {
 			case "path":
 				if value != "0" && value != "" {
-					cfg.Path = value
+					cfg.Path = cleanPath(value)
 				}
 			case "workdir":
 				if value != "" {
 					if value == "." {
-						cfg.WorkDir = exeDir
+						cfg.WorkDir = cfg.ExeDir
 					} else {
-						cfg.WorkDir = value
+						cfg.WorkDir = cleanPath(value)
 					}
 				}
+			case "redirectworkdir":
+				cfg.RedirectWorkDir = value == "1" || strings.ToLower(value) == "true"
+			case "cachedir":
+				if value == "." {
+					cfg.CacheDir = cfg.ExeDir
+				} else {
+					cfg.CacheDir = cleanPath(value)
+				}
+			case "installerlog":
+				if value == "." {
+					cfg.InstallerLog = cfg.ExeDir
+				} else {
+					cfg.InstallerLog = cleanPath(value)
+				}
+			case "cachemaxsize":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.CacheMaxSize = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "cachemaxage":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.CacheMaxAge = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "stagingdir":
+				if value == "." {
+					cfg.StagingDir = cfg.ExeDir
+				} else {
+					cfg.StagingDir = cleanPath(value)
+				}
 			case "updateself":
 				cfg.UpdateSelf = value == "1" || strings.ToLower(value) == "true"
 			case "ignorecrlerrors":
 				cfg.IgnoreCrlErrors = value == "1" || strings.ToLower(value) == "true"
 			case "branch":
+				if branch := strings.ToLower(value); slices.Contains(Branches, branch) {
+					cfg.Branch = branch
+				} else if value != "" {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "downloadconnections":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.DownloadConnections = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "verifyconcurrency":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.VerifyConcurrency = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "headersforapi":
+				cfg.HeadersForAPI = value == "1" || strings.ToLower(value) == "true"
+			case "autosavepath":
+				cfg.AutoSavePath = value == "1" || strings.ToLower(value) == "true"
+			case "connectcheckurl":
+				if value != "" {
+					cfg.ConnectCheckURL = value
+				}
+			case "assetretrydelay":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.AssetRetryDelay = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "backupcount":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.BackupCount = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "postinstallwait":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.PostInstallWait = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "postinstallretries":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.PostInstallRetries = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "waitforbrowserclose":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.WaitForBrowserClose = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "verifybylaunch":
+				cfg.VerifyByLaunch = value == "1" || strings.ToLower(value) == "true"
+			case "postinstallsentinels":
+				var sentinels []string
+				for _, p := range strings.Split(value, ",") {
+					if p = strings.TrimSpace(p); p == "" {
+						continue
+					}
+					p = path.Clean(filepath.ToSlash(p))
+					if p == ".." || strings.HasPrefix(p, "../") || path.IsAbs(p) || strings.Contains(p, ":") {
+						invalid = append(invalid, parts[0]+"="+value)
+						sentinels = cfg.PostInstallSentinels
+						break
+					}
+					sentinels = append(sentinels, p)
+				}
+				cfg.PostInstallSentinels = sentinels
+			case "maxrunduration":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.MaxRunDuration = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "checkinterval":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.CheckInterval = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "offlinetolerant":
+				cfg.OfflineTolerant = value == "1" || strings.ToLower(value) == "true"
+			case "allowhtmlfallback":
+				cfg.AllowHTMLFallback = value == "1" || strings.ToLower(value) == "true"
+			case "autoelevate":
+				cfg.AutoElevate = value == "1" || strings.ToLower(value) == "true"
+			case "keeptemponerror":
+				cfg.KeepTempOnError = value == "1" || strings.ToLower(value) == "true"
+			case "logphases":
+				cfg.LogPhases = value == "1" || strings.ToLower(value) == "true"
+			case "scheduledtask":
+				cfg.ScheduledTask = value == "1" || strings.ToLower(value) == "true"
+			case "msiinstalldirproperty":
+				cfg.MsiInstallDirProperty = value
+			case "useragent":
+				cfg.UserAgent = value
+			case "webhookurl":
+				if u, err := url.Parse(value); value == "" || err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+					cfg.WebhookURL = value
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "webhookevents":
+				events := DefaultWebhookEvents
 				if value != "" {
-					cfg.Branch = value
+					events = nil
+					for _, event := range strings.Split(value, ",") {
+						event = strings.ToLower(strings.TrimSpace(event))
+						if !slices.Contains(settingChoices("webhookevents"), event) {
+							invalid = append(invalid, parts[0]+"="+value)
+							events = cfg.WebhookEvents
+							break
+						}
+						events = append(events, event)
+					}
+				}
+				cfg.WebhookEvents = events
+			case "releaserepo":
+				if value != "" && !releaseRepoRe.MatchString(value) {
+					return nil, fmt.Errorf("invalid ReleaseRepo %q, expected owner/repo", value)
+				}
+				cfg.ReleaseRepo = value
+			case "versionscheme":
+				if scheme := strings.ToLower(value); scheme == "" || slices.Contains(VersionSchemes(), scheme) {
+					cfg.VersionScheme = scheme
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "skipversion":
+				cfg.SkipVersion = value
+			case "overwritepolicy":
+				switch policy := strings.ToLower(value); policy {
+				case OverwriteAll, OverwriteSkipExisting, OverwriteSkipListed:
+					cfg.OverwritePolicy = policy
+				default:
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "preservefiles":
+				cfg.PreserveFiles = nil
+				for _, pattern := range strings.Split(value, ",") {
+					if pattern = strings.TrimSpace(pattern); pattern != "" {
+						cfg.PreserveFiles = append(cfg.PreserveFiles, pattern)
+					}
+				}
+			case "archiveroot":
+				if root, ok := cleanArchiveRoot(value); ok {
+					cfg.ArchiveRoot = root
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "archiverootstrip":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.ArchiveRootStrip = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "stableexcludepatterns":
+				patterns := []string{}
+				for _, pattern := range strings.Split(value, ";") {
+					if pattern = strings.TrimSpace(pattern); pattern == "" {
+						continue
+					}
+					if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+						invalid = append(invalid, parts[0]+"="+value)
+						patterns = cfg.StableExcludePatterns
+						break
+					}
+					patterns = append(patterns, pattern)
+				}
+				cfg.StableExcludePatterns = patterns
+			case "extrasearchpaths":
+				cfg.ExtraSearchPaths = nil
+				for _, p := range strings.Split(value, ";") {
+					if p = strings.TrimSpace(p); p != "" {
+						cfg.ExtraSearchPaths = append(cfg.ExtraSearchPaths, cleanPath(p))
+					}
+				}
+			case "browserexe":
+				if validExeName(value) {
+					cfg.BrowserExe = value
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "browserexecandidates":
+				var names []string
+				for _, name := range strings.Split(value, ";") {
+					if name = strings.TrimSpace(name); name == "" {
+						continue
+					}
+					if !validExeName(name) {
+						invalid = append(invalid, parts[0]+"="+value)
+						names = cfg.BrowserExeCandidates
+						break
+					}
+					names = append(names, name)
+				}
+				cfg.BrowserExeCandidates = names
+			case "maintenancewindow":
+				if windows, err := ParseMaintenanceWindows(value); err == nil {
+					cfg.MaintenanceWindows = windows
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
 				}
+			case "skiponbattery":
+				cfg.SkipOnBattery = value == "1" || strings.ToLower(value) == "true"
+			case "skiponmetered":
+				cfg.SkipOnMetered = value == "1" || strings.ToLower(value) == "true"
+			case "minbatterycharge":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.MinBatteryCharge = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "pinnedcacert":
+				cfg.PinnedCACert = cleanPath(value)
+			case "disablehttp2":
+				cfg.DisableHTTP2 = value == "1" || strings.ToLower(value) == "true"
+			case "mintlsversion":
+				if _, ok := tlsVersions[value]; !ok {
+					return nil, fmt.Errorf("invalid MinTLSVersion %q, expected 1.2 or 1.3", value)
+				}
+				cfg.MinTLSVersion = value
+			case "checksumoptional":
+				cfg.ChecksumOptional = value == "1" || strings.ToLower(value) == "true"
+			case "verifyattestation":
+				cfg.VerifyAttestation = value == "1" || strings.ToLower(value) == "true"
+			case "attestationtrustedroot":
+				cfg.AttestationTrustedRoot = cleanPath(value)
+			case "rekorpublickey":
+				cfg.RekorPublicKey = cleanPath(value)
+			case "verifycosign":
+				cfg.VerifyCosign = value == "1" || strings.ToLower(value) == "true"
+			case "cosignpublickey":
+				cfg.CosignPublicKey = cleanPath(value)
+			case "cosignidentity":
+				if _, err := regexp.Compile(value); err != nil {
+					invalid = append(invalid, parts[0]+"="+value)
+				} else {
+					cfg.CosignIdentity = value
+				}
+			case "checkcertexpiry":
+				cfg.CheckCertExpiry = value == "1" || strings.ToLower(value) == "true"
+			case "certexpirywarndays":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.CertExpiryWarnDays = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			case "requirevalidcert":
+				cfg.RequireValidCert = value == "1" || strings.ToLower(value) == "true"
+			case "maxreleasepages":
+				if n, ok := cfg.intSetting(parts[0], value); ok {
+					cfg.MaxReleasePages = n
+				} else {
+					invalid = append(invalid, parts[0]+"="+value)
+				}
+			default:
+				invalid = append(invalid, parts[0]+"="+value)
+			}
+		}
+
+		// Header names keep their original case
+		if section == "headers" {
+			cfg.Headers[strings.TrimSpace(parts[0])] = value
+		}
+
+		if section == "installs" {
+			name := strings.TrimSpace(parts[0])
+			in, err := parseInstall(name, value)
+			if err == nil && slices.ContainsFunc(cfg.Installs, func(other Install) bool { return strings.EqualFold(other.Name, name) }) {
+				err = fmt.Errorf("duplicate install name %q", name)
+			}
+			if err != nil {
+				invalid = append(invalid, parts[0]+"="+value)
+			} else {
+				cfg.Installs = append(cfg.Installs, in)
+			}
+		}
+
+		if section == "assetpreference" {
+			weight := cfg.AssetWeights.field(key)
+			if n, err := strconv.Atoi(value); err == nil && weight != nil {
+				*weight = n
+			} else {
+				invalid = append(invalid, parts[0]+"="+value)
 			}
 		}
 	}
@@ -125,11 +1019,38 @@ func Load(exeDir string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	return cfg, nil
+	if cfg.PinnedCACert != "" && cfg.IgnoreCrlErrors {
+		return nil, fmt.Errorf("PinnedCACert and IgnoreCrlErrors cannot be used together")
+	}
+
+	if cfg.VerifyAttestation && cfg.AttestationTrustedRoot == "" {
+		return nil, fmt.Errorf("VerifyAttestation requires AttestationTrustedRoot")
+	}
+	if cfg.VerifyAttestation && cfg.RekorPublicKey == "" {
+		return nil, fmt.Errorf("VerifyAttestation requires RekorPublicKey")
+	}
+
+	if cfg.VerifyCosign && cfg.CosignPublicKey == "" && cfg.CosignIdentity == "" {
+		return nil, fmt.Errorf("VerifyCosign requires CosignPublicKey or CosignIdentity")
+	}
+	if cfg.VerifyCosign && cfg.CosignPublicKey == "" && cfg.AttestationTrustedRoot == "" {
+		return nil, fmt.Errorf("VerifyCosign with CosignIdentity requires AttestationTrustedRoot")
+	}
+	if cfg.VerifyCosign && cfg.CosignPublicKey == "" && cfg.RekorPublicKey == "" {
+		return nil, fmt.Errorf("VerifyCosign with CosignIdentity requires RekorPublicKey")
+	}
+
+	return invalid, nil
 }
 
 // Save writes the configuration to the INI file
 func (c *Config) Save() error {
+	return atomicWriteFile(c.ConfigFile, []byte(c.render()), 0644)
+}
+
+// render formats the [Settings], [Headers] and [AssetPreference] sections
+// of the configuration
+func (c *Config) render() string {
 	var content strings.Builder
 
 	content.WriteString("[Settings]\n")
@@ -147,6 +1068,26 @@ func (c *Config) Save() error {
 	}
 	content.WriteString(fmt.Sprintf("WorkDir=%s\n", workDir))
 
+	if c.RedirectWorkDir {
+		content.WriteString("RedirectWorkDir=1\n")
+	} else {
+		content.WriteString("RedirectWorkDir=0\n")
+	}
+
+	cacheDir := c.CacheDir
+	if cacheDir != "" && cacheDir == c.ExeDir {
+		cacheDir = "."
+	}
+	content.WriteString(fmt.Sprintf("CacheDir=%s\n", cacheDir))
+	content.WriteString(fmt.Sprintf("CacheMaxSize=%d\n", c.CacheMaxSize))
+	content.WriteString(fmt.Sprintf("CacheMaxAge=%d\n", c.CacheMaxAge))
+
+	stagingDir := c.StagingDir
+	if stagingDir != "" && stagingDir == c.ExeDir {
+		stagingDir = "."
+	}
+	content.WriteString(fmt.Sprintf("StagingDir=%s\n", stagingDir))
+
 	if c.UpdateSelf {
 		content.WriteString("UpdateSelf=1\n")
 	} else {
@@ -160,38 +1101,390 @@ func (c *Config) Save() error {
 	}
 
 	content.WriteString(fmt.Sprintf("Branch=%s\n", c.Branch))
+	content.WriteString(fmt.Sprintf("StableExcludePatterns=%s\n", strings.Join(c.StableExcludePatterns, ";")))
+	content.WriteString(fmt.Sprintf("DownloadConnections=%d\n", c.DownloadConnections))
+	content.WriteString(fmt.Sprintf("VerifyConcurrency=%d\n", c.VerifyConcurrency))
+
+	if c.HeadersForAPI {
+		content.WriteString("HeadersForAPI=1\n")
+	} else {
+		content.WriteString("HeadersForAPI=0\n")
+	}
+
+	content.WriteString(fmt.Sprintf("MaxReleasePages=%d\n", c.MaxReleasePages))
+	content.WriteString(fmt.Sprintf("PinnedCACert=%s\n", c.PinnedCACert))
+
+	if c.DisableHTTP2 {
+		content.WriteString("DisableHTTP2=1\n")
+	} else {
+		content.WriteString("DisableHTTP2=0\n")
+	}
+	content.WriteString(fmt.Sprintf("MinTLSVersion=%s\n", c.MinTLSVersion))
+
+	if c.ChecksumOptional {
+		content.WriteString("ChecksumOptional=1\n")
+	} else {
+		content.WriteString("ChecksumOptional=0\n")
+	}
+
+	if c.VerifyAttestation {
+		content.WriteString("VerifyAttestation=1\n")
+	} else {
+		content.WriteString("VerifyAttestation=0\n")
+	}
+	content.WriteString(fmt.Sprintf("AttestationTrustedRoot=%s\n", c.AttestationTrustedRoot))
+	content.WriteString(fmt.Sprintf("RekorPublicKey=%s\n", c.RekorPublicKey))
+
+	if c.VerifyCosign {
+		content.WriteString("VerifyCosign=1\n")
+	} else {
+		content.WriteString("VerifyCosign=0\n")
+	}
+	content.WriteString(fmt.Sprintf("CosignPublicKey=%s\n", c.CosignPublicKey))
+	content.WriteString(fmt.Sprintf("CosignIdentity=%s\n", c.CosignIdentity))
 
-	return os.WriteFile(c.ConfigFile, []byte(content.String()), 0644)
+	if c.CheckCertExpiry {
+		content.WriteString("CheckCertExpiry=1\n")
+	} else {
+		content.WriteString("CheckCertExpiry=0\n")
+	}
+	content.WriteString(fmt.Sprintf("CertExpiryWarnDays=%d\n", c.CertExpiryWarnDays))
+	if c.RequireValidCert {
+		content.WriteString("RequireValidCert=1\n")
+	} else {
+		content.WriteString("RequireValidCert=0\n")
+	}
+
+	if c.AutoSavePath {
+		content.WriteString("AutoSavePath=1\n")
+	} else {
+		content.WriteString("AutoSavePath=0\n")
+	}
+
+	content.WriteString(fmt.Sprintf("ConnectCheckURL=%s\n", c.ConnectCheckURL))
+	content.WriteString(fmt.Sprintf("AssetRetryDelay=%d\n", c.AssetRetryDelay))
+	content.WriteString(fmt.Sprintf("PostInstallWait=%d\n", c.PostInstallWait))
+	content.WriteString(fmt.Sprintf("PostInstallRetries=%d\n", c.PostInstallRetries))
+	content.WriteString(fmt.Sprintf("WaitForBrowserClose=%d\n", c.WaitForBrowserClose))
+
+	if c.VerifyByLaunch {
+		content.WriteString("VerifyByLaunch=1\n")
+	} else {
+		content.WriteString("VerifyByLaunch=0\n")
+	}
+	content.WriteString(fmt.Sprintf("PostInstallSentinels=%s\n", strings.Join(c.PostInstallSentinels, ",")))
+	content.WriteString(fmt.Sprintf("MaxRunDuration=%d\n", c.MaxRunDuration))
+	content.WriteString(fmt.Sprintf("CheckInterval=%d\n", c.CheckInterval))
+	content.WriteString(fmt.Sprintf("MsiInstallDirProperty=%s\n", c.MsiInstallDirProperty))
+
+	installerLog := c.InstallerLog
+	if installerLog != "" && installerLog == c.ExeDir {
+		installerLog = "."
+	}
+	content.WriteString(fmt.Sprintf("InstallerLog=%s\n", installerLog))
+	content.WriteString(fmt.Sprintf("UserAgent=%s\n", c.UserAgent))
+	content.WriteString(fmt.Sprintf("WebhookURL=%s\n", c.WebhookURL))
+	content.WriteString(fmt.Sprintf("WebhookEvents=%s\n", strings.Join(c.WebhookEvents, ",")))
+	content.WriteString(fmt.Sprintf("ReleaseRepo=%s\n", c.ReleaseRepo))
+	content.WriteString(fmt.Sprintf("VersionScheme=%s\n", c.VersionScheme))
+	content.WriteString(fmt.Sprintf("SkipVersion=%s\n", c.SkipVersion))
+	content.WriteString(fmt.Sprintf("OverwritePolicy=%s\n", c.OverwritePolicy))
+	content.WriteString(fmt.Sprintf("PreserveFiles=%s\n", strings.Join(c.PreserveFiles, ",")))
+	content.WriteString(fmt.Sprintf("ArchiveRoot=%s\n", c.ArchiveRoot))
+	content.WriteString(fmt.Sprintf("ArchiveRootStrip=%d\n", c.ArchiveRootStrip))
+	content.WriteString(fmt.Sprintf("ExtraSearchPaths=%s\n", strings.Join(c.ExtraSearchPaths, ";")))
+	content.WriteString(fmt.Sprintf("BrowserExe=%s\n", c.BrowserExe))
+	content.WriteString(fmt.Sprintf("BrowserExeCandidates=%s\n", strings.Join(c.BrowserExeCandidates, ";")))
+
+	windows := make([]string, len(c.MaintenanceWindows))
+	for i, w := range c.MaintenanceWindows {
+		windows[i] = w.String()
+	}
+	content.WriteString(fmt.Sprintf("MaintenanceWindow=%s\n", strings.Join(windows, ", ")))
+	if c.SkipOnBattery {
+		content.WriteString("SkipOnBattery=1\n")
+	} else {
+		content.WriteString("SkipOnBattery=0\n")
+	}
+	content.WriteString(fmt.Sprintf("MinBatteryCharge=%d\n", c.MinBatteryCharge))
+	if c.SkipOnMetered {
+		content.WriteString("SkipOnMetered=1\n")
+	} else {
+		content.WriteString("SkipOnMetered=0\n")
+	}
+
+	if c.OfflineTolerant {
+		content.WriteString("OfflineTolerant=1\n")
+	} else {
+		content.WriteString("OfflineTolerant=0\n")
+	}
+
+	if c.AllowHTMLFallback {
+		content.WriteString("AllowHTMLFallback=1\n")
+	} else {
+		content.WriteString("AllowHTMLFallback=0\n")
+	}
+
+	if c.AutoElevate {
+		content.WriteString("AutoElevate=1\n")
+	} else {
+		content.WriteString("AutoElevate=0\n")
+	}
+
+	if c.KeepTempOnError {
+		content.WriteString("KeepTempOnError=1\n")
+	} else {
+		content.WriteString("KeepTempOnError=0\n")
+	}
+	content.WriteString(fmt.Sprintf("BackupCount=%d\n", c.BackupCount))
+
+	if c.LogPhases {
+		content.WriteString("LogPhases=1\n")
+	} else {
+		content.WriteString("LogPhases=0\n")
+	}
+
+	if c.ScheduledTask {
+		content.WriteString("ScheduledTask=1\n")
+	} else {
+		content.WriteString("ScheduledTask=0\n")
+	}
+
+	if len(c.Headers) > 0 {
+		names := make([]string, 0, len(c.Headers))
+		for name := range c.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		content.WriteString("\n[Headers]\n")
+		for _, name := range names {
+			content.WriteString(fmt.Sprintf("%s=%s\n", name, c.Headers[name]))
+		}
+	}
+
+	if len(c.Installs) > 0 {
+		content.WriteString("\n[Installs]\n")
+		for _, in := range c.Installs {
+			content.WriteString(fmt.Sprintf("%s=%s\n", in.Name, in))
+		}
+	}
+
+	if c.AssetWeights != DefaultAssetWeights {
+		content.WriteString("\n[AssetPreference]\n")
+		for _, name := range assetWeightNames {
+			content.WriteString(fmt.Sprintf("%s=%d\n", name, *c.AssetWeights.field(strings.ToLower(name))))
+		}
+	}
+
+	return content.String()
+}
+
+// machineStateKeys are [Settings] keys that record the state of this
+// computer rather than a preference, so they are not moved between
+// installs by Export and Import
+var machineStateKeys = []string{"ScheduledTask"}
+
+// machineState reports whether a [Settings] key is one of machineStateKeys
+func machineState(key string) bool {
+	for _, k := range machineStateKeys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Export writes the [Settings], [Headers], [Installs] and
+// [AssetPreference] sections to a standalone file. The [Log] and [Cache]
+// sections and machineStateKeys are not exported.
+func (c *Config) Export(path string) error {
+	var content strings.Builder
+	section := ""
+	for _, line := range strings.SplitAfter(c.render(), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = trimmed[1 : len(trimmed)-1]
+		}
+		key, _, _ := strings.Cut(trimmed, "=")
+		if strings.EqualFold(section, "Settings") && machineState(strings.TrimSpace(key)) {
+			continue
+		}
+		content.WriteString(line)
+	}
+	return atomicWriteFile(path, []byte(content.String()), 0644)
+}
+
+// Import merges the [Settings], [Headers], [Installs] and [AssetPreference]
+// of an exported file into the INI file in a single write, and updates the
+// configuration to the result. Nothing is written if a setting is unknown
+// or invalid. Settings enforced by policy and machineStateKeys are left
+// alone. It returns the replaced values, as "Key: old -> new".
+func (c *Config) Import(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockConfigFile(c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock config file: %w", err)
+	}
+	defer unlock()
+
+	// Validate the imported settings on top of the current ones
+	merged := defaults(c.ExeDir)
+	content := ""
+	if current, err := os.ReadFile(c.ConfigFile); err == nil {
+		content = string(current)
+		if _, err := parse(merged, strings.NewReader(content)); err != nil {
+			return nil, err
+		}
+	}
+	invalid, err := parse(merged, strings.NewReader(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	if len(invalid) > 0 {
+		return nil, fmt.Errorf("invalid settings: %s", strings.Join(invalid, ", "))
+	}
+
+	if err := applyPolicies(merged); err != nil {
+		return nil, err
+	}
+
+	var replaced []string
+	for _, e := range iniEntries(string(data)) {
+		if !strings.EqualFold(e.section, "Settings") && !strings.EqualFold(e.section, "Headers") &&
+			!strings.EqualFold(e.section, "AssetPreference") && !strings.EqualFold(e.section, "Installs") {
+			continue
+		}
+		if strings.EqualFold(e.section, "Settings") && (c.Enforced(e.key) || machineState(e.key)) {
+			continue
+		}
+		if old := iniValue(content, e.section, e.key); old != "" && old != e.value {
+			replaced = append(replaced, fmt.Sprintf("%s: %s -> %s", e.key, old, e.value))
+		}
+		content = setINIValue(content, e.section, e.key, e.value)
+	}
+	if err := atomicWriteFile(c.ConfigFile, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+
+	// Reload the written file like Load, keeping what Load and ForInstall
+	// set up beyond it
+	reloaded := defaults(filepath.Dir(c.ConfigFile))
+	reloaded.ConfigFile = c.ConfigFile
+	if _, err := parse(reloaded, strings.NewReader(content)); err != nil {
+		return nil, err
+	}
+	if err := applyPolicies(reloaded); err != nil {
+		return nil, err
+	}
+	reloaded.Regenerated, reloaded.DamagedBackup, reloaded.Warnings = c.Regenerated, c.DamagedBackup, c.Warnings
+	if c.InstallName != "" {
+		for _, in := range reloaded.Installs {
+			if in.Name == c.InstallName {
+				reloaded = reloaded.ForInstall(in)
+				break
+			}
+		}
+	}
+	*c = *reloaded
+	return replaced, nil
+}
+
+// iniEntry is a single key of an INI file
+type iniEntry struct {
+	section, key, value string
+}
+
+// iniEntries lists the keys of an INI file in order
+func iniEntries(data string) []iniEntry {
+	var entries []iniEntry
+	section := ""
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSuffix(strings.TrimPrefix(line, "["), "]")
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		entries = append(entries, iniEntry{section, strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+	}
+	return entries
 }
 
 // LogEntry writes a log entry to the INI file
 func (c *Config) LogEntry(key, value string) error {
+	return c.setEntry("Log", c.stateKey(key), value)
+}
+
+// CacheEntry writes a single key of the [Cache] section to the INI file
+func (c *Config) CacheEntry(key, value string) error {
+	return c.setEntry("Cache", c.stateKey(key), value)
+}
+
+// SetSetting writes a single key of the [Settings] section to the INI file,
+// leaving the rest of the file untouched. Settings enforced by the policy
+// file cannot be changed.
+func (c *Config) SetSetting(key, value string) error {
+	if c.Enforced(key) {
+		return fmt.Errorf("%s is enforced by policy", key)
+	}
+	return c.setEntry("Settings", key, value)
+}
+
+// setEntry updates or appends a key in the given section of the INI file.
+// The file is read and written under the config file lock.
+func (c *Config) setEntry(section, key, value string) error {
+	// Overlapping runs write the file too, none of their changes may be
+	// lost between the read and the write
+	unlock, err := lockConfigFile(c.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to lock config file: %w", err)
+	}
+	defer unlock()
+
 	// Read existing content
 	existingContent := ""
 	if data, err := os.ReadFile(c.ConfigFile); err == nil {
 		existingContent = string(data)
 	}
+	return atomicWriteFile(c.ConfigFile, []byte(setINIValue(existingContent, section, key, value)), 0644)
+}
 
-	// Check if [Log] section exists
-	if !strings.Contains(existingContent, "[Log]") {
-		existingContent += "\n[Log]\n"
+// setINIValue returns INI data with key set to value in the given section,
+// adding the key and the section if missing
+func setINIValue(existingContent, section, key, value string) string {
+	header := "[" + section + "]"
+
+	// Check if the section exists
+	if !strings.Contains(strings.ToLower(existingContent), strings.ToLower(header)) {
+		existingContent += "\n" + header + "\n"
 	}
 
 	// Find and update or append the key
 	lines := strings.Split(existingContent, "\n")
 	found := false
-	inLogSection := false
+	inSection := false
 	for i, line := range lines {
 		trimmedLine := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmedLine, "[Log]") {
-			inLogSection = true
+		if strings.EqualFold(trimmedLine, header) {
+			inSection = true
 			continue
 		}
 		if strings.HasPrefix(trimmedLine, "[") && strings.HasSuffix(trimmedLine, "]") {
-			inLogSection = false
+			inSection = false
 			continue
 		}
-		if inLogSection && strings.HasPrefix(strings.ToLower(trimmedLine), strings.ToLower(key)+"=") {
+		if inSection && strings.HasPrefix(strings.ToLower(trimmedLine), strings.ToLower(key)+"=") {
 			lines[i] = fmt.Sprintf("%s=%s", key, value)
 			found = true
 			break
@@ -199,57 +1492,239 @@ func (c *Config) LogEntry(key, value string) error {
 	}
 
 	if !found {
-		// Append to Log section
+		// Append to the section
 		newLines := []string{}
-		addedToLog := false
-		inLogSection = false
+		added := false
+		inSection = false
 		for _, line := range lines {
 			trimmedLine := strings.TrimSpace(line)
-			if strings.HasPrefix(trimmedLine, "[Log]") {
-				inLogSection = true
+			if strings.EqualFold(trimmedLine, header) {
+				inSection = true
 				newLines = append(newLines, line)
 				continue
 			}
-			if inLogSection && !addedToLog && (trimmedLine == "" || (strings.HasPrefix(trimmedLine, "[") && strings.HasSuffix(trimmedLine, "]"))) {
+			if inSection && !added && (trimmedLine == "" || (strings.HasPrefix(trimmedLine, "[") && strings.HasSuffix(trimmedLine, "]"))) {
 				newLines = append(newLines, fmt.Sprintf("%s=%s", key, value))
-				addedToLog = true
+				added = true
 			}
-			if strings.HasPrefix(trimmedLine, "[") && strings.HasSuffix(trimmedLine, "]") && trimmedLine != "[Log]" {
-				inLogSection = false
+			if strings.HasPrefix(trimmedLine, "[") && strings.HasSuffix(trimmedLine, "]") && !strings.EqualFold(trimmedLine, header) {
+				inSection = false
 			}
 			newLines = append(newLines, line)
 		}
-		if !addedToLog {
+		if !added {
 			newLines = append(newLines, fmt.Sprintf("%s=%s", key, value))
 		}
 		lines = newLines
 	}
+	return strings.Join(lines, "\n")
+}
 
-	return os.WriteFile(c.ConfigFile, []byte(strings.Join(lines, "\n")), 0644)
+// LogValue returns the value of a key in the [Log] section, or an empty
+// string if it is not present
+func (c *Config) LogValue(key string) string {
+	return c.entry("Log", c.stateKey(key))
 }
 
-// GetBrowserPath returns the path to the browser executable
-// It will try to auto-detect if not configured
-func (c *Config) GetBrowserPath() string {
-	if c.Path != "" {
-		return c.Path
+// CacheValue returns the value of a key in the [Cache] section, or an
+// empty string if it is not present
+func (c *Config) CacheValue(key string) string {
+	return c.entry("Cache", c.stateKey(key))
+}
+
+// entry returns the value of a key in the given section of the INI file,
+// or an empty string if it is not present
+func (c *Config) entry(section, key string) string {
+	data, err := os.ReadFile(c.ConfigFile)
+	if err != nil {
+		return ""
 	}
+	return iniValue(string(data), section, key)
+}
 
-	// Try to find in common locations
+// iniValue returns the value of a key in the given section of INI data,
+// or an empty string if it is not present
+func iniValue(data, section, key string) string {
+	header := "[" + section + "]"
+	inSection := false
+	for _, line := range strings.Split(data, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmedLine, "[") && strings.HasSuffix(trimmedLine, "]") {
+			inSection = strings.EqualFold(trimmedLine, header)
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		parts := strings.SplitN(trimmedLine, "=", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), key) {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+
+	return ""
+}
+
+// RememberBrowserPath writes an auto-detected browser path back to
+// [Settings] so later runs use the same install without searching again.
+// It does nothing if AutoSavePath is off, Path is already set or enforced
+// by policy, or no browser was found.
+func (c *Config) RememberBrowserPath() error {
+	if !c.AutoSavePath || c.Path != "" || c.Enforced("Path") {
+		return nil
+	}
+
+	path := c.GetBrowserPath()
+	if path == "" {
+		return nil
+	}
+
+	if err := c.SetSetting("Path", path); err != nil {
+		return err
+	}
+	c.Path = path
+	return nil
+}
+
+// SetSkipVersion persists the version to skip. An empty version clears it.
+func (c *Config) SetSkipVersion(version string) error {
+	if err := c.SetSetting("SkipVersion", version); err != nil {
+		return err
+	}
+	c.SkipVersion = version
+	return nil
+}
+
+// ReleaseAPI returns the releases API URL of ReleaseRepo, or of the
+// official releases if it is not set
+func (c *Config) ReleaseAPI() string {
+	if c.ReleaseRepo == "" {
+		return ReleaseAPIURL
+	}
+	return GitHubAPIURL + "/repos/" + c.ReleaseRepo + "/releases"
+}
+
+// ExcludedFromStable reports whether the release tag is kept off the stable
+// branch by StableExcludePatterns. Tags are never excluded on other
+// branches.
+func (c *Config) ExcludedFromStable(tag string) bool {
+	if !strings.EqualFold(c.Branch, "stable") {
+		return false
+	}
+	for _, pattern := range c.StableExcludePatterns {
+		if re, err := regexp.Compile("(?i)" + pattern); err == nil && re.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// TLSMinVersion returns the TLS version MinTLSVersion stands for, TLS 1.2
+// if it is not set
+func (c *Config) TLSMinVersion() uint16 {
+	if version, ok := tlsVersions[c.MinTLSVersion]; ok {
+		return version
+	}
+	return tlsVersions[DefaultMinTLSVersion]
+}
+
+// DefaultInstallDir returns the standard install directory in Program Files
+func DefaultInstallDir() string {
 	programFiles := os.Getenv("ProgramFiles")
 	if programFiles == "" {
 		programFiles = "C:\\Program Files"
 	}
+	return filepath.Join(programFiles, BrowserName)
+}
+
+// runningBrowserPath returns the executable path of a running browser
+// process with one of the given executable names. It is a variable so
+// tests can stub it out.
+var runningBrowserPath = findRunningBrowser
+
+// validExeName reports whether name is a plain file name, without a
+// directory
+func validExeName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\:`)
+}
+
+// BrowserExeName returns the configured file name of the browser
+// executable
+func (c *Config) BrowserExeName() string {
+	if c.BrowserExe == "" {
+		return BrowserExe
+	}
+	return c.BrowserExe
+}
+
+// browserExePath returns the executable of a configured Path. Path may name
+// the install folder instead of the executable: the first of
+// BrowserExeNames found in it is used then, or BrowserExe if there is none.
+// Other paths are returned as they are.
+func (c *Config) browserExePath(path string) string {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return path
+	}
+	for _, name := range c.BrowserExeNames() {
+		exe := filepath.Join(path, name)
+		if info, err := os.Stat(exe); err == nil && !info.IsDir() {
+			return exe
+		}
+	}
+	return filepath.Join(path, c.BrowserExeName())
+}
+
+// BrowserExeNames returns the executable names GetBrowserPath looks for:
+// BrowserExe, then BrowserExeCandidates
+func (c *Config) BrowserExeNames() []string {
+	names := []string{c.BrowserExeName()}
+	for _, name := range c.BrowserExeCandidates {
+		if !slices.ContainsFunc(names, func(n string) bool { return strings.EqualFold(n, name) }) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
 
-	possiblePaths := []string{
-		filepath.Join(c.ExeDir, BrowserName, BrowserExe),
-		filepath.Join(programFiles, BrowserName, BrowserExe),
+// GetBrowserPath returns the path to the browser executable, that of
+// the install folder if Path names one.
+// It will try to auto-detect if not configured, falling back to the path of
+// a running browser process. Each location is searched for every name of
+// BrowserExeNames in turn.
+func (c *Config) GetBrowserPath() string {
+	if c.Path != "" {
+		return c.browserExePath(c.Path)
 	}
+	names := c.BrowserExeNames()
 
-	// Check for portable version in exe directory
-	portablePath := filepath.Join(c.ExeDir, BrowserName+"-Portable.exe")
-	if _, err := os.Stat(portablePath); err == nil {
-		possiblePaths = append([]string{filepath.Join(c.ExeDir, BrowserName, BrowserExe)}, possiblePaths...)
+	// Try to find in common locations
+	possibleDirs := []string{
+		filepath.Join(c.ExeDir, BrowserName),
+		DefaultInstallDir(),
+	}
+	if dir := os.Getenv("ProgramFiles(x86)"); dir != "" {
+		possibleDirs = append(possibleDirs, filepath.Join(dir, BrowserName))
+	}
+	if dir := os.Getenv("LOCALAPPDATA"); dir != "" {
+		possibleDirs = append(possibleDirs, filepath.Join(dir, "Programs", BrowserName))
+	}
+
+	var possiblePaths []string
+	for _, dir := range possibleDirs {
+		for _, name := range names {
+			possiblePaths = append(possiblePaths, filepath.Join(dir, name))
+		}
+	}
+	for _, p := range c.ExtraSearchPaths {
+		p = expandEnv(p)
+		if slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(filepath.Base(p), name) }) {
+			possiblePaths = append(possiblePaths, p)
+			continue
+		}
+		for _, name := range names {
+			possiblePaths = append(possiblePaths, filepath.Join(p, name))
+		}
 	}
 
 	for _, p := range possiblePaths {
@@ -258,12 +1733,31 @@ func (c *Config) GetBrowserPath() string {
 		}
 	}
 
-	return ""
+	return runningBrowserPath(names)
+}
+
+// envVarRe matches Windows style %VARIABLE% references
+var envVarRe = regexp.MustCompile(`%([^%]+)%`)
+
+// expandEnv replaces %VARIABLE% references in s with their values. Unset
+// variables are left as they are.
+func expandEnv(s string) string {
+	return envVarRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if value, ok := os.LookupEnv(strings.Trim(ref, "%")); ok {
+			return value
+		}
+		return ref
+	})
 }
 
 // IsPortable returns true if running in portable mode
 func (c *Config) IsPortable() bool {
-	portablePath := filepath.Join(c.ExeDir, BrowserName+"-Portable.exe")
-	_, err := os.Stat(portablePath)
+	_, err := os.Stat(c.PortableMarkerPath())
 	return err == nil
 }
+
+// PortableMarkerPath returns the path of the portable launcher whose
+// presence marks a portable install
+func (c *Config) PortableMarkerPath() string {
+	return filepath.Join(c.ExeDir, BrowserName+"-Portable.exe")
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"crypto/tls"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -40,6 +44,62 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestLoadBlankConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		backup  bool
+	}{
+		{"empty", "", false},
+		{"whitespace", "\n  \r\n", false},
+		{"NUL bytes", "\x00\x00\x00\x00", false},
+		{"cut-off header", "[Sett", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, ConfigFileName)
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+
+			cfg, err := Load(tmpDir)
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			if !cfg.Regenerated || cfg.Branch != DefaultBranch {
+				t.Errorf("Expected the defaults to be regenerated, got Regenerated=%v Branch=%s", cfg.Regenerated, cfg.Branch)
+			}
+
+			// The defaults are written and load normally next time
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("Failed to read config file: %v", err)
+			}
+			if string(data) != defaults(tmpDir).render() {
+				t.Errorf("Expected the default settings to be written, got %q", data)
+			}
+			reloaded, err := Load(tmpDir)
+			if err != nil {
+				t.Fatalf("Failed to reload config: %v", err)
+			}
+			if reloaded.Regenerated {
+				t.Error("Expected the regenerated file to be used as is")
+			}
+
+			backup, err := os.ReadFile(configPath + ".damaged")
+			if tt.backup {
+				if err != nil || string(backup) != tt.content || cfg.DamagedBackup != configPath+".damaged" {
+					t.Errorf("Expected the damaged file to be kept, got %q (%v)", backup, err)
+				}
+			} else if !os.IsNotExist(err) || cfg.DamagedBackup != "" {
+				t.Error("Expected no backup of a file without content")
+			}
+		})
+	}
+}
+
 func TestLoadExistingConfig(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "noraneko-test")
 	if err != nil {
@@ -174,3 +234,1182 @@ func TestLogEntry(t *testing.T) {
 		t.Error("Config missing LastResult entry")
 	}
 }
+
+func TestLogValue(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if got := cfg.LogValue("LastRun"); got != "" {
+		t.Errorf("Expected empty LastRun before logging, got '%s'", got)
+	}
+
+	if err := cfg.LogEntry("LastRun", "2024-01-01 12:00:00"); err != nil {
+		t.Fatalf("Failed to write log entry: %v", err)
+	}
+
+	if got := cfg.LogValue("LastRun"); got != "2024-01-01 12:00:00" {
+		t.Errorf("Expected LastRun '2024-01-01 12:00:00', got '%s'", got)
+	}
+
+	// Settings keys must not leak into the log lookup
+	if got := cfg.LogValue("Branch"); got != "" {
+		t.Errorf("Expected no Branch in [Log], got '%s'", got)
+	}
+}
+
+func TestLogEntryConcurrent(t *testing.T) {
+	tmpDir := t.TempDir()
+	if _, err := Load(tmpDir); err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Each writer loads its own config, like overlapping runs do
+	const writers = 8
+	const entries = 10
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg, err := Load(tmpDir)
+			if err != nil {
+				t.Errorf("Failed to load config: %v", err)
+				return
+			}
+			for i := 0; i < entries; i++ {
+				key := fmt.Sprintf("Writer%dEntry%d", w, i)
+				if err := cfg.LogEntry(key, "done"); err != nil {
+					t.Errorf("Failed to write %s: %v", key, err)
+				}
+				if err := cfg.CacheEntry(key, "done"); err != nil {
+					t.Errorf("Failed to write %s: %v", key, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	for w := 0; w < writers; w++ {
+		for i := 0; i < entries; i++ {
+			key := fmt.Sprintf("Writer%dEntry%d", w, i)
+			if cfg.LogValue(key) != "done" || cfg.CacheValue(key) != "done" {
+				t.Errorf("Entry %s was lost", key)
+			}
+		}
+	}
+	if cfg.Branch != DefaultBranch {
+		t.Errorf("Expected the settings to survive, got Branch=%s", cfg.Branch)
+	}
+}
+
+func TestLoadHeaders(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configContent := `[Settings]
+Branch=nightly
+HeadersForAPI=1
+
+[Headers]
+Referer=https://mirror.example.com/
+X-Auth-Token=abc=def
+`
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if !cfg.HeadersForAPI {
+		t.Error("Expected HeadersForAPI to be true")
+	}
+	if got := cfg.Headers["Referer"]; got != "https://mirror.example.com/" {
+		t.Errorf("Expected Referer header, got '%s'", got)
+	}
+	if got := cfg.Headers["X-Auth-Token"]; got != "abc=def" {
+		t.Errorf("Expected X-Auth-Token 'abc=def', got '%s'", got)
+	}
+
+	// Headers survive a save/load round trip
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	reloaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if len(reloaded.Headers) != 2 || reloaded.Headers["X-Auth-Token"] != "abc=def" {
+		t.Errorf("Headers not preserved across save: %v", reloaded.Headers)
+	}
+}
+
+func TestLoadAssetPreference(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configContent := `[Settings]
+Branch=nightly
+
+[AssetPreference]
+Flavor=0
+msi=100
+Exe=-5
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	want := DefaultAssetWeights
+	want.Flavor, want.Msi, want.Exe = 0, 100, -5
+	if cfg.AssetWeights != want {
+		t.Errorf("Expected weights %+v, got %+v", want, cfg.AssetWeights)
+	}
+
+	// Weights survive a save/load round trip
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	reloaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if reloaded.AssetWeights != want {
+		t.Errorf("Weights not preserved across save: %+v", reloaded.AssetWeights)
+	}
+
+	// Unknown keys and non-integer weights are reported
+	invalid, err := parse(defaults(tmpDir), strings.NewReader("[AssetPreference]\nArchitecture=5\nZip=high\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(invalid) != 2 {
+		t.Errorf("Expected 2 invalid weights, got %v", invalid)
+	}
+
+	// Default weights are not written
+	if strings.Contains(defaults(tmpDir).render(), "[AssetPreference]") {
+		t.Error("Expected no [AssetPreference] section for the default weights")
+	}
+}
+
+func TestLoadPinnedCACertExclusive(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configContent := `[Settings]
+IgnoreCrlErrors=1
+PinnedCACert=C:\certs\ca.pem
+`
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	if _, err := Load(tmpDir); err == nil {
+		t.Error("Expected an error when PinnedCACert and IgnoreCrlErrors are both set")
+	}
+}
+
+func TestLoadVerifyAttestation(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		wantErr  bool
+	}{
+		{"root and log key", "VerifyAttestation=1\nAttestationTrustedRoot=C:\\certs\\fulcio.pem\nRekorPublicKey=C:\\certs\\rekor.pub\n", false},
+		{"without root", "VerifyAttestation=1\nRekorPublicKey=C:\\certs\\rekor.pub\n", true},
+		{"without log key", "VerifyAttestation=1\nAttestationTrustedRoot=C:\\certs\\fulcio.pem\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte("[Settings]\n"+tt.settings), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+			_, err := Load(tmpDir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadVerifyCosign(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		wantErr  bool
+	}{
+		{"public key", "VerifyCosign=1\nCosignPublicKey=C:\\keys\\cosign.pub\n", false},
+		{"keyless", "VerifyCosign=1\nCosignIdentity=https://github.com/f3liz-dev/.*\nAttestationTrustedRoot=C:\\certs\\fulcio.pem\nRekorPublicKey=C:\\certs\\rekor.pub\n", false},
+		{"keyless without log key", "VerifyCosign=1\nCosignIdentity=https://github.com/f3liz-dev/.*\nAttestationTrustedRoot=C:\\certs\\fulcio.pem\n", true},
+		{"no key or identity", "VerifyCosign=1\n", true},
+		{"keyless without root", "VerifyCosign=1\nCosignIdentity=https://github.com/f3liz-dev/.*\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte("[Settings]\n"+tt.settings), 0644); err != nil {
+				t.Fatalf("Failed to write config file: %v", err)
+			}
+			_, err := Load(tmpDir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// An identity that is not a regular expression is reported
+	invalid, err := parse(defaults(t.TempDir()), strings.NewReader("[Settings]\nCosignIdentity=https://(\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(invalid) != 1 {
+		t.Errorf("Expected the identity to be invalid, got %v", invalid)
+	}
+}
+
+func TestLoadMinTLSVersion(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+		want  uint16
+	}{
+		{"1.2", true, tls.VersionTLS12},
+		{"1.3", true, tls.VersionTLS13},
+		{"1.1", false, 0},
+		{"TLS1.3", false, 0},
+		{"", false, 0},
+	}
+
+	for _, tt := range tests {
+		tmpDir := t.TempDir()
+		content := "[Settings]\nMinTLSVersion=" + tt.value + "\n"
+		if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		cfg, err := Load(tmpDir)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("Expected MinTLSVersion %q to be rejected", tt.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MinTLSVersion %q: unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got := cfg.TLSMinVersion(); got != tt.want {
+			t.Errorf("MinTLSVersion %q: expected %x, got %x", tt.value, tt.want, got)
+		}
+	}
+
+	// Without the setting TLS 1.2 is the minimum
+	cfg, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.MinTLSVersion != DefaultMinTLSVersion || cfg.TLSMinVersion() != tls.VersionTLS12 {
+		t.Errorf("Expected TLS 1.2 by default, got %q", cfg.MinTLSVersion)
+	}
+}
+
+func TestLoadStableExcludePatterns(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{`-rc\d*\b;-candidate\b`, []string{`-rc\d*\b`, `-candidate\b`}},
+		{` -preview ; ; -test `, []string{"-preview", "-test"}},
+		{"", []string{}},
+		{`-rc;([a-z`, DefaultStableExcludePatterns},
+	}
+
+	for _, tt := range tests {
+		tmpDir := t.TempDir()
+		content := "[Settings]\nStableExcludePatterns=" + tt.value + "\n"
+		if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		cfg, err := Load(tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if strings.Join(cfg.StableExcludePatterns, ";") != strings.Join(tt.want, ";") {
+			t.Errorf("StableExcludePatterns=%s: expected %q, got %q", tt.value, tt.want, cfg.StableExcludePatterns)
+		}
+	}
+
+	cfg := &Config{Branch: "stable", StableExcludePatterns: DefaultStableExcludePatterns}
+	for tag, excluded := range map[string]bool{
+		"v2.0.0-rc1": true, "v2.0.0-RC.2": true, "v2.0.0-candidate": true,
+		"v2.0.0": false, "v2.0.0-rcfix": false, "v2.0.0-beta": false,
+	} {
+		if got := cfg.ExcludedFromStable(tag); got != excluded {
+			t.Errorf("Tag %s: expected excluded=%v, got %v", tag, excluded, got)
+		}
+	}
+	cfg.Branch = "nightly"
+	if cfg.ExcludedFromStable("v2.0.0-rc1") {
+		t.Error("Expected no exclusion outside the stable branch")
+	}
+}
+
+func TestRememberBrowserPath(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.LogEntry("LastResult", "No new version found"); err != nil {
+		t.Fatalf("Failed to write log entry: %v", err)
+	}
+
+	// Nothing is persisted while no browser can be found
+	if err := cfg.RememberBrowserPath(); err != nil {
+		t.Fatalf("RememberBrowserPath failed: %v", err)
+	}
+	if cfg.Path != "" {
+		t.Errorf("Expected no path to be saved, got '%s'", cfg.Path)
+	}
+
+	browserPath := filepath.Join(tmpDir, BrowserName, BrowserExe)
+	if err := os.MkdirAll(filepath.Dir(browserPath), 0755); err != nil {
+		t.Fatalf("Failed to create browser dir: %v", err)
+	}
+	if err := os.WriteFile(browserPath, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create browser exe: %v", err)
+	}
+
+	if err := cfg.RememberBrowserPath(); err != nil {
+		t.Fatalf("RememberBrowserPath failed: %v", err)
+	}
+
+	reloaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if reloaded.Path != browserPath {
+		t.Errorf("Expected saved path '%s', got '%s'", browserPath, reloaded.Path)
+	}
+	if got := reloaded.LogValue("LastResult"); got != "No new version found" {
+		t.Errorf("Expected log to survive, got '%s'", got)
+	}
+}
+
+func TestRememberBrowserPathDisabled(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte("[Settings]\nPath=0\nAutoSavePath=0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	browserPath := filepath.Join(tmpDir, BrowserName, BrowserExe)
+	os.MkdirAll(filepath.Dir(browserPath), 0755)
+	os.WriteFile(browserPath, []byte("exe"), 0644)
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if err := cfg.RememberBrowserPath(); err != nil {
+		t.Fatalf("RememberBrowserPath failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(data), "Path=0") {
+		t.Errorf("Expected Path to stay unset with AutoSavePath=0:\n%s", data)
+	}
+}
+
+func TestLoadOverwritePolicy(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configContent := `[Settings]
+OverwritePolicy=Skip-Listed
+PreserveFiles=distribution/policies.json, defaults/pref/* ,
+`
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.OverwritePolicy != OverwriteSkipListed {
+		t.Errorf("Expected policy %s, got %s", OverwriteSkipListed, cfg.OverwritePolicy)
+	}
+	expected := []string{"distribution/policies.json", "defaults/pref/*"}
+	if strings.Join(cfg.PreserveFiles, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected preserved files %v, got %v", expected, cfg.PreserveFiles)
+	}
+
+	// Unknown policies keep the default
+	if err := os.WriteFile(configPath, []byte("[Settings]\nOverwritePolicy=never\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err = Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.OverwritePolicy != OverwriteAll {
+		t.Errorf("Expected default policy %s, got %s", OverwriteAll, cfg.OverwritePolicy)
+	}
+}
+
+func TestLoadArchiveRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+
+	configContent := `[Settings]
+ArchiveRoot=noraneko-*\core\
+ArchiveRootStrip=2
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ArchiveRoot != "noraneko-*/core" || cfg.ArchiveRootStrip != 2 {
+		t.Errorf("Expected root noraneko-*/core and strip 2, got %q and %d", cfg.ArchiveRoot, cfg.ArchiveRootStrip)
+	}
+
+	// Roots outside the archive, bad globs and strips out of range are rejected
+	for _, value := range []string{"../noraneko", "noraneko/../..", "/opt/noraneko", `\noraneko`, "noraneko[", "ArchiveRootStrip=-2"} {
+		line := "ArchiveRoot=" + value
+		if strings.HasPrefix(value, "ArchiveRootStrip") {
+			line = value
+		}
+		invalid, err := parse(defaults(tmpDir), strings.NewReader("[Settings]\n"+line+"\n"))
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", line, err)
+		}
+		if len(invalid) != 1 {
+			t.Errorf("Expected %s to be rejected, got %v", line, invalid)
+		}
+	}
+
+	// The default copies from the first folder
+	if cfg := defaults(tmpDir); cfg.ArchiveRoot != "" || cfg.ArchiveRootStrip != DefaultArchiveRootStrip {
+		t.Errorf("Expected no root and strip %d by default, got %q and %d", DefaultArchiveRootStrip, cfg.ArchiveRoot, cfg.ArchiveRootStrip)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	srcDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	configContent := `[Settings]
+Branch=beta
+DownloadConnections=4
+OverwritePolicy=skip-listed
+PreserveFiles=distribution/policies.json,defaults/pref/*
+UserAgent=Corp/1.0
+
+[Headers]
+X-Auth-Token=secret
+
+[Log]
+LastRun=2024-01-01 12:00:00
+`
+	if err := os.WriteFile(filepath.Join(srcDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	src, err := Load(srcDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	exported := filepath.Join(srcDir, "export.ini")
+	if err := src.Export(exported); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if strings.Contains(string(data), "LastRun") {
+		t.Error("Export should not contain the log")
+	}
+
+	dstDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dstDir)
+
+	dst, err := Load(dstDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	dst.LogEntry("LastResult", "No new version found")
+
+	replaced, err := dst.Import(exported)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if strings.Join(replaced, "|") != strings.Join([]string{
+		"Branch: nightly -> beta",
+		"DownloadConnections: 1 -> 4",
+		"OverwritePolicy: all -> skip-listed",
+	}, "|") {
+		t.Errorf("Unexpected replaced settings: %v", replaced)
+	}
+
+	reloaded, err := Load(dstDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	for _, cfg := range []*Config{dst, reloaded} {
+		if cfg.Branch != "beta" || cfg.DownloadConnections != 4 || cfg.UserAgent != "Corp/1.0" {
+			t.Errorf("Settings not imported: %+v", cfg)
+		}
+		if cfg.OverwritePolicy != OverwriteSkipListed || strings.Join(cfg.PreserveFiles, ",") != "distribution/policies.json,defaults/pref/*" {
+			t.Errorf("Overwrite settings not imported: %s %v", cfg.OverwritePolicy, cfg.PreserveFiles)
+		}
+		if cfg.Headers["X-Auth-Token"] != "secret" {
+			t.Errorf("Headers not imported: %v", cfg.Headers)
+		}
+	}
+	if reloaded.LogValue("LastResult") != "No new version found" {
+		t.Error("Import should keep the existing log")
+	}
+}
+
+func TestImportKeepsMachineStateAndScope(t *testing.T) {
+	srcDir := t.TempDir()
+	src, err := Load(srcDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	src.ScheduledTask = true
+	exported := filepath.Join(srcDir, "export.ini")
+	if err := src.Export(exported); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if data, _ := os.ReadFile(exported); strings.Contains(string(data), "ScheduledTask") {
+		t.Error("Export should not contain ScheduledTask")
+	}
+
+	dstDir := t.TempDir()
+	configContent := "[Settings]\nBranch=stable\n\n[Installs]\nNightly=/data/noraneko/noraneko.exe;nightly\n"
+	if err := os.WriteFile(filepath.Join(dstDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	global, err := Load(dstDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg := global.ForInstall(global.Installs[0])
+	cfg.Warnings = []string{"ignoring invalid setting X=1"}
+
+	// A hand-written file may still carry ScheduledTask
+	importPath := filepath.Join(dstDir, "import.ini")
+	if err := os.WriteFile(importPath, []byte("[Settings]\nScheduledTask=1\nDownloadConnections=4\n"), 0644); err != nil {
+		t.Fatalf("Failed to write import file: %v", err)
+	}
+	if _, err := cfg.Import(importPath); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if cfg.DownloadConnections != 4 {
+		t.Errorf("Expected DownloadConnections to be imported, got %d", cfg.DownloadConnections)
+	}
+	if cfg.ScheduledTask {
+		t.Error("Expected ScheduledTask not to be imported")
+	}
+	if cfg.InstallName != "Nightly" || cfg.Branch != "nightly" || cfg.Path != "/data/noraneko/noraneko.exe" {
+		t.Errorf("Expected the install scope to be kept, got %s %s %s", cfg.InstallName, cfg.Branch, cfg.Path)
+	}
+	if len(cfg.Warnings) != 1 {
+		t.Errorf("Expected the load warnings to be kept, got %v", cfg.Warnings)
+	}
+	if reloaded, _ := Load(dstDir); reloaded.ScheduledTask {
+		t.Error("Expected ScheduledTask not to be written")
+	}
+}
+
+func TestImportRejectsInvalidSettings(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	before, err := os.ReadFile(cfg.ConfigFile)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+
+	tests := map[string]string{
+		"invalid value":  "[Settings]\nBranch=beta\nDownloadConnections=many\n",
+		"unknown key":    "[Settings]\nBranhc=beta\n",
+		"conflicting CA": "[Settings]\nPinnedCACert=ca.pem\nIgnoreCrlErrors=1\n",
+	}
+	for name, content := range tests {
+		path := filepath.Join(tmpDir, "import.ini")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write import file: %v", err)
+		}
+		if _, err := cfg.Import(path); err == nil {
+			t.Errorf("%s: expected import to fail", name)
+		}
+	}
+
+	after, err := os.ReadFile(cfg.ConfigFile)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	if string(after) != string(before) {
+		t.Error("A rejected import must not change the config file")
+	}
+}
+
+func TestLoadReleaseRepo(t *testing.T) {
+	tests := []struct {
+		repo  string
+		valid bool
+		api   string
+	}{
+		{"", true, ReleaseAPIURL},
+		{"someone/noraneko-fork", true, "https://api.github.com/repos/someone/noraneko-fork/releases"},
+		{"my-org/runtime.test_2", true, "https://api.github.com/repos/my-org/runtime.test_2/releases"},
+		{"noraneko-runtime", false, ""},
+		{"a/b/c", false, ""},
+		{"-owner/repo", false, ""},
+		{"owner/repo?x=1", false, ""},
+		{"https://github.com/owner/repo", false, ""},
+	}
+
+	for _, tt := range tests {
+		tmpDir, err := os.MkdirTemp("", "noraneko-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		defer os.RemoveAll(tmpDir)
+
+		content := "[Settings]\nReleaseRepo=" + tt.repo + "\n"
+		if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+
+		cfg, err := Load(tmpDir)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("Expected ReleaseRepo %q to be rejected", tt.repo)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ReleaseRepo %q: unexpected error: %v", tt.repo, err)
+			continue
+		}
+		if got := cfg.ReleaseAPI(); got != tt.api {
+			t.Errorf("ReleaseRepo %q: expected %s, got %s", tt.repo, tt.api, got)
+		}
+	}
+}
+
+func TestLoadCacheDir(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configContent := `[Settings]
+CacheDir=.
+CacheMaxSize=512
+CacheMaxAge=-1
+`
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if cfg.CacheDir != tmpDir {
+		t.Errorf("Expected CacheDir %s, got %s", tmpDir, cfg.CacheDir)
+	}
+	if cfg.CacheMaxSize != 512 {
+		t.Errorf("Expected CacheMaxSize 512, got %d", cfg.CacheMaxSize)
+	}
+	if cfg.CacheMaxAge != DefaultCacheMaxAge {
+		t.Errorf("Expected invalid CacheMaxAge to keep the default, got %d", cfg.CacheMaxAge)
+	}
+
+	// The cache directory is written back relative to the updater
+	if !strings.Contains(cfg.render(), "CacheDir=.\n") {
+		t.Errorf("Expected CacheDir=. in rendered config:\n%s", cfg.render())
+	}
+}
+
+func TestLoadSettingRanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	configContent := `[Settings]
+DownloadConnections=64
+VerifyConcurrency=0
+MaxReleasePages=abc
+PostInstallWait=-5
+CheckInterval=20000
+MaxRunDuration=7200
+CertExpiryWarnDays=1000
+BackupCount = 3
+NoSuchSetting=1
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Values above the maximum are clamped, values below the minimum and
+	// non-numbers keep the default
+	for name, got := range map[string][2]int{
+		"DownloadConnections": {cfg.DownloadConnections, 16},
+		"VerifyConcurrency":   {cfg.VerifyConcurrency, DefaultVerifyConcurrency},
+		"MaxReleasePages":     {cfg.MaxReleasePages, DefaultMaxReleasePages},
+		"PostInstallWait":     {cfg.PostInstallWait, DefaultPostInstallWait},
+		"CheckInterval":       {cfg.CheckInterval, 10080},
+		"MaxRunDuration":      {cfg.MaxRunDuration, 7200},
+		"CertExpiryWarnDays":  {cfg.CertExpiryWarnDays, 365},
+		"BackupCount":         {cfg.BackupCount, 3},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("Expected %s %d, got %d", name, got[1], got[0])
+		}
+	}
+
+	expected := []string{
+		"DownloadConnections=64 is above the maximum of 16, using 16",
+		"CheckInterval=20000 is above the maximum of 10080, using 10080",
+		"CertExpiryWarnDays=1000 is above the maximum of 365, using 365",
+		"ignoring invalid setting VerifyConcurrency=0, expected a number from 1 to 64",
+		"ignoring invalid setting MaxReleasePages=abc, expected a number from 1 to 100",
+		"ignoring invalid setting PostInstallWait=-5, expected a number from 0 to 600",
+		"ignoring invalid or unknown setting NoSuchSetting=1",
+	}
+	if !reflect.DeepEqual(cfg.Warnings, expected) {
+		t.Errorf("Expected warnings:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(cfg.Warnings, "\n"))
+	}
+}
+
+func TestGetBrowserPathRunningProcessFallback(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	t.Setenv("ProgramFiles", filepath.Join(tmpDir, "ProgramFiles"))
+
+	running := filepath.Join(tmpDir, "Running", BrowserExe)
+	orig := runningBrowserPath
+	runningBrowserPath = func([]string) string { return running }
+	defer func() { runningBrowserPath = orig }()
+
+	cfg := defaults(tmpDir)
+
+	// Nothing installed: the running process is used
+	if got := cfg.GetBrowserPath(); got != running {
+		t.Errorf("Expected the running browser %s, got %s", running, got)
+	}
+
+	// A browser in a common location wins over the running process
+	local := filepath.Join(tmpDir, BrowserName, BrowserExe)
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		t.Fatalf("Failed to create browser dir: %v", err)
+	}
+	if err := os.WriteFile(local, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create browser exe: %v", err)
+	}
+	if got := cfg.GetBrowserPath(); got != local {
+		t.Errorf("Expected the local browser %s, got %s", local, got)
+	}
+
+	// The configured path wins over both
+	cfg.Path = filepath.Join(tmpDir, "Configured", BrowserExe)
+	if got := cfg.GetBrowserPath(); got != cfg.Path {
+		t.Errorf("Expected the configured path %s, got %s", cfg.Path, got)
+	}
+}
+
+func TestLoadNormalizesPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Forward slashes as written by other tools, with repeated and
+	// trailing separators mixed in
+	slashDir := filepath.ToSlash(tmpDir)
+	configContent := "[Settings]\n" +
+		"Path=" + slashDir + "//Noraneko/./" + BrowserExe + "\n" +
+		"WorkDir=" + slashDir + "/\n" +
+		"CacheDir=" + slashDir + "/cache//\n" +
+		"InstallerLog=" + slashDir + "/logs/../logs\n" +
+		"PinnedCACert=" + slashDir + "/certs//ca.pem\n"
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	expected := map[string][2]string{
+		"Path":         {cfg.Path, filepath.Join(tmpDir, "Noraneko", BrowserExe)},
+		"WorkDir":      {cfg.WorkDir, tmpDir},
+		"CacheDir":     {cfg.CacheDir, filepath.Join(tmpDir, "cache")},
+		"InstallerLog": {cfg.InstallerLog, filepath.Join(tmpDir, "logs")},
+		"PinnedCACert": {cfg.PinnedCACert, filepath.Join(tmpDir, "certs", "ca.pem")},
+	}
+	for key, v := range expected {
+		if v[0] != v[1] {
+			t.Errorf("Expected %s %s, got %s", key, v[1], v[0])
+		}
+	}
+
+	// The normalized WorkDir is recognized as the executable directory and
+	// a saved config loads back unchanged
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config file: %v", err)
+	}
+	if !strings.Contains(string(data), "WorkDir=.\n") {
+		t.Errorf("Expected WorkDir to be saved as '.', got:\n%s", data)
+	}
+
+	reloaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if reloaded.Path != cfg.Path || reloaded.WorkDir != cfg.WorkDir || reloaded.CacheDir != cfg.CacheDir {
+		t.Errorf("Expected paths to round-trip, got %+v", reloaded)
+	}
+}
+
+func TestGetBrowserPathSearchLocations(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("ProgramFiles", filepath.Join(tmpDir, "ProgramFiles"))
+	t.Setenv("ProgramFiles(x86)", filepath.Join(tmpDir, "ProgramFilesX86"))
+	t.Setenv("LOCALAPPDATA", filepath.Join(tmpDir, "LocalAppData"))
+	t.Setenv("NORANEKO_APPS", filepath.Join(tmpDir, "Apps"))
+
+	orig := runningBrowserPath
+	runningBrowserPath = func([]string) string { return "" }
+	defer func() { runningBrowserPath = orig }()
+
+	install := func(dir string) string {
+		t.Helper()
+		p := filepath.Join(dir, BrowserExe)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create browser dir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte("exe"), 0644); err != nil {
+			t.Fatalf("Failed to create browser exe: %v", err)
+		}
+		return p
+	}
+
+	configContent := "[Settings]\nExtraSearchPaths=" +
+		filepath.Join(tmpDir, "Missing") + "; %NORANEKO_APPS%" + string(filepath.Separator) + "Noraneko ;" +
+		filepath.Join(tmpDir, "Scoop", "current", BrowserExe) + "\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.ExtraSearchPaths) != 3 {
+		t.Fatalf("Expected 3 extra search paths, got %v", cfg.ExtraSearchPaths)
+	}
+
+	if got := cfg.GetBrowserPath(); got != "" {
+		t.Fatalf("Expected no browser yet, got %s", got)
+	}
+
+	// An executable path entry is used as is
+	scoop := install(filepath.Join(tmpDir, "Scoop", "current"))
+	if got := cfg.GetBrowserPath(); got != scoop {
+		t.Errorf("Expected %s, got %s", scoop, got)
+	}
+
+	// Directory entries are searched in order, with variables expanded
+	apps := install(filepath.Join(tmpDir, "Apps", "Noraneko"))
+	if got := cfg.GetBrowserPath(); got != apps {
+		t.Errorf("Expected %s, got %s", apps, got)
+	}
+
+	// The default locations come before the extra ones
+	local := install(filepath.Join(tmpDir, "LocalAppData", "Programs", BrowserName))
+	if got := cfg.GetBrowserPath(); got != local {
+		t.Errorf("Expected %s, got %s", local, got)
+	}
+	x86 := install(filepath.Join(tmpDir, "ProgramFilesX86", BrowserName))
+	if got := cfg.GetBrowserPath(); got != x86 {
+		t.Errorf("Expected %s, got %s", x86, got)
+	}
+}
+
+func TestGetBrowserPathCustomExe(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("ProgramFiles", filepath.Join(tmpDir, "ProgramFiles"))
+	t.Setenv("ProgramFiles(x86)", "")
+	t.Setenv("LOCALAPPDATA", "")
+
+	var searched []string
+	orig := runningBrowserPath
+	runningBrowserPath = func(names []string) string {
+		searched = names
+		return ""
+	}
+	defer func() { runningBrowserPath = orig }()
+
+	configContent := "[Settings]\nBrowserExe=nora.exe\nBrowserExeCandidates=launcher.exe; NORA.exe ;bad\\name.exe\n" +
+		"ExtraSearchPaths=" + filepath.Join(tmpDir, "Apps", "launcher.exe") + "\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// An invalid candidate list is ignored, duplicates of BrowserExe too
+	if cfg.BrowserExe != "nora.exe" || len(cfg.BrowserExeCandidates) != 0 {
+		t.Errorf("Expected BrowserExe nora.exe without candidates, got %q, %v", cfg.BrowserExe, cfg.BrowserExeCandidates)
+	}
+	cfg.BrowserExeCandidates = []string{"launcher.exe", "NORA.exe"}
+	if names := cfg.BrowserExeNames(); !reflect.DeepEqual(names, []string{"nora.exe", "launcher.exe"}) {
+		t.Errorf("Expected nora.exe and launcher.exe, got %v", names)
+	}
+
+	install := func(path string) string {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create browser dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("exe"), 0644); err != nil {
+			t.Fatalf("Failed to create browser exe: %v", err)
+		}
+		return path
+	}
+
+	// The default name is not looked for, a running browser is asked for
+	// the configured names
+	install(filepath.Join(tmpDir, "ProgramFiles", BrowserName, BrowserExe))
+	if got := cfg.GetBrowserPath(); got != "" {
+		t.Errorf("Expected no browser, got %s", got)
+	}
+	if !reflect.DeepEqual(searched, []string{"nora.exe", "launcher.exe"}) {
+		t.Errorf("Expected running browsers named nora.exe or launcher.exe, got %v", searched)
+	}
+
+	// An extra search path naming a candidate is used as is
+	apps := install(filepath.Join(tmpDir, "Apps", "launcher.exe"))
+	if got := cfg.GetBrowserPath(); got != apps {
+		t.Errorf("Expected %s, got %s", apps, got)
+	}
+
+	// Candidates are found in the default locations, after BrowserExe
+	launcher := install(filepath.Join(tmpDir, "ProgramFiles", BrowserName, "launcher.exe"))
+	if got := cfg.GetBrowserPath(); got != launcher {
+		t.Errorf("Expected %s, got %s", launcher, got)
+	}
+	nora := install(filepath.Join(tmpDir, "ProgramFiles", BrowserName, "nora.exe"))
+	if got := cfg.GetBrowserPath(); got != nora {
+		t.Errorf("Expected %s, got %s", nora, got)
+	}
+
+	// Names with a directory are rejected
+	invalid, _ := parse(defaults(tmpDir), strings.NewReader("[Settings]\nBrowserExe=bin/nora.exe\n"))
+	if len(invalid) != 1 {
+		t.Errorf("Expected BrowserExe with a directory to be invalid, got %v", invalid)
+	}
+}
+
+func TestGetBrowserPathDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	installDir := filepath.Join(tmpDir, BrowserName)
+	if err := os.MkdirAll(installDir, 0755); err != nil {
+		t.Fatalf("Failed to create install dir: %v", err)
+	}
+	cfg := defaults(tmpDir)
+
+	// A folder without the executable still gets BrowserExe appended
+	cfg.Path = installDir
+	exe := filepath.Join(installDir, BrowserExe)
+	if got := cfg.GetBrowserPath(); got != exe {
+		t.Errorf("Expected %s for the install folder, got %s", exe, got)
+	}
+
+	// A candidate found in the folder is used
+	cfg.BrowserExeCandidates = []string{"launcher.exe"}
+	launcher := filepath.Join(installDir, "launcher.exe")
+	if err := os.WriteFile(launcher, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to write launcher: %v", err)
+	}
+	if got := cfg.GetBrowserPath(); got != launcher {
+		t.Errorf("Expected the launcher in the install folder, got %s", got)
+	}
+	if err := os.WriteFile(exe, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to write browser exe: %v", err)
+	}
+	if got := cfg.GetBrowserPath(); got != exe {
+		t.Errorf("Expected BrowserExe before the candidates, got %s", got)
+	}
+
+	// Paths of the executable, or of files that do not exist yet, are kept
+	for _, path := range []string{exe, launcher, filepath.Join(tmpDir, "Missing", BrowserExe)} {
+		cfg.Path = path
+		if got := cfg.GetBrowserPath(); got != path {
+			t.Errorf("Expected %s to be used as is, got %s", path, got)
+		}
+	}
+
+	// A portable install named by its folder keeps the portable layout
+	cfg.Path = ""
+	sub := cfg.ForInstall(Install{Name: "Portable", Path: installDir, Portable: true})
+	if sub.ExeDir != tmpDir {
+		t.Errorf("Expected ExeDir %s for a portable install folder, got %s", tmpDir, sub.ExeDir)
+	}
+}
+
+func TestLoadSettingChoices(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+
+	if err := os.WriteFile(configPath, []byte("[Settings]\nBranch=Stable\nVersionScheme=DATE\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Branch != "stable" || cfg.VersionScheme != "date" || len(cfg.Warnings) != 0 {
+		t.Errorf("Expected branch stable and scheme date, got %s, %s, %v", cfg.Branch, cfg.VersionScheme, cfg.Warnings)
+	}
+
+	// Typos keep the defaults and are reported
+	if err := os.WriteFile(configPath, []byte("[Settings]\nBranch=stabel\nVersionScheme=calver\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err = Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Branch != DefaultBranch || cfg.VersionScheme != "" {
+		t.Errorf("Expected the defaults, got %s, %s", cfg.Branch, cfg.VersionScheme)
+	}
+	expected := []string{
+		"ignoring invalid setting Branch=stabel, expected one of nightly, beta, stable",
+		"ignoring invalid setting VersionScheme=calver, expected one of auto, semver, date",
+	}
+	if !reflect.DeepEqual(cfg.Warnings, expected) {
+		t.Errorf("Expected warnings:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(cfg.Warnings, "\n"))
+	}
+
+	// Registered schemes are accepted
+	RegisterVersionScheme("CalVer")
+	cfg, err = Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.VersionScheme != "calver" {
+		t.Errorf("Expected the registered scheme, got %q", cfg.VersionScheme)
+	}
+
+	// Installs are checked too
+	if _, err := parseInstall("Main", "/opt/noraneko/noraneko.exe;nighty"); err == nil {
+		t.Error("Expected an unknown install branch to be rejected")
+	}
+}
+
+func TestLoadWebhookEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, ConfigFileName)
+
+	tests := []struct {
+		value    string
+		expected []string
+		warnings int
+	}{
+		{"", DefaultWebhookEvents, 0},
+		{"Failure, no-update", []string{WebhookFailure, WebhookNoUpdate}, 0},
+		{"update,always", DefaultWebhookEvents, 1},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(configPath, []byte("[Settings]\nWebhookEvents="+tt.value+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		cfg, err := Load(tmpDir)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if !reflect.DeepEqual(cfg.WebhookEvents, tt.expected) || len(cfg.Warnings) != tt.warnings {
+			t.Errorf("WebhookEvents=%s: expected %v with %d warnings, got %v, %v", tt.value, tt.expected, tt.warnings, cfg.WebhookEvents, cfg.Warnings)
+		}
+	}
+}
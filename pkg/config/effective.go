@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Sources a setting's effective value can come from
+const (
+	SourceDefault = "default"
+	SourceINI     = "INI"
+	SourcePolicy  = "policy"
+	SourceEnv     = "env"
+)
+
+// EffectiveSetting is a setting as the updater uses it and where its
+// value came from
+type EffectiveSetting struct {
+	// Key as written in the INI file, prefixed with the section for
+	// [Headers] and [AssetPreference], e.g. AssetPreference.Msi
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Effective lists every setting with its resolved value and source: the
+// policy file, the INI file, the environment or the built-in default. As
+// the first run writes every default to the INI file, values the file sets
+// to their default are reported as defaults. No command line flag changes
+// a setting.
+func (c *Config) Effective() []EffectiveSetting {
+	inFile := map[string]bool{}
+	if data, err := os.ReadFile(c.ConfigFile); err == nil {
+		for _, e := range iniEntries(string(data)) {
+			inFile[strings.ToLower(e.section+"."+e.key)] = true
+		}
+	}
+	defaultValues := map[string]string{}
+	for _, e := range withAssetWeights(defaults(c.ExeDir)) {
+		defaultValues[strings.ToLower(e.section+"."+e.key)] = e.value
+	}
+
+	entries := withAssetWeights(c)
+	settings := make([]EffectiveSetting, 0, len(entries))
+	for _, e := range entries {
+		s := EffectiveSetting{Key: e.key, Value: e.value, Source: SourceDefault}
+		isSetting := e.section == "Settings"
+		if !isSetting {
+			s.Key = e.section + "." + e.key
+		}
+
+		id := strings.ToLower(e.section + "." + e.key)
+		defaultValue, hasDefault := defaultValues[id]
+		switch {
+		case isSetting && c.Enforced(e.key):
+			s.Source = SourcePolicy
+		case inFile[id] && (!hasDefault || e.value != defaultValue):
+			s.Source = SourceINI
+		case isSetting && e.key == "WorkDir":
+			// The system temp folder, from %TEMP%
+			s.Value = c.WorkDir
+			s.Source = SourceEnv
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// withAssetWeights returns the rendered settings of c, including the
+// [AssetPreference] weights that are left out when they are the defaults
+func withAssetWeights(c *Config) []iniEntry {
+	entries := iniEntries(c.render())
+	if c.AssetWeights == DefaultAssetWeights {
+		for _, name := range assetWeightNames {
+			value := *DefaultAssetWeights.field(strings.ToLower(name))
+			entries = append(entries, iniEntry{"AssetPreference", name, strconv.Itoa(value)})
+		}
+	}
+	return entries
+}
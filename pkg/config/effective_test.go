@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEffectiveSources(t *testing.T) {
+	withPolicy(t, `{"policies": {"Branch": "stable"}}`)
+
+	tmpDir := t.TempDir()
+	ini := "[Settings]\nBranch=beta\nBackupCount=3\nCacheMaxAge=30\n\n[Headers]\nReferer=https://mirror.example.com/\n\n[AssetPreference]\nMsi=100\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(ini), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	got := map[string]EffectiveSetting{}
+	for _, s := range cfg.Effective() {
+		got[s.Key] = s
+	}
+
+	tests := []struct {
+		key    string
+		value  string
+		source string
+	}{
+		{"Branch", "stable", SourcePolicy},
+		{"BackupCount", "3", SourceINI},
+		{"CacheMaxAge", "30", SourceDefault}, // set in the INI file to the default
+		{"MaxReleasePages", "10", SourceDefault},
+		{"WorkDir", os.TempDir(), SourceEnv},
+		{"Headers.Referer", "https://mirror.example.com/", SourceINI},
+		{"AssetPreference.Msi", "100", SourceINI},
+		{"AssetPreference.Flavor", "40", SourceDefault},
+	}
+	for _, tt := range tests {
+		s, ok := got[tt.key]
+		if !ok {
+			t.Errorf("Expected %s to be listed", tt.key)
+			continue
+		}
+		if s.Value != tt.value || s.Source != tt.source {
+			t.Errorf("Expected %s=%s from %s, got %s from %s", tt.key, tt.value, tt.source, s.Value, s.Source)
+		}
+	}
+
+	// A WorkDir set in the INI file comes from there
+	cfg.WorkDir = tmpDir
+	if err := cfg.SetSetting("WorkDir", "."); err != nil {
+		t.Fatalf("Failed to set WorkDir: %v", err)
+	}
+	for _, s := range cfg.Effective() {
+		if s.Key == "WorkDir" && (s.Value != "." || s.Source != SourceINI) {
+			t.Errorf("Expected WorkDir=. from the INI file, got %s from %s", s.Value, s.Source)
+		}
+	}
+}
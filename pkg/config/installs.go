@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// installNameRe matches the names of [Installs] entries, which are used in
+// [Log] and [Cache] keys and in file names
+var installNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Install is one of several browser installs updated by every run, from
+// the [Installs] section:
+//
+//	Nightly=D:\Nightly\Noraneko\noraneko.exe;nightly;portable
+//
+// The branch and the portable flag are optional.
+type Install struct {
+	Name string
+
+	// Path to the browser executable. The layout of a portable install
+	// is its parent folder, which holds Noraneko-Portable.exe.
+	Path string
+
+	// Release branch, empty for the Branch setting
+	Branch string
+
+	Portable bool
+}
+
+// String formats the install as its [Installs] value
+func (in Install) String() string {
+	value := in.Path + ";" + in.Branch
+	if in.Portable {
+		value += ";portable"
+	}
+	return value
+}
+
+// parseInstall parses an [Installs] entry
+func parseInstall(name, value string) (Install, error) {
+	if !installNameRe.MatchString(name) {
+		return Install{}, fmt.Errorf("invalid install name %q, use letters, digits, - and _", name)
+	}
+
+	fields := strings.Split(value, ";")
+	if len(fields) > 3 {
+		return Install{}, fmt.Errorf("expected path;branch;portable")
+	}
+	in := Install{Name: name, Path: cleanPath(strings.TrimSpace(fields[0]))}
+	if in.Path == "" {
+		return Install{}, fmt.Errorf("missing browser path")
+	}
+	if len(fields) > 1 {
+		in.Branch = strings.ToLower(strings.TrimSpace(fields[1]))
+		if in.Branch != "" && !slices.Contains(Branches, in.Branch) {
+			return Install{}, fmt.Errorf("unknown branch %q, expected %s", in.Branch, strings.Join(Branches, ", "))
+		}
+	}
+	if len(fields) > 2 {
+		switch flag := strings.ToLower(strings.TrimSpace(fields[2])); flag {
+		case "portable", "1":
+			in.Portable = true
+		case "", "0":
+		default:
+			return Install{}, fmt.Errorf("unknown flag %q, expected portable", flag)
+		}
+	}
+	return in, nil
+}
+
+// ForInstall returns a copy of the configuration for one of Installs,
+// with its path and branch. Its [Log] and [Cache] entries and state files
+// are kept apart from those of other installs, see InstallName. For a
+// portable install, the folder of its layout takes the place of ExeDir.
+func (c *Config) ForInstall(in Install) *Config {
+	cfg := *c
+	cfg.Installs = nil
+	cfg.InstallName = in.Name
+	cfg.Path = in.Path
+	if in.Branch != "" {
+		cfg.Branch = in.Branch
+	}
+	if in.Portable {
+		cfg.ExeDir = filepath.Dir(filepath.Dir(cfg.GetBrowserPath()))
+	}
+	return &cfg
+}
+
+// stateKey returns the [Log] or [Cache] key under which the install of the
+// configuration keeps key
+func (c *Config) stateKey(key string) string {
+	if c.InstallName == "" {
+		return key
+	}
+	return c.InstallName + "." + key
+}
+
+// InstallFile returns the name of a state file of the updater, such as
+// JournalName, for the install of the configuration: the install name is
+// added before the extension
+func (c *Config) InstallFile(name string) string {
+	if c.InstallName == "" {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + c.InstallName + ext
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadInstalls(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configContent := `[Settings]
+Branch=stable
+
+[Installs]
+Main=/opt/noraneko/noraneko.exe
+Nightly=/data/Nightly/Noraneko/noraneko.exe;nightly;portable
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	want := []Install{
+		{Name: "Main", Path: "/opt/noraneko/noraneko.exe"},
+		{Name: "Nightly", Path: "/data/Nightly/Noraneko/noraneko.exe", Branch: "nightly", Portable: true},
+	}
+	if !reflect.DeepEqual(cfg.Installs, want) {
+		t.Errorf("Expected installs %+v, got %+v", want, cfg.Installs)
+	}
+
+	// Installs survive a save/load round trip
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	reloaded, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.Installs, want) {
+		t.Errorf("Installs not preserved across save: %+v", reloaded.Installs)
+	}
+
+	// Bad names, missing paths, unknown flags and duplicates are reported
+	invalid, err := parse(defaults(tmpDir), strings.NewReader(`[Installs]
+bad.name=/opt/a/noraneko.exe
+Empty=
+Flagged=/opt/b/noraneko.exe;beta;installed
+Twice=/opt/c/noraneko.exe
+twice=/opt/d/noraneko.exe
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(invalid) != 4 {
+		t.Errorf("Expected 4 invalid installs, got %v", invalid)
+	}
+}
+
+func TestForInstall(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.Branch = "stable"
+	cfg.Installs = []Install{{Name: "Nightly", Path: "/data/Nightly/Noraneko/noraneko.exe", Branch: "nightly", Portable: true}}
+
+	sub := cfg.ForInstall(cfg.Installs[0])
+	if sub.Path != cfg.Installs[0].Path || sub.Branch != "nightly" || sub.Installs != nil {
+		t.Errorf("Expected the install's path and branch, got %s, %s, %v", sub.Path, sub.Branch, sub.Installs)
+	}
+	if sub.ExeDir != "/data/Nightly" {
+		t.Errorf("Expected the portable layout as ExeDir, got %s", sub.ExeDir)
+	}
+	if got := sub.InstallFile(JournalName); got != "Noraneko-WinUpdater.Nightly.journal" {
+		t.Errorf("Expected a journal of the install, got %s", got)
+	}
+	if got := cfg.InstallFile(JournalName); got != JournalName {
+		t.Errorf("Expected the journal name to be unchanged, got %s", got)
+	}
+
+	// State entries of installs are kept apart
+	if err := sub.LogEntry("InstalledBranch", "nightly"); err != nil {
+		t.Fatalf("Failed to write log entry: %v", err)
+	}
+	if err := cfg.LogEntry("InstalledBranch", "stable"); err != nil {
+		t.Fatalf("Failed to write log entry: %v", err)
+	}
+	if got := sub.LogValue("InstalledBranch"); got != "nightly" {
+		t.Errorf("Expected the install's entry, got %s", got)
+	}
+	if got := cfg.entry("Log", "Nightly.InstalledBranch"); got != "nightly" {
+		t.Errorf("Expected a prefixed entry, got %s", got)
+	}
+
+	// Compacting keeps the prefixed entries
+	if _, err := cfg.Compact(); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if got := sub.LogValue("InstalledBranch"); got != "nightly" {
+		t.Errorf("Expected the install's entry to survive compaction, got %s", got)
+	}
+}
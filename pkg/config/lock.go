@@ -0,0 +1,23 @@
+package config
+
+import "os"
+
+// lockConfigFile waits for and takes the lock that serializes changes to
+// the INI file at path across processes, such as a scheduled run and a
+// manual one, and returns the function releasing it. The INI file cannot
+// be locked itself as every write replaces it, so a lock file next to it
+// is used. The system releases the lock of a process that exits.
+func lockConfigFile(path string) (func(), error) {
+	f, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AppxManifestName is the manifest at the root of every MSIX/AppX package
+const AppxManifestName = "AppxManifest.xml"
+
+// PackagedInstall reports whether the browser at exePath was installed from
+// an MSIX/AppX package: its folder holds a package manifest, lies in a
+// WindowsApps folder or is the root folder of a registered package. Such
+// installs are read-only and updated through the package, not in place.
+func PackagedInstall(exePath string) bool {
+	if exePath == "" {
+		return false
+	}
+	dir := filepath.Dir(exePath)
+	if _, err := os.Stat(filepath.Join(dir, AppxManifestName)); err == nil {
+		return true
+	}
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		if strings.EqualFold(part, "WindowsApps") {
+			return true
+		}
+	}
+	return registeredPackageDir(dir)
+}
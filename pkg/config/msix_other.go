@@ -0,0 +1,8 @@
+//go:build !windows
+
+package config
+
+// registeredPackageDir is only implemented on Windows
+func registeredPackageDir(dir string) bool {
+	return false
+}
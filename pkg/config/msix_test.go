@@ -0,0 +1,42 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPackagedInstall(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	plain := filepath.Join(tmpDir, "Programs", BrowserName)
+	manifest := filepath.Join(tmpDir, "Packaged")
+	for _, dir := range []string{plain, manifest} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(manifest, AppxManifestName), []byte("<Package/>"), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		exePath  string
+		expected bool
+	}{
+		{"regular install", filepath.Join(plain, BrowserExe), false},
+		{"package manifest", filepath.Join(manifest, BrowserExe), true},
+		{"WindowsApps folder", filepath.Join(tmpDir, "windowsapps", "Noraneko_1.0.0.0_x64__abc", BrowserExe), true},
+		{"WindowsApps in a file name", filepath.Join(tmpDir, "WindowsApps.old", BrowserExe), false},
+		{"no browser", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PackagedInstall(tt.exePath); got != tt.expected {
+				t.Errorf("Expected %v for %s, got %v", tt.expected, tt.exePath, got)
+			}
+		})
+	}
+}
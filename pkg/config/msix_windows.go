@@ -0,0 +1,46 @@
+//go:build windows
+
+package config
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// packageRepositoryKey lists the MSIX/AppX packages installed for the
+// current user, each with its PackageRootFolder
+const packageRepositoryKey = `Software\Classes\Local Settings\Software\Microsoft\Windows\CurrentVersion\AppModel\Repository\Packages`
+
+// registeredPackageDir reports whether dir is in the root folder of an
+// MSIX/AppX package registered for the current user
+func registeredPackageDir(dir string) bool {
+	key, err := registry.OpenKey(registry.CURRENT_USER, packageRepositoryKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return false
+	}
+	defer key.Close()
+
+	packages, err := key.ReadSubKeyNames(-1)
+	if err != nil {
+		return false
+	}
+	dir = strings.ToLower(filepath.Clean(dir))
+	for _, name := range packages {
+		pkg, err := registry.OpenKey(key, name, registry.QUERY_VALUE)
+		if err != nil {
+			continue
+		}
+		root, _, err := pkg.GetStringValue("PackageRootFolder")
+		pkg.Close()
+		if err != nil || root == "" {
+			continue
+		}
+		root = strings.ToLower(filepath.Clean(root))
+		if dir == root || strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
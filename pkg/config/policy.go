@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PolicyFileName is the name of the enterprise policy file
+const PolicyFileName = "policies.json"
+
+// policyPath returns the path of the policy file, or an empty string if
+// there is no Program Files folder. It is a variable so tests can move it.
+var policyPath = func() string {
+	programFiles := os.Getenv("ProgramFiles")
+	if programFiles == "" {
+		return ""
+	}
+	return filepath.Join(programFiles, BrowserName, "WinUpdater", PolicyFileName)
+}
+
+// policyFile is the layout of policies.json, e.g.
+//
+//	{"policies": {"Branch": "stable", "UpdateSelf": false}}
+//
+// Keys are the [Settings] keys of the INI file.
+type policyFile struct {
+	Policies map[string]any `json:"policies"`
+}
+
+// applyPolicies reads the policy file, if there is one, and overrides the
+// settings it lists. They are recorded in Policies and cannot be changed
+// with SetSetting or Import.
+func applyPolicies(cfg *Config) error {
+	path := policyPath()
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var file policyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse policy file %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(file.Policies))
+	for key := range file.Policies {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// The policies are applied as INI settings, so they are validated like
+	// the INI file
+	var content strings.Builder
+	content.WriteString("[Settings]\n")
+	var invalid []string
+	for _, key := range keys {
+		value, ok := policyValue(file.Policies[key])
+		if !ok || strings.ContainsAny(key, "=\r\n") {
+			invalid = append(invalid, key)
+			continue
+		}
+		content.WriteString(fmt.Sprintf("%s=%s\n", key, value))
+	}
+	if len(invalid) == 0 {
+		parsed, err := parse(cfg, strings.NewReader(content.String()))
+		if err != nil {
+			return fmt.Errorf("invalid policy file %s: %w", path, err)
+		}
+		invalid = parsed
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid policies in %s: %s", path, strings.Join(invalid, ", "))
+	}
+
+	cfg.Policies = keys
+	cfg.enforced = map[string]bool{}
+	for _, key := range keys {
+		cfg.enforced[strings.ToLower(key)] = true
+	}
+	return nil
+}
+
+// policyValue formats a JSON policy value as an INI value. Booleans become
+// 1 or 0; numbers must be whole.
+func policyValue(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, !strings.ContainsAny(v, "\r\n")
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	case float64:
+		if v != float64(int64(v)) {
+			return "", false
+		}
+		return strconv.FormatInt(int64(v), 10), true
+	}
+	return "", false
+}
+
+// Enforced reports whether a setting is set by the policy file
+func (c *Config) Enforced(key string) bool {
+	return c.enforced[strings.ToLower(key)]
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withPolicy points the policy file at a temp file with the given content,
+// or at a missing file if content is empty
+func withPolicy(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), PolicyFileName)
+	if content != "" {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write policy file: %v", err)
+		}
+	}
+	orig := policyPath
+	policyPath = func() string { return path }
+	t.Cleanup(func() { policyPath = orig })
+}
+
+func TestPolicyPrecedence(t *testing.T) {
+	withPolicy(t, `{"policies": {"Branch": "stable", "UpdateSelf": false, "BackupCount": 2}}`)
+
+	tmpDir := t.TempDir()
+	ini := "[Settings]\nBranch=beta\nUpdateSelf=1\nBackupCount=5\nCacheMaxAge=7\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, ConfigFileName), []byte(ini), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Policy over INI, INI over default
+	if cfg.Branch != "stable" || cfg.UpdateSelf || cfg.BackupCount != 2 {
+		t.Errorf("Expected the policies to win, got Branch=%s UpdateSelf=%v BackupCount=%d", cfg.Branch, cfg.UpdateSelf, cfg.BackupCount)
+	}
+	if cfg.CacheMaxAge != 7 || cfg.CacheMaxSize != DefaultCacheMaxSize {
+		t.Errorf("Expected INI and default values elsewhere, got CacheMaxAge=%d CacheMaxSize=%d", cfg.CacheMaxAge, cfg.CacheMaxSize)
+	}
+	if want := []string{"BackupCount", "Branch", "UpdateSelf"}; !reflect.DeepEqual(cfg.Policies, want) {
+		t.Errorf("Expected policies %v, got %v", want, cfg.Policies)
+	}
+	if !cfg.Enforced("branch") || cfg.Enforced("CacheMaxAge") {
+		t.Error("Expected only the policy keys to be enforced")
+	}
+
+	// Enforced settings cannot be changed
+	if err := cfg.SetSetting("Branch", "nightly"); err == nil {
+		t.Error("Expected SetSetting to refuse an enforced setting")
+	}
+	if err := cfg.SetSkipVersion("1.0.0"); err != nil {
+		t.Errorf("Expected other settings to be writable: %v", err)
+	}
+
+	importPath := filepath.Join(tmpDir, "import.ini")
+	if err := os.WriteFile(importPath, []byte("[Settings]\nBranch=nightly\nCacheMaxAge=14\n"), 0644); err != nil {
+		t.Fatalf("Failed to write import file: %v", err)
+	}
+	replaced, err := cfg.Import(importPath)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(replaced) != 1 || !strings.HasPrefix(replaced[0], "CacheMaxAge") {
+		t.Errorf("Expected only CacheMaxAge to be replaced, got %v", replaced)
+	}
+	if cfg.Branch != "stable" || cfg.CacheMaxAge != 14 || !cfg.Enforced("Branch") {
+		t.Errorf("Expected the policy to survive the import, got Branch=%s CacheMaxAge=%d", cfg.Branch, cfg.CacheMaxAge)
+	}
+	if cfg.entry("Settings", "Branch") != "beta" {
+		t.Errorf("Expected the INI to keep its own Branch, got %s", cfg.entry("Settings", "Branch"))
+	}
+}
+
+func TestPolicyMissing(t *testing.T) {
+	withPolicy(t, "")
+
+	cfg, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.Policies) != 0 || cfg.Enforced("Branch") {
+		t.Errorf("Expected no policies, got %v", cfg.Policies)
+	}
+}
+
+func TestPolicyInvalid(t *testing.T) {
+	tests := map[string]string{
+		"not JSON":         `{"policies": `,
+		"unknown key":      `{"policies": {"Branhc": "stable"}}`,
+		"invalid value":    `{"policies": {"DownloadConnections": 0}}`,
+		"fractional value": `{"policies": {"BackupCount": 1.5}}`,
+		"list value":       `{"policies": {"Branch": ["stable"]}}`,
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			withPolicy(t, content)
+			if _, err := Load(t.TempDir()); err == nil {
+				t.Error("Expected an invalid policy file to fail loading")
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package config
+
+// findRunningBrowser is only implemented on Windows
+func findRunningBrowser(names []string) string {
+	return ""
+}
+
+// BrowserRunning is only implemented on Windows
+func BrowserRunning(exePath string) bool {
+	return false
+}
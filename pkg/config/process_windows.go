@@ -0,0 +1,82 @@
+//go:build windows
+
+package config
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                      = syscall.NewLazyDLL("kernel32.dll")
+	procQueryFullProcessImageName = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+const processQueryLimitedInformation = 0x1000
+
+// findRunningBrowser returns the executable path of a running browser
+// process with one of the given executable names, or an empty string if
+// none is found
+func findRunningBrowser(names []string) string {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		exe := syscall.UTF16ToString(entry.ExeFile[:])
+		if !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(exe, name) }) {
+			continue
+		}
+		if path := processImagePath(entry.ProcessID); path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// BrowserRunning reports whether a browser process runs the executable at
+// exePath
+func BrowserRunning(exePath string) bool {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(syscall.TH32CS_SNAPPROCESS, 0)
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	exePath = filepath.Clean(exePath)
+	exeName := filepath.Base(exePath)
+	var entry syscall.ProcessEntry32
+	entry.Size = uint32(unsafe.Sizeof(entry))
+	for err = syscall.Process32First(snapshot, &entry); err == nil; err = syscall.Process32Next(snapshot, &entry) {
+		if !strings.EqualFold(syscall.UTF16ToString(entry.ExeFile[:]), exeName) {
+			continue
+		}
+		if strings.EqualFold(filepath.Clean(processImagePath(entry.ProcessID)), exePath) {
+			return true
+		}
+	}
+	return false
+}
+
+// processImagePath returns the full executable path of a process
+func processImagePath(pid uint32) string {
+	process, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return ""
+	}
+	defer syscall.CloseHandle(process)
+
+	buf := make([]uint16, syscall.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if ok, _, _ := procQueryFullProcessImageName.Call(uintptr(process), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size))); ok == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:size])
+}
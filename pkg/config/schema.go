@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// settingComments explains the [Settings] keys, as written above keys that
+// UpdateSchema adds. Lines are separated by newlines.
+var settingComments = map[string]string{
+	"Path":                   "Path to noraneko.exe or its folder (auto-detected if empty, including from a running browser)",
+	"WorkDir":                "Working directory for downloads (empty = system temp folder)",
+	"RedirectWorkDir":        "Use the system temp folder when WorkDir is the updater's folder (.) and the browser is installed, not portable (1 = enabled)\nNext to an installed updater the folder may not be writable, and extracted files would land beside the install",
+	"CacheDir":               "Keep verified downloads here to reuse them on retries and reinstalls (empty = no cache, . = next to the updater)\nOnly releases that publish a checksum file are cached",
+	"CacheMaxSize":           "Size limit of the download cache in MB (0 = unlimited)",
+	"CacheMaxAge":            "Days a cached download is kept after its last use (0 = forever)",
+	"StagingDir":             "Folder -stage downloads and verifies updates to, installed later by -apply-staged (empty = %LOCALAPPDATA%\\Noraneko-WinUpdater, . = next to the updater)\nOnly the current user, SYSTEM and Administrators can open it; -apply-staged verifies the download again",
+	"UpdateSelf":             "Enable/disable self-updates (1 = enabled)",
+	"IgnoreCrlErrors":        "Ignore certificate revocation errors (0 = disabled)",
+	"Branch":                 "Release branch to track (nightly, beta, stable)\nAfter switching, the new branch's release is installed even if its version is lower",
+	"StableExcludePatterns":  "Regular expressions (separated by ;) of release tags never installed on the stable branch, matched ignoring case\nKeeps release candidates published as regular releases by mistake off stable (empty = exclude nothing)",
+	"DownloadConnections":    "Parallel connections per download, up to 16 (1 = single stream)",
+	"VerifyConcurrency":      "Files hashed in parallel by -verify-install, 1 to 64",
+	"HeadersForAPI":          "Also send [Headers] with GitHub API requests (0 = downloads only)",
+	"MaxReleasePages":        "Maximum pages (of 100 releases) fetched when listing releases, 1 to 100",
+	"PinnedCACert":           "PEM file with the only CA trusted for TLS (empty = system store)\nCannot be combined with IgnoreCrlErrors=1",
+	"DisableHTTP2":           "Use HTTP/1.1 only, for proxies that mishandle HTTP/2 (0 = allow HTTP/2)",
+	"MinTLSVersion":          "Lowest TLS version accepted for all connections: 1.2 or 1.3, other values are rejected",
+	"ChecksumOptional":       "Install without checksum verification, with a warning, if the release's checksum file\nstill fails to download after retries (0 = fail the update)",
+	"VerifyAttestation":      "Require a GitHub build provenance attestation signed by the release repository's workflows (0 = disabled)",
+	"AttestationTrustedRoot": "PEM file with the Sigstore Fulcio root and intermediate, required by VerifyAttestation and keyless VerifyCosign",
+	"RekorPublicKey":         "PEM file with the public key of the Rekor transparency log, required by VerifyAttestation and keyless VerifyCosign\nA signing certificate is only checked at the time a signed entry timestamp of this log proves",
+	"VerifyCosign":           "Require a cosign signature published with the asset: <asset>.sig for key-based signing, or a <asset>.sigstore.json or <asset>.bundle bundle (0 = disabled)",
+	"CosignPublicKey":        "PEM file with the public key cosign signatures are made with (empty = keyless, see CosignIdentity)",
+	"CosignIdentity":         "Regular expression the whole URI or email of a keyless signing certificate must match, e.g. https://github.com/owner/repo/.*\nThe certificate must chain to AttestationTrustedRoot when the bundle's Rekor entry was logged",
+	"CheckCertExpiry":        "Warn if the Authenticode signing certificate of an .exe/.msi installer is expired or expires soon (Windows only)",
+	"CertExpiryWarnDays":     "Days before the certificate expires that CheckCertExpiry starts warning, up to 365",
+	"RequireValidCert":       "Reject installers whose Authenticode signature does not verify with WinVerifyTrust, or whose signing certificate is expired or not yet valid and the signature not timestamped from while it was (0 = only warn)\nRevocation is checked unless IgnoreCrlErrors=1",
+	"AutoSavePath":           "Save the auto-detected path above after the first run (1 = enabled)",
+	"ConnectCheckURL":        "URL probed before checking for updates",
+	"AssetRetryDelay":        "Seconds to wait before checking a release without assets (still publishing) again, up to 3600 (0 = fail right away)",
+	"PostInstallWait":        "Seconds between reads of the installed version after an install, for installers that finish in the background (up to 600)",
+	"PostInstallRetries":     "Extra reads of the installed version before warning that the install did not take effect, up to 100 (0 = read once)\nTags without a version, such as nightly-20240501, are read once and not compared",
+	"WaitForBrowserClose":    "Seconds to wait for a running browser to close before installing, up to 86400 (0 = install right away)\nScheduled runs that time out defer the update to the next run, other runs fail",
+	"VerifyByLaunch":         "Also run noraneko.exe --version after an install and compare the version it prints (0 = disabled)\nA browser that prints nothing within 10 seconds, e.g. by opening a window, is closed and the check skipped",
+	"PostInstallSentinels":   "Comma-separated files of a portable update, e.g. omni.ja,noraneko.exe, compared with the downloaded archive after the copy\nA file that differs fails the update and the next run copies it again (empty = no check)",
+	"MaxRunDuration":         "Seconds a run may take before it is aborted and its partial downloads removed, e.g. 3600, up to 604800 (0 = no limit)\nA running installer or the copy into the install is not interrupted",
+	"CheckInterval":          "Minutes between update checks of the Windows service (-install-service) and of -on-launch, 1 to 10080",
+	"MsiInstallDirProperty":  "MSI property that receives the install directory (empty = package default)",
+	"InstallerLog":           "Folder for detailed installer logs, for MSI and Inno Setup installers (empty = no log, . = next to the updater)",
+	"UserAgent":              "User-Agent sent with all requests (empty = Noraneko-WinUpdater/<version>)",
+	"WebhookURL":             "URL the result of a run (the -json output, with an error field for failed runs) is POSTed to (empty = disabled)\nTried 3 times; credentials in URLs and [Headers] values are redacted from the payload",
+	"WebhookEvents":          "Comma-separated runs POSTed to WebhookURL: update, failure and no-update (empty = update,failure)",
+	"ReleaseRepo":            "GitHub repository (owner/repo) to fetch releases from (empty = official releases)",
+	"VersionScheme":          "Versioning scheme of releases: semver or date (empty = detect from the version)",
+	"SkipVersion":            "Version or tag never offered as an update (set with -skip, cleared with -unskip)",
+	"OverwritePolicy":        "Existing files an update may overwrite: all, skip-existing or skip-listed",
+	"PreserveFiles":          "Comma-separated globs kept by skip-listed, e.g. distribution/policies.json,defaults/pref/*",
+	"ArchiveRoot":            "Folder of a portable archive whose content is installed, e.g. noraneko/core or noraneko-*/core (empty = see ArchiveRootStrip)",
+	"ArchiveRootStrip":       "Folders a portable archive is descended into before its content is installed, up to 16, each level must hold a single folder\n0 = the archive's top level, -1 = its first folder",
+	"ExtraSearchPaths":       "Semicolon-separated folders (or noraneko.exe paths) also searched for the browser\nProgram Files, Program Files (x86) and %LOCALAPPDATA%\\Programs are always searched",
+	"BrowserExe":             "File name of the browser executable, for renamed executables or custom launchers",
+	"BrowserExeCandidates":   "Semicolon-separated other executable names looked for when detecting the browser, e.g. noraneko-launcher.exe\nEvery search location is checked for BrowserExe first, then for these names in order",
+	"MaintenanceWindow":      "Scheduled runs install updates only in these weekly windows, e.g. Sat-Sun, Mon-Fri 22:00-06:00 (empty = any time)\nOutside them the update is deferred and the next window is logged",
+	"SkipOnBattery":          "Scheduled runs defer updates while the computer runs on battery below MinBatteryCharge (0 = disabled)\nThe deferral is logged and the next run tries again; interactive runs always proceed",
+	"MinBatteryCharge":       "Battery charge in percent, 0 to 100, below which SkipOnBattery defers updates",
+	"SkipOnMetered":          "Scheduled runs defer updates while the network connection is metered, roaming or near its data limit (0 = disabled)\nThe deferral is logged and the next run tries again; interactive runs always proceed",
+	"OfflineTolerant":        "Treat a failed connection check as a warning (0 = abort the run)",
+	"AllowHTMLFallback":      "Read the latest release from the github.com release feed and pages when the API is blocked (0 = disabled)\nThe connection check only warns then; prereleases are passed over as with the API",
+	"AutoElevate":            "Ask for administrator rights (UAC) when the install directory needs them (0 = fail instead)",
+	"KeepTempOnError":        "Keep the download and extracted files after a failed install (0 = always delete)",
+	"BackupCount":            "Previous installs kept as Noraneko-<version>.bak next to the install for -rollback, up to 50 (0 = none)\nOnly portable updates are backed up, the oldest backups are removed first",
+	"LogPhases":              "Log how long each phase of the last run took (connect, download, ...) as LastPhases",
+	"ScheduledTask":          "Whether a scheduled task should exist (set by -create-task and -remove-task)",
+}
+
+// UpdateSchema adds the [Settings] keys missing from the INI file, as
+// written by older versions, with their default values and a comment
+// explaining them. Keys already in the file keep their values, and the rest
+// of the file is left as it is. It returns the added keys.
+func (c *Config) UpdateSchema() ([]string, error) {
+	unlock, err := lockConfigFile(c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock config file: %w", err)
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	present := map[string]bool{}
+	for _, e := range iniEntries(string(data)) {
+		if strings.EqualFold(e.section, "Settings") {
+			present[strings.ToLower(e.key)] = true
+		}
+	}
+
+	var added, lines []string
+	for _, e := range iniEntries(defaults(c.ExeDir).render()) {
+		if e.section != "Settings" || present[strings.ToLower(e.key)] {
+			continue
+		}
+		if comment := settingComments[e.key]; comment != "" {
+			for _, line := range strings.Split(comment, "\n") {
+				lines = append(lines, "; "+line)
+			}
+		}
+		lines = append(lines, e.key+"="+e.value)
+		added = append(added, e.key)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	updated := insertSettings(string(data), lines)
+	if err := atomicWriteFile(c.ConfigFile, []byte(updated), 0644); err != nil {
+		return nil, err
+	}
+	return added, nil
+}
+
+// insertSettings adds lines after the last entry of the [Settings] section
+// of INI data, or in a new [Settings] section at the top if there is none
+func insertSettings(data string, lines []string) string {
+	fileLines := strings.Split(data, "\n")
+	insertAt := -1
+	inSettings := false
+	for i, line := range fileLines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			if inSettings {
+				break
+			}
+			inSettings = strings.EqualFold(trimmed, "[Settings]")
+			if inSettings {
+				insertAt = i + 1
+			}
+			continue
+		}
+		if inSettings && trimmed != "" {
+			insertAt = i + 1
+		}
+	}
+
+	if insertAt < 0 {
+		return "[Settings]\n" + strings.Join(lines, "\n") + "\n\n" + data
+	}
+	out := append([]string{}, fileLines[:insertAt]...)
+	out = append(out, lines...)
+	out = append(out, fileLines[insertAt:]...)
+	return strings.Join(out, "\n")
+}
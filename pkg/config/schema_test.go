@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateSchema(t *testing.T) {
+	tmpDir := t.TempDir()
+	old := "[Settings]\n" +
+		"; my branch\n" +
+		"Branch=beta\n" +
+		"WorkDir=" + tmpDir + "\n" +
+		"CertExpiryWarnDays=7\n" +
+		"\n" +
+		"[Log]\n" +
+		"LastRun=2024-03-01 12:00:00\n"
+	cfgFile := filepath.Join(tmpDir, ConfigFileName)
+	if err := os.WriteFile(cfgFile, []byte(old), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	added, err := cfg.UpdateSchema()
+	if err != nil {
+		t.Fatalf("UpdateSchema failed: %v", err)
+	}
+
+	addedSet := map[string]bool{}
+	for _, key := range added {
+		addedSet[key] = true
+	}
+	for _, key := range []string{"Branch", "WorkDir", "CertExpiryWarnDays"} {
+		if addedSet[key] {
+			t.Errorf("Expected the existing key %s not to be added", key)
+		}
+	}
+	for _, key := range []string{"Path", "UpdateSelf", "RequireValidCert", "ScheduledTask"} {
+		if !addedSet[key] {
+			t.Errorf("Expected the missing key %s to be added, added %v", key, added)
+		}
+	}
+
+	data, err := os.ReadFile(cfgFile)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	content := string(data)
+	for _, want := range []string{
+		"[Settings]\n; my branch\nBranch=beta\n",
+		"CertExpiryWarnDays=7\n",
+		"; Revocation is checked unless IgnoreCrlErrors=1\nRequireValidCert=0\n",
+		"; Enable/disable self-updates (1 = enabled)\nUpdateSelf=1\n",
+		"\n\n[Log]\nLastRun=2024-03-01 12:00:00\n",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected the config to contain %q, got:\n%s", want, content)
+		}
+	}
+	if strings.Count(content, "Branch=") != 1 || strings.Count(content, "CertExpiryWarnDays=") != 1 {
+		t.Errorf("Expected existing keys once, got:\n%s", content)
+	}
+	if strings.Index(content, "UpdateSelf=") > strings.Index(content, "[Log]") {
+		t.Errorf("Expected the keys to be added to [Settings], got:\n%s", content)
+	}
+
+	// The values read are unchanged and nothing is left to add
+	cfg, err = Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load updated config: %v", err)
+	}
+	if cfg.Branch != "beta" || cfg.WorkDir != tmpDir || cfg.CertExpiryWarnDays != 7 || !cfg.UpdateSelf {
+		t.Errorf("Expected the settings to be kept, got Branch %q, WorkDir %q, CertExpiryWarnDays %d",
+			cfg.Branch, cfg.WorkDir, cfg.CertExpiryWarnDays)
+	}
+	if added, err := cfg.UpdateSchema(); err != nil || len(added) != 0 {
+		t.Errorf("Expected nothing to add, got %v (%v)", added, err)
+	}
+}
+
+func TestSettingComments(t *testing.T) {
+	// Every setting is explained when it is added
+	for _, e := range iniEntries(defaults(t.TempDir()).render()) {
+		if e.section == "Settings" && settingComments[e.key] == "" {
+			t.Errorf("Setting %s has no comment", e.key)
+		}
+	}
+}
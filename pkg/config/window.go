@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a weekly period in which scheduled runs may install
+// updates, such as "Sat-Sun" or "Mon-Fri 22:00-06:00"
+type MaintenanceWindow struct {
+	// Days the window starts on, from FirstDay to LastDay. Ranges may wrap
+	// around the week, e.g. Fri-Mon.
+	FirstDay, LastDay time.Weekday
+
+	// Minutes since midnight. An End at or before Start ends on the next
+	// day.
+	Start, End int
+}
+
+// dayNames maps the accepted day abbreviations to weekdays
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseMaintenanceWindows parses a comma-separated list of windows. Each
+// window is a day or day range followed by an optional HH:MM-HH:MM time
+// range, or only a time range for every day.
+func ParseMaintenanceWindows(value string) ([]MaintenanceWindow, error) {
+	var windows []MaintenanceWindow
+	for _, item := range strings.Split(value, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+
+		w := MaintenanceWindow{FirstDay: time.Sunday, LastDay: time.Saturday, End: 24 * 60}
+		if !strings.Contains(fields[0], ":") {
+			first, last, err := parseDays(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			w.FirstDay, w.LastDay = first, last
+			fields = fields[1:]
+		}
+
+		switch len(fields) {
+		case 0:
+		case 1:
+			start, end, err := parseTimeRange(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			w.Start, w.End = start, end
+		default:
+			return nil, fmt.Errorf("invalid maintenance window %q", strings.TrimSpace(item))
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// parseDays parses "Sat" or "Sat-Sun"
+func parseDays(s string) (time.Weekday, time.Weekday, error) {
+	first, last, isRange := strings.Cut(strings.ToLower(s), "-")
+	if !isRange {
+		last = first
+	}
+	f, ok := dayNames[first]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid day %q, expected Mon, Tue, ...", first)
+	}
+	l, ok := dayNames[last]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid day %q, expected Mon, Tue, ...", last)
+	}
+	return f, l, nil
+}
+
+// parseTimeRange parses "22:00-06:00" into minutes since midnight
+func parseTimeRange(s string) (int, int, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == 24*60 {
+		return 0, 0, fmt.Errorf("invalid start time %q", from)
+	}
+	return start, end, nil
+}
+
+// parseClock parses HH:MM, allowing 24:00 as the end of the day
+func parseClock(s string) (int, error) {
+	var h, m int
+	if n, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || n != 2 || len(s) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// String formats the window as it is written to the INI file
+func (w MaintenanceWindow) String() string {
+	days := dayAbbrev(w.FirstDay)
+	if w.LastDay != w.FirstDay {
+		days += "-" + dayAbbrev(w.LastDay)
+	}
+	return fmt.Sprintf("%s %02d:%02d-%02d:%02d", days, w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// dayAbbrev returns the three-letter name of a weekday
+func dayAbbrev(d time.Weekday) string {
+	return d.String()[:3]
+}
+
+// hasDay reports whether the window starts on the given weekday
+func (w MaintenanceWindow) hasDay(d time.Weekday) bool {
+	if w.FirstDay <= w.LastDay {
+		return d >= w.FirstDay && d <= w.LastDay
+	}
+	return d >= w.FirstDay || d <= w.LastDay
+}
+
+// span returns the start and end of the window opening on t's day
+func (w MaintenanceWindow) span(t time.Time) (time.Time, time.Time) {
+	y, m, d := t.Date()
+	start := time.Date(y, m, d, 0, w.Start, 0, 0, t.Location())
+	end := time.Date(y, m, d, 0, w.End, 0, 0, t.Location())
+	if w.End <= w.Start {
+		end = time.Date(y, m, d+1, 0, w.End, 0, 0, t.Location())
+	}
+	return start, end
+}
+
+// Contains reports whether t falls in the window, including the part of
+// a window that started the day before and runs past midnight
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	for back := 0; back <= 1; back++ {
+		day := t.AddDate(0, 0, -back)
+		if !w.hasDay(day.Weekday()) {
+			continue
+		}
+		start, end := w.span(day)
+		if !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// InMaintenanceWindow reports whether t falls in one of the windows. No
+// windows means updates are always allowed.
+func InMaintenanceWindow(windows []MaintenanceWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextMaintenanceWindow returns the start of the first window opening
+// after t, or the zero time if there are no windows
+func NextMaintenanceWindow(windows []MaintenanceWindow, t time.Time) time.Time {
+	var next time.Time
+	for days := 0; days <= 7; days++ {
+		day := t.AddDate(0, 0, days)
+		for _, w := range windows {
+			if !w.hasDay(day.Weekday()) {
+				continue
+			}
+			start, _ := w.span(day)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+	}
+	return next
+}
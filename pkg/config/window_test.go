@@ -0,0 +1,86 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a local time in the week of Monday 2024-06-03
+func at(day time.Weekday, hour, min int) time.Time {
+	return time.Date(2024, 6, 2+int(day), hour, min, 0, 0, time.Local)
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	windows, err := ParseMaintenanceWindows("Sat-Sun, Mon-Fri 22:00-06:00")
+	if err != nil {
+		t.Fatalf("Failed to parse windows: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		in   bool
+	}{
+		{"Saturday morning", at(time.Saturday, 9, 0), true},
+		{"Sunday night", at(time.Sunday, 23, 59), true},
+		{"Monday afternoon", at(time.Monday, 14, 0), false},
+		{"Tuesday late evening", at(time.Tuesday, 22, 30), true},
+		{"Wednesday early morning", at(time.Wednesday, 5, 59), true},
+		{"Wednesday at six", at(time.Wednesday, 6, 0), false},
+		{"Friday just before ten", at(time.Friday, 21, 59), false},
+		{"Saturday after Friday night", at(time.Saturday, 3, 0), true},
+	}
+
+	for _, tt := range tests {
+		if got := InMaintenanceWindow(windows, tt.t); got != tt.in {
+			t.Errorf("%s (%s): expected in window %v, got %v", tt.name, tt.t.Format("Mon 15:04"), tt.in, got)
+		}
+	}
+
+	// Without windows updates are always allowed
+	if !InMaintenanceWindow(nil, at(time.Monday, 14, 0)) {
+		t.Error("Expected no windows to allow any time")
+	}
+}
+
+func TestNextMaintenanceWindow(t *testing.T) {
+	windows, err := ParseMaintenanceWindows("Sat 02:00-05:00, Wed 22:00-23:00")
+	if err != nil {
+		t.Fatalf("Failed to parse windows: %v", err)
+	}
+
+	tests := []struct {
+		t, next time.Time
+	}{
+		{at(time.Monday, 12, 0), at(time.Wednesday, 22, 0)},
+		{at(time.Wednesday, 22, 30), at(time.Saturday, 2, 0)},
+		{at(time.Saturday, 6, 0), at(time.Wednesday, 22, 0).AddDate(0, 0, 7)},
+	}
+	for _, tt := range tests {
+		if got := NextMaintenanceWindow(windows, tt.t); !got.Equal(tt.next) {
+			t.Errorf("After %s: expected %s, got %s", tt.t.Format("Mon 15:04"), tt.next.Format("Mon Jan 2 15:04"), got.Format("Mon Jan 2 15:04"))
+		}
+	}
+}
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	windows, err := ParseMaintenanceWindows("fri-mon, 01:00-24:00")
+	if err != nil {
+		t.Fatalf("Failed to parse windows: %v", err)
+	}
+	if len(windows) != 2 {
+		t.Fatalf("Expected 2 windows, got %d", len(windows))
+	}
+	if got := windows[0].String(); got != "Fri-Mon 00:00-24:00" {
+		t.Errorf("Unexpected window %s", got)
+	}
+	if got := windows[1].String(); got != "Sun-Sat 01:00-24:00" {
+		t.Errorf("Unexpected window %s", got)
+	}
+
+	for _, invalid := range []string{"Someday", "Mon 22:00", "Mon 25:00-26:00", "Mon 9:00-17:00", "Mon 24:00-01:00", "Mon 01:00-02:00 extra"} {
+		if _, err := ParseMaintenanceWindows(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package tui implements the interactive terminal output of the updater:
+// a progress bar and confirmation prompts. It is only active when stdout
+// is a terminal and the updater is not running as a scheduled task, and
+// only uses color then, unless disabled with NO_COLOR or -no-color.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// barWidth is the number of cells in the progress bar
+const barWidth = 30
+
+// pathWidth is the number of characters of a path shown by FileProgress
+const pathWidth = 50
+
+// ANSI escape sequences for colored output
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// colorSupported reports whether escape sequences can be written to the
+// terminal f. It is a variable so tests can stub it out.
+var colorSupported = enableColor
+
+// isTerminal reports whether f is an interactive console. It is a variable
+// so tests can stub it out.
+var isTerminal = func(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// UI renders progress and asks questions on the console
+type UI struct {
+	out         io.Writer
+	in          *bufio.Reader
+	interactive bool
+	assumeYes   bool
+
+	// Whether output is colored, only ever set for interactive UIs
+	color bool
+
+	// Last rendered percentage, to avoid redrawing the same bar
+	lastPercent int
+}
+
+// New creates a UI writing to out and reading answers from in. The UI is
+// interactive if out is a terminal and the run is not scheduled; otherwise
+// the updater keeps its plain line output. Interactive UIs use color
+// unless the NO_COLOR environment variable is set. With assumeYes, update
+// confirmations are answered automatically.
+func New(out *os.File, in io.Reader, scheduled, assumeYes bool) *UI {
+	interactive := !scheduled && isTerminal(out)
+	return &UI{
+		out:         out,
+		in:          bufio.NewReader(in),
+		interactive: interactive,
+		assumeYes:   assumeYes,
+		color:       interactive && os.Getenv("NO_COLOR") == "" && colorSupported(out),
+		lastPercent: -1,
+	}
+}
+
+// DisableColor turns colored output off, e.g. for -no-color
+func (ui *UI) DisableColor() {
+	ui.color = false
+}
+
+// paint wraps s in the escape sequence code if color is enabled
+func (ui *UI) paint(code, s string) string {
+	if !ui.color || s == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// Interactive reports whether the progress bar and prompts are enabled
+func (ui *UI) Interactive() bool {
+	return ui.interactive
+}
+
+// Progress draws the download or install progress bar. It does nothing if
+// the UI is not interactive.
+func (ui *UI) Progress(done, total int64) {
+	if !ui.interactive {
+		return
+	}
+
+	if total <= 0 {
+		fmt.Fprintf(ui.out, "\r%s downloaded ", formatMB(done))
+		return
+	}
+
+	percent := int(done * 100 / total)
+	if percent == ui.lastPercent {
+		return
+	}
+	ui.lastPercent = percent
+
+	filled := barWidth * percent / 100
+	bar := ui.paint(ansiGreen, strings.Repeat("#", filled)) + strings.Repeat("-", barWidth-filled)
+	fmt.Fprintf(ui.out, "\r[%s] %3d%%  %s / %s ", bar, percent, formatMB(done), formatMB(total))
+	if done >= total {
+		fmt.Fprintln(ui.out)
+		ui.lastPercent = -1
+	}
+}
+
+// FileProgress shows how many files have been processed and the last one,
+// e.g. while verifying an install. It does nothing if the UI is not
+// interactive.
+func (ui *UI) FileProgress(done, total int, path string) {
+	if !ui.interactive {
+		return
+	}
+
+	// Keep the line a fixed width so shorter paths overwrite longer ones
+	if len(path) > pathWidth {
+		path = "..." + path[len(path)-pathWidth+3:]
+	}
+	counter := ui.paint(ansiCyan, fmt.Sprintf("%d/%d", done, total))
+	fmt.Fprintf(ui.out, "\r[%s] %-*s", counter, pathWidth, path)
+	if done >= total {
+		fmt.Fprintln(ui.out)
+	}
+}
+
+// Confirm asks whether to install the latest version. It is answered
+// automatically with assumeYes.
+func (ui *UI) Confirm(current, latest string) bool {
+	if ui.assumeYes {
+		return true
+	}
+	return ui.Ask(fmt.Sprintf("Install %s (currently %s)?", latest, current), true)
+}
+
+// Ask asks a yes/no question. An empty answer or a read error selects def.
+func (ui *UI) Ask(question string, def bool) bool {
+	if def {
+		fmt.Fprintf(ui.out, "%s [Y/n] ", ui.paint(ansiBold, question))
+	} else {
+		fmt.Fprintf(ui.out, "%s [y/N] ", ui.paint(ansiBold, question))
+	}
+
+	answer, _ := ui.in.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
+
+// formatMB formats a byte count in megabytes
+func formatMB(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
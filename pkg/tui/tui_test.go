@@ -0,0 +1,198 @@
+package tui
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// withTerminal stubs terminal detection for the duration of a test
+func withTerminal(t *testing.T, terminal bool) {
+	t.Helper()
+	orig := isTerminal
+	isTerminal = func(*os.File) bool { return terminal }
+	t.Cleanup(func() { isTerminal = orig })
+}
+
+func TestInteractiveGating(t *testing.T) {
+	tests := []struct {
+		terminal    bool
+		scheduled   bool
+		interactive bool
+	}{
+		{true, false, true},
+		{true, true, false},
+		{false, false, false},
+		{false, true, false},
+	}
+
+	for _, tt := range tests {
+		withTerminal(t, tt.terminal)
+		ui := New(os.Stdout, strings.NewReader(""), tt.scheduled, false)
+		if ui.Interactive() != tt.interactive {
+			t.Errorf("terminal=%v scheduled=%v: expected interactive=%v", tt.terminal, tt.scheduled, tt.interactive)
+		}
+	}
+}
+
+func TestColorGating(t *testing.T) {
+	orig := colorSupported
+	colorSupported = func(*os.File) bool { return true }
+	t.Cleanup(func() { colorSupported = orig })
+
+	tests := []struct {
+		name     string
+		terminal bool
+		noColor  string
+		disable  bool
+		color    bool
+	}{
+		{"terminal", true, "", false, true},
+		{"redirected", false, "", false, false},
+		{"NO_COLOR", true, "1", false, false},
+		{"-no-color", true, "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withTerminal(t, tt.terminal)
+			t.Setenv("NO_COLOR", tt.noColor)
+
+			ui := New(os.Stdout, strings.NewReader(""), false, false)
+			if tt.disable {
+				ui.DisableColor()
+			}
+			var out bytes.Buffer
+			ui.out = &out
+			ui.interactive = true
+
+			ui.Progress(50, 100)
+			ui.FileProgress(1, 2, "omni.ja")
+			ui.Ask("Reboot now?", false)
+			hasCodes := strings.Contains(out.String(), "\x1b[")
+			if hasCodes != tt.color {
+				t.Errorf("Expected color=%v, got output %q", tt.color, out.String())
+			}
+
+			// Color never changes the text itself
+			var plainOut bytes.Buffer
+			plain := &UI{out: &plainOut, in: bufio.NewReader(strings.NewReader("")), interactive: true, lastPercent: -1}
+			plain.Progress(50, 100)
+			plain.FileProgress(1, 2, "omni.ja")
+			plain.Ask("Reboot now?", false)
+			if got := stripANSI(out.String()); got != plainOut.String() {
+				t.Errorf("Expected plain text %q, got %q", plainOut.String(), got)
+			}
+		})
+	}
+}
+
+// stripANSI removes escape sequences from s
+func stripANSI(s string) string {
+	for _, code := range []string{ansiReset, ansiBold, ansiGreen, ansiCyan} {
+		s = strings.ReplaceAll(s, code, "")
+	}
+	return s
+}
+
+func TestPipeIsNotTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if New(w, r, false, false).Interactive() {
+		t.Error("Expected a pipe not to be treated as a terminal")
+	}
+}
+
+func TestProgressPlainFallback(t *testing.T) {
+	var out bytes.Buffer
+	ui := &UI{out: &out, lastPercent: -1}
+
+	ui.Progress(50, 100)
+	ui.Progress(100, 100)
+	if out.Len() != 0 {
+		t.Errorf("Expected no progress output when not interactive, got %q", out.String())
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	var out bytes.Buffer
+	ui := &UI{out: &out, interactive: true, lastPercent: -1}
+
+	ui.Progress(50, 100)
+	if !strings.Contains(out.String(), " 50%") {
+		t.Errorf("Expected 50%% progress, got %q", out.String())
+	}
+
+	// The same percentage is not redrawn
+	out.Reset()
+	ui.Progress(50, 100)
+	if out.Len() != 0 {
+		t.Errorf("Expected no redraw, got %q", out.String())
+	}
+
+	ui.Progress(100, 100)
+	if !strings.Contains(out.String(), "100%") || !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("Expected a finished bar ending the line, got %q", out.String())
+	}
+}
+
+func TestFileProgress(t *testing.T) {
+	var out bytes.Buffer
+	ui := &UI{out: &out, interactive: true, lastPercent: -1}
+
+	ui.FileProgress(1, 3, "browser/omni.ja")
+	if !strings.HasPrefix(out.String(), "\r[1/3] browser/omni.ja") || strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("Expected an unfinished counter line, got %q", out.String())
+	}
+
+	// Long paths are shortened from the front
+	out.Reset()
+	long := strings.Repeat("d/", 40) + "omni.ja"
+	ui.FileProgress(2, 3, long)
+	if !strings.Contains(out.String(), "...") || !strings.HasSuffix(strings.TrimRight(out.String(), " "), "omni.ja") {
+		t.Errorf("Expected a shortened path, got %q", out.String())
+	}
+
+	out.Reset()
+	ui.FileProgress(3, 3, "noraneko.exe")
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("Expected the last file to end the line, got %q", out.String())
+	}
+
+	// Nothing is drawn when not interactive
+	out.Reset()
+	(&UI{out: &out}).FileProgress(1, 1, "noraneko.exe")
+	if out.Len() != 0 {
+		t.Errorf("Expected no output when not interactive, got %q", out.String())
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer    string
+		assumeYes bool
+		expected  bool
+	}{
+		{"\n", false, true},
+		{"y\n", false, true},
+		{"no\n", false, false},
+		{"N\n", false, false},
+		{"n\n", true, true},
+	}
+
+	for _, tt := range tests {
+		withTerminal(t, true)
+		ui := New(os.Stdout, strings.NewReader(tt.answer), false, tt.assumeYes)
+		ui.out = &bytes.Buffer{}
+		if got := ui.Confirm("1.0.0", "1.1.0"); got != tt.expected {
+			t.Errorf("answer %q assumeYes=%v: expected %v, got %v", tt.answer, tt.assumeYes, tt.expected, got)
+		}
+	}
+}
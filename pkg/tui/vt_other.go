@@ -0,0 +1,11 @@
+//go:build !windows
+
+package tui
+
+import "os"
+
+// enableColor reports whether the terminal f handles ANSI escape
+// sequences, which all supported terminals outside Windows do
+func enableColor(f *os.File) bool {
+	return true
+}
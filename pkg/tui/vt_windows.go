@@ -0,0 +1,30 @@
+//go:build windows
+
+package tui
+
+import (
+	"os"
+	"syscall"
+)
+
+var (
+	kernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procSetConsoleMode = kernel32.NewProc("SetConsoleMode")
+)
+
+const enableVirtualTerminalProcessing = 0x0004
+
+// enableColor turns on ANSI escape sequence handling for the console f
+// and reports whether it is available. Consoles older than Windows 10
+// do not support it.
+func enableColor(f *os.File) bool {
+	var mode uint32
+	if err := syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode); err != nil {
+		return false
+	}
+	if mode&enableVirtualTerminalProcessing != 0 {
+		return true
+	}
+	ok, _, _ := procSetConsoleMode.Call(f.Fd(), uintptr(mode|enableVirtualTerminalProcessing))
+	return ok != 0
+}
@@ -0,0 +1,163 @@
+package updater
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxExtractedSize limits the bytes an archive may expand to, so a
+// damaged or malicious archive cannot fill the disk
+const maxExtractedSize = 16 << 30
+
+// archiveFormat returns the archive format of an asset by its extension:
+// "zip", "tar.gz" or "7z", or "" if it is not an archive
+func archiveFormat(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".7z"):
+		return "7z"
+	}
+	return ""
+}
+
+// extractArchive extracts the archive at src, of the format its name
+// tells, to dest
+func (u *Updater) extractArchive(src, dest string) error {
+	switch format := archiveFormat(src); format {
+	case "zip":
+		return u.unzip(src, dest)
+	case "tar.gz":
+		return untarGz(src, dest)
+	case "7z":
+		return un7z(src, dest)
+	default:
+		return fmt.Errorf("unsupported archive type %s, expected .zip, .tar.gz or .7z", filepath.Ext(src))
+	}
+}
+
+// archiveWriter writes the entries of an archive below a destination
+// directory. It rejects paths outside of it, links and special files, and
+// archives that expand beyond maxExtractedSize.
+type archiveWriter struct {
+	dest    string
+	written int64
+}
+
+// newArchiveWriter returns an archiveWriter extracting to dest
+func newArchiveWriter(dest string) *archiveWriter {
+	return &archiveWriter{dest: filepath.Clean(dest)}
+}
+
+// path returns where the archive entry name is extracted to
+func (w *archiveWriter) path(name string) (string, error) {
+	// Clean the file name from the archive to prevent path traversal
+	cleanName := filepath.Clean(filepath.FromSlash(name))
+	if strings.HasPrefix(cleanName, "..") || filepath.IsAbs(cleanName) || filepath.VolumeName(cleanName) != "" {
+		return "", fmt.Errorf("illegal file path in archive: %s", name)
+	}
+
+	// Prevent ZipSlip vulnerability
+	fpath := filepath.Join(w.dest, cleanName)
+	if !strings.HasPrefix(filepath.Clean(fpath), w.dest+string(os.PathSeparator)) && filepath.Clean(fpath) != w.dest {
+		return "", fmt.Errorf("illegal file path: %s", fpath)
+	}
+	return longPath(fpath), nil
+}
+
+// dir creates the directory entry name
+func (w *archiveWriter) dir(name string) error {
+	fpath, err := w.path(name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(fpath, os.ModePerm)
+}
+
+// file writes the file entry name with the content of r. size is the
+// size the archive lists for the entry, or -1 if it lists none.
+func (w *archiveWriter) file(name string, mode os.FileMode, size int64, r io.Reader) error {
+	if !mode.IsRegular() {
+		return fmt.Errorf("archive entry %s is not a regular file (%v)", name, mode.Type())
+	}
+	fpath, err := w.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
+		return err
+	}
+
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(outFile, io.LimitReader(r, maxExtractedSize-w.written+1))
+	outFile.Close()
+	if err != nil {
+		return err
+	}
+
+	w.written += n
+	if w.written > maxExtractedSize {
+		return fmt.Errorf("archive expands to more than %d bytes", int64(maxExtractedSize))
+	}
+	if size >= 0 && n != size {
+		return fmt.Errorf("archive entry %s has %d bytes, expected %d", name, n, size)
+	}
+	return nil
+}
+
+// untarGz extracts a gzip compressed tar archive. PAX headers, which
+// GitHub source tarballs start with, are skipped.
+func untarGz(src, dest string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	w := newArchiveWriter(dest)
+	tr := tar.NewReader(zr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = w.dir(header.Name)
+		case tar.TypeReg:
+			err = w.file(header.Name, header.FileInfo().Mode(), header.Size, tr)
+		case tar.TypeXGlobalHeader, tar.TypeXHeader:
+			// PAX metadata, such as the commit ID git archive writes
+		default:
+			err = fmt.Errorf("archive entry %s is not a regular file or directory", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
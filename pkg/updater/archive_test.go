@@ -0,0 +1,270 @@
+package updater
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// sample7z holds 7z archives made by bsdtar with each supported method.
+// They hold app/noraneko.exe, app/sub/data.txt, the empty file
+// app/sub/blank.txt and the empty directory app/empty; the LZMA ones
+// have a packed header.
+var sample7z = map[string]string{
+	"lzma":    "N3q8ryccAAPtb9MixwAAAAAAAAAiAAAAAAAAABRwhwMANBlJ7o3pBhLsfVusa5FHy/vMJaf//49UAAAAAIEzB64Pz7XvEA/r6p4BDWIDjdNMQj8OdlN5R7yHOmVRyYN9fDH2++gnRoLZTGWoRSOF7rxvEm8w/DdQTz/32WlDYk+9nFCPN4cBGIedpnRSnzL7MglqmXXRIdQKsr6S3IyJKhxEx9SGo6n3YiMF+SPfz7eUroPhCZUv5cU/hCTO+aLQPDToicB+7ZLyLFM8Lai5h1glf/W/z7SgVXEDHMgQJjhsz//515AAFwYbAQmArAAHCwEAASMDAQEFXQAAgAAMgYUKAUpz7zMAAA==",
+	"lzma2":   "N3q8ryccAAMJovIwuQAAAAAAAAAcAAAAAAAAAHvjEVUBAA9oZWxsbyA3egpuZXN0ZWQKAOABfgCdXQAAgTMHrg/PObAMB8hDf0GIm4il7fglULOUX+FDaDMzTBeHedojfK2MMdvE+yTdaBvvhhYj20lmu/xAK679VPdlkDN3VhIx7kyDvTnCwTpD9bNs86YUDnGfR8Npn1Da1tw8CtdFFiaeKdYFvupiO/ExDsm9qytUjTAeLQUulBH871hoEKQUrMtx5WCnyokOwmgNfQQRlnCBAxONAAAAABcGFAEJgKUABwsBAAEhIQEWDIF/CgFjConLAAA=",
+	"copy":    "N3q8ryccAAOa43IAEAAAAAAAAAB+AQAAAAAAAFIzVItoZWxsbyA3egpuZXN0ZWQKAQQGAAIJCQcABwsCAAEBAAEBAAwJBwAICgGotOgFjZWr6wAABQYOATwPAYARgJUAYQBwAHAALwBuAG8AcgBhAG4AZQBrAG8ALgBlAHgAZQAAAGEAcABwAC8AcwB1AGIALwBkAGEAdABhAC4AdAB4AHQAAABhAHAAcAAvAHMAdQBiAC8AYgBsAGEAbgBrAC4AdAB4AHQAAABhAHAAcAAvAGUAbQBwAHQAeQAAAGEAcABwAC8AcwB1AGIAAABhAHAAcAAAABQyAQBfGDwMZF3dAV8YPAxkXd0BXxg8DGRd3QF4EzsMZF3dAV8YPAxkXd0BeBM7DGRd3QESMgEAXxg8DGRd3QFfGDwMZF3dAV8YPAxkXd0BeBM7DGRd3QFfGDwMZF3dAXgTOwxkXd0BEzIBAPhLPAxkXd0B+Es8DGRd3QFfGDwMZF3dAfhLPAxkXd0B+Es8DGRd3QH4SzwMZF3dARUaAQAggKSBIICkgSCApIEQgO1BEIDtQRCA7UEAAA==",
+	"deflate": "N3q8ryccAAPD6mzsuAAAAAAAAAAiAAAAAAAAAJSdxIfLSM3JyVcwr+LKSy0uSU3hAgAAAIEzB64PzxYxDAfIQ2wC14U6GJeD4zRhV4L0oAswChVYNlMt+4lfgoDWaAKO31KJzGwu+OUnyw8jzlrDNMCUAraPeJJl5mJpi9fGdm0NCun6+PFJ+GdCE87Dr1rnB4lUKHeytMns5GJaH45fSkWBWEjJzwbQ86nGK/Iut58JdrjICRAsb76piRW1H4YUOeTOQfh3IX9bomn1I+Vz97uVFX/9rMwAFwYSAQmApgAHCwEAASMDAQEFXQAAgAAMgX8KAS4hFsUAAA==",
+	"bzip2":   "N3q8ryccAAM/c95I4AAAAAAAAAAiAAAAAAAAAEjK6fRCWmg2MUFZJlNZL7eSzQAABFmAABBAAACABkWMECAAMQNA0CA0BpB0Uc7Bzs5Pi7kinChIF9vJZoAAAIEzB64P0YkKnKCQoHJD1LHihMlw8oLKcZgCBiXXxZewC32TfSSfWRMFAqrgALvOUBtL8p/rLsvOq1Qm5egNsFIaCid0KFYP4nlVVSldTeUzvzM/HmYeUbivN2zKehcMtKcjeyKTMDyBoVPyjnWfEYdag3Cdje6/XPDZwJyJo3iKo9o0yGw5S2EaI97YYR8+C8gp6JX9I6s4Ou35p+pYWV//uiwAABcGOQEJgKcABwsBAAEjAwEBBV0AAIAADIF/CgFTXotFAAA=",
+	// The files above and the symbolic link app/link
+	"symlink": "N3q8ryccAAPtHhDf6gAAAAAAAAAiAAAAAAAAAM4um0EANBlJ7o3pBhLsfVvwWvI/4HyVPvids37G8uSXyslhX83//slEAAAAgTMHrg/QaX28nz9HQVz2ZxwWBTX1snatYA45yN6pIE/OLYFYQrQg/mRlHPS2w6WySSNzGIN+blT0yYKArQMvmLv4APDLfu7OAc/YL+RMz83jCvOK9eFS2bgLGPSmE0r0gK50wqUCypL+SpRRhekhrFinrzrSrWnsDwFJroaCTRmVKMSnulSb1+DkMSyzA+dqZ6WSZZeEVyXLjHKUacjuG73Skr3RWGv3iD7b9JJql3v1+R8ddr+Lw0zJljlV//7J/AAXBiYBCYDEAAcLAQABIwMBAQVdAACAAAyBuAoBdfKCFwAA",
+}
+
+// sampleGitArchive is a tar.gz made by git archive of the sample files but
+// the empty directory, which starts with a pax_global_header entry
+// holding the commit ID
+const sampleGitArchive = "H4sIAAAAAAACA+3X0WqDMBQG4FzvKfoEXRKTk/Wiz1KOJrZQa0RTkD39su1O6TbGdKz7v5uICYj8nF/seDwcm1hyczgF9qEXP09mRPS2ZtM1bxqhDClTyOL9vjJWKnEUK7gOifv8yD7G9NG5z/anL/dHWL2p4uUS2rSnsgxPBXvjJe1YUSVtvXNktKoKL+tQ7yw5zf5BwN3grntc+hmv8+CcvT3/+Xoy/4q0FRbzv0r+bey5Dee4DWNYKn/KHX8zf6Vm/a+KfB75L+4UmiZu3DNK/f/2/3AtF/0GfKP/tVGE/l8x/7Lh9rxNY/qN/p/nbzT6f9X8PSdeKP4v5O9m+UuyyH8FbRhSwC8dAAAAAAAAAAAAAMBdeQGi6lH/ACgAAA=="
+
+// sampleFiles is the content of the sample archives
+var sampleFiles = map[string]string{
+	"app/noraneko.exe":  "hello 7z\n",
+	"app/sub/data.txt":  "nested\n",
+	"app/sub/blank.txt": "",
+	"app/empty/":        "",
+}
+
+func decodeSample7z(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := base64.StdEncoding.DecodeString(sample7z[name])
+	if err != nil {
+		t.Fatalf("Failed to decode the %s sample: %v", name, err)
+	}
+	return data
+}
+
+// makeTestTarGz builds a gzip compressed tar archive; names ending in a
+// slash are directories
+func makeTestTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(name, "/") {
+			header.Mode, header.Typeflag = 0755, tar.TypeDir
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to add %s to tar: %v", name, err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write %s to tar: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to finish tar: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to finish gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// extractTestArchive writes data to a file of the given name and extracts
+// it to a new directory, which it returns
+func extractTestArchive(t *testing.T, name string, data []byte) (string, error) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, name)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	dest := filepath.Join(tmpDir, "extract")
+	u := &Updater{}
+	return dest, u.extractArchive(src, dest)
+}
+
+func TestExtractArchive(t *testing.T) {
+	archives := map[string][]byte{
+		"app.zip":    makeTestZip(t, sampleFiles),
+		"app.tar.gz": makeTestTarGz(t, sampleFiles),
+		"app.tgz":    makeTestTarGz(t, sampleFiles),
+	}
+	for method := range sample7z {
+		if method != "symlink" {
+			archives["app-"+method+".7z"] = decodeSample7z(t, method)
+		}
+	}
+
+	for name, data := range archives {
+		dest, err := extractTestArchive(t, name, data)
+		if err != nil {
+			t.Errorf("%s: failed to extract: %v", name, err)
+			continue
+		}
+		for file, want := range sampleFiles {
+			path := filepath.Join(dest, filepath.FromSlash(file))
+			if strings.HasSuffix(file, "/") {
+				if info, err := os.Stat(path); err != nil || !info.IsDir() {
+					t.Errorf("%s: expected the directory %s: %v", name, file, err)
+				}
+				continue
+			}
+			got, err := os.ReadFile(path)
+			if err != nil || string(got) != want {
+				t.Errorf("%s: expected %s to hold %q, got %q (%v)", name, file, want, got, err)
+			}
+		}
+	}
+}
+
+func TestExtractGitArchive(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(sampleGitArchive)
+	if err != nil {
+		t.Fatalf("Failed to decode the git archive sample: %v", err)
+	}
+	dest, err := extractTestArchive(t, "app.tar.gz", data)
+	if err != nil {
+		t.Fatalf("Failed to extract the git archive: %v", err)
+	}
+	for file, want := range sampleFiles {
+		if strings.HasSuffix(file, "/") {
+			continue
+		}
+		got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(file)))
+		if err != nil || string(got) != want {
+			t.Errorf("Expected %s to hold %q, got %q (%v)", file, want, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "pax_global_header")); !os.IsNotExist(err) {
+		t.Errorf("Expected the pax global header not to be extracted, got %v", err)
+	}
+}
+
+func TestExtractArchiveRejectsUnsafeEntries(t *testing.T) {
+	var symlinkTar bytes.Buffer
+	zw := gzip.NewWriter(&symlinkTar)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: "app/link", Linkname: "../../evil.txt", Typeflag: tar.TypeSymlink}); err != nil {
+		t.Fatalf("Failed to add the link to tar: %v", err)
+	}
+	tw.Close()
+	zw.Close()
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"slip.tar.gz", makeTestTarGz(t, map[string]string{"../evil.txt": "evil"}), "illegal file path"},
+		{"slip.zip", makeTestZip(t, map[string]string{"../evil.txt": "evil"}), "illegal file path"},
+		{"link.tar.gz", symlinkTar.Bytes(), "not a regular file"},
+		{"link.7z", decodeSample7z(t, "symlink"), "not a regular file"},
+		{"app.rar", []byte("Rar!"), "unsupported archive type .rar"},
+	}
+
+	for _, tt := range tests {
+		dest, err := extractTestArchive(t, tt.name, tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dest), "evil.txt")); err == nil {
+			t.Errorf("%s: a file was written outside of the destination", tt.name)
+		}
+	}
+}
+
+func TestExtract7zDamaged(t *testing.T) {
+	// Change the stored content of app/noraneko.exe
+	data := decodeSample7z(t, "copy")
+	data[32] ^= 0xFF
+	if _, err := extractTestArchive(t, "app.7z", data); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Expected a checksum mismatch, got %v", err)
+	}
+
+	// Truncated archives are detected from the header
+	data = decodeSample7z(t, "lzma")
+	if _, err := extractTestArchive(t, "app.7z", data[:len(data)-10]); err == nil {
+		t.Error("Expected an error for a truncated archive")
+	}
+}
+
+func TestSevenZipDictCap(t *testing.T) {
+	// A 4 GB dictionary is shrunk to small unpacked data
+	lzma2 := szCoder{id: szLZMA2, props: []byte{40}}
+	if _, err := newCoderReader(lzma2, bytes.NewReader(nil), 1024); err != nil {
+		t.Errorf("Expected the dictionary to shrink to the data, got %v", err)
+	}
+	// but refused when the data claims to be as large
+	if _, err := newCoderReader(lzma2, bytes.NewReader(nil), 1<<40); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("Expected LZMA2 to refuse the dictionary, got %v", err)
+	}
+	lzma1 := szCoder{id: szLZMA, props: []byte{0x5D, 0xFF, 0xFF, 0xFF, 0xFF}}
+	if _, err := newCoderReader(lzma1, bytes.NewReader(nil), 1<<40); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+		t.Errorf("Expected LZMA to refuse the dictionary, got %v", err)
+	}
+}
+
+// FuzzUn7z feeds damaged archives to the 7z reader, which must fail
+// rather than panic, hang or allocate without bound. The samples and
+// testdata/fuzz/FuzzUn7z make up the corpus.
+func FuzzUn7z(f *testing.F) {
+	for _, sample := range sample7z {
+		data, err := base64.StdEncoding.DecodeString(sample)
+		if err != nil {
+			f.Fatalf("Failed to decode a sample: %v", err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		z, err := openSevenZip(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return
+		}
+		z.extract(func(f *sevenZipFile, r io.Reader) error {
+			_, err := io.Copy(io.Discard, io.LimitReader(r, 64<<20))
+			return err
+		})
+	})
+}
+
+func TestBCJReader(t *testing.T) {
+	// x86 code with calls and jumps to relative addresses, filtered and
+	// compressed with: xz --format=raw --x86 --lzma2=dict=4KiB
+	code := make([]byte, 1024)
+	for i := 0; i < len(code); i += 16 {
+		code[i] = 0xE9
+		if i%32 == 0 {
+			code[i] = 0xE8
+		}
+		binary.LittleEndian.PutUint32(code[i+1:], uint32(int32(i*37%5000-2500)))
+		for j := 5; j < 16; j++ {
+			code[i+j] = 0x90
+		}
+	}
+	filtered, _ := base64.StdEncoding.DecodeString("4AP/AKpdAHQQWs/8gvd2Xr2TtBjxr0aT9i/In9J5e89xpG6ggV0HbQnOy1J6CxtzrIRO02MXWBklZ/FAENHu93arpYeboNTHVxNni8pG4OSN0mtukifJyLnyWSxPZ6i6UG7rBorjQ2i9qB3RuLIkQCpe7qkpXN20bmWT7Ilf35XEk4wRPwxdMfscL1689XHhprRaOWw0xCXWRhZCJgYFKZAEERla+ZZb4AHFbwY4uzQAAA==")
+
+	r, err := lzma.Reader2Config{DictCap: lzma.MinDictCap}.NewReader2(bytes.NewReader(filtered))
+	if err != nil {
+		t.Fatalf("Failed to read the LZMA2 stream: %v", err)
+	}
+	// Single byte reads exercise instructions that span reads
+	got, err := io.ReadAll(newBCJReader(iotest.OneByteReader(r)))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if !bytes.Equal(got, code) {
+		t.Errorf("Decoded code differs from the original")
+	}
+}
@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveSourceDir returns the folder of an extracted portable archive
+// whose content is installed: ArchiveRoot if set, otherwise the folder
+// ArchiveRootStrip levels down, or the first folder by default
+func (u *Updater) archiveSourceDir(extractDir string) (string, error) {
+	if u.cfg.ArchiveRoot != "" {
+		return findArchiveRoot(extractDir, u.cfg.ArchiveRoot)
+	}
+	if u.cfg.ArchiveRootStrip >= 0 {
+		return stripArchiveRoot(extractDir, u.cfg.ArchiveRootStrip)
+	}
+
+	entries, err := os.ReadDir(extractDir)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			// Use the first directory as the source
+			return filepath.Join(extractDir, entry.Name()), nil
+		}
+	}
+	return extractDir, nil
+}
+
+// findArchiveRoot returns the single folder below extractDir matching the
+// slash-separated pattern
+func findArchiveRoot(extractDir, pattern string) (string, error) {
+	matches, err := filepath.Glob(filepath.Join(extractDir, filepath.FromSlash(pattern)))
+	if err != nil {
+		return "", fmt.Errorf("invalid ArchiveRoot %q: %w", pattern, err)
+	}
+
+	var dirs []string
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.IsDir() {
+			dirs = append(dirs, m)
+		}
+	}
+	switch len(dirs) {
+	case 0:
+		return "", fmt.Errorf("ArchiveRoot %s is not a folder of the archive", pattern)
+	case 1:
+		return dirs[0], nil
+	}
+	names := make([]string, len(dirs))
+	for i, d := range dirs {
+		names[i], _ = filepath.Rel(extractDir, d)
+		names[i] = filepath.ToSlash(names[i])
+	}
+	return "", fmt.Errorf("ArchiveRoot %s matches several folders: %s", pattern, strings.Join(names, ", "))
+}
+
+// stripArchiveRoot descends levels folders into extractDir. Each level
+// must hold a single folder; files next to it are not installed.
+func stripArchiveRoot(extractDir string, levels int) (string, error) {
+	dir := extractDir
+	for level := 1; level <= levels; level++ {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+		var sub string
+		var files int
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files++
+				continue
+			}
+			if sub != "" {
+				return "", fmt.Errorf("cannot strip %d folders from the archive: level %d has more than one folder", levels, level)
+			}
+			sub = entry.Name()
+		}
+		if sub == "" {
+			return "", fmt.Errorf("cannot strip %d folders from the archive: level %d has no folder", levels, level)
+		}
+		if files > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: ArchiveRootStrip skips %d files next to %s\n", files, sub)
+		}
+		dir = filepath.Join(dir, sub)
+	}
+	return dir, nil
+}
@@ -0,0 +1,110 @@
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestExtractPortableArchiveRoot(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		strip int
+		root  string
+	}{
+		{
+			name:  "flat archive",
+			files: map[string]string{"noraneko.exe": "exe", "browser/omni.ja": "omni"},
+			strip: 0,
+		},
+		{
+			name:  "nested core folder",
+			files: map[string]string{"noraneko/core/noraneko.exe": "exe", "noraneko/core/browser/omni.ja": "omni", "noraneko/README.txt": "readme"},
+			strip: 2,
+		},
+		{
+			name:  "root glob",
+			files: map[string]string{"noraneko-2.0.0/core/noraneko.exe": "exe", "noraneko-2.0.0/core/browser/omni.ja": "omni", "noraneko-2.0.0/tools/x.exe": "x"},
+			strip: -1,
+			root:  "noraneko-*/core",
+		},
+		{
+			name:  "root overrides strip",
+			files: map[string]string{"dist/noraneko.exe": "exe", "dist/browser/omni.ja": "omni"},
+			strip: 5,
+			root:  "dist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newPortableInstall(t, "1.0.0")
+			cfg.ArchiveRootStrip = tt.strip
+			cfg.ArchiveRoot = tt.root
+
+			zipPath := filepath.Join(cfg.WorkDir, "portable.zip")
+			if err := os.WriteFile(zipPath, makeTestZip(t, tt.files), 0644); err != nil {
+				t.Fatalf("Failed to write zip: %v", err)
+			}
+
+			u := New(cfg, Options{Portable: true})
+			if err := u.extractPortable(context.Background(), zipPath); err != nil {
+				t.Fatalf("Extraction failed: %v", err)
+			}
+
+			installDir := filepath.Join(cfg.ExeDir, config.BrowserName)
+			for _, name := range []string{"noraneko.exe", "browser/omni.ja"} {
+				if _, err := os.Stat(filepath.Join(installDir, filepath.FromSlash(name))); err != nil {
+					t.Errorf("Expected %s at the top of the install: %v", name, err)
+				}
+			}
+			for _, name := range []string{"core", "README.txt", "tools"} {
+				if _, err := os.Stat(filepath.Join(installDir, name)); err == nil {
+					t.Errorf("Expected %s outside the archive root to be skipped", name)
+				}
+			}
+		})
+	}
+}
+
+func TestArchiveSourceDirErrors(t *testing.T) {
+	extractDir := t.TempDir()
+	for _, dir := range []string{"noraneko-a/core", "noraneko-b/core"} {
+		if err := os.MkdirAll(filepath.Join(extractDir, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	tests := []struct {
+		strip int
+		root  string
+		want  string
+	}{
+		{strip: 1, want: "more than one folder"},
+		{strip: -1, root: "noraneko-*/core", want: "matches several folders: noraneko-a/core, noraneko-b/core"},
+		{strip: -1, root: "noraneko-a/missing", want: "is not a folder"},
+	}
+	for _, tt := range tests {
+		cfg := newPortableInstall(t, "1.0.0")
+		cfg.ArchiveRootStrip = tt.strip
+		cfg.ArchiveRoot = tt.root
+
+		u := New(cfg, Options{Portable: true})
+		if _, err := u.archiveSourceDir(extractDir); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Expected an error containing %q for strip %d and root %q, got %v", tt.want, tt.strip, tt.root, err)
+		}
+	}
+
+	// Stripping past the last folder fails too
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.ArchiveRootStrip = 3
+	u := New(cfg, Options{Portable: true})
+	if _, err := u.archiveSourceDir(filepath.Join(extractDir, "noraneko-a")); err == nil || !strings.Contains(err.Error(), "level 2 has no folder") {
+		t.Errorf("Expected an error for a level without folders, got %v", err)
+	}
+}
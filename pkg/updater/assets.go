@@ -0,0 +1,370 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// goarch is the architecture assets are selected for
+var goarch = runtime.GOARCH
+
+// archTokens lists the name fragments that identify a build for each
+// architecture
+var archTokens = []struct {
+	arch   string
+	tokens []string
+}{
+	{"amd64", []string{"x86_64", "x64", "win64", "amd64"}},
+	{"386", []string{"i686", "win32"}},
+	{"arm64", []string{"aarch64", "arm64"}},
+}
+
+// sleep waits before an incomplete release is fetched again, the
+// installed version is read again or a webhook is retried, overridable
+// for tests
+var sleep = time.Sleep
+
+// IncompleteReleaseError is returned when a release has no assets yet,
+// which usually means it is still being published
+type IncompleteReleaseError struct {
+	Tag string
+}
+
+func (e *IncompleteReleaseError) Error() string {
+	return fmt.Sprintf("release %s has no assets yet, it may still be publishing; try again later", e.Tag)
+}
+
+// FlavorMismatchError is returned when portable mode is requested but the
+// best asset of the release is an installer, and AllowFlavorFallback is not
+// set
+type FlavorMismatchError struct {
+	Tag   string
+	Asset string
+}
+
+func (e *FlavorMismatchError) Error() string {
+	return fmt.Sprintf("release %s has no portable asset, only the installer %s; use -allow-flavor-fallback to install it instead", e.Tag, e.Asset)
+}
+
+// windowsRe matches "win", "windows", "win32" or "win64" as a separate word,
+// so names like "darwin" are not mistaken for Windows builds
+var windowsRe = regexp.MustCompile(`(^|[^a-z])win(dows|32|64)?([^a-z]|$)`)
+
+// flavorContentTypes are the asset content types expected for each flavor,
+// used to break ties between assets that score the same
+var flavorContentTypes = map[bool][]string{
+	true:  {"application/zip", "application/x-zip-compressed"},
+	false: {"application/x-msdownload", "application/vnd.microsoft.portable-executable"},
+}
+
+// AssetMatch is the result of scoring a release asset against the current
+// architecture and install flavor
+type AssetMatch struct {
+	Asset *Asset
+	// Candidate is false if the asset cannot be used at all
+	Candidate bool
+	// Score ranks candidates by the [AssetPreference] weights, it may be
+	// zero or negative
+	Score   int
+	Reasons []string
+	// FlavorMismatch is set if the asset is not of the requested flavor
+	FlavorMismatch bool
+	// ContentTypeMatch is set if the asset's content type is the one of
+	// the requested flavor, which breaks ties between equal scores
+	ContentTypeMatch bool
+}
+
+// archName returns the architecture name used in canonical asset names
+func archName() string {
+	switch goarch {
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	default:
+		return "x86_64"
+	}
+}
+
+// scoreAsset rates how well an asset fits this platform and flavor, using
+// the given weights
+func scoreAsset(asset *Asset, portable bool, weights config.AssetWeights) AssetMatch {
+	m := AssetMatch{Asset: asset}
+	name := strings.ToLower(asset.Name)
+
+	isArchive := archiveFormat(name) != ""
+	isInstaller := strings.HasSuffix(name, ".exe") || strings.HasSuffix(name, ".msi")
+	if !isArchive && !isInstaller {
+		m.Reasons = append(m.Reasons, "not an archive, .exe or .msi")
+		return m
+	}
+
+	if !windowsRe.MatchString(name) {
+		m.Reasons = append(m.Reasons, "not a Windows build")
+		return m
+	}
+	score := weights.Windows
+	m.Reasons = append(m.Reasons, "Windows build")
+
+	// Reject builds for other architectures, reward ours
+	for _, a := range archTokens {
+		if a.arch == goarch {
+			continue
+		}
+		for _, token := range a.tokens {
+			if strings.Contains(name, token) {
+				m.Reasons = append(m.Reasons, "built for "+a.arch)
+				return m
+			}
+		}
+	}
+	for _, a := range archTokens {
+		if a.arch != goarch {
+			continue
+		}
+		for _, token := range a.tokens {
+			if strings.Contains(name, token) {
+				score += weights.Arch
+				m.Reasons = append(m.Reasons, "matches "+goarch)
+				break
+			}
+		}
+	}
+
+	// Prefer the requested flavor, but keep the other as a fallback
+	if isArchive == portable {
+		score += weights.Flavor
+		if portable {
+			m.Reasons = append(m.Reasons, "portable flavor")
+		} else {
+			m.Reasons = append(m.Reasons, "installer flavor")
+		}
+	} else {
+		m.FlavorMismatch = true
+		m.Reasons = append(m.Reasons, "flavor mismatch")
+	}
+
+	var canonical string
+	if portable {
+		canonical = fmt.Sprintf("windows-%s-portable.zip", archName())
+	} else {
+		canonical = fmt.Sprintf("windows-%s-setup.exe", archName())
+	}
+	if strings.HasSuffix(name, canonical) {
+		score += weights.CanonicalName
+		m.Reasons = append(m.Reasons, "canonical name")
+	}
+
+	// .tar.gz and .7z archives get no format bonus, so a .zip wins
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		score += weights.Zip
+	case strings.HasSuffix(name, ".exe"):
+		score += weights.Exe
+	case strings.HasSuffix(name, ".msi"):
+		score += weights.Msi
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(asset.ContentType, ";")[0]))
+	for _, t := range flavorContentTypes[portable] {
+		if mediaType == t {
+			m.ContentTypeMatch = true
+			m.Reasons = append(m.Reasons, "content type "+t)
+			break
+		}
+	}
+
+	m.Candidate = true
+	m.Score = score
+	return m
+}
+
+// matchAssets scores every asset of the current release. A configuration
+// without any weights, as built in code rather than loaded, uses the
+// default weights.
+func (u *Updater) matchAssets() []AssetMatch {
+	isPortable := u.isPortable()
+	weights := u.cfg.AssetWeights
+	if weights == (config.AssetWeights{}) {
+		weights = config.DefaultAssetWeights
+	}
+
+	matches := make([]AssetMatch, 0, len(u.release.Assets))
+	for i := range u.release.Assets {
+		matches = append(matches, scoreAsset(&u.release.Assets[i], isPortable, weights))
+	}
+	return matches
+}
+
+// findAsset finds the appropriate download asset for this platform. Of
+// assets with the same score, one whose content type fits the flavor
+// wins. In portable mode an installer is only used with
+// AllowFlavorFallback, which is recorded for the run result. Installs may
+// still use a portable zip, which is extracted over the install. An asset
+// named in the options is used as it is.
+func (u *Updater) findAsset() (*Asset, error) {
+	u.flavorFallback = false
+	if len(u.release.Assets) == 0 {
+		return nil, &IncompleteReleaseError{Tag: u.release.TagName}
+	}
+	if u.opts.Asset != "" {
+		return u.namedAsset(u.opts.Asset)
+	}
+
+	var best *AssetMatch
+	matches := u.matchAssets()
+	for i := range matches {
+		m := &matches[i]
+		if !m.Candidate {
+			continue
+		}
+		if best == nil || m.Score > best.Score ||
+			(m.Score == best.Score && m.ContentTypeMatch && !best.ContentTypeMatch) {
+			best = m
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("no suitable download found for this platform")
+	}
+	if best.FlavorMismatch && u.isPortable() {
+		if !u.opts.AllowFlavorFallback {
+			return nil, &FlavorMismatchError{Tag: u.release.TagName, Asset: best.Asset.Name}
+		}
+		u.flavorFallback = true
+	}
+	return best.Asset, nil
+}
+
+// namedAsset returns the release asset named name, or else the only one
+// matching name as a glob pattern. The asset is extracted if it is a zip
+// and run as an installer if it is an .exe or .msi, whatever the platform
+// and flavor.
+func (u *Updater) namedAsset(name string) (*Asset, error) {
+	var matches []*Asset
+	for i := range u.release.Assets {
+		asset := &u.release.Assets[i]
+		if asset.Name == name {
+			matches = []*Asset{asset}
+			break
+		}
+		ok, err := path.Match(name, asset.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset pattern %q: %w", name, err)
+		}
+		if ok {
+			matches = append(matches, asset)
+		}
+	}
+
+	var names []string
+	if len(matches) == 0 {
+		for _, asset := range u.release.Assets {
+			names = append(names, asset.Name)
+		}
+		return nil, fmt.Errorf("release %s has no asset matching %q (assets: %s)", u.release.TagName, name, strings.Join(names, ", "))
+	}
+	if len(matches) > 1 {
+		for _, asset := range matches {
+			names = append(names, asset.Name)
+		}
+		return nil, fmt.Errorf("asset pattern %q matches several assets of release %s: %s", name, u.release.TagName, strings.Join(names, ", "))
+	}
+
+	asset := matches[0]
+	lower := strings.ToLower(asset.Name)
+	if archiveFormat(lower) == "" && !strings.HasSuffix(lower, ".exe") && !strings.HasSuffix(lower, ".msi") {
+		return nil, fmt.Errorf("asset %s is not an archive, .exe or .msi", asset.Name)
+	}
+	return asset, nil
+}
+
+// findAssetWithRetry finds the download asset like findAsset. If the
+// release has no assets yet and AssetRetryDelay is set, the release is
+// fetched once more after the delay, unless ctx is done first.
+func (u *Updater) findAssetWithRetry(ctx context.Context) (*Asset, error) {
+	asset, err := u.findAsset()
+	var incomplete *IncompleteReleaseError
+	if !errors.As(err, &incomplete) || u.cfg.AssetRetryDelay <= 0 {
+		return asset, err
+	}
+
+	fmt.Fprintf(u.out, "Release %s has no assets yet, retrying in %d seconds...\n", incomplete.Tag, u.cfg.AssetRetryDelay)
+	if err := sleepContext(ctx, time.Duration(u.cfg.AssetRetryDelay)*time.Second); err != nil {
+		return nil, err
+	}
+
+	release, err := u.getLatestRelease(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest release: %w", err)
+	}
+	u.release = release
+	return u.findAsset()
+}
+
+// DumpAssetMatch fetches the latest release and prints every asset with
+// its score and the reasons behind it, marking the one that would be used
+func (u *Updater) DumpAssetMatch(w io.Writer) error {
+	release, err := u.getLatestRelease(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get latest release: %w", err)
+	}
+	u.release = release
+
+	isPortable := u.isPortable()
+	flavor := "installer"
+	if isPortable {
+		flavor = "portable"
+	}
+	fmt.Fprintf(w, "Release %s, arch %s, flavor %s\n", release.TagName, goarch, flavor)
+
+	selected, err := u.findAsset()
+	for _, m := range u.matchAssets() {
+		marker := " "
+		if selected != nil && m.Asset == selected {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %4d  %s (%s)\n", marker, m.Score, m.Asset.Name, strings.Join(m.Reasons, ", "))
+	}
+
+	var mismatch *FlavorMismatchError
+	switch {
+	case len(release.Assets) == 0:
+		fmt.Fprintln(w, "Release has no assets yet, it may still be publishing.")
+	case errors.As(err, &mismatch):
+		fmt.Fprintf(w, "No portable asset found, -allow-flavor-fallback would use %s.\n", mismatch.Asset)
+	case selected == nil:
+		fmt.Fprintln(w, "No suitable asset found.")
+	}
+	return nil
+}
+
+// PrintURL fetches the latest release and prints the download URL of the
+// asset an update would use, followed by the URL of its checksum file if
+// the release has one
+func (u *Updater) PrintURL(w io.Writer) error {
+	release, err := u.getLatestRelease(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get latest release: %w", err)
+	}
+	u.release = release
+
+	asset, err := u.findAsset()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, asset.BrowserDownloadURL)
+	if checksum := u.findChecksumAsset(); checksum != nil {
+		fmt.Fprintln(w, checksum.BrowserDownloadURL)
+	}
+	return nil
+}
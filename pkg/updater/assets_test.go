@@ -0,0 +1,507 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// withArch overrides the architecture assets are selected for
+func withArch(t *testing.T, arch string) {
+	t.Helper()
+	orig := goarch
+	goarch = arch
+	t.Cleanup(func() { goarch = orig })
+}
+
+func TestScoreAsset(t *testing.T) {
+	withArch(t, "amd64")
+
+	tests := []struct {
+		name      string
+		portable  bool
+		candidate bool
+	}{
+		{"noraneko-1.0.0-linux-x86_64.tar.gz", true, false},
+		{"noraneko-1.0.0-darwin-x86_64.zip", true, false},
+		{"noraneko-1.0.0-windows-i686-portable.zip", true, false},
+		{"noraneko-1.0.0-windows-aarch64-setup.exe", false, false},
+		{"noraneko-1.0.0-windows-x86_64-portable.zip", true, true},
+		{"noraneko-1.0.0-win64.zip", true, true},
+		{"noraneko-1.0.0-windows-x86_64-setup.exe", true, true},
+	}
+
+	for _, tt := range tests {
+		m := scoreAsset(&Asset{Name: tt.name}, tt.portable, config.DefaultAssetWeights)
+		if m.Candidate != tt.candidate {
+			t.Errorf("scoreAsset(%s) = %d (%v), expected candidate=%v", tt.name, m.Score, m.Reasons, tt.candidate)
+		}
+	}
+
+	// The requested flavor outranks the other one
+	zip := scoreAsset(&Asset{Name: "noraneko-windows-x86_64-portable.zip"}, true, config.DefaultAssetWeights)
+	exe := scoreAsset(&Asset{Name: "noraneko-windows-x86_64-setup.exe"}, true, config.DefaultAssetWeights)
+	if zip.Score <= exe.Score {
+		t.Errorf("Expected portable zip (%d) to outrank setup (%d) in portable mode", zip.Score, exe.Score)
+	}
+}
+
+func TestFindAssetWeights(t *testing.T) {
+	withArch(t, "amd64")
+	tmpDir := t.TempDir()
+
+	assets := []Asset{
+		{Name: "noraneko-1.0.0-windows-x86_64-portable.zip"},
+		{Name: "noraneko-1.0.0-windows-x86_64-setup.exe"},
+		{Name: "noraneko-1.0.0-windows-x86_64.msi"},
+		{Name: "noraneko-1.0.0-win-any.zip"},
+	}
+
+	tests := []struct {
+		name     string
+		portable bool
+		weights  func(w *config.AssetWeights)
+		want     string
+	}{
+		{"defaults installed", false, func(w *config.AssetWeights) {}, "noraneko-1.0.0-windows-x86_64-setup.exe"},
+		{"defaults portable", true, func(w *config.AssetWeights) {}, "noraneko-1.0.0-windows-x86_64-portable.zip"},
+		{"prefer msi", false, func(w *config.AssetWeights) {
+			w.Msi = 100
+		}, "noraneko-1.0.0-windows-x86_64.msi"},
+		{"avoid exe", false, func(w *config.AssetWeights) {
+			w.Exe = -1000
+		}, "noraneko-1.0.0-windows-x86_64.msi"},
+		{"ignore arch and name", true, func(w *config.AssetWeights) {
+			w.Arch, w.CanonicalName, w.Zip = -20, 0, 0
+		}, "noraneko-1.0.0-win-any.zip"},
+		{"zip for installs", false, func(w *config.AssetWeights) {
+			w.CanonicalName, w.Flavor, w.Zip = 0, 0, 50
+		}, "noraneko-1.0.0-windows-x86_64-portable.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir, AssetWeights: config.DefaultAssetWeights}
+			tt.weights(&cfg.AssetWeights)
+			u := New(cfg, Options{Portable: tt.portable})
+			u.release = &Release{TagName: "v1.0.0", Assets: assets}
+
+			asset, err := u.findAsset()
+			if err != nil {
+				t.Fatalf("Failed to find asset: %v", err)
+			}
+			if asset.Name != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, asset.Name)
+			}
+		})
+	}
+
+	// Weights never make a build for another platform a candidate
+	cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir, AssetWeights: config.AssetWeights{Windows: -10}}
+	u := New(cfg, Options{Portable: true})
+	u.release = &Release{TagName: "v1.0.0", Assets: []Asset{
+		{Name: "noraneko-1.0.0-linux-x86_64.zip"},
+		{Name: "noraneko-1.0.0-windows-i686-portable.zip"},
+	}}
+	if asset, err := u.findAsset(); err == nil {
+		t.Errorf("Expected no candidate, got %s", asset.Name)
+	}
+}
+
+func TestFindAssetContentType(t *testing.T) {
+	withArch(t, "amd64")
+	tmpDir := t.TempDir()
+
+	// Names that score the same, told apart only by their content type
+	assets := []Asset{
+		{Name: "noraneko-windows-x64-a.zip", ContentType: "application/octet-stream"},
+		{Name: "noraneko-windows-x64-b.zip", ContentType: "application/zip"},
+		{Name: "noraneko-windows-x64-c.zip", ContentType: "application/x-msdownload"},
+	}
+
+	tests := []struct {
+		name     string
+		portable bool
+		want     string
+	}{
+		{"portable prefers zip", true, "noraneko-windows-x64-b.zip"},
+		{"installer prefers x-msdownload", false, "noraneko-windows-x64-c.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{Portable: tt.portable})
+			u.release = &Release{TagName: "v1.0.0", Assets: assets}
+			asset, err := u.findAsset()
+			if err != nil {
+				t.Fatalf("Failed to find asset: %v", err)
+			}
+			if asset.Name != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, asset.Name)
+			}
+		})
+	}
+
+	// The content type never outweighs a better name, and parameters and
+	// case are ignored
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{Portable: true})
+	u.release = &Release{TagName: "v1.0.0", Assets: []Asset{
+		{Name: "noraneko-windows-x64-any.zip", ContentType: "application/zip"},
+		{Name: "noraneko-1.0.0-windows-x86_64-portable.zip", ContentType: "application/octet-stream"},
+	}}
+	if asset, err := u.findAsset(); err != nil || asset.Name != "noraneko-1.0.0-windows-x86_64-portable.zip" {
+		t.Errorf("Expected the canonical name to win, got %v (%v)", asset, err)
+	}
+	m := scoreAsset(&Asset{Name: "noraneko-windows-x64.zip", ContentType: "Application/Zip; charset=binary"}, true, config.DefaultAssetWeights)
+	if !m.ContentTypeMatch {
+		t.Errorf("Expected the content type to match, reasons %v", m.Reasons)
+	}
+}
+
+func TestFindAssetInstallerPrefersSetup(t *testing.T) {
+	withArch(t, "amd64")
+
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	u.release = &Release{
+		Assets: []Asset{
+			{Name: "noraneko-1.0.0-windows-x86_64-portable.zip"},
+			{Name: "noraneko-1.0.0-windows-x86_64-setup.exe"},
+		},
+	}
+
+	asset, err := u.findAsset()
+	if err != nil {
+		t.Fatalf("Failed to find asset: %v", err)
+	}
+	if asset.Name != "noraneko-1.0.0-windows-x86_64-setup.exe" {
+		t.Errorf("Expected setup.exe for installed mode, got %s", asset.Name)
+	}
+}
+
+func TestFindAssetFlavorMismatch(t *testing.T) {
+	withArch(t, "amd64")
+	tmpDir := t.TempDir()
+
+	setupOnly := &Release{
+		TagName: "v1.0.0",
+		Assets:  []Asset{{Name: "noraneko-1.0.0-windows-x86_64-setup.exe"}},
+	}
+
+	// Portable mode fails without the fallback
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{Portable: true})
+	u.release = setupOnly
+	_, err := u.findAsset()
+	var mismatch *FlavorMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected a FlavorMismatchError, got %v", err)
+	}
+	if mismatch.Tag != "v1.0.0" || mismatch.Asset != "noraneko-1.0.0-windows-x86_64-setup.exe" {
+		t.Errorf("Unexpected error %+v", mismatch)
+	}
+
+	// With the fallback the installer is used and the switch recorded
+	u = New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{Portable: true, AllowFlavorFallback: true})
+	u.release = setupOnly
+	asset, err := u.findAsset()
+	if err != nil {
+		t.Fatalf("Expected the fallback to find the installer: %v", err)
+	}
+	if asset.Name != "noraneko-1.0.0-windows-x86_64-setup.exe" || !u.flavorFallback {
+		t.Errorf("Expected a recorded fallback to the installer, got %s (fallback=%v)", asset.Name, u.flavorFallback)
+	}
+
+	// A portable asset is preferred even with the fallback allowed
+	u.release = &Release{Assets: append([]Asset{{Name: "noraneko-1.0.0-windows-x86_64-portable.zip"}}, setupOnly.Assets...)}
+	if asset, err := u.findAsset(); err != nil || asset.Name != "noraneko-1.0.0-windows-x86_64-portable.zip" || u.flavorFallback {
+		t.Errorf("Expected the portable zip without a fallback, got %v, %v (fallback=%v)", asset, err, u.flavorFallback)
+	}
+
+	// Installs still accept a portable zip, which is extracted over them
+	u = New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	u.release = &Release{Assets: []Asset{{Name: "noraneko-1.0.0-windows-x86_64-portable.zip"}}}
+	if _, err := u.findAsset(); err != nil {
+		t.Errorf("Expected a zip to be accepted for an install: %v", err)
+	}
+}
+
+func TestDumpAssetMatch(t *testing.T) {
+	withArch(t, "amd64")
+
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.0.0", "assets": [
+			{"name": "noraneko-1.0.0-linux-x86_64.tar.gz"},
+			{"name": "noraneko-1.0.0-windows-x86_64-portable.zip"},
+			{"name": "noraneko-1.0.0-windows-x86_64-setup.exe"},
+			{"name": "sha256sums.txt"}
+		]}`))
+	}))
+	defer server.Close()
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{Portable: true})
+	u.apiURL = server.URL
+
+	var out bytes.Buffer
+	if err := u.DumpAssetMatch(&out); err != nil {
+		t.Fatalf("DumpAssetMatch failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("Expected a header and 4 asset lines, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[0], "flavor portable") {
+		t.Errorf("Header missing flavor: %s", lines[0])
+	}
+
+	for _, name := range []string{"linux-x86_64.tar.gz", "portable.zip", "setup.exe", "sha256sums.txt"} {
+		if !strings.Contains(out.String(), name) {
+			t.Errorf("Asset %s missing from output", name)
+		}
+	}
+
+	selected := lines[2]
+	if !strings.HasPrefix(selected, "*") || !strings.Contains(selected, "portable.zip") {
+		t.Errorf("Expected the portable zip to be marked as selected, got: %s", selected)
+	}
+	if !strings.Contains(lines[1], "   0  ") {
+		t.Errorf("Expected the Linux asset to score 0, got: %s", lines[1])
+	}
+}
+
+func TestPrintURL(t *testing.T) {
+	withArch(t, "arm64")
+	tmpDir := t.TempDir()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.0.0", "assets": [
+			{"name": "noraneko-windows-x86_64-portable.zip", "browser_download_url": "https://example.com/x86_64-portable.zip"},
+			{"name": "noraneko-windows-aarch64-portable.zip", "browser_download_url": "https://example.com/aarch64-portable.zip"},
+			{"name": "noraneko-windows-aarch64-setup.exe", "browser_download_url": "https://example.com/aarch64-setup.exe"},
+			{"name": "sha256sums.txt", "browser_download_url": "https://example.com/sha256sums.txt"}
+		]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		portable bool
+		want     string
+	}{
+		{true, "https://example.com/aarch64-portable.zip\nhttps://example.com/sha256sums.txt\n"},
+		{false, "https://example.com/aarch64-setup.exe\nhttps://example.com/sha256sums.txt\n"},
+	}
+	for _, tt := range tests {
+		u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{Portable: tt.portable})
+		u.apiURL = server.URL
+
+		var out bytes.Buffer
+		if err := u.PrintURL(&out); err != nil {
+			t.Fatalf("PrintURL failed: %v", err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("Portable %v: expected %q, got %q", tt.portable, tt.want, out.String())
+		}
+	}
+}
+
+func TestFindAssetMsi(t *testing.T) {
+	withArch(t, "amd64")
+
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	u.release = &Release{
+		Assets: []Asset{
+			{Name: "noraneko-1.0.0-windows-x86_64-portable.zip"},
+			{Name: "noraneko-1.0.0-windows-x86_64.msi"},
+		},
+	}
+
+	asset, err := u.findAsset()
+	if err != nil {
+		t.Fatalf("Failed to find asset: %v", err)
+	}
+	if asset.Name != "noraneko-1.0.0-windows-x86_64.msi" {
+		t.Errorf("Expected the MSI for installed mode, got %s", asset.Name)
+	}
+}
+
+func TestFindAssetNoAssets(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	u.release = &Release{TagName: "v1.0.0"}
+
+	_, err = u.findAsset()
+	var incomplete *IncompleteReleaseError
+	if !errors.As(err, &incomplete) {
+		t.Fatalf("Expected an IncompleteReleaseError, got %v", err)
+	}
+	if incomplete.Tag != "v1.0.0" {
+		t.Errorf("Expected tag v1.0.0, got %s", incomplete.Tag)
+	}
+}
+
+func TestFindAssetRetriesIncompleteRelease(t *testing.T) {
+	withArch(t, "amd64")
+
+	var slept time.Duration
+	orig := sleepContext
+	sleepContext = func(ctx context.Context, d time.Duration) error {
+		slept += d
+		return nil
+	}
+	t.Cleanup(func() { sleepContext = orig })
+
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The assets show up on the second request
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Write([]byte(`{"tag_name": "v1.0.0", "assets": []}`))
+			return
+		}
+		w.Write([]byte(`{"tag_name": "v1.0.0", "assets": [{"name": "noraneko-1.0.0-windows-x86_64-setup.exe"}]}`))
+	}))
+	defer server.Close()
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir, AssetRetryDelay: 30}, Options{})
+	u.apiURL = server.URL
+	if u.release, err = u.getLatestRelease(context.Background()); err != nil {
+		t.Fatalf("Failed to get release: %v", err)
+	}
+
+	asset, err := u.findAssetWithRetry(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the retry to find the asset: %v", err)
+	}
+	if asset.Name != "noraneko-1.0.0-windows-x86_64-setup.exe" {
+		t.Errorf("Unexpected asset %s", asset.Name)
+	}
+	if slept != 30*time.Second {
+		t.Errorf("Expected a 30s wait, got %v", slept)
+	}
+
+	// Without a delay the error is returned right away
+	requests = 0
+	u.cfg.AssetRetryDelay = 0
+	u.release = &Release{TagName: "v1.0.0"}
+	if _, err := u.findAssetWithRetry(context.Background()); !errors.As(err, new(*IncompleteReleaseError)) {
+		t.Errorf("Expected an IncompleteReleaseError, got %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no refetch without AssetRetryDelay, got %d request(s)", requests)
+	}
+}
+
+func TestFindAssetRetryHonorsDeadline(t *testing.T) {
+	withArch(t, "amd64")
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"tag_name": "v1.0.0", "assets": []}`))
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir, AssetRetryDelay: 3600}, Options{})
+	u.apiURL = server.URL
+	u.release = &Release{TagName: "v1.0.0"}
+
+	// The run deadline expires during the hour-long wait
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := u.findAssetWithRetry(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the wait, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the wait to stop at the deadline, took %v", elapsed)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no refetch after the deadline, got %d request(s)", requests)
+	}
+}
+
+func TestFindAssetByName(t *testing.T) {
+	withArch(t, "amd64")
+	tmpDir := t.TempDir()
+	release := &Release{
+		TagName: "v1.0.0",
+		Assets: []Asset{
+			{Name: "noraneko-1.0.0-windows-x86_64-portable.zip"},
+			{Name: "noraneko-1.0.0-windows-x86_64-setup.exe"},
+			{Name: "noraneko-1.0.0-windows-aarch64-portable.zip"},
+			{Name: "noraneko-1.0.0-linux-x86_64.tar.bz2"},
+			{Name: "SHA256SUMS.txt"},
+		},
+	}
+
+	tests := []struct {
+		asset string
+		want  string
+		err   string
+	}{
+		// Exact names bypass the scoring, even for another architecture
+		{"noraneko-1.0.0-windows-aarch64-portable.zip", "noraneko-1.0.0-windows-aarch64-portable.zip", ""},
+		{"noraneko-1.0.0-windows-x86_64-setup.exe", "noraneko-1.0.0-windows-x86_64-setup.exe", ""},
+		{"*-x86_64-portable.zip", "noraneko-1.0.0-windows-x86_64-portable.zip", ""},
+		{"*-setup.exe", "noraneko-1.0.0-windows-x86_64-setup.exe", ""},
+		{"*-portable.zip", "", "matches several assets"},
+		{"noraneko-2.0.0-*.zip", "", "has no asset matching"},
+		{"noraneko-1.0.0-linux-*", "", "not an archive, .exe or .msi"},
+		{"[", "", "invalid asset pattern"},
+	}
+	for _, tt := range tests {
+		u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{Portable: true, Asset: tt.asset})
+		u.release = release
+		asset, err := u.findAsset()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected an error containing %q, got %v", tt.asset, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || asset.Name != tt.want {
+			t.Errorf("%s: expected %s, got %v (%v)", tt.asset, tt.want, asset, err)
+		}
+		if u.flavorFallback {
+			t.Errorf("%s: expected a named asset not to count as a flavor fallback", tt.asset)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// inTotoPayloadType is the DSSE payload type of in-toto attestations
+const inTotoPayloadType = "application/vnd.in-toto+json"
+
+// attestationBundle is the part of a Sigstore bundle needed to verify a
+// DSSE-signed in-toto statement, or the signature of a file made by cosign
+type attestationBundle struct {
+	VerificationMaterial verificationMaterial `json:"verificationMaterial"`
+	DSSEEnvelope         struct {
+		Payload     []byte `json:"payload"`
+		PayloadType string `json:"payloadType"`
+		Signatures  []struct {
+			Sig []byte `json:"sig"`
+		} `json:"signatures"`
+	} `json:"dsseEnvelope"`
+	MessageSignature struct {
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+}
+
+// certificates returns the DER signing certificate of a bundle followed by
+// its intermediates
+func (m *verificationMaterial) certificates() [][]byte {
+	var raw [][]byte
+	if len(m.Certificate.RawBytes) > 0 {
+		raw = append(raw, m.Certificate.RawBytes)
+	}
+	for _, c := range m.X509CertificateChain.Certificates {
+		raw = append(raw, c.RawBytes)
+	}
+	return raw
+}
+
+// verificationMaterial holds the signing certificate of a Sigstore bundle
+// and the transparency log entries of its signature
+type verificationMaterial struct {
+	Certificate struct {
+		RawBytes []byte `json:"rawBytes"`
+	} `json:"certificate"`
+	X509CertificateChain struct {
+		Certificates []struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificates"`
+	} `json:"x509CertificateChain"`
+	TlogEntries []tlogEntry `json:"tlogEntries"`
+}
+
+// inTotoStatement is the signed payload of an attestation
+type inTotoStatement struct {
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+}
+
+// releaseRepo returns the owner/repo releases are fetched from
+func (u *Updater) releaseRepo() string {
+	if u.cfg.ReleaseRepo != "" {
+		return u.cfg.ReleaseRepo
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(config.ReleaseAPIURL, "/releases"), config.GitHubAPIURL+"/repos/")
+}
+
+// verifyAttestation checks that the downloaded asset has a build provenance
+// attestation signed by a workflow of the release repository
+func (u *Updater) verifyAttestation(ctx context.Context, path string) error {
+	roots, err := loadAttestationRoots(u.cfg.AttestationTrustedRoot)
+	if err != nil {
+		return err
+	}
+	rekorKey, err := loadRekorKey(u.cfg.RekorPublicKey)
+	if err != nil {
+		return err
+	}
+
+	digest, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+
+	var bundles []json.RawMessage
+	if u.staged != nil {
+		bundles = u.staged.Attestations
+	} else if bundles, err = u.getAttestations(ctx, digest); err != nil {
+		return err
+	}
+	u.attestations = bundles
+	if len(bundles) == 0 {
+		return fmt.Errorf("no attestation found for sha256:%s", digest)
+	}
+
+	for _, bundle := range bundles {
+		if err = verifyAttestationBundle(bundle, digest, roots, rekorKey, u.releaseRepo()); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// loadAttestationRoots reads the PEM certificates attestation signing
+// certificates must chain to
+func loadAttestationRoots(path string) (*x509.CertPool, error) {
+	if path == "" {
+		return nil, errors.New("AttestationTrustedRoot is not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestation trusted root: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// getAttestations fetches the attestation bundles GitHub stores for a
+// SHA256 digest in the release repository
+func (u *Updater) getAttestations(ctx context.Context, digest string) ([]json.RawMessage, error) {
+	url := u.repoAPIURL() + "/attestations/sha256:" + digest
+
+	req, err := u.newRequest(ctx, "GET", url)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := u.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Attestations []struct {
+			Bundle json.RawMessage `json:"bundle"`
+		} `json:"attestations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode attestations: %w", err)
+	}
+
+	bundles := make([]json.RawMessage, 0, len(result.Attestations))
+	for _, a := range result.Attestations {
+		bundles = append(bundles, a.Bundle)
+	}
+	return bundles, nil
+}
+
+// verifyAttestationBundle verifies a Sigstore bundle for the asset with the
+// given SHA256 digest: a signed entry timestamp of the Rekor log with
+// rekorKey must prove when the signature was logged, the signing
+// certificate must chain to roots at that time and belong to a workflow of
+// repo, a DSSE signature must be valid and the statement must name the
+// digest.
+func verifyAttestationBundle(data []byte, digest string, roots *x509.CertPool, rekorKey *ecdsa.PublicKey, repo string) error {
+	var bundle attestationBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return fmt.Errorf("failed to decode attestation bundle: %w", err)
+	}
+	envelope := bundle.DSSEEnvelope
+	if envelope.PayloadType != inTotoPayloadType {
+		return fmt.Errorf("unexpected payload type %q", envelope.PayloadType)
+	}
+	if len(envelope.Signatures) == 0 {
+		return errors.New("attestation is not signed")
+	}
+
+	// Signing certificates are short-lived, so they are checked at the
+	// time the log proves the signature was logged
+	material := bundle.VerificationMaterial
+	certs := material.certificates()
+	if len(certs) == 0 {
+		return errors.New("no signing certificate")
+	}
+	payloadHash := sha256.Sum256(envelope.Payload)
+	logged, err := loggedTime(material.TlogEntries, rekorKey, func(entry *rekorEntry) bool {
+		if entry.Kind != "dsse" || entry.Spec.PayloadHash.Algorithm != "sha256" ||
+			!strings.EqualFold(entry.Spec.PayloadHash.Value, hex.EncodeToString(payloadHash[:])) {
+			return false
+		}
+		for _, s := range entry.Spec.Signatures {
+			if hasVerifier(s.Verifier, certs[0]) {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	leaf, err := verifySigningCert(certs, roots, logged)
+	if err != nil {
+		return err
+	}
+	if !signedByRepo(leaf, repo) {
+		return fmt.Errorf("attestation was not signed by a workflow of %s", repo)
+	}
+
+	// Any DSSE signature over the statement made with the certificate
+	pae := dssePAE(envelope.PayloadType, envelope.Payload)
+	for _, sig := range envelope.Signatures {
+		if err = checkSignature(leaf, pae, sig.Sig); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid attestation signature: %w", err)
+	}
+
+	// The statement must be about this asset
+	var statement inTotoStatement
+	if err := json.Unmarshal(envelope.Payload, &statement); err != nil {
+		return fmt.Errorf("failed to decode attestation statement: %w", err)
+	}
+	for _, s := range statement.Subject {
+		if strings.EqualFold(s.Digest["sha256"], digest) {
+			return nil
+		}
+	}
+	return fmt.Errorf("attestation does not cover sha256:%s", digest)
+}
+
+// verifySigningCert parses a DER signing certificate and its
+// intermediates and checks that it chains to roots and allows code
+// signing at the given time
+func verifySigningCert(raw [][]byte, roots *x509.CertPool, at time.Time) (*x509.Certificate, error) {
+	if len(raw) == 0 {
+		return nil, errors.New("no signing certificate")
+	}
+	leaf, err := x509.ParseCertificate(raw[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing certificate: %w", err)
+	}
+	intermediates := x509.NewCertPool()
+	for _, r := range raw[1:] {
+		cert, err := x509.ParseCertificate(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid intermediate certificate: %w", err)
+		}
+		intermediates.AddCert(cert)
+	}
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("untrusted signing certificate: %w", err)
+	}
+	return leaf, nil
+}
+
+// signedByRepo reports whether a Fulcio certificate was issued to a GitHub
+// Actions workflow of repo
+func signedByRepo(cert *x509.Certificate, repo string) bool {
+	prefix := strings.ToLower("https://github.com/" + repo + "/")
+	for _, uri := range cert.URIs {
+		if strings.HasPrefix(strings.ToLower(uri.String()), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// dssePAE returns the DSSE pre-authentication encoding that is signed
+func dssePAE(payloadType string, payload []byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// checkSignature verifies a signature made with the certificate's key
+func checkSignature(cert *x509.Certificate, signed, sig []byte) error {
+	var algo x509.SignatureAlgorithm
+	switch key := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		algo = x509.ECDSAWithSHA256
+		if key.Curve.Params().BitSize == 384 {
+			algo = x509.ECDSAWithSHA384
+		}
+	case *rsa.PublicKey:
+		algo = x509.SHA256WithRSA
+	case ed25519.PublicKey:
+		algo = x509.PureEd25519
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return cert.CheckSignature(algo, signed, sig)
+}
@@ -0,0 +1,310 @@
+package updater
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSigner issues Fulcio-like signing certificates from a test root and
+// logs signatures in a Rekor-like test log
+type testSigner struct {
+	root     *x509.Certificate
+	rootKey  *ecdsa.PrivateKey
+	rekorKey *ecdsa.PrivateKey
+	issued   time.Time
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	issued := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test sigstore root"},
+		NotBefore:             issued.AddDate(-1, 0, 0),
+		NotAfter:              issued.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create root: %v", err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse root: %v", err)
+	}
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return &testSigner{root: root, rootKey: key, rekorKey: rekorKey, issued: issued}
+}
+
+// rekorKeyPath writes the public key of the signer's log to a PEM file
+func (s *testSigner) rekorKeyPath(t *testing.T) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&s.rekorKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode public key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "rekor.pub")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	return path
+}
+
+// tlogEntry returns a transparency log entry for body logged a minute
+// after the signer issues certificates, with a signed entry timestamp of
+// the signer's log
+func (s *testSigner) tlogEntry(t *testing.T, body map[string]any) map[string]any {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&s.rekorKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode public key: %v", err)
+	}
+	logID := sha256.Sum256(der)
+	payload := rekorPayload{
+		Body:           mustJSON(t, body),
+		IntegratedTime: s.issued.Add(time.Minute).Unix(),
+		LogID:          hex.EncodeToString(logID[:]),
+		LogIndex:       42,
+	}
+	digest := sha256.Sum256(mustJSON(t, payload))
+	set, err := ecdsa.SignASN1(rand.Reader, s.rekorKey, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return map[string]any{
+		"logIndex":          "42",
+		"logId":             map[string]any{"keyId": logID[:]},
+		"integratedTime":    fmt.Sprint(payload.IntegratedTime),
+		"inclusionPromise":  map[string]any{"signedEntryTimestamp": set},
+		"canonicalizedBody": payload.Body,
+	}
+}
+
+// roots returns a pool trusting the signer's root
+func (s *testSigner) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.root)
+	return pool
+}
+
+// bundle returns a signed bundle whose statement names digest, issued to
+// a workflow of repo
+func (s *testSigner) bundle(t *testing.T, repo, digest string) map[string]any {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	identity, _ := url.Parse("https://github.com/" + repo + "/.github/workflows/release.yml@refs/tags/v1.0.0")
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    s.issued,
+		NotAfter:     s.issued.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{identity},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.root, &key.PublicKey, s.rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create leaf: %v", err)
+	}
+
+	payload := []byte(fmt.Sprintf(`{"_type": "https://in-toto.io/Statement/v1",
+		"subject": [{"name": "noraneko-windows-x86_64-portable.zip", "digest": {"sha256": %q}}],
+		"predicateType": "https://slsa.dev/provenance/v1"}`, digest))
+	hash := sha256.Sum256(dssePAE(inTotoPayloadType, payload))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	payloadHash := sha256.Sum256(payload)
+	entry := s.tlogEntry(t, map[string]any{
+		"apiVersion": "0.0.1",
+		"kind":       "dsse",
+		"spec": map[string]any{
+			"payloadHash": map[string]any{"algorithm": "sha256", "value": hex.EncodeToString(payloadHash[:])},
+			"signatures": []any{map[string]any{
+				"signature": base64.StdEncoding.EncodeToString(sig),
+				"verifier":  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			}},
+		},
+	})
+
+	return map[string]any{
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]any{"rawBytes": der},
+			"tlogEntries": []any{entry},
+		},
+		"dsseEnvelope": map[string]any{
+			"payload":     payload,
+			"payloadType": inTotoPayloadType,
+			"signatures":  []any{map[string]any{"sig": sig}},
+		},
+	}
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	return data
+}
+
+func TestVerifyAttestationBundle(t *testing.T) {
+	const repo = "f3liz-dev/noraneko-runtime"
+	digest := strings.Repeat("ab", 32)
+	signer := newTestSigner(t)
+	rekorKey := &signer.rekorKey.PublicKey
+
+	valid := signer.bundle(t, repo, digest)
+	if err := verifyAttestationBundle(mustJSON(t, valid), digest, signer.roots(), rekorKey, repo); err != nil {
+		t.Fatalf("Expected a valid bundle to verify: %v", err)
+	}
+
+	// Another digest is not covered
+	if err := verifyAttestationBundle(mustJSON(t, valid), strings.Repeat("cd", 32), signer.roots(), rekorKey, repo); err == nil {
+		t.Error("Expected a bundle for another digest to be rejected")
+	}
+
+	// A statement changed after signing fails the signature check
+	tampered := signer.bundle(t, repo, digest)
+	envelope := tampered["dsseEnvelope"].(map[string]any)
+	envelope["payload"] = []byte(strings.Replace(string(envelope["payload"].([]byte)), digest, strings.Repeat("cd", 32), 1))
+	err := verifyAttestationBundle(mustJSON(t, tampered), strings.Repeat("cd", 32), signer.roots(), rekorKey, repo)
+	if err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("Expected a tampered statement to fail the signature check, got %v", err)
+	}
+
+	// Signatures from other repositories or roots are not trusted
+	if err := verifyAttestationBundle(mustJSON(t, signer.bundle(t, "someone/else", digest)), digest, signer.roots(), rekorKey, repo); err == nil {
+		t.Error("Expected a bundle from another repository to be rejected")
+	}
+	if err := verifyAttestationBundle(mustJSON(t, valid), digest, newTestSigner(t).roots(), rekorKey, repo); err == nil {
+		t.Error("Expected a bundle from an untrusted root to be rejected")
+	}
+
+	// Any of several DSSE signatures may be the valid one
+	multi := signer.bundle(t, repo, digest)
+	envelope = multi["dsseEnvelope"].(map[string]any)
+	envelope["signatures"] = append([]any{map[string]any{"sig": []byte("not a signature")}}, envelope["signatures"].([]any)...)
+	if err := verifyAttestationBundle(mustJSON(t, multi), digest, signer.roots(), rekorKey, repo); err != nil {
+		t.Errorf("Expected a bundle with one valid signature to verify: %v", err)
+	}
+}
+
+func TestVerifyAttestationBundleLogTime(t *testing.T) {
+	const repo = "f3liz-dev/noraneko-runtime"
+	digest := strings.Repeat("ab", 32)
+	signer := newTestSigner(t)
+	rekorKey := &signer.rekorKey.PublicKey
+
+	tests := []struct {
+		name   string
+		modify func(bundle map[string]any)
+		err    string
+	}{
+		{"no log entry", func(bundle map[string]any) {
+			material := bundle["verificationMaterial"].(map[string]any)
+			material["tlogEntries"] = []any{}
+		}, "no transparency log entry"},
+		{"backdated", func(bundle map[string]any) {
+			entry := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)
+			entry["integratedTime"] = fmt.Sprint(signer.issued.Add(-time.Hour).Unix())
+		}, "invalid signed entry timestamp"},
+		{"no timestamp", func(bundle map[string]any) {
+			entry := bundle["verificationMaterial"].(map[string]any)["tlogEntries"].([]any)[0].(map[string]any)
+			delete(entry, "inclusionPromise")
+		}, "no signed entry timestamp"},
+		{"other log", func(bundle map[string]any) {
+			material := bundle["verificationMaterial"].(map[string]any)
+			material["tlogEntries"] = newTestSigner(t).bundle(t, repo, digest)["verificationMaterial"].(map[string]any)["tlogEntries"]
+		}, "not from the trusted Rekor log"},
+		{"entry of another signature", func(bundle map[string]any) {
+			material := bundle["verificationMaterial"].(map[string]any)
+			material["tlogEntries"] = signer.bundle(t, repo, digest)["verificationMaterial"].(map[string]any)["tlogEntries"]
+		}, "for another signature"},
+	}
+	for _, tt := range tests {
+		bundle := signer.bundle(t, repo, digest)
+		tt.modify(bundle)
+		err := verifyAttestationBundle(mustJSON(t, bundle), digest, signer.roots(), rekorKey, repo)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestVerifyAttestationFetchesBundles(t *testing.T) {
+	signer := newTestSigner(t)
+
+	dir := t.TempDir()
+	asset := filepath.Join(dir, "asset.zip")
+	if err := os.WriteFile(asset, []byte("PK\x03\x04asset"), 0644); err != nil {
+		t.Fatalf("Failed to write asset: %v", err)
+	}
+	digest, err := hashFile(asset)
+	if err != nil {
+		t.Fatalf("Failed to hash asset: %v", err)
+	}
+	rootPath := filepath.Join(dir, "root.pem")
+	rootPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.root.Raw})
+	if err := os.WriteFile(rootPath, rootPEM, 0644); err != nil {
+		t.Fatalf("Failed to write root: %v", err)
+	}
+
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Write(mustJSON(t, map[string]any{"attestations": []any{
+			map[string]any{"bundle": signer.bundle(t, "someone/fork", digest)},
+		}}))
+	}))
+	defer server.Close()
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.ReleaseRepo = "someone/fork"
+	cfg.VerifyAttestation = true
+	cfg.AttestationTrustedRoot = rootPath
+	cfg.RekorPublicKey = signer.rekorKeyPath(t)
+	u := New(cfg, Options{})
+	u.apiURL = server.URL + "/repos/someone/fork/releases"
+
+	if err := u.verifyAttestation(context.Background(), asset); err != nil {
+		t.Fatalf("Expected the attestation to verify: %v", err)
+	}
+	if requested != "/repos/someone/fork/attestations/sha256:"+digest {
+		t.Errorf("Unexpected attestation request %s", requested)
+	}
+}
@@ -0,0 +1,174 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// Backup is a copy of a previous install kept for -rollback
+type Backup struct {
+	Path    string
+	Version string
+	Created time.Time
+}
+
+// backupName returns the directory name of the backup of a version
+func backupName(version string) string {
+	return config.BrowserName + "-" + version + ".bak"
+}
+
+// listBackups returns the backups in dir, newest first
+func listBackups(dir string) ([]Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := config.BrowserName + "-"
+	var backups []Backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{
+			Path:    filepath.Join(dir, name),
+			Version: strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".bak"),
+			Created: info.ModTime(),
+		})
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// pruneBackups removes the oldest backups in dir so that at most keep
+// remain
+func pruneBackups(dir string, keep int) error {
+	backups, err := listBackups(dir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(backups); i++ {
+		if err := os.RemoveAll(longPath(backups[i].Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupInstall copies the install in browserDir to a versioned backup next
+// to it before an update overwrites it, and prunes backups beyond
+// BackupCount. Nothing is backed up if BackupCount is 0 or browserDir is not
+// the detected install.
+func (u *Updater) backupInstall(ctx context.Context, browserDir string) error {
+	if u.cfg.BackupCount <= 0 {
+		return nil
+	}
+	browserPath := u.cfg.GetBrowserPath()
+	if browserPath == "" || filepath.Clean(filepath.Dir(browserPath)) != filepath.Clean(browserDir) {
+		return nil
+	}
+
+	version, err := u.getCurrentVersion()
+	if err != nil {
+		return fmt.Errorf("failed to determine the installed version: %w", err)
+	}
+
+	// Copy to a temporary name first so an interrupted copy is never
+	// mistaken for a complete backup
+	backupDir := filepath.Join(filepath.Dir(browserDir), backupName(version))
+	partial := backupDir + ".partial"
+	if err := os.RemoveAll(longPath(partial)); err != nil {
+		return err
+	}
+	if err := u.copyTree(ctx, browserDir, partial); err != nil {
+		os.RemoveAll(longPath(partial))
+		return err
+	}
+	if err := os.RemoveAll(longPath(backupDir)); err != nil {
+		return err
+	}
+	if err := os.Rename(longPath(partial), longPath(backupDir)); err != nil {
+		return err
+	}
+
+	// The modification time orders backups, newest first
+	now := time.Now()
+	if err := os.Chtimes(longPath(backupDir), now, now); err != nil {
+		return err
+	}
+	fmt.Fprintf(u.out, "Backed up version %s to %s\n", version, backupDir)
+
+	return pruneBackups(filepath.Dir(browserDir), u.cfg.BackupCount)
+}
+
+// Rollback restores the most recent backup over the current install and
+// returns the restored backup. The current install is moved aside while
+// the backup is copied and put back if the copy fails.
+func (u *Updater) Rollback() (*Backup, error) {
+	browserPath := u.cfg.GetBrowserPath()
+	if browserPath == "" {
+		return nil, fmt.Errorf("browser not found")
+	}
+	browserDir := filepath.Dir(browserPath)
+
+	backups, err := listBackups(filepath.Dir(browserDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	if len(backups) == 0 {
+		return nil, fmt.Errorf("no backup found next to %s", browserDir)
+	}
+	backup := backups[0]
+
+	aside := browserDir + ".rollback"
+	if err := os.RemoveAll(longPath(aside)); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(longPath(browserDir), longPath(aside)); err != nil {
+		return nil, fmt.Errorf("failed to move the current install aside: %w", err)
+	}
+	if err := u.copyTree(context.Background(), backup.Path, browserDir); err != nil {
+		os.RemoveAll(longPath(browserDir))
+		if rerr := os.Rename(longPath(aside), longPath(browserDir)); rerr != nil {
+			return nil, fmt.Errorf("failed to restore backup: %w (current install left in %s: %v)", err, aside, rerr)
+		}
+		return nil, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	if err := os.RemoveAll(longPath(aside)); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove %s: %v\n", aside, err)
+	}
+
+	// An interrupted update is not resumed over the restored files
+	u.removeJournal()
+
+	// Keep -verify-install in line with the restored files
+	if err := u.writeManifest(browserDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write install manifest: %v\n", err)
+	}
+	u.logResult(fmt.Sprintf("Rolled back to %s", backup.Version))
+	return &backup, nil
+}
+
+// copyTree copies the directory src to dst, which must not exist yet, so
+// the OverwritePolicy does not apply
+func (u *Updater) copyTree(ctx context.Context, src, dst string) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	return u.copyDir(ctx, src, dst, nil)
+}
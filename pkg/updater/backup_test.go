@@ -0,0 +1,126 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// releaseZip builds a portable archive reporting the given version
+func releaseZip(t *testing.T, version string) []byte {
+	return makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":        "exe " + version,
+		"noraneko/application.ini":     fmt.Sprintf("[App]\nVersion=%s\n", version),
+		"noraneko/" + version + ".txt": version,
+	})
+}
+
+// ageBackups moves the modification time of the backups in dir back, so
+// backups made in quick succession still have a clear order
+func ageBackups(t *testing.T, dir string) {
+	t.Helper()
+	backups, err := listBackups(dir)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	for _, b := range backups {
+		old := b.Created.Add(-time.Hour)
+		if err := os.Chtimes(b.Path, old, old); err != nil {
+			t.Fatalf("Failed to age backup: %v", err)
+		}
+	}
+}
+
+func TestBackupRotation(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.BackupCount = 2
+	parent := filepath.Dir(filepath.Dir(cfg.Path))
+
+	for _, version := range []string{"1.1.0", "1.2.0", "1.3.0"} {
+		server := newReleaseServer(t, "v"+version, releaseZip(t, version))
+		u := newTestUpdater(cfg, Options{Portable: true}, server)
+		if _, err := u.Run(); err != nil {
+			t.Fatalf("Update to %s failed: %v", version, err)
+		}
+		ageBackups(t, parent)
+	}
+
+	backups, err := listBackups(parent)
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	var versions []string
+	for _, b := range backups {
+		versions = append(versions, b.Version)
+	}
+	if fmt.Sprint(versions) != "[1.2.0 1.1.0]" {
+		t.Errorf("Expected backups [1.2.0 1.1.0], newest first, got %v", versions)
+	}
+
+	// Backups hold the files of the version they are named after
+	data, err := os.ReadFile(filepath.Join(parent, backupName("1.2.0"), "application.ini"))
+	if err != nil || string(data) != "[App]\nVersion=1.2.0\n" {
+		t.Errorf("Expected the 1.2.0 backup to contain version 1.2.0, got %q (%v)", data, err)
+	}
+}
+
+func TestBackupDisabled(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	server := newReleaseServer(t, "v1.1.0", releaseZip(t, "1.1.0"))
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	backups, err := listBackups(filepath.Dir(filepath.Dir(cfg.Path)))
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	if len(backups) != 0 {
+		t.Errorf("Expected no backups with BackupCount=0, got %v", backups)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.BackupCount = 3
+
+	// Nothing to restore before the first update
+	if _, err := New(cfg, Options{}).Rollback(); err == nil {
+		t.Error("Expected rollback without a backup to fail")
+	}
+
+	server := newReleaseServer(t, "v1.1.0", releaseZip(t, "1.1.0"))
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "1.1.0" {
+		t.Fatalf("Expected version 1.1.0 after the update, got %s", v)
+	}
+
+	backup, err := u.Rollback()
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if backup.Version != "1.0.0" {
+		t.Errorf("Expected the 1.0.0 backup to be restored, got %s", backup.Version)
+	}
+	if v, _ := u.getCurrentVersion(); v != "1.0.0" {
+		t.Errorf("Expected version 1.0.0 after rollback, got %s", v)
+	}
+
+	// Files only the newer version had are gone
+	browserDir := filepath.Dir(cfg.Path)
+	if _, err := os.Stat(filepath.Join(browserDir, "1.1.0.txt")); err == nil {
+		t.Error("Expected files of the rolled back version to be removed")
+	}
+	if _, err := os.Stat(browserDir + ".rollback"); err == nil {
+		t.Error("Expected the replaced install to be cleaned up")
+	}
+	if mismatches, err := u.VerifyInstall(); err != nil || len(mismatches) != 0 {
+		t.Errorf("Expected the manifest to match the restored install, got %v (%v)", mismatches, err)
+	}
+}
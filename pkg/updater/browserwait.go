@@ -0,0 +1,50 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// browserPollInterval is how often WaitForBrowserClose checks whether the
+// browser is still running
+const browserPollInterval = 5 * time.Second
+
+// browserRunning reports whether the browser at an executable path is
+// running, overridable for tests
+var browserRunning = config.BrowserRunning
+
+// errBrowserRunning is returned when the browser is still running after
+// WaitForBrowserClose seconds
+var errBrowserRunning = errors.New("the browser is still running, close it and try again")
+
+// waitForBrowserClose waits up to WaitForBrowserClose seconds for the
+// browser at exePath to close, so the install does not replace the files
+// of a running browser
+func (u *Updater) waitForBrowserClose(ctx context.Context, exePath string) error {
+	if u.cfg.WaitForBrowserClose <= 0 || exePath == "" || !browserRunning(exePath) {
+		return nil
+	}
+
+	timeout := time.Duration(u.cfg.WaitForBrowserClose) * time.Second
+	fmt.Fprintf(u.out, "The browser is running, waiting up to %v for it to close...\n", timeout)
+	for waited := time.Duration(0); ; waited += browserPollInterval {
+		if waited >= timeout {
+			return errBrowserRunning
+		}
+		if waited > 0 && waited%time.Minute == 0 {
+			fmt.Fprintf(u.out, "Still waiting for the browser to close (%v left)...\n", timeout-waited)
+		}
+		sleep(browserPollInterval)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !browserRunning(exePath) {
+			fmt.Fprintln(u.out, "The browser was closed, installing.")
+			return nil
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// withRunningBrowser makes the browser look running for the first polls
+// checks, and records the paths checked
+func withRunningBrowser(t *testing.T, polls int) *[]string {
+	t.Helper()
+	var checked []string
+	origRunning, origSleep := browserRunning, sleep
+	browserRunning = func(exePath string) bool {
+		checked = append(checked, exePath)
+		return len(checked) <= polls
+	}
+	sleep = func(time.Duration) {}
+	t.Cleanup(func() { browserRunning, sleep = origRunning, origSleep })
+	return &checked
+}
+
+func TestWaitForBrowserCloseBeforeTimeout(t *testing.T) {
+	checked := withRunningBrowser(t, 3)
+	server := newReleaseServer(t, "v2.0.0", makeTestZip(t, map[string]string{"noraneko/" + config.BrowserExe: "new exe"}))
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.WaitForBrowserClose = 60
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	result, err := u.Run()
+	if err != nil || !result.Updated {
+		t.Fatalf("Expected the update once the browser closed, got %+v (%v)", result, err)
+	}
+	want := filepath.Join(filepath.Dir(cfg.Path), config.BrowserExe)
+	if len(*checked) != 4 || (*checked)[0] != want {
+		t.Errorf("Expected %s to be checked 4 times, got %v", want, *checked)
+	}
+}
+
+func TestWaitForBrowserCloseTimeout(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{"noraneko/" + config.BrowserExe: "new exe"})
+
+	// Scheduled runs defer the update and succeed
+	checked := withRunningBrowser(t, 1000)
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.WaitForBrowserClose = 60
+	u := newTestUpdater(cfg, Options{Portable: true, Scheduled: true}, server)
+	result, err := u.Run()
+	if err != nil {
+		t.Fatalf("Expected a scheduled run to defer the update, got %v", err)
+	}
+	if result.Updated || !result.UpdateAvailable || !strings.Contains(result.Message, "deferred") {
+		t.Errorf("Expected a deferred update, got %+v", result)
+	}
+	if polls := int(60*time.Second/browserPollInterval) + 1; len(*checked) != polls {
+		t.Errorf("Expected %d checks within the timeout, got %d", polls, len(*checked))
+	}
+	if got, _ := os.ReadFile(cfg.Path); string(got) != "exe" {
+		t.Errorf("Expected the running browser to be left alone, got exe %q", got)
+	}
+
+	// Other runs fail
+	withRunningBrowser(t, 1000)
+	cfg = newPortableInstall(t, "1.0.0")
+	cfg.WaitForBrowserClose = 60
+	u = newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); !errors.Is(err, errBrowserRunning) {
+		t.Errorf("Expected the run to fail with the browser running, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package updater
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// releaseCachePath returns the path of the cached release response
+func (u *Updater) releaseCachePath() string {
+	return filepath.Join(u.cfg.ExeDir, u.cfg.InstallFile(config.ReleaseCacheName))
+}
+
+// cachedRelease returns the ETag and release cached for url, or an empty
+// ETag if there is no usable cache entry
+func (u *Updater) cachedRelease(url string) (string, *Release) {
+	etag := u.cfg.CacheValue("ReleaseETag")
+	if etag == "" || u.cfg.CacheValue("ReleaseURL") != url {
+		return "", nil
+	}
+
+	data, err := os.ReadFile(u.releaseCachePath())
+	if err != nil {
+		return "", nil
+	}
+	var release Release
+	if err := json.Unmarshal(data, &release); err != nil {
+		return "", nil
+	}
+	return etag, &release
+}
+
+// saveReleaseCache stores a release response and its ETag for conditional
+// requests on later runs. Responses without an ETag are not cached.
+func (u *Updater) saveReleaseCache(url, etag string, data []byte) error {
+	if etag == "" {
+		return nil
+	}
+	if err := os.WriteFile(u.releaseCachePath(), data, 0644); err != nil {
+		return err
+	}
+	if err := u.cfg.CacheEntry("ReleaseURL", url); err != nil {
+		return err
+	}
+	return u.cfg.CacheEntry("ReleaseETag", etag)
+}
@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestGetLatestReleaseNotModified(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"tag_name": "v1.3.0", "assets": [{"name": "noraneko-windows.zip", "size": 42}]}`))
+	}))
+	defer server.Close()
+
+	u := New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL
+
+	first, err := u.getLatestRelease(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get latest release: %v", err)
+	}
+	if cfg.CacheValue("ReleaseETag") != `"v1"` {
+		t.Errorf("Expected the ETag to be cached, got '%s'", cfg.CacheValue("ReleaseETag"))
+	}
+
+	// A new Updater reuses the persisted release on 304
+	u = New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL
+
+	second, err := u.getLatestRelease(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get cached release: %v", err)
+	}
+	if notModified != 1 {
+		t.Errorf("Expected one conditional request answered with 304, got %d", notModified)
+	}
+	if second.TagName != first.TagName || len(second.Assets) != 1 || second.Assets[0].Size != 42 {
+		t.Errorf("Expected the cached release, got %+v", second)
+	}
+
+	// A cache entry for another URL is not used
+	u.apiURL = server.URL + "/other"
+	if _, err := u.getLatestRelease(context.Background()); err != nil {
+		t.Fatalf("Failed to get latest release: %v", err)
+	}
+	if notModified != 1 {
+		t.Error("Expected no conditional request for a different URL")
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+}
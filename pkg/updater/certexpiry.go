@@ -0,0 +1,104 @@
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// errNoSignature is returned for an installer without an Authenticode
+// signature
+var errNoSignature = errors.New("installer is not signed")
+
+// signingCertificates returns the certificates embedded in the Authenticode
+// signature of an installer, overridable for tests
+var signingCertificates = installerCertificates
+
+// verifySignature verifies the Authenticode signature of an installer and
+// returns the time of its timestamp, overridable for tests
+var verifySignature = authenticodeSignature
+
+// signingCertificate returns the certificate that signed an installer
+// among the certificates of its signature: the code signing certificate
+// that is not a CA, or else the first one that is not a CA
+func signingCertificate(certs []*x509.Certificate) *x509.Certificate {
+	var leaf *x509.Certificate
+	for _, cert := range certs {
+		if cert.IsCA {
+			continue
+		}
+		for _, usage := range cert.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageCodeSigning {
+				return cert
+			}
+		}
+		if leaf == nil {
+			leaf = cert
+		}
+	}
+	return leaf
+}
+
+// certExpiryProblem describes why cert is not, or soon no longer, valid at
+// now, or returns "" if it stays valid for longer than window. invalid is
+// set if the certificate is not valid at now at all.
+func certExpiryProblem(cert *x509.Certificate, now time.Time, window time.Duration) (problem string, invalid bool) {
+	const day = "2006-01-02"
+	switch {
+	case now.Before(cert.NotBefore):
+		return fmt.Sprintf("is not valid until %s", cert.NotBefore.Format(day)), true
+	case now.After(cert.NotAfter):
+		return fmt.Sprintf("expired on %s", cert.NotAfter.Format(day)), true
+	case cert.NotAfter.Sub(now) <= window:
+		days := int(cert.NotAfter.Sub(now).Hours() / 24)
+		return fmt.Sprintf("expires on %s, in %d days", cert.NotAfter.Format(day), days), false
+	}
+	return "", false
+}
+
+// checkCertExpiry verifies the Authenticode signature of the installer at
+// path and reports a missing, expired or soon expiring signing certificate.
+// An expired certificate is fine if the verified signature is timestamped
+// from while it was valid. Problems are only warnings unless
+// RequireValidCert is set; a certificate expiring within the warning window
+// is still valid and never rejected.
+func (u *Updater) checkCertExpiry(path string) error {
+	certs, err := signingCertificates(path)
+	var cert *x509.Certificate
+	if err == nil {
+		if cert = signingCertificate(certs); cert == nil {
+			err = errNoSignature
+		}
+	}
+	if err != nil {
+		if u.cfg.RequireValidCert {
+			return fmt.Errorf("cannot check the signing certificate: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: cannot check the signing certificate: %v\n", err)
+		return nil
+	}
+
+	signedAt, trustErr := verifySignature(path, !u.cfg.IgnoreCrlErrors)
+	window := time.Duration(u.cfg.CertExpiryWarnDays) * 24 * time.Hour
+	problem, invalid := certExpiryProblem(cert, clock(), window)
+	if invalid && trustErr == nil && !signedAt.IsZero() {
+		fmt.Fprintf(u.out, "Signing certificate of %s %s, but the signature was timestamped on %s.\n", cert.Subject.CommonName, problem, signedAt.Format("2006-01-02"))
+		return nil
+	}
+	switch {
+	case invalid && u.cfg.RequireValidCert:
+		return fmt.Errorf("signing certificate of %s %s", cert.Subject.CommonName, problem)
+	case trustErr != nil && u.cfg.RequireValidCert:
+		return fmt.Errorf("signature of %s is not trusted: %w", cert.Subject.CommonName, trustErr)
+	case trustErr != nil:
+		fmt.Fprintf(os.Stderr, "Warning: signature of %s is not trusted: %v\n", cert.Subject.CommonName, trustErr)
+	}
+	if problem == "" {
+		fmt.Fprintf(u.out, "Signing certificate of %s is valid until %s.\n", cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Warning: signing certificate of %s %s\n", cert.Subject.CommonName, problem)
+	return nil
+}
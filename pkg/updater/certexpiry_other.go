@@ -0,0 +1,19 @@
+//go:build !windows
+
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"time"
+)
+
+// installerCertificates is only implemented on Windows
+func installerCertificates(path string) ([]*x509.Certificate, error) {
+	return nil, errors.New("reading Authenticode signatures is only supported on Windows")
+}
+
+// authenticodeSignature is only implemented on Windows
+func authenticodeSignature(path string, checkRevocation bool) (time.Time, error) {
+	return time.Time{}, errors.New("verifying Authenticode signatures is only supported on Windows")
+}
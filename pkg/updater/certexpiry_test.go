@@ -0,0 +1,115 @@
+package updater
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestCertExpiryProblem(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	window := 30 * 24 * time.Hour
+
+	tests := []struct {
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+		problem   string
+		invalid   bool
+	}{
+		{"valid", now.AddDate(-1, 0, 0), now.AddDate(1, 0, 0), "", false},
+		{"just outside the window", now.AddDate(-1, 0, 0), now.Add(window + time.Hour), "", false},
+		{"inside the window", now.AddDate(-1, 0, 0), now.AddDate(0, 0, 10), "expires on 2024-06-11, in 10 days", false},
+		{"expires today", now.AddDate(-1, 0, 0), now.Add(time.Hour), "expires on 2024-06-01, in 0 days", false},
+		{"expired", now.AddDate(-2, 0, 0), now.AddDate(0, 0, -1), "expired on 2024-05-31", true},
+		{"not yet valid", now.AddDate(0, 0, 2), now.AddDate(1, 0, 0), "is not valid until 2024-06-03", true},
+	}
+	for _, tt := range tests {
+		cert := &x509.Certificate{NotBefore: tt.notBefore, NotAfter: tt.notAfter}
+		problem, invalid := certExpiryProblem(cert, now, window)
+		if problem != tt.problem || invalid != tt.invalid {
+			t.Errorf("%s: expected %q (invalid=%v), got %q (invalid=%v)", tt.name, tt.problem, tt.invalid, problem, invalid)
+		}
+	}
+
+	// A window of 0 only reports invalid certificates
+	cert := &x509.Certificate{NotBefore: now.AddDate(-1, 0, 0), NotAfter: now.AddDate(0, 0, 1)}
+	if problem, _ := certExpiryProblem(cert, now, 0); problem != "" {
+		t.Errorf("Expected no warning without a window, got %q", problem)
+	}
+}
+
+func TestSigningCertificate(t *testing.T) {
+	root := &x509.Certificate{IsCA: true, Subject: pkix.Name{CommonName: "Root"}}
+	timestamp := &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping}, Subject: pkix.Name{CommonName: "TSA"}}
+	signer := &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, Subject: pkix.Name{CommonName: "Signer"}}
+
+	if got := signingCertificate([]*x509.Certificate{root, timestamp, signer}); got != signer {
+		t.Errorf("Expected the code signing certificate, got %v", got)
+	}
+	if got := signingCertificate([]*x509.Certificate{root, timestamp}); got != timestamp {
+		t.Errorf("Expected the first certificate that is not a CA, got %v", got)
+	}
+	if got := signingCertificate([]*x509.Certificate{root}); got != nil {
+		t.Errorf("Expected no signing certificate among CAs, got %v", got)
+	}
+}
+
+func TestCheckCertExpiry(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	origClock, origCerts, origVerify := clock, signingCertificates, verifySignature
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock, signingCertificates, verifySignature = origClock, origCerts, origVerify })
+
+	withSigner := func(notAfter time.Time) {
+		signingCertificates = func(string) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{{
+				Subject:     pkix.Name{CommonName: "Noraneko"},
+				ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+				NotBefore:   now.AddDate(-1, 0, 0),
+				NotAfter:    notAfter,
+			}}, nil
+		}
+	}
+
+	tests := []struct {
+		name     string
+		notAfter time.Time
+		unsigned bool
+		signedAt time.Time
+		trustErr error
+		require  bool
+		err      string
+	}{
+		{"valid", now.AddDate(1, 0, 0), false, time.Time{}, nil, true, ""},
+		{"expiring soon only warns", now.AddDate(0, 0, 5), false, time.Time{}, nil, true, ""},
+		{"expired warns", now.AddDate(0, 0, -1), false, time.Time{}, nil, false, ""},
+		{"expired rejected", now.AddDate(0, 0, -1), false, time.Time{}, nil, true, "expired on 2024-05-31"},
+		{"expired but timestamped", now.AddDate(0, 0, -1), false, now.AddDate(0, -1, 0), nil, true, ""},
+		{"timestamp not verified", now.AddDate(0, 0, -1), false, now.AddDate(0, -1, 0), errors.New("bad digest"), true, "expired on 2024-05-31"},
+		{"untrusted warns", now.AddDate(1, 0, 0), false, time.Time{}, errors.New("untrusted root"), false, ""},
+		{"untrusted rejected", now.AddDate(1, 0, 0), false, time.Time{}, errors.New("untrusted root"), true, "not trusted: untrusted root"},
+		{"unsigned warns", time.Time{}, true, time.Time{}, nil, false, ""},
+		{"unsigned rejected", time.Time{}, true, time.Time{}, nil, true, "not signed"},
+	}
+	for _, tt := range tests {
+		withSigner(tt.notAfter)
+		if tt.unsigned {
+			signingCertificates = func(string) ([]*x509.Certificate, error) { return nil, errNoSignature }
+		}
+		verifySignature = func(string, bool) (time.Time, error) { return tt.signedAt, tt.trustErr }
+		u := New(&config.Config{CheckCertExpiry: true, CertExpiryWarnDays: 30, RequireValidCert: tt.require}, Options{})
+		err := u.checkCertExpiry("setup.exe")
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+//go:build windows
+
+package updater
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procCryptMsgClose = windows.NewLazySystemDLL("crypt32.dll").NewProc("CryptMsgClose")
+
+// installerCertificates returns the certificates embedded in the
+// Authenticode signature of an .exe or .msi file
+func installerCertificates(path string) ([]*x509.Certificate, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var store, msg windows.Handle
+	err = windows.CryptQueryObject(
+		windows.CERT_QUERY_OBJECT_FILE,
+		unsafe.Pointer(pathPtr),
+		windows.CERT_QUERY_CONTENT_FLAG_PKCS7_SIGNED_EMBED,
+		windows.CERT_QUERY_FORMAT_FLAG_BINARY,
+		0, nil, nil, nil, &store, &msg, nil)
+	if err != nil {
+		if errors.Is(err, windows.Errno(windows.CRYPT_E_NO_MATCH)) {
+			return nil, errNoSignature
+		}
+		return nil, fmt.Errorf("failed to read signature: %w", err)
+	}
+	defer windows.CertCloseStore(store, 0)
+	defer cryptMsgClose(msg)
+
+	var certs []*x509.Certificate
+	var ctx *windows.CertContext
+	for {
+		ctx, err = windows.CertEnumCertificatesInStore(store, ctx)
+		if err != nil {
+			break
+		}
+		encoded := unsafe.Slice(ctx.EncodedCert, ctx.Length)
+		cert, err := x509.ParseCertificate(append([]byte(nil), encoded...))
+		if err != nil {
+			continue
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// cryptMsgClose releases the message handle returned by CryptQueryObject
+func cryptMsgClose(msg windows.Handle) {
+	procCryptMsgClose.Call(uintptr(msg))
+}
+
+var (
+	wintrust                           = windows.NewLazySystemDLL("wintrust.dll")
+	procWTHelperProvDataFromStateData  = wintrust.NewProc("WTHelperProvDataFromStateData")
+	procWTHelperGetProvSignerFromChain = wintrust.NewProc("WTHelperGetProvSignerFromChain")
+)
+
+// cryptProviderSigner mirrors CRYPT_PROVIDER_SGNR
+type cryptProviderSigner struct {
+	size               uint32
+	verifyAsOf         windows.Filetime
+	certChainCount     uint32
+	certChain          uintptr
+	signerType         uint32
+	signer             uintptr
+	err                uint32
+	counterSignerCount uint32
+	counterSigners     uintptr
+	chainContext       uintptr
+}
+
+// authenticodeSignature verifies the Authenticode signature of an .exe or
+// .msi file and its certificate chain with WinVerifyTrust. A certificate
+// that has expired since is accepted if the signature carries a timestamp
+// from while it was valid; the time of that timestamp is returned, or the
+// zero time if the signature has none.
+func authenticodeSignature(path string, checkRevocation bool) (time.Time, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	file := &windows.WinTrustFileInfo{
+		Size:     uint32(unsafe.Sizeof(windows.WinTrustFileInfo{})),
+		FilePath: pathPtr,
+	}
+	data := &windows.WinTrustData{
+		Size:                            uint32(unsafe.Sizeof(windows.WinTrustData{})),
+		UIChoice:                        windows.WTD_UI_NONE,
+		RevocationChecks:                windows.WTD_REVOKE_NONE,
+		UnionChoice:                     windows.WTD_CHOICE_FILE,
+		FileOrCatalogOrBlobOrSgnrOrCert: unsafe.Pointer(file),
+		StateAction:                     windows.WTD_STATEACTION_VERIFY,
+	}
+	if checkRevocation {
+		data.RevocationChecks = windows.WTD_REVOKE_WHOLECHAIN
+	}
+	err = windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	defer func() {
+		data.StateAction = windows.WTD_STATEACTION_CLOSE
+		windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	}()
+	if err != nil {
+		if errors.Is(err, windows.Errno(windows.TRUST_E_NOSIGNATURE)) {
+			return time.Time{}, errNoSignature
+		}
+		return time.Time{}, err
+	}
+
+	provData, _, _ := procWTHelperProvDataFromStateData.Call(uintptr(data.StateData))
+	if provData == 0 {
+		return time.Time{}, nil
+	}
+	signerPtr, _, _ := procWTHelperGetProvSignerFromChain.Call(provData, 0, 0, 0)
+	if signerPtr == 0 {
+		return time.Time{}, nil
+	}
+	signer := *(**cryptProviderSigner)(unsafe.Pointer(&signerPtr))
+	if signer.counterSignerCount == 0 {
+		return time.Time{}, nil
+	}
+	// Without a timestamp this is the current time, with one it is the
+	// time the timestamp vouches for
+	return time.Unix(0, signer.verifyAsOf.Nanoseconds()), nil
+}
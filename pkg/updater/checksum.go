@@ -0,0 +1,147 @@
+package updater
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// maxChecksumFileSize limits how much a compressed checksum file may
+	// expand to
+	maxChecksumFileSize = 16 << 20
+
+	// checksumAttempts is how often the checksum file download is tried
+	checksumAttempts = 3
+
+	// checksumRetryDelay is the wait before the second attempt, doubled
+	// before each further one
+	checksumRetryDelay = 5 * time.Second
+)
+
+// gzipMagic is the leading bytes of gzip compressed data
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// checksumManifest is the JSON checksum file format, mapping file names to
+// SHA256 digests, optionally prefixed with "sha256:"
+type checksumManifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// isSignatureName reports whether an asset name is a detached signature
+func isSignatureName(name string) bool {
+	switch path.Ext(strings.ToLower(name)) {
+	case ".asc", ".sig", ".minisig":
+		return true
+	}
+	return false
+}
+
+// downloadChecksum downloads the checksum file asset to dest. Failed
+// downloads are retried with a growing delay, so a transient failure of
+// this small file does not fail the update. The wait ends early once ctx
+// is done.
+func (u *Updater) downloadChecksum(ctx context.Context, asset *Asset, dest string) error {
+	delay := checksumRetryDelay
+	for attempt := 1; ; attempt++ {
+		_, err := u.newDownloader(asset.Size, nil).Download(ctx, asset.BrowserDownloadURL, dest)
+		if err == nil || ctx.Err() != nil || attempt >= checksumAttempts {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Checksum download failed (%v), retrying in %v...\n", err, delay)
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+		delay *= 2
+	}
+}
+
+// expectedChecksum returns the lowercase SHA256 listed for fileName in a
+// checksum file. Gzip compressed files are decompressed first, and the
+// format, JSON manifest or "<hash>  <name>" lines, is detected from the
+// content.
+func expectedChecksum(checksumPath, fileName string) (string, error) {
+	data, err := readChecksumFile(checksumPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read checksum file: %w", err)
+	}
+
+	var hash string
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		hash, err = jsonChecksum(data, fileName)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		hash = textChecksum(data, fileName)
+	}
+
+	if hash == "" {
+		return "", fmt.Errorf("checksum for %s not found in checksum file", fileName)
+	}
+	return strings.ToLower(hash), nil
+}
+
+// readChecksumFile reads a checksum file, decompressing it if it is gzip
+// compressed
+func readChecksumFile(checksumPath string) ([]byte, error) {
+	data, err := os.ReadFile(checksumPath)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data, err = io.ReadAll(io.LimitReader(zr, maxChecksumFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxChecksumFileSize {
+		return nil, fmt.Errorf("decompressed checksum file exceeds %d bytes", maxChecksumFileSize)
+	}
+	return data, nil
+}
+
+// textChecksum finds fileName in "<hash>  <name>" lines, as written by
+// sha256sum
+func textChecksum(data []byte, fileName string) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.Fields(line)
+		if len(parts) >= 2 {
+			name := strings.TrimPrefix(parts[1], "*")
+			if strings.EqualFold(name, fileName) || strings.HasSuffix(name, fileName) {
+				return parts[0]
+			}
+		}
+	}
+	return ""
+}
+
+// jsonChecksum finds fileName in a JSON checksum manifest
+func jsonChecksum(data []byte, fileName string) (string, error) {
+	var manifest checksumManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse checksum manifest: %w", err)
+	}
+
+	for name, hash := range manifest.Files {
+		if strings.EqualFold(name, fileName) || strings.HasSuffix(name, "/"+fileName) {
+			return strings.TrimPrefix(strings.ToLower(hash), "sha256:"), nil
+		}
+	}
+	return "", nil
+}
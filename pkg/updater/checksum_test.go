@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// gzipData compresses data with gzip
+func gzipData(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to compress: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExpectedChecksumFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	asset := []byte("PK\x03\x04 portable zip")
+	sum := sha256.Sum256(asset)
+	digest := hex.EncodeToString(sum[:])
+	assetPath := filepath.Join(tmpDir, "noraneko-windows-x86_64-portable.zip")
+	if err := os.WriteFile(assetPath, asset, 0644); err != nil {
+		t.Fatalf("Failed to write asset: %v", err)
+	}
+
+	text := strings.Repeat("0", 64) + "  noraneko-windows-x86_64-setup.exe\n" +
+		digest + " *noraneko-windows-x86_64-portable.zip\n"
+	manifest := `{"files": {
+		"noraneko-windows-x86_64-setup.exe": "` + strings.Repeat("0", 64) + `",
+		"noraneko-windows-x86_64-portable.zip": "sha256:` + strings.ToUpper(digest) + `"
+	}}`
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"SHA256SUMS", []byte(text)},
+		{"SHA256SUMS.gz", gzipData(t, text)},
+		{"checksums.json", []byte(manifest)},
+		{"checksums.json.gz", gzipData(t, manifest)},
+	}
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checksumPath := filepath.Join(tmpDir, tt.name)
+			if err := os.WriteFile(checksumPath, tt.data, 0644); err != nil {
+				t.Fatalf("Failed to write checksum file: %v", err)
+			}
+
+			got, err := expectedChecksum(checksumPath, filepath.Base(assetPath))
+			if err != nil {
+				t.Fatalf("expectedChecksum failed: %v", err)
+			}
+			if got != digest {
+				t.Errorf("Expected %s, got %s", digest, got)
+			}
+			if err := u.verifyChecksum(assetPath, checksumPath, filepath.Base(assetPath)); err != nil {
+				t.Errorf("verifyChecksum failed: %v", err)
+			}
+
+			if _, err := expectedChecksum(checksumPath, "noraneko-linux.tar.gz"); err == nil {
+				t.Error("Expected an unlisted file to have no checksum")
+			}
+		})
+	}
+}
+
+func TestExpectedChecksumInvalidJSON(t *testing.T) {
+	checksumPath := filepath.Join(t.TempDir(), "checksums.json")
+	if err := os.WriteFile(checksumPath, []byte(`{"files": [`), 0644); err != nil {
+		t.Fatalf("Failed to write checksum file: %v", err)
+	}
+	if _, err := expectedChecksum(checksumPath, "noraneko.zip"); err == nil || !strings.Contains(err.Error(), "checksum manifest") {
+		t.Errorf("Expected a manifest parse error, got %v", err)
+	}
+}
+
+func TestFindChecksumAssetFormats(t *testing.T) {
+	tests := []struct {
+		assets   []string
+		expected string
+	}{
+		{[]string{"noraneko-portable.zip", "SHA256SUMS.gz"}, "SHA256SUMS.gz"},
+		{[]string{"noraneko-portable.zip", "checksums.json"}, "checksums.json"},
+		{[]string{"SHA256SUMS.asc", "SHA256SUMS"}, "SHA256SUMS"},
+		{[]string{"noraneko-portable.zip", "checksums.json.sig"}, ""},
+	}
+
+	for _, tt := range tests {
+		release := &Release{}
+		for _, name := range tt.assets {
+			release.Assets = append(release.Assets, Asset{Name: name})
+		}
+		u := &Updater{release: release}
+
+		got := ""
+		if asset := u.findChecksumAsset(); asset != nil {
+			got = asset.Name
+		}
+		if got != tt.expected {
+			t.Errorf("%v: expected %q, got %q", tt.assets, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// VersionComparator orders version strings of one versioning scheme.
+// Compare returns a negative number if a is older than b, zero if they are
+// the same version and a positive number if a is newer.
+type VersionComparator interface {
+	Compare(a, b string) int
+}
+
+var (
+	comparatorsMu sync.RWMutex
+	comparators   = map[string]VersionComparator{
+		"semver": semverComparator{},
+		"date":   dateComparator{},
+	}
+)
+
+// dateVersionRe matches date-based versions such as 2024.05.01, 2024-05-01
+// or 20240501
+var dateVersionRe = regexp.MustCompile(`^(?:(?:19|20)\d{2}[.-]\d{1,2}[.-]\d{1,2}|(?:19|20)\d{6})(?:\D|$)`)
+
+// RegisterVersionComparator makes a comparator available under name. The
+// name is matched against the VersionScheme setting and the branch, and
+// becomes a valid VersionScheme.
+func RegisterVersionComparator(name string, c VersionComparator) {
+	comparatorsMu.Lock()
+	defer comparatorsMu.Unlock()
+	comparators[strings.ToLower(name)] = c
+	config.RegisterVersionScheme(name)
+}
+
+// lookupComparator returns the comparator registered under name
+func lookupComparator(name string) (VersionComparator, bool) {
+	comparatorsMu.RLock()
+	defer comparatorsMu.RUnlock()
+	c, ok := comparators[strings.ToLower(name)]
+	return c, ok
+}
+
+// comparatorFor selects the comparator for a version: the configured
+// scheme, then one registered for the branch, then auto-detection from the
+// version itself
+func comparatorFor(scheme, branch, version string) VersionComparator {
+	if scheme != "" && !strings.EqualFold(scheme, "auto") {
+		if c, ok := lookupComparator(scheme); ok {
+			return c
+		}
+		fmt.Fprintf(os.Stderr, "Warning: unknown VersionScheme %s, detecting it instead\n", scheme)
+	}
+	if c, ok := lookupComparator(branch); ok {
+		return c
+	}
+	if dateVersionRe.MatchString(strings.TrimPrefix(version, "v")) {
+		return dateComparator{}
+	}
+	return semverComparator{}
+}
+
+// compareParts compares two lists of numeric version parts, treating
+// missing parts as zero
+func compareParts(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var ap, bp int
+		if i < len(a) {
+			ap = a[i]
+		}
+		if i < len(b) {
+			bp = b[i]
+		}
+		if ap != bp {
+			if ap > bp {
+				return 1
+			}
+			return -1
+		}
+	}
+	return 0
+}
+
+// semverComparator compares dotted numeric versions such as 1.2.3 or
+// Firefox-style 128.0a1. Prerelease and channel suffixes are ignored.
+type semverComparator struct{}
+
+func (semverComparator) Compare(a, b string) int {
+	return compareParts(parseVersion(strings.TrimPrefix(a, "v")), parseVersion(strings.TrimPrefix(b, "v")))
+}
+
+// dateComparator compares date-based versions such as 2024.05.01,
+// 2024-05-01 or 20240501, optionally followed by further numeric parts
+type dateComparator struct{}
+
+func (dateComparator) Compare(a, b string) int {
+	return compareParts(parseDateVersion(a), parseDateVersion(b))
+}
+
+// parseDateVersion splits a date-based version into year, month, day and
+// any following numbers
+func parseDateVersion(v string) []int {
+	var parts []int
+	for _, field := range strings.FieldsFunc(v, func(r rune) bool { return r < '0' || r > '9' }) {
+		if len(parts) == 0 && len(field) == 8 {
+			// 20240501
+			y, _ := strconv.Atoi(field[:4])
+			m, _ := strconv.Atoi(field[4:6])
+			d, _ := strconv.Atoi(field[6:])
+			parts = append(parts, y, m, d)
+			continue
+		}
+		n, _ := strconv.Atoi(field)
+		parts = append(parts, n)
+	}
+	return parts
+}
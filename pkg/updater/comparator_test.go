@@ -0,0 +1,117 @@
+package updater
+
+import (
+	"os"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestSemverComparator(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.1", "1.0.0", 1},
+		{"1.0.0", "1.0.0", 0},
+		{"v1.0.0", "1.0", 0},
+		{"1.9.0", "1.10.0", -1},
+		{"128.0a1", "127.0.2", 1},
+		{"128.0a1", "128.0", 0},
+		{"2.0.0-beta", "1.9.9", 1},
+	}
+
+	for _, tt := range tests {
+		if got := (semverComparator{}).Compare(tt.a, tt.b); sign(got) != tt.expected {
+			t.Errorf("semver Compare(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestDateComparator(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"2024.05.02", "2024.05.01", 1},
+		{"2024-05-01", "2024.05.01", 0},
+		{"20240501", "2024.5.1", 0},
+		{"2024-06-01", "2024-05-31", 1},
+		{"2023.12.31", "2024.01.01", -1},
+		{"2024.05.01.2", "2024.05.01.1", 1},
+		{"v2024.05.01", "2024-05-01-nightly", 0},
+	}
+
+	for _, tt := range tests {
+		if got := (dateComparator{}).Compare(tt.a, tt.b); sign(got) != tt.expected {
+			t.Errorf("date Compare(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+// reverseComparator orders versions backwards, to tell it apart in tests
+type reverseComparator struct{}
+
+func (reverseComparator) Compare(a, b string) int {
+	return -(semverComparator{}).Compare(a, b)
+}
+
+func TestComparatorSelection(t *testing.T) {
+	RegisterVersionComparator("Reverse", reverseComparator{})
+	defer func() {
+		comparatorsMu.Lock()
+		delete(comparators, "reverse")
+		comparatorsMu.Unlock()
+	}()
+
+	tests := []struct {
+		scheme, branch, version string
+		expected                VersionComparator
+	}{
+		{"", "nightly", "1.2.3", semverComparator{}},
+		{"", "nightly", "128.0a1", semverComparator{}},
+		{"", "nightly", "2024.05.01", dateComparator{}},
+		{"", "nightly", "v20240501", dateComparator{}},
+		{"auto", "nightly", "2024-05-01", dateComparator{}},
+		{"semver", "nightly", "2024.05.01", semverComparator{}},
+		{"DATE", "nightly", "1.2.3", dateComparator{}},
+		{"", "reverse", "1.2.3", reverseComparator{}},
+		{"semver", "reverse", "1.2.3", semverComparator{}},
+		{"unknown", "nightly", "2024.05.01", dateComparator{}},
+	}
+
+	for _, tt := range tests {
+		if got := comparatorFor(tt.scheme, tt.branch, tt.version); got != tt.expected {
+			t.Errorf("comparatorFor(%q, %q, %q) = %T, expected %T", tt.scheme, tt.branch, tt.version, got, tt.expected)
+		}
+	}
+}
+
+func TestIsNewerVersionDateScheme(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir, VersionScheme: "date"}
+	u := New(cfg, Options{})
+
+	// Dashes would end the version for the semver comparator
+	if !u.isNewerVersion("2024-05-01", "2024-05-02") {
+		t.Error("Expected 2024-05-02 to be newer than 2024-05-01")
+	}
+	if u.isNewerVersion("2024-05-02", "2024-05-01") {
+		t.Error("Expected 2024-05-01 not to be newer than 2024-05-02")
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n > 0:
+		return 1
+	case n < 0:
+		return -1
+	}
+	return 0
+}
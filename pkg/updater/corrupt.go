@@ -0,0 +1,136 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// installKeyFiles are files of an install, besides the browser executable,
+// that are never empty. Which of them exist depends on the build.
+var installKeyFiles = []string{"application.ini", "platform.ini", "omni.ja", "browser/omni.ja"}
+
+// installProblems lists what is wrong with the install in dir: a missing
+// browser executable browserExe or empty key files, as left behind by an
+// interrupted update. A directory without any key file is not an install,
+// so it has no problems and is never removed as a broken one.
+func installProblems(dir, browserExe string) []string {
+	var problems []string
+	found := false
+	for _, name := range append([]string{browserExe}, installKeyFiles...) {
+		info, err := os.Stat(longPath(filepath.Join(dir, filepath.FromSlash(name))))
+		switch {
+		case err != nil:
+			if name == browserExe {
+				problems = append(problems, name+" is missing")
+			}
+		case info.Mode().IsRegular() && info.Size() == 0:
+			found = true
+			problems = append(problems, name+" is empty")
+		default:
+			found = true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return problems
+}
+
+// corruptInstall checks the directory updates are installed to and
+// returns it with its problems if it holds a broken install, or an empty
+// string if it does not
+func (u *Updater) corruptInstall() (string, []string) {
+	dir := u.extractDir()
+	problems := installProblems(dir, u.cfg.BrowserExeName())
+	if len(problems) == 0 {
+		return "", nil
+	}
+	return dir, problems
+}
+
+// protectedDir reports whether dir is, or holds, a directory no install
+// may be removed from: a volume root, the user profile, Program Files or
+// the Windows directory. A configured Path pointing there must not make
+// ReinstallIfCorrupt delete it.
+func protectedDir(dir string) bool {
+	dir = filepath.Clean(dir)
+	if filepath.Dir(dir) == dir {
+		return true
+	}
+	protected := []string{os.Getenv("USERPROFILE"), os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)"),
+		os.Getenv("ProgramW6432"), os.Getenv("SystemRoot")}
+	if home, err := os.UserHomeDir(); err == nil {
+		protected = append(protected, home)
+	}
+	for _, p := range protected {
+		if p == "" {
+			continue
+		}
+		rel, err := filepath.Rel(strings.ToLower(dir), strings.ToLower(filepath.Clean(p)))
+		if err == nil && filepath.IsLocal(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeBrokenInstall deletes the files of the broken install found by
+// Run with ReinstallIfCorrupt, so the new release is not laid over its
+// remains. Only files listed in the install manifest are deleted, so
+// whatever else shares the directory is left alone; without a manifest
+// nothing is. With the skip-listed overwrite policy, PreserveFiles are
+// kept as an update would keep them.
+func (u *Updater) removeBrokenInstall() error {
+	dir := u.wipeDir
+	if dir == "" {
+		return nil
+	}
+	if protectedDir(dir) {
+		return fmt.Errorf("refusing to remove the broken install at %s, it is a system or profile folder", dir)
+	}
+
+	manifest, err := u.loadManifest()
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintf(os.Stderr, "Warning: %s has no install manifest, installing over the broken install without removing it\n", dir)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove the broken install: %w", err)
+	}
+	fmt.Fprintf(u.out, "Removing the broken install at %s...\n", dir)
+
+	dirs := map[string]bool{}
+	for rel := range manifest {
+		rel = filepath.FromSlash(rel)
+		if !filepath.IsLocal(rel) {
+			continue
+		}
+		if u.cfg.OverwritePolicy == config.OverwriteSkipListed && isPreserved(rel, u.cfg.PreserveFiles) {
+			continue
+		}
+		if err := os.Remove(longPath(filepath.Join(dir, rel))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove the broken install: %w", err)
+		}
+		for parent := filepath.Dir(rel); parent != "."; parent = filepath.Dir(parent) {
+			dirs[parent] = true
+		}
+	}
+
+	// Remove the folders emptied above, deepest first; folders with other
+	// files stay
+	sorted := slices.Collect(maps.Keys(dirs))
+	slices.SortFunc(sorted, func(a, b string) int { return len(b) - len(a) })
+	for _, rel := range sorted {
+		os.Remove(longPath(filepath.Join(dir, rel)))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// writeInstallFiles creates files with the given content below dir
+func writeInstallFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestInstallProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected []string
+	}{
+		{"not installed", nil, nil},
+		{"unrelated folder", map[string]string{"readme.txt": "hello"}, nil},
+		{"healthy", map[string]string{config.BrowserExe: "exe", "application.ini": "[App]", "browser/omni.ja": "PK"}, nil},
+		{"missing exe", map[string]string{"application.ini": "[App]", "omni.ja": "PK"}, []string{config.BrowserExe + " is missing"}},
+		{"empty key files", map[string]string{config.BrowserExe: "exe", "application.ini": "", "browser/omni.ja": ""},
+			[]string{"application.ini is empty", "browser/omni.ja is empty"}},
+		{"empty exe", map[string]string{config.BrowserExe: ""}, []string{config.BrowserExe + " is empty"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), config.BrowserName)
+			writeInstallFiles(t, dir, tt.files)
+			if got := installProblems(dir, config.BrowserExe); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunReinstallIfCorrupt(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=1.0.0\n",
+		"noraneko/omni.ja":         "PK new",
+	})
+	server := newReleaseServer(t, "v1.0.0", archive)
+
+	// An interrupted update left an empty omni.ja and a stray file
+	newBrokenInstall := func() (*config.Config, string) {
+		cfg := newPortableInstall(t, "1.0.0")
+		browserDir := filepath.Dir(cfg.Path)
+		writeInstallFiles(t, browserDir, map[string]string{
+			"omni.ja":                         "",
+			"stray.dll":                       "old",
+			"distribution/policies.json":      "{}",
+			"distribution/extensions/old.xpi": "old",
+		})
+		return cfg, browserDir
+	}
+
+	// Without the flag the broken install is only reported
+	cfg, browserDir := newBrokenInstall()
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(browserDir, "omni.ja")); len(data) != 0 {
+		t.Error("Expected no reinstall without -reinstall-if-corrupt")
+	}
+
+	// Without an install manifest nothing is removed
+	cfg, browserDir = newBrokenInstall()
+	u = newTestUpdater(cfg, Options{Portable: true, ReinstallIfCorrupt: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(browserDir, "stray.dll")); err != nil {
+		t.Errorf("Expected no file to be removed without a manifest: %v", err)
+	}
+
+	// With it the files of the manifest are removed and replaced, even at
+	// the same version. Files the manifest does not list are kept.
+	cfg, browserDir = newBrokenInstall()
+	cfg.OverwritePolicy = config.OverwriteSkipListed
+	cfg.PreserveFiles = []string{"distribution/policies.json"}
+	writeInstallFiles(t, browserDir, map[string]string{"notes.txt": "mine"})
+	u = newTestUpdater(cfg, Options{Portable: true, ReinstallIfCorrupt: true}, server)
+	manifest := Manifest{}
+	for _, name := range []string{config.BrowserExe, "application.ini", "omni.ja", "stray.dll", "distribution/policies.json", "distribution/extensions/old.xpi"} {
+		manifest[name] = "digest"
+	}
+	if err := u.saveManifest(manifest); err != nil {
+		t.Fatal(err)
+	}
+	result, err := u.Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !result.Updated {
+		t.Errorf("Expected a reinstall, got %+v", result)
+	}
+	if data, _ := os.ReadFile(filepath.Join(browserDir, "omni.ja")); string(data) != "PK new" {
+		t.Errorf("Expected the new omni.ja, got %q", data)
+	}
+	for _, name := range []string{"stray.dll", "distribution/extensions"} {
+		if _, err := os.Stat(filepath.Join(browserDir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("Expected %s of the broken install to be removed", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(browserDir, "distribution", "policies.json")); err != nil {
+		t.Errorf("Expected the preserved file to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(browserDir, "notes.txt")); err != nil {
+		t.Errorf("Expected the file missing from the manifest to be kept: %v", err)
+	}
+	if problems := installProblems(browserDir, config.BrowserExe); len(problems) != 0 {
+		t.Errorf("Expected a healthy install, got %v", problems)
+	}
+}
+
+func TestProtectedDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	tests := []struct {
+		dir       string
+		protected bool
+	}{
+		{string(filepath.Separator), true},
+		{home, true},
+		{filepath.Dir(home), true},
+		{filepath.Join(home, "Noraneko"), false},
+	}
+	for _, tt := range tests {
+		if got := protectedDir(tt.dir); got != tt.protected {
+			t.Errorf("protectedDir(%s): expected %v, got %v", tt.dir, tt.protected, got)
+		}
+	}
+
+	u := New(&config.Config{}, Options{})
+	u.wipeDir = home
+	if err := u.removeBrokenInstall(); err == nil {
+		t.Error("Expected removing the profile folder to be refused")
+	}
+}
@@ -0,0 +1,327 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// cosignFileLimit caps the size of signature, certificate and bundle
+// assets read for cosign verification
+const cosignFileLimit = 1 << 20
+
+// cosignSignature is a cosign signature of a file with the signing
+// certificate and transparency log entries of keyless signing, if any
+type cosignSignature struct {
+	Sig     []byte
+	Certs   [][]byte
+	Entries []tlogEntry
+}
+
+// legacyCosignBundle is the bundle written by cosign sign-blob --bundle
+// before it used the Sigstore bundle format
+type legacyCosignBundle struct {
+	Base64Signature string `json:"base64Signature"`
+	Cert            string `json:"cert"`
+	RekorBundle     *struct {
+		SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+		Payload              struct {
+			Body           []byte      `json:"body"`
+			IntegratedTime json.Number `json:"integratedTime"`
+			LogIndex       json.Number `json:"logIndex"`
+			LogID          string      `json:"logID"`
+		} `json:"Payload"`
+	} `json:"rekorBundle"`
+}
+
+// verifyCosign checks the cosign signature published with the asset: a
+// <asset>.sigstore.json or <asset>.bundle bundle, or <asset>.sig. With
+// CosignPublicKey the signature must be made with that key, otherwise by a
+// certificate chaining to AttestationTrustedRoot whose identity matches
+// CosignIdentity, at a time a bundle's Rekor entry proves.
+func (u *Updater) verifyCosign(ctx context.Context, path string) error {
+	sig, err := u.fetchCosignSignature(ctx, u.asset.Name)
+	if err != nil {
+		return err
+	}
+
+	if u.cfg.CosignPublicKey != "" {
+		key, err := loadCosignPublicKey(u.cfg.CosignPublicKey)
+		if err != nil {
+			return err
+		}
+		return checkFileSignature(key, path, sig.Sig)
+	}
+
+	roots, err := loadAttestationRoots(u.cfg.AttestationTrustedRoot)
+	if err != nil {
+		return err
+	}
+	rekorKey, err := loadRekorKey(u.cfg.RekorPublicKey)
+	if err != nil {
+		return err
+	}
+	leaf, err := verifyCosignCert(sig, roots, rekorKey, u.cfg.CosignIdentity)
+	if err != nil {
+		return err
+	}
+	return checkFileSignature(leaf.PublicKey, path, sig.Sig)
+}
+
+// fetchCosignSignature downloads the cosign signature of the named asset
+// from the release, preferring a bundle
+func (u *Updater) fetchCosignSignature(ctx context.Context, name string) (*cosignSignature, error) {
+	for _, ext := range []string{".sigstore.json", ".bundle"} {
+		if asset := u.releaseAsset(name + ext); asset != nil {
+			data, err := u.fetchSmallAsset(ctx, asset)
+			if err != nil {
+				return nil, err
+			}
+			return parseCosignBundle(data)
+		}
+	}
+
+	sigAsset := u.releaseAsset(name + ".sig")
+	if sigAsset == nil {
+		return nil, fmt.Errorf("the release has no cosign signature for %s", name)
+	}
+	data, err := u.fetchSmallAsset(ctx, sigAsset)
+	if err != nil {
+		return nil, err
+	}
+	return &cosignSignature{Sig: decodeBase64OrRaw(data)}, nil
+}
+
+// releaseAsset returns the asset of the release with the given name,
+// ignoring case
+func (u *Updater) releaseAsset(name string) *Asset {
+	for i := range u.release.Assets {
+		if strings.EqualFold(u.release.Assets[i].Name, name) {
+			return &u.release.Assets[i]
+		}
+	}
+	return nil
+}
+
+// fetchSmallAsset downloads an asset of at most cosignFileLimit bytes, or
+// returns the copy kept with a staged update
+func (u *Updater) fetchSmallAsset(ctx context.Context, asset *Asset) ([]byte, error) {
+	if u.staged != nil {
+		data, ok := u.staged.Signatures[asset.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s was not staged with the update", asset.Name)
+		}
+		return data, nil
+	}
+
+	req, err := u.newRequest(ctx, "GET", asset.BrowserDownloadURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := u.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: status %d", asset.Name, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, cosignFileLimit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", asset.Name, err)
+	}
+	if len(data) > cosignFileLimit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", asset.Name, cosignFileLimit)
+	}
+	if u.signatures == nil {
+		u.signatures = map[string][]byte{}
+	}
+	u.signatures[asset.Name] = data
+	return data, nil
+}
+
+// parseCosignBundle reads the signature from a Sigstore bundle or a
+// legacy cosign bundle
+func parseCosignBundle(data []byte) (*cosignSignature, error) {
+	var bundle attestationBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to decode cosign bundle: %w", err)
+	}
+	if len(bundle.MessageSignature.Signature) > 0 {
+		return &cosignSignature{
+			Sig:     bundle.MessageSignature.Signature,
+			Certs:   bundle.VerificationMaterial.certificates(),
+			Entries: bundle.VerificationMaterial.TlogEntries,
+		}, nil
+	}
+
+	var legacy legacyCosignBundle
+	if err := json.Unmarshal(data, &legacy); err != nil || legacy.Base64Signature == "" {
+		return nil, errors.New("cosign bundle has no signature")
+	}
+	sigBytes, err := base64.StdEncoding.DecodeString(legacy.Base64Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cosign bundle signature: %w", err)
+	}
+	sig := &cosignSignature{Sig: sigBytes}
+	if legacy.Cert != "" {
+		if sig.Certs, err = parseCertificatePEM(decodeBase64OrRaw([]byte(legacy.Cert))); err != nil {
+			return nil, fmt.Errorf("invalid cosign bundle certificate: %w", err)
+		}
+	}
+	if rekor := legacy.RekorBundle; rekor != nil {
+		keyID, err := hex.DecodeString(rekor.Payload.LogID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cosign bundle log ID: %w", err)
+		}
+		var entry tlogEntry
+		entry.LogIndex = rekor.Payload.LogIndex
+		entry.LogID.KeyID = keyID
+		entry.IntegratedTime = rekor.Payload.IntegratedTime
+		entry.InclusionPromise.SignedEntryTimestamp = rekor.SignedEntryTimestamp
+		entry.CanonicalizedBody = rekor.Payload.Body
+		sig.Entries = []tlogEntry{entry}
+	}
+	return sig, nil
+}
+
+// verifyCosignCert checks the signing certificate of a keyless signature:
+// it must chain to roots at the time a signed entry timestamp of the Rekor
+// log with rekorKey proves the signature was logged, and have an identity
+// matching the whole of the identity pattern
+func verifyCosignCert(sig *cosignSignature, roots *x509.CertPool, rekorKey *ecdsa.PublicKey, identity string) (*x509.Certificate, error) {
+	if len(sig.Certs) == 0 {
+		return nil, errors.New("keyless cosign signature has no certificate, publish a bundle or set CosignPublicKey for key-based signatures")
+	}
+
+	// Signing certificates expire minutes after they are issued, so they
+	// are checked when the signature was logged
+	logged, err := loggedTime(sig.Entries, rekorKey, func(entry *rekorEntry) bool {
+		return entry.Kind == "hashedrekord" &&
+			bytes.Equal(entry.Spec.Signature.Content, sig.Sig) &&
+			hasVerifier(entry.Spec.Signature.PublicKey.Content, sig.Certs[0])
+	})
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := verifySigningCert(sig.Certs, roots, logged)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile("^(?:" + identity + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid CosignIdentity: %w", err)
+	}
+	var identities []string
+	for _, uri := range leaf.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, leaf.EmailAddresses...)
+	for _, id := range identities {
+		if re.MatchString(id) {
+			return leaf, nil
+		}
+	}
+	return nil, fmt.Errorf("signing certificate identity %s does not match CosignIdentity", strings.Join(identities, ", "))
+}
+
+// loadCosignPublicKey reads a PEM public key
+func loadCosignPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cosign public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM public key found in %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cosign public key: %w", err)
+	}
+	return key, nil
+}
+
+// checkFileSignature verifies a cosign signature of the file at path: an
+// ECDSA or RSA signature of its SHA256 digest, or an Ed25519 signature of
+// its content
+func checkFileSignature(key crypto.PublicKey, path string, sig []byte) error {
+	if key, ok := key.(ed25519.PublicKey); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, data, sig) {
+			return errors.New("cosign signature does not match the download")
+		}
+		return nil
+	}
+
+	digestHex, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	digest, err := hex.DecodeString(digestHex)
+	if err != nil {
+		return err
+	}
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return errors.New("cosign signature does not match the download")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return errors.New("cosign signature does not match the download")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// parseCertificatePEM returns the DER certificates of PEM data
+func parseCertificatePEM(data []byte) ([][]byte, error) {
+	var certs [][]byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// decodeBase64OrRaw decodes base64 text as cosign writes signatures and
+// certificates, returning other data unchanged
+func decodeBase64OrRaw(data []byte) []byte {
+	decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return data
+	}
+	return decoded
+}
@@ -0,0 +1,258 @@
+package updater
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// cosignArtifact is the signed test asset
+const cosignArtifact = "noraneko-windows-x86_64-portable.zip"
+
+// newCosignUpdater returns an Updater whose release publishes the given
+// files next to the asset, and the path of the downloaded asset
+func newCosignUpdater(t *testing.T, cfg *config.Config, content []byte, files map[string][]byte) (*Updater, string) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	release := &Release{TagName: "v2.0.0", Assets: []Asset{{Name: cosignArtifact, BrowserDownloadURL: server.URL + "/" + cosignArtifact}}}
+	for name := range files {
+		release.Assets = append(release.Assets, Asset{Name: name, BrowserDownloadURL: server.URL + "/" + name})
+	}
+
+	path := filepath.Join(t.TempDir(), cosignArtifact)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write artifact: %v", err)
+	}
+	u := New(cfg, Options{})
+	u.release = release
+	u.asset = &release.Assets[0]
+	return u, path
+}
+
+// signBlob signs content like cosign sign-blob with an ECDSA key, returning
+// the base64 signature
+func signBlob(t *testing.T, key *ecdsa.PrivateKey, content []byte) []byte {
+	t.Helper()
+	digest := sha256.Sum256(content)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig))
+}
+
+// issue returns a leaf certificate for identity issued by the signer's root
+func (s *testSigner) issue(t *testing.T, identity string) ([]byte, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	uri, _ := url.Parse(identity)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		NotBefore:    s.issued,
+		NotAfter:     s.issued.Add(10 * time.Minute),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		URIs:         []*url.URL{uri},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.root, &key.PublicKey, s.rootKey)
+	if err != nil {
+		t.Fatalf("Failed to create leaf: %v", err)
+	}
+	return der, key
+}
+
+func TestVerifyCosignPublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode public key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	cfg := &config.Config{VerifyCosign: true, CosignPublicKey: keyPath}
+
+	content := []byte("PK\x03\x04 test artifact")
+	sig := signBlob(t, key, content)
+
+	u, path := newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".sig": sig})
+	if err := u.verifyDownload(context.Background(), path); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+
+	// A tampered download fails
+	u, path = newCosignUpdater(t, cfg, []byte("PK\x03\x04 tampered"), map[string][]byte{cosignArtifact + ".sig": sig})
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "does not match the download") {
+		t.Errorf("Expected the tampered download to fail, got %v", err)
+	}
+
+	// So does a missing signature
+	u, path = newCosignUpdater(t, cfg, content, nil)
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "no cosign signature") {
+		t.Errorf("Expected a missing signature to fail, got %v", err)
+	}
+}
+
+// cosignBundle returns a Sigstore bundle of a keyless signature, logged in
+// the signer's log unless logged is false
+func (s *testSigner) cosignBundle(t *testing.T, cert, sig []byte, logged bool) []byte {
+	t.Helper()
+	entries := []any{}
+	if logged {
+		entries = append(entries, s.tlogEntry(t, map[string]any{
+			"apiVersion": "0.0.1",
+			"kind":       "hashedrekord",
+			"spec": map[string]any{
+				"signature": map[string]any{
+					"content":   sig,
+					"publicKey": map[string]any{"content": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})},
+				},
+			},
+		}))
+	}
+	return mustJSON(t, map[string]any{
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]any{"rawBytes": cert},
+			"tlogEntries": entries,
+		},
+		"messageSignature": map[string]any{"signature": sig},
+	})
+}
+
+func TestVerifyCosignKeyless(t *testing.T) {
+	signer := newTestSigner(t)
+	rootPath := filepath.Join(t.TempDir(), "fulcio.pem")
+	if err := os.WriteFile(rootPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signer.root.Raw}), 0644); err != nil {
+		t.Fatalf("Failed to write root: %v", err)
+	}
+	cfg := &config.Config{
+		VerifyCosign:           true,
+		CosignIdentity:         `https://github\.com/f3liz-dev/noraneko/.*`,
+		AttestationTrustedRoot: rootPath,
+		RekorPublicKey:         signer.rekorKeyPath(t),
+	}
+
+	content := []byte("PK\x03\x04 test artifact")
+	cert, key := signer.issue(t, "https://github.com/f3liz-dev/noraneko/.github/workflows/release.yml@refs/tags/v2.0.0")
+	sig := mustDecodeBase64(t, signBlob(t, key, content))
+
+	// A Sigstore bundle with the signature logged while the certificate
+	// was valid
+	bundle := signer.cosignBundle(t, cert, sig, true)
+	u, path := newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".sigstore.json": bundle})
+	if err := u.verifyDownload(context.Background(), path); err != nil {
+		t.Errorf("Expected a valid bundle, got %v", err)
+	}
+
+	// A tampered download fails
+	u, path = newCosignUpdater(t, cfg, []byte("PK\x03\x04 tampered"), map[string][]byte{cosignArtifact + ".sigstore.json": bundle})
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "does not match the download") {
+		t.Errorf("Expected the tampered download to fail, got %v", err)
+	}
+
+	// Without a log entry proving when it was made, the signature is
+	// rejected
+	u, path = newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".sigstore.json": signer.cosignBundle(t, cert, sig, false)})
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "no transparency log entry") {
+		t.Errorf("Expected a bundle without a log entry to be rejected, got %v", err)
+	}
+	files := map[string][]byte{
+		cosignArtifact + ".sig": []byte(base64.StdEncoding.EncodeToString(sig)),
+		cosignArtifact + ".pem": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}),
+	}
+	u, path = newCosignUpdater(t, cfg, content, files)
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "no certificate") {
+		t.Errorf("Expected a keyless signature without a bundle to be rejected, got %v", err)
+	}
+
+	// So is a log entry of another signature
+	otherSig := mustDecodeBase64(t, signBlob(t, key, []byte("other")))
+	var swapped map[string]any
+	if err := json.Unmarshal(signer.cosignBundle(t, cert, otherSig, true), &swapped); err != nil {
+		t.Fatalf("Failed to decode bundle: %v", err)
+	}
+	swapped["messageSignature"] = map[string]any{"signature": sig}
+	u, path = newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".sigstore.json": mustJSON(t, swapped)})
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "for another signature") {
+		t.Errorf("Expected a log entry of another signature to be rejected, got %v", err)
+	}
+
+	// A legacy cosign bundle carries the log entry too
+	entry := signer.tlogEntry(t, map[string]any{
+		"kind": "hashedrekord",
+		"spec": map[string]any{"signature": map[string]any{
+			"content":   sig,
+			"publicKey": map[string]any{"content": pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})},
+		}},
+	})
+	legacy := mustJSON(t, map[string]any{
+		"base64Signature": base64.StdEncoding.EncodeToString(sig),
+		"cert":            base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})),
+		"rekorBundle": map[string]any{
+			"SignedEntryTimestamp": entry["inclusionPromise"].(map[string]any)["signedEntryTimestamp"],
+			"Payload": map[string]any{
+				"body":           entry["canonicalizedBody"],
+				"integratedTime": signer.issued.Add(time.Minute).Unix(),
+				"logIndex":       42,
+				"logID":          hex.EncodeToString(entry["logId"].(map[string]any)["keyId"].([]byte)),
+			},
+		},
+	})
+	u, path = newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".bundle": legacy})
+	if err := u.verifyDownload(context.Background(), path); err != nil {
+		t.Errorf("Expected a valid legacy bundle, got %v", err)
+	}
+
+	// A certificate of another identity is rejected
+	other, otherKey := signer.issue(t, "https://github.com/someone/else/.github/workflows/release.yml@refs/heads/main")
+	otherBundle := signer.cosignBundle(t, other, mustDecodeBase64(t, signBlob(t, otherKey, content)), true)
+	u, path = newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".sigstore.json": otherBundle})
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "does not match CosignIdentity") {
+		t.Errorf("Expected another identity to be rejected, got %v", err)
+	}
+}
+
+func mustDecodeBase64(t *testing.T, data []byte) []byte {
+	t.Helper()
+	decoded, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	return decoded
+}
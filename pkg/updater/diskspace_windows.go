@@ -0,0 +1,28 @@
+//go:build windows
+
+package updater
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procGetDiskFreeSpaceEx = kernel32.NewProc("GetDiskFreeSpaceExW")
+)
+
+// diskFree returns the bytes available to the current user on the volume
+// holding dir
+func diskFree(dir string) (uint64, error) {
+	p, err := syscall.UTF16PtrFromString(longPath(dir))
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	r, _, err := procGetDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if r == 0 {
+		return 0, err
+	}
+	return available, nil
+}
@@ -0,0 +1,213 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errRangeUnsupported is returned when the server cannot serve byte ranges
+var errRangeUnsupported = errors.New("server does not support range requests")
+
+// fetchMultiConn downloads a file using several parallel Range requests,
+// each writing its own byte segment of the destination file
+func (d *Downloader) fetchMultiConn(ctx context.Context, url, filepath string) error {
+	size, err := d.probeRangeSupport(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	connections := d.Connections
+	if int64(connections) > size {
+		connections = int(size)
+	}
+	if connections < 2 {
+		return errRangeUnsupported
+	}
+
+	out, err := os.Create(filepath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if err := out.Truncate(size); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	progress := newProgressWriter(d.Progress, size, connections)
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	segmentSize := size / int64(connections)
+	for i := 0; i < connections; i++ {
+		start := int64(i) * segmentSize
+		end := start + segmentSize - 1
+		if i == connections-1 {
+			end = size - 1
+		}
+
+		wg.Add(1)
+		go func(segment int, start, end int64) {
+			defer wg.Done()
+			if err := d.fetchSegment(ctx, url, out, progress.segment(segment), start, end); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return fmt.Errorf("segmented download failed: %w", firstErr)
+	}
+	return progress.finish()
+}
+
+// probeRangeSupport requests the first byte of the file and returns the
+// total size if the server answers with a partial response
+func (d *Downloader) probeRangeSupport(ctx context.Context, url string) (int64, error) {
+	req, err := d.u.newRequest(ctx, "GET", url)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+
+	resp, err := d.u.do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := checkLoginWall(resp); err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, errRangeUnsupported
+	}
+
+	// Content-Range: bytes 0-0/12345
+	contentRange := resp.Header.Get("Content-Range")
+	idx := strings.LastIndex(contentRange, "/")
+	if idx == -1 {
+		return 0, errRangeUnsupported
+	}
+	size, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil || size <= 0 {
+		return 0, errRangeUnsupported
+	}
+
+	return size, nil
+}
+
+// fetchSegment fetches bytes start-end (inclusive) and writes them at the
+// same offset in out
+func (d *Downloader) fetchSegment(ctx context.Context, url string, out io.WriterAt, progress io.Writer, start, end int64) error {
+	req, err := d.u.newRequest(ctx, "GET", url)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	resp, err := d.u.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("range %d-%d returned status %d", start, end, resp.StatusCode)
+	}
+
+	length := end - start + 1
+	written, err := io.Copy(io.MultiWriter(io.NewOffsetWriter(out, start), progress), io.LimitReader(resp.Body, length))
+	if err != nil {
+		return err
+	}
+	if written != length {
+		return fmt.Errorf("range %d-%d: received %d of %d bytes", start, end, written, length)
+	}
+
+	return nil
+}
+
+// progressWriter counts the bytes written by one or more download streams,
+// each writing a segment of the file, and reports their sum to the
+// ProgressFunc, which is never called concurrently and sees it only grow
+type progressWriter struct {
+	mu       sync.Mutex
+	segments []int64
+	done     int64
+	total    int64
+	fn       ProgressFunc
+}
+
+// newProgressWriter returns a writer reporting progress towards total
+// bytes to fn, which may be nil. Writes to it count as the first segment;
+// a download in several segments writes each to segment(i).
+func newProgressWriter(fn ProgressFunc, total int64, segments int) *progressWriter {
+	return &progressWriter{segments: make([]int64, max(segments, 1)), total: total, fn: fn}
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.add(0, int64(len(b)))
+	return len(b), nil
+}
+
+// segment returns a writer counting the bytes of segment i
+func (p *progressWriter) segment(i int) io.Writer {
+	return segmentWriter{p, i}
+}
+
+// add counts n more bytes of segment i
+func (p *progressWriter) add(i int, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.segments[i] += n
+	p.done += n
+	if p.fn != nil {
+		p.fn(p.done, p.total)
+	}
+}
+
+// finish checks that the segments add up to the total once they are all
+// done, so the last report was the full size
+func (p *progressWriter) finish() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var sum int64
+	for _, n := range p.segments {
+		sum += n
+	}
+	if sum != p.total {
+		return fmt.Errorf("segmented download received %d of %d bytes", sum, p.total)
+	}
+	return nil
+}
+
+// segmentWriter counts the bytes written to it as one segment of a
+// progressWriter
+type segmentWriter struct {
+	p *progressWriter
+	i int
+}
+
+func (w segmentWriter) Write(b []byte) (int, error) {
+	w.p.add(w.i, int64(len(b)))
+	return len(b), nil
+}
@@ -0,0 +1,436 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// testPayload returns deterministic content of the given size
+func testPayload(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	return data
+}
+
+func TestDownloadMultiConn(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	payload := testPayload(100003)
+	var rangeRequests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&rangeRequests, 1)
+		}
+		http.ServeContent(w, r, "asset.zip", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ExeDir:              tmpDir,
+		WorkDir:             tmpDir,
+		DownloadConnections: 4,
+	}
+	u := New(cfg, Options{})
+
+	dest := filepath.Join(tmpDir, "asset.zip")
+	if _, err := u.newDownloader(0, nil).Download(context.Background(), server.URL+"/asset.zip", dest); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Error("Reassembled file does not match the original")
+	}
+
+	// One probe plus one request per segment
+	if got := atomic.LoadInt32(&rangeRequests); got != 5 {
+		t.Errorf("Expected 5 range requests, got %d", got)
+	}
+}
+
+func TestProgressWriterSegments(t *testing.T) {
+	// Run with -race: segments report from their own goroutines
+	const segments, writes, chunk = 8, 500, 37
+	total := int64(segments * writes * chunk)
+
+	var calls, last, lastTotal int64
+	var inCall atomic.Int32
+	agg := newProgressWriter(func(done, size int64) {
+		if inCall.Add(1) != 1 {
+			t.Error("ProgressFunc called concurrently")
+		}
+		if done < last {
+			t.Errorf("Progress went backwards: %d after %d", done, last)
+		}
+		calls++
+		last, lastTotal = done, size
+		inCall.Add(-1)
+	}, total, segments)
+
+	var wg sync.WaitGroup
+	buf := make([]byte, chunk)
+	for i := 0; i < segments; i++ {
+		wg.Add(1)
+		go func(w io.Writer) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				w.Write(buf)
+			}
+		}(agg.segment(i))
+	}
+	wg.Wait()
+
+	if err := agg.finish(); err != nil {
+		t.Fatalf("Expected the segments to add up: %v", err)
+	}
+	if last != total || lastTotal != total || calls != segments*writes {
+		t.Errorf("Expected %d reports ending at %d of %d, got %d ending at %d of %d",
+			segments*writes, total, total, calls, last, lastTotal)
+	}
+	for i, n := range agg.segments {
+		if n != writes*chunk {
+			t.Errorf("Segment %d counted %d bytes, expected %d", i, n, writes*chunk)
+		}
+	}
+
+	// A short segment is caught
+	short := newProgressWriter(nil, 10, 2)
+	short.segment(0).Write(make([]byte, 5))
+	short.segment(1).Write(make([]byte, 4))
+	if err := short.finish(); err == nil {
+		t.Error("Expected a short download to fail")
+	}
+}
+
+func TestDownloadMultiConnFallback(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	payload := testPayload(4096)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ignore Range headers entirely
+		atomic.AddInt32(&requests, 1)
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ExeDir:              tmpDir,
+		WorkDir:             tmpDir,
+		DownloadConnections: 4,
+	}
+	u := New(cfg, Options{})
+
+	dest := filepath.Join(tmpDir, "asset.zip")
+	if _, err := u.newDownloader(0, nil).Download(context.Background(), server.URL+"/asset.zip", dest); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(data, payload) {
+		t.Error("Downloaded file does not match the original")
+	}
+
+	// The probe plus the single-stream fallback
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("Expected 2 requests, got %d", got)
+	}
+}
+
+func TestDownloadMultiConnChecksum(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	payload := testPayload(65536)
+	sum := sha256.Sum256(payload)
+	sums := fmt.Sprintf("%s  noraneko-windows.zip\n", hex.EncodeToString(sum[:]))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/noraneko-windows.zip", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "noraneko-windows.zip", time.Time{}, bytes.NewReader(payload))
+	})
+	mux.HandleFunc("/sha256sums.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sums))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := &config.Config{
+		ExeDir:              tmpDir,
+		WorkDir:             tmpDir,
+		DownloadConnections: 3,
+	}
+	u := New(cfg, Options{})
+
+	dest := filepath.Join(tmpDir, "noraneko-windows.zip")
+	if _, err := u.newDownloader(0, nil).Download(context.Background(), server.URL+"/noraneko-windows.zip", dest); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	checksumPath := filepath.Join(tmpDir, "sha256sums.txt")
+	if _, err := u.newDownloader(0, nil).Download(context.Background(), server.URL+"/sha256sums.txt", checksumPath); err != nil {
+		t.Fatalf("Checksum download failed: %v", err)
+	}
+	if err := u.verifyChecksum(dest, checksumPath, "noraneko-windows.zip"); err != nil {
+		t.Errorf("Checksum verification failed: %v", err)
+	}
+}
+
+func TestDownloadSizeMismatch(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The server ends the response early but still answers 200
+	payload := testPayload(1000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload[:600])
+	}))
+	defer server.Close()
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+
+	dest := filepath.Join(tmpDir, "asset.zip")
+	if _, err := u.newDownloader(int64(len(payload)), nil).Download(context.Background(), server.URL+"/asset.zip", dest); err == nil {
+		t.Fatal("Expected a truncated download to fail")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("Expected the truncated download to be removed")
+	}
+
+	// The same response is accepted if the size matches the metadata
+	if _, err := u.newDownloader(600, nil).Download(context.Background(), server.URL+"/asset.zip", dest); err != nil {
+		t.Errorf("Expected a complete download to succeed: %v", err)
+	}
+}
+
+func TestChecksumPrefetchedDuringDownload(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	sum := sha256.Sum256(archive)
+	sums := fmt.Sprintf("%s  noraneko-windows-x86_64-portable.zip\n", hex.EncodeToString(sum[:]))
+
+	// The asset is only served once the checksum file has been requested,
+	// so the update can only finish if both downloads overlap
+	checksumRequested := make(chan struct{})
+	var overlapped atomic.Bool
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [
+			{"name": "noraneko-windows-x86_64-portable.zip", "browser_download_url": %q},
+			{"name": "sha256sums.txt", "browser_download_url": %q}]}`,
+			server.URL+"/download/portable.zip", server.URL+"/download/sha256sums.txt")
+	})
+	mux.HandleFunc("/download/portable.zip", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-checksumRequested:
+			overlapped.Store(true)
+		case <-time.After(5 * time.Second):
+		}
+		w.Write(archive)
+	})
+	mux.HandleFunc("/download/sha256sums.txt", func(w http.ResponseWriter, r *http.Request) {
+		close(checksumRequested)
+		w.Write([]byte(sums))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := newPortableInstall(t, "1.0.0")
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if !overlapped.Load() {
+		t.Error("Expected the checksum file to be fetched while the asset downloads")
+	}
+	if v, _ := u.getCurrentVersion(); v != "2.0.0" {
+		t.Errorf("Expected the verified update to be installed, got %s", v)
+	}
+}
+
+func TestChecksumDownloadErrorFailsUpdate(t *testing.T) {
+	var slept []time.Duration
+	orig := sleepContext
+	sleepContext = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+	t.Cleanup(func() { sleepContext = orig })
+
+	archive := makeTestZip(t, map[string]string{"noraneko/noraneko.exe": "new exe"})
+	server, requests := newFlakyChecksumServer(t, archive, nil, 100)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err == nil {
+		t.Fatal("Expected a failed checksum download to fail the update")
+	}
+	if v, _ := u.getCurrentVersion(); v != "1.0.0" {
+		t.Errorf("Expected nothing to be installed, got %s", v)
+	}
+	if *requests != checksumAttempts {
+		t.Errorf("Expected %d checksum download attempts, got %d", checksumAttempts, *requests)
+	}
+	if len(slept) != 2 || slept[0] != checksumRetryDelay || slept[1] != 2*checksumRetryDelay {
+		t.Errorf("Expected waits of %v and %v, got %v", checksumRetryDelay, 2*checksumRetryDelay, slept)
+	}
+}
+
+func TestChecksumDownloadRetried(t *testing.T) {
+	origSleep, origSleepContext := sleep, sleepContext
+	sleep = func(time.Duration) {}
+	sleepContext = func(context.Context, time.Duration) error { return nil }
+	t.Cleanup(func() { sleep, sleepContext = origSleep, origSleepContext })
+
+	archive := makeTestZip(t, map[string]string{"noraneko/noraneko.exe": "new exe"})
+	server, requests := newFlakyChecksumServer(t, archive, nil, checksumAttempts-1)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	result, err := u.Run()
+	if err != nil || !result.Updated {
+		t.Fatalf("Expected the update after the checksum download was retried, got %+v (%v)", result, err)
+	}
+	if *requests != checksumAttempts {
+		t.Errorf("Expected %d checksum download attempts, got %d", checksumAttempts, *requests)
+	}
+	if u.cfg.CacheValue("VerifiedSHA256") == "" {
+		t.Error("Expected the download to be recorded as verified")
+	}
+}
+
+func TestChecksumRetryWaitCancelled(t *testing.T) {
+	server, requests := newFlakyChecksumServer(t, nil, nil, 100)
+	u := New(&config.Config{ExeDir: t.TempDir(), WorkDir: t.TempDir()}, Options{})
+
+	// Cancelling, as a failed asset download does, ends the retry wait
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	asset := &Asset{Name: "sha256sums.txt", BrowserDownloadURL: server.URL + "/download/sha256sums.txt"}
+	err := u.downloadChecksum(ctx, asset, filepath.Join(t.TempDir(), "sha256sums.txt"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the cancellation to end the retry wait, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= checksumRetryDelay {
+		t.Errorf("Expected the wait to stop early, took %v", elapsed)
+	}
+	if *requests != 1 {
+		t.Errorf("Expected 1 checksum download attempt, got %d", *requests)
+	}
+}
+
+func TestChecksumOptional(t *testing.T) {
+	origSleep, origSleepContext := sleep, sleepContext
+	sleep = func(time.Duration) {}
+	sleepContext = func(context.Context, time.Duration) error { return nil }
+	t.Cleanup(func() { sleep, sleepContext = origSleep, origSleepContext })
+
+	archive := makeTestZip(t, map[string]string{"noraneko/noraneko.exe": "new exe"})
+	server, _ := newFlakyChecksumServer(t, archive, nil, 100)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.ChecksumOptional = true
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	result, err := u.Run()
+	if err != nil || !result.Updated {
+		t.Fatalf("Expected an unavailable checksum file to be skipped, got %+v (%v)", result, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(filepath.Dir(cfg.Path), config.BrowserExe)); string(got) != "new exe" {
+		t.Errorf("Expected the update to be installed, got exe %q", got)
+	}
+	if u.cfg.CacheValue("VerifiedSHA256") != "" {
+		t.Error("Expected an unverified download not to be recorded as verified")
+	}
+}
+
+func TestCheckMagic(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		valid   bool
+	}{
+		{"noraneko-windows-x86_64-portable.zip", "PK\x03\x04rest", true},
+		{"noraneko-windows-x86_64-setup.exe", "MZ\x90\x00", true},
+		{"noraneko-windows-x86_64.msi", "\xD0\xCF\x11\xE0\xA1\xB1\x1A\xE1", true},
+		{"noraneko-windows-x86_64-portable.zip", "<!DOCTYPE html><title>Blocked</title>", false},
+		{"noraneko-windows-x86_64-setup.exe", "PK\x03\x04", false},
+		{"noraneko-windows-x86_64-setup.exe", "", false},
+		{"sha256sums.txt", "<html>", true},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, "asset")
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write asset: %v", err)
+		}
+		if err := checkMagic(path, tt.name); (err == nil) != tt.valid {
+			t.Errorf("checkMagic(%s, %q) = %v, expected valid=%v", tt.name, tt.content, err, tt.valid)
+		}
+	}
+}
+
+func TestRunRejectsHTMLAsZip(t *testing.T) {
+	page := []byte("<html><body>Access to this site is blocked by your proxy.</body></html>")
+	server := newReleaseServer(t, "v2.0.0", page)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.WorkDir = t.TempDir()
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	_, err := u.Run()
+	if err == nil || !strings.Contains(err.Error(), "HTML page") {
+		t.Fatalf("Expected the HTML page to be rejected, got %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "1.0.0" {
+		t.Errorf("Expected nothing to be installed, got %s", v)
+	}
+	if entries, _ := os.ReadDir(cfg.WorkDir); len(entries) != 0 {
+		t.Errorf("Expected the rejected download to be removed, found %d entries", len(entries))
+	}
+}
@@ -0,0 +1,128 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// cacheEntryRe matches the names of download cache entries, which are the
+// SHA256 digests of their contents
+var cacheEntryRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// fromCache copies the cache entry of the expected SHA256 to dest. It
+// reports false if the cache is not used or has no intact entry; corrupt
+// entries are removed.
+func (d *Downloader) fromCache(ctx context.Context, dest string) bool {
+	if d.CacheDir == "" || d.SHA256 == "" {
+		return false
+	}
+
+	entry := filepath.Join(d.CacheDir, d.SHA256)
+	if actual, err := hashFile(entry); err != nil {
+		return false
+	} else if actual != d.SHA256 {
+		fmt.Fprintf(os.Stderr, "Warning: removing corrupt cache entry %s\n", entry)
+		os.Remove(entry)
+		return false
+	}
+
+	if err := d.u.copyFile(ctx, entry, dest, nil); err != nil {
+		return false
+	}
+
+	// Keep recently used entries from being evicted
+	now := time.Now()
+	os.Chtimes(entry, now, now)
+	return true
+}
+
+// store adds a verified download to the cache under its SHA256 and evicts
+// entries beyond the size and age limits
+func (d *Downloader) store(src string) error {
+	if err := os.MkdirAll(d.CacheDir, 0755); err != nil {
+		return err
+	}
+	if err := copyToCache(src, d.CacheDir, d.SHA256); err != nil {
+		return err
+	}
+	return evictCache(d.CacheDir, d.CacheMaxSize, d.CacheMaxAge, time.Now())
+}
+
+// copyToCache copies src into dir as name. The copy is written to a
+// temporary file first so an interrupted copy never leaves a truncated
+// entry behind.
+func copyToCache(src, dir, name string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(dir, ".partial-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+// evictCache removes cache entries not used within maxAge, then the least
+// recently used ones until the total size is at most maxSize. A zero limit
+// is not enforced. Other files in dir are left alone.
+func evictCache(dir string, maxSize int64, maxAge time.Duration, now time.Time) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var entries []os.FileInfo
+	for _, e := range dirEntries {
+		if !e.Type().IsRegular() || !cacheEntryRe.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if maxAge > 0 && now.Sub(info.ModTime()) > maxAge {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		entries = append(entries, info)
+	}
+
+	if maxSize <= 0 {
+		return nil
+	}
+
+	// Keep the most recently used entries that fit
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().After(entries[j].ModTime())
+	})
+	var total int64
+	for _, info := range entries {
+		total += info.Size()
+		if total > maxSize {
+			if err := os.Remove(filepath.Join(dir, info.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newChecksumReleaseServer serves a release with a portable zip and its
+// checksum file, counting the asset downloads
+func newChecksumReleaseServer(t *testing.T, archive []byte, downloads *int) *httptest.Server {
+	t.Helper()
+	server, _ := newFlakyChecksumServer(t, archive, downloads, 0)
+	return server
+}
+
+// newFlakyChecksumServer is newChecksumReleaseServer with a checksum file
+// that fails with 404 for the first failures requests. It returns the
+// number of checksum file requests; downloads may be nil.
+func newFlakyChecksumServer(t *testing.T, archive []byte, downloads *int, failures int) (*httptest.Server, *int) {
+	t.Helper()
+
+	sum := sha256.Sum256(archive)
+	sums := fmt.Sprintf("%s  noraneko-windows-x86_64-portable.zip\n", hex.EncodeToString(sum[:]))
+
+	var server *httptest.Server
+	var requests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [
+			{"name": "noraneko-windows-x86_64-portable.zip", "browser_download_url": %q},
+			{"name": "sha256sums.txt", "browser_download_url": %q}]}`,
+			server.URL+"/download/portable.zip", server.URL+"/download/sha256sums.txt")
+	})
+	mux.HandleFunc("/download/portable.zip", func(w http.ResponseWriter, r *http.Request) {
+		if downloads != nil {
+			*downloads++
+		}
+		w.Write(archive)
+	})
+	mux.HandleFunc("/download/sha256sums.txt", func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests <= failures {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(sums))
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestDownloadCacheHitAndMiss(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	sum := sha256.Sum256(archive)
+	digest := hex.EncodeToString(sum[:])
+
+	downloads := 0
+	server := newChecksumReleaseServer(t, archive, &downloads)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.CacheDir = t.TempDir()
+
+	// A miss downloads the asset and stores it under its digest
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if downloads != 1 {
+		t.Fatalf("Expected 1 download, got %d", downloads)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.CacheDir, digest)); err != nil {
+		t.Fatalf("Expected the download to be cached: %v", err)
+	}
+
+	// A reinstall is served from the cache
+	u = newTestUpdater(cfg, Options{Portable: true, ForceReinstall: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("Expected the reinstall to use the cache, got %d downloads", downloads)
+	}
+
+	// A corrupt entry is dropped and the asset downloaded again
+	if err := os.WriteFile(filepath.Join(cfg.CacheDir, digest), []byte("garbage"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt cache entry: %v", err)
+	}
+	u = newTestUpdater(cfg, Options{Portable: true, ForceReinstall: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if downloads != 2 {
+		t.Errorf("Expected a corrupt entry to be downloaded again, got %d downloads", downloads)
+	}
+	if actual, _ := hashFile(filepath.Join(cfg.CacheDir, digest)); actual != digest {
+		t.Error("Expected the corrupt entry to be replaced")
+	}
+}
+
+func TestEvictCache(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// Entries named by digest, last used 1 to 4 days ago
+	var names []string
+	for i := 1; i <= 4; i++ {
+		name := strings.Repeat(fmt.Sprint(i), 64)
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+			t.Fatalf("Failed to write entry: %v", err)
+		}
+		used := now.Add(-time.Duration(i) * 24 * time.Hour)
+		if err := os.Chtimes(path, used, used); err != nil {
+			t.Fatalf("Failed to set entry time: %v", err)
+		}
+		names = append(names, name)
+	}
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, make([]byte, 1000), 0644); err != nil {
+		t.Fatalf("Failed to write other file: %v", err)
+	}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	// No limits keep everything
+	if err := evictCache(dir, 0, 0, now); err != nil {
+		t.Fatalf("evictCache failed: %v", err)
+	}
+	for _, name := range names {
+		if !exists(name) {
+			t.Fatalf("Expected %s to be kept without limits", name[:8])
+		}
+	}
+
+	// The age limit drops entries unused for longer
+	if err := evictCache(dir, 0, 3*24*time.Hour+time.Hour, now); err != nil {
+		t.Fatalf("evictCache failed: %v", err)
+	}
+	if exists(names[3]) || !exists(names[2]) {
+		t.Error("Expected only the entry unused for 4 days to be evicted")
+	}
+
+	// The size limit drops the least recently used entries
+	if err := evictCache(dir, 250, 0, now); err != nil {
+		t.Fatalf("evictCache failed: %v", err)
+	}
+	if !exists(names[0]) || !exists(names[1]) || exists(names[2]) {
+		t.Error("Expected the two most recently used entries to fit the size limit")
+	}
+
+	if !exists("notes.txt") {
+		t.Error("Expected files that are not cache entries to be left alone")
+	}
+}
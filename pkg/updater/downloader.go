@@ -0,0 +1,161 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Downloader downloads a release file to disk. Each option adds one
+// behavior and is off at its zero value, so a Downloader without options
+// fetches with a single stream and checks nothing.
+type Downloader struct {
+	// Parallel Range requests, 1 or less for a single stream. Servers
+	// without range support are read with a single stream instead.
+	Connections int
+
+	// Expected size in bytes, 0 if unknown
+	Size int64
+
+	// Expected SHA256 digest in hex, empty to skip the check
+	SHA256 string
+
+	// Folder of verified downloads stored under their SHA256, empty to
+	// disable the cache. It is only used with SHA256: an intact entry is
+	// copied instead of downloading, and new downloads are stored.
+	CacheDir string
+
+	// Size limit in bytes and age limit of cache entries, 0 for no limit
+	CacheMaxSize int64
+	CacheMaxAge  time.Duration
+
+	// Called with the bytes downloaded so far, may be nil
+	Progress ProgressFunc
+
+	// Updater whose client and request headers are used
+	u *Updater
+}
+
+// newDownloader returns a Downloader for a file of the given size, 0 if
+// unknown, using DownloadConnections
+func (u *Updater) newDownloader(size int64, progress ProgressFunc) *Downloader {
+	return &Downloader{
+		Connections: u.cfg.DownloadConnections,
+		Size:        size,
+		Progress:    progress,
+		u:           u,
+	}
+}
+
+// useCache enables the download cache of the configuration for a file
+// with the given digest
+func (d *Downloader) useCache(digest string) {
+	cfg := d.u.cfg
+	d.SHA256 = digest
+	d.CacheDir = cfg.CacheDir
+	d.CacheMaxSize = int64(cfg.CacheMaxSize) << 20
+	d.CacheMaxAge = time.Duration(cfg.CacheMaxAge) * 24 * time.Hour
+}
+
+// Download fetches url to dest, or copies it from the cache, and verifies
+// the result. It reports whether the cache was used. A file that fails
+// verification is removed.
+func (d *Downloader) Download(ctx context.Context, url, dest string) (cached bool, err error) {
+	if d.fromCache(ctx, dest) {
+		return true, nil
+	}
+
+	if err := d.fetch(ctx, url, dest); err != nil {
+		return false, err
+	}
+	if err := d.Verify(dest); err != nil {
+		os.Remove(dest)
+		return false, err
+	}
+
+	if d.CacheDir != "" && d.SHA256 != "" {
+		if err := d.store(dest); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to cache download: %v\n", err)
+		}
+	}
+	return false, nil
+}
+
+// Verify checks a downloaded file against the expected size and SHA256,
+// if they are set
+func (d *Downloader) Verify(path string) error {
+	if d.Size > 0 {
+		if err := checkFileSize(path, d.Size); err != nil {
+			return err
+		}
+	}
+
+	if d.SHA256 != "" {
+		actualHash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if actualHash != d.SHA256 {
+			return fmt.Errorf("checksum mismatch: expected %s, got %s", d.SHA256, actualHash)
+		}
+	}
+	return nil
+}
+
+// fetch downloads url to dest, with several connections if possible
+func (d *Downloader) fetch(ctx context.Context, url, dest string) error {
+	if d.Connections > 1 {
+		err := d.fetchMultiConn(ctx, url, dest)
+		if !errors.Is(err, errRangeUnsupported) {
+			return err
+		}
+		// Fall back to a single stream
+	}
+
+	req, err := d.u.newRequest(ctx, "GET", url)
+	if err != nil {
+		return err
+	}
+
+	resp, err := d.u.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download returned status %d", resp.StatusCode)
+	}
+	if err := checkLoginWall(resp); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	total := resp.ContentLength
+	if total < 0 {
+		total = 0
+	}
+	_, err = io.Copy(io.MultiWriter(out, newProgressWriter(d.Progress, total, 1)), resp.Body)
+	return err
+}
+
+// checkFileSize verifies that a downloaded file has the expected size
+func checkFileSize(path string, expected int64) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() != expected {
+		return fmt.Errorf("size mismatch: expected %d bytes, got %d", expected, info.Size())
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// newDownloaderServer serves payload with range support and counts the
+// requests and Range requests it receives
+func newDownloaderServer(t *testing.T, payload []byte) (server *httptest.Server, requests, ranges *int32) {
+	t.Helper()
+	requests, ranges = new(int32), new(int32)
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(ranges, 1)
+		}
+		http.ServeContent(w, r, "asset.zip", time.Time{}, bytes.NewReader(payload))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests, ranges
+}
+
+func TestDownloaderOptions(t *testing.T) {
+	payload := testPayload(50000)
+	sum := sha256.Sum256(payload)
+	digest := hex.EncodeToString(sum[:])
+	wrongDigest := strings.Repeat("0", 64)
+
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+
+	tests := []struct {
+		name       string
+		downloader Downloader
+		wantErr    string
+		wantRanges int32
+	}{
+		{"no options", Downloader{}, "", 0},
+		{"connections", Downloader{Connections: 4}, "", 5},
+		{"size", Downloader{Size: int64(len(payload))}, "", 0},
+		{"wrong size", Downloader{Size: 100}, "size mismatch", 0},
+		{"sha256", Downloader{SHA256: digest}, "", 0},
+		{"wrong sha256", Downloader{SHA256: wrongDigest}, "checksum mismatch", 0},
+		{"connections with sha256", Downloader{Connections: 2, SHA256: digest}, "", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, ranges := newDownloaderServer(t, payload)
+			d := tt.downloader
+			d.u = u
+
+			dest := filepath.Join(t.TempDir(), "asset.zip")
+			cached, err := d.Download(context.Background(), server.URL+"/asset.zip", dest)
+			if cached {
+				t.Error("Expected no cache to be used")
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				if _, err := os.Stat(dest); !os.IsNotExist(err) {
+					t.Error("Expected the rejected download to be removed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+				t.Error("Downloaded file does not match the original")
+			}
+			if got := atomic.LoadInt32(ranges); got != tt.wantRanges {
+				t.Errorf("Expected %d range requests, got %d", tt.wantRanges, got)
+			}
+		})
+	}
+}
+
+func TestDownloaderProgress(t *testing.T) {
+	payload := testPayload(20000)
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+
+	for _, connections := range []int{1, 3} {
+		server, _, _ := newDownloaderServer(t, payload)
+
+		var last, total int64
+		d := u.newDownloader(0, func(downloaded, size int64) {
+			last, total = downloaded, size
+		})
+		d.Connections = connections
+
+		dest := filepath.Join(tmpDir, "asset.zip")
+		if _, err := d.Download(context.Background(), server.URL+"/asset.zip", dest); err != nil {
+			t.Fatalf("Download with %d connections failed: %v", connections, err)
+		}
+		if last != int64(len(payload)) || total != int64(len(payload)) {
+			t.Errorf("Expected progress to reach %d of %d with %d connections, got %d of %d",
+				len(payload), len(payload), connections, last, total)
+		}
+	}
+}
+
+func TestDownloaderCache(t *testing.T) {
+	payload := testPayload(30000)
+	sum := sha256.Sum256(payload)
+	digest := hex.EncodeToString(sum[:])
+	server, requests, _ := newDownloaderServer(t, payload)
+
+	tmpDir := t.TempDir()
+	cacheDir := filepath.Join(tmpDir, "cache")
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	download := func(d *Downloader) bool {
+		t.Helper()
+		d.u = u
+		dest := filepath.Join(t.TempDir(), "asset.zip")
+		cached, err := d.Download(context.Background(), server.URL+"/asset.zip", dest)
+		if err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		if data, _ := os.ReadFile(dest); !bytes.Equal(data, payload) {
+			t.Error("Downloaded file does not match the original")
+		}
+		return cached
+	}
+
+	// Without a digest the cache is not used
+	if download(&Downloader{CacheDir: cacheDir}) {
+		t.Error("Expected no cache hit without SHA256")
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Error("Expected nothing to be cached without SHA256")
+	}
+
+	// The first download is stored, the second one copied from the cache
+	if download(&Downloader{SHA256: digest, CacheDir: cacheDir}) {
+		t.Error("Expected a cache miss on the first download")
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, digest)); err != nil {
+		t.Fatalf("Expected the download to be cached: %v", err)
+	}
+	before := atomic.LoadInt32(requests)
+	if !download(&Downloader{SHA256: digest, CacheDir: cacheDir}) {
+		t.Error("Expected a cache hit on the second download")
+	}
+	if got := atomic.LoadInt32(requests); got != before {
+		t.Errorf("Expected no request for a cached download, got %d", got-before)
+	}
+
+	// A corrupt entry is removed and downloaded again
+	if err := os.WriteFile(filepath.Join(cacheDir, digest), []byte("corrupt"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt cache entry: %v", err)
+	}
+	if download(&Downloader{SHA256: digest, CacheDir: cacheDir}) {
+		t.Error("Expected a corrupt cache entry to be skipped")
+	}
+	if got, _ := hashFile(filepath.Join(cacheDir, digest)); got != digest {
+		t.Error("Expected the cache entry to be replaced")
+	}
+
+	// Older entries beyond the size limit are evicted after storing
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(cacheDir, digest), old, old); err != nil {
+		t.Fatalf("Failed to age cache entry: %v", err)
+	}
+	other := testPayload(1000)
+	otherSum := sha256.Sum256(other)
+	otherServer, _, _ := newDownloaderServer(t, other)
+	d := &Downloader{SHA256: hex.EncodeToString(otherSum[:]), CacheDir: cacheDir, CacheMaxSize: int64(len(other)), u: u}
+	if _, err := d.Download(context.Background(), otherServer.URL+"/other.zip", filepath.Join(tmpDir, "other.zip")); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, digest)); !os.IsNotExist(err) {
+		t.Error("Expected the older entry to be evicted beyond CacheMaxSize")
+	}
+}
@@ -0,0 +1,81 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// elevation is how the install step deals with administrator rights
+type elevation int
+
+const (
+	// Run the installer in the current process context
+	elevationNone elevation = iota
+	// Relaunch the installer through a UAC prompt
+	elevationPrompt
+	// Installing is not possible without administrator rights
+	elevationUnavailable
+)
+
+// elevationFor decides how to run the install step. A UAC prompt is only
+// shown for interactive runs with AutoElevate, as nobody can answer it
+// during a scheduled run.
+func elevationFor(needsAdmin, elevated, scheduled, autoElevate bool) elevation {
+	switch {
+	case !needsAdmin || elevated:
+		return elevationNone
+	case scheduled || !autoElevate:
+		return elevationUnavailable
+	default:
+		return elevationPrompt
+	}
+}
+
+// dirNeedsAdmin reports whether files cannot be written to dir, or to its
+// nearest existing parent if dir does not exist yet, without
+// administrator rights
+func dirNeedsAdmin(dir string) bool {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+
+	probe, err := os.CreateTemp(dir, ".write-probe-*")
+	if err != nil {
+		return os.IsPermission(err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return false
+}
+
+// installElevation returns how to run an installer targeting dir, or an
+// actionable error if administrator rights are needed but unavailable
+func (u *Updater) installElevation(dir string) (elevation, error) {
+	needsAdmin := dirNeedsAdmin(dir)
+	e := elevationFor(needsAdmin, needsAdmin && isElevated(), u.opts.Scheduled, u.cfg.AutoElevate)
+	if e != elevationUnavailable {
+		return e, nil
+	}
+	if u.opts.Scheduled {
+		return e, fmt.Errorf("installing to %s requires administrator rights, but the scheduled task is not elevated; recreate the task to run with highest privileges", dir)
+	}
+	return e, fmt.Errorf("installing to %s requires administrator rights; run the updater as administrator or set AutoElevate=1", dir)
+}
+
+// runCommand runs a program and returns its exit code, through a UAC
+// prompt if elevate is set
+func runCommand(elevate bool, name string, args ...string) (int, error) {
+	if elevate {
+		return runElevated(name, args)
+	}
+	return exitCode(exec.Command(name, args...).Run())
+}
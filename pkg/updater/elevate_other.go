@@ -0,0 +1,18 @@
+//go:build !windows
+
+package updater
+
+import (
+	"errors"
+	"os"
+)
+
+// isElevated reports whether the process runs as root
+func isElevated() bool {
+	return os.Geteuid() == 0
+}
+
+// runElevated is not supported outside Windows
+func runElevated(name string, args []string) (int, error) {
+	return 0, errors.New("elevation is only supported on Windows")
+}
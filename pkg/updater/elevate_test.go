@@ -0,0 +1,66 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestElevationFor(t *testing.T) {
+	tests := []struct {
+		needsAdmin  bool
+		elevated    bool
+		scheduled   bool
+		autoElevate bool
+		expected    elevation
+	}{
+		{false, false, false, false, elevationNone},
+		{false, false, true, true, elevationNone},
+		{true, true, false, false, elevationNone},
+		{true, true, true, false, elevationNone},
+		{true, false, false, true, elevationPrompt},
+		{true, false, false, false, elevationUnavailable},
+		{true, false, true, true, elevationUnavailable},
+		{true, false, true, false, elevationUnavailable},
+	}
+
+	for _, tt := range tests {
+		got := elevationFor(tt.needsAdmin, tt.elevated, tt.scheduled, tt.autoElevate)
+		if got != tt.expected {
+			t.Errorf("elevationFor(needsAdmin=%v, elevated=%v, scheduled=%v, autoElevate=%v) = %d, expected %d",
+				tt.needsAdmin, tt.elevated, tt.scheduled, tt.autoElevate, got, tt.expected)
+		}
+	}
+}
+
+func TestDirNeedsAdmin(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if dirNeedsAdmin(tmpDir) {
+		t.Error("Expected a writable directory not to need admin rights")
+	}
+	// A missing directory is judged by its nearest existing parent
+	if dirNeedsAdmin(filepath.Join(tmpDir, "missing", "Noraneko")) {
+		t.Error("Expected a missing directory under a writable parent not to need admin rights")
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected the write probe to be removed, found %d entries", len(entries))
+	}
+
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions cannot be tested on Windows or as root")
+	}
+	readOnly := filepath.Join(tmpDir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if !dirNeedsAdmin(filepath.Join(readOnly, "Noraneko")) {
+		t.Error("Expected a read-only parent to need admin rights")
+	}
+}
@@ -0,0 +1,104 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// githubAccept is the media type requested from the GitHub API
+const githubAccept = "application/vnd.github.v3+json"
+
+// protectedHeaders are managed by the updater or the HTTP client and can
+// never be set from the configuration
+var protectedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"Upgrade":           true,
+	"Te":                true,
+	"Trailer":           true,
+	"Range":             true,
+}
+
+// defaultHeaders are set by the updater itself; configured values replace
+// them, which is logged
+var defaultHeaders = map[string]bool{
+	"User-Agent": true,
+	"Accept":     true,
+}
+
+// customHeaders returns the configured [Headers], validated once per
+// Updater. Protected headers are dropped and replaced defaults are logged.
+func (u *Updater) customHeaders() http.Header {
+	u.headersOnce.Do(func() {
+		names := make([]string, 0, len(u.cfg.Headers))
+		for name := range u.cfg.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		u.headers = http.Header{}
+		for _, name := range names {
+			canonical := http.CanonicalHeaderKey(name)
+			if protectedHeaders[canonical] {
+				fmt.Fprintf(os.Stderr, "Warning: ignoring configured header %s, it cannot be overridden\n", canonical)
+				continue
+			}
+			if defaultHeaders[canonical] {
+				fmt.Fprintf(os.Stderr, "Note: configured header %s replaces the default value\n", canonical)
+			}
+			u.headers.Set(canonical, u.cfg.Headers[name])
+		}
+	})
+	return u.headers
+}
+
+// userAgent returns the configured User-Agent or the updater default
+func (u *Updater) userAgent() string {
+	if u.cfg.UserAgent != "" {
+		return u.cfg.UserAgent
+	}
+	return "Noraneko-WinUpdater/" + u.opts.Version
+}
+
+// applyHeaders sets the User-Agent and adds the configured headers to a
+// request. API requests only receive the latter when HeadersForAPI is
+// enabled.
+func (u *Updater) applyHeaders(req *http.Request, api bool) {
+	req.Header.Set("User-Agent", u.userAgent())
+	if api && !u.cfg.HeadersForAPI {
+		return
+	}
+	for name, values := range u.customHeaders() {
+		req.Header[name] = values
+	}
+}
+
+// repoAPIURL returns the API URL of the release repository, which the
+// releases and attestations endpoints are below
+func (u *Updater) repoAPIURL() string {
+	return strings.TrimSuffix(u.apiURL, "/releases")
+}
+
+// newRequest builds a request with the headers every request of the
+// updater carries. Requests to the repository API, such as its releases
+// and attestations, or to the connection check are treated as API
+// requests.
+func (u *Updater) newRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	api := strings.HasPrefix(url, u.apiURL) || strings.HasPrefix(url, u.repoAPIURL()+"/") || url == u.checkURL
+	if api {
+		req.Header.Set("Accept", githubAccept)
+	}
+	u.applyHeaders(req, api)
+	return req, nil
+}
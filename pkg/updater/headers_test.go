@@ -0,0 +1,216 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestCustomHeadersOnDownload(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var received http.Header
+	var receivedHost string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		receivedHost = r.Host
+		w.Write([]byte("payload"))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ExeDir:  tmpDir,
+		WorkDir: tmpDir,
+		Headers: map[string]string{
+			"Referer":      "https://mirror.example.com/",
+			"x-auth-token": "secret",
+			"Host":         "evil.example.com",
+		},
+	}
+	u := New(cfg, Options{Version: "1.0.0"})
+
+	if _, err := u.newDownloader(0, nil).Download(context.Background(), server.URL+"/asset.zip", filepath.Join(tmpDir, "asset.zip")); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if got := received.Get("Referer"); got != "https://mirror.example.com/" {
+		t.Errorf("Expected Referer header, got '%s'", got)
+	}
+	if got := received.Get("X-Auth-Token"); got != "secret" {
+		t.Errorf("Expected X-Auth-Token header, got '%s'", got)
+	}
+	if got := received.Get("User-Agent"); got != "Noraneko-WinUpdater/1.0.0" {
+		t.Errorf("Expected default User-Agent to be kept, got '%s'", got)
+	}
+	if receivedHost == "evil.example.com" {
+		t.Error("Configured Host header must not override the request host")
+	}
+}
+
+func TestCustomHeadersOnAPI(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Write([]byte(`{"tag_name": "v1.0.0"}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ExeDir:  tmpDir,
+		WorkDir: tmpDir,
+		Headers: map[string]string{"X-Auth-Token": "secret", "User-Agent": "Custom/1.0"},
+	}
+
+	// API requests do not get the headers by default
+	u := New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL
+	if _, err := u.getLatestRelease(context.Background()); err != nil {
+		t.Fatalf("Failed to get release: %v", err)
+	}
+	if received.Get("X-Auth-Token") != "" {
+		t.Error("Expected no custom headers on API requests by default")
+	}
+
+	cfg.HeadersForAPI = true
+	u = New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL
+	if _, err := u.getLatestRelease(context.Background()); err != nil {
+		t.Fatalf("Failed to get release: %v", err)
+	}
+	if got := received.Get("X-Auth-Token"); got != "secret" {
+		t.Errorf("Expected X-Auth-Token on API request, got '%s'", got)
+	}
+	if got := received.Get("User-Agent"); got != "Custom/1.0" {
+		t.Errorf("Expected configured User-Agent to replace the default, got '%s'", got)
+	}
+}
+
+func TestCustomHeadersNotOnAttestations(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Write([]byte(`{"attestations": []}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{Headers: map[string]string{"X-Auth-Token": "secret"}}
+	u := New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL + "/repos/f3liz-dev/noraneko/releases"
+	if _, err := u.getAttestations(context.Background(), strings.Repeat("ab", 32)); err != nil {
+		t.Fatalf("Failed to get attestations: %v", err)
+	}
+	if received.Get("X-Auth-Token") != "" {
+		t.Error("Expected no custom headers on the attestations request")
+	}
+	if got := received.Get("Accept"); got != githubAccept {
+		t.Errorf("Expected the API Accept header, got '%s'", got)
+	}
+}
+
+func TestConfiguredUserAgent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var agents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		w.Write([]byte(`{"tag_name": "v1.0.0", "assets": []}`))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ExeDir:    tmpDir,
+		WorkDir:   tmpDir,
+		UserAgent: "Corp-Deployment/2.0",
+	}
+	u := New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL
+	u.checkURL = server.URL
+
+	if err := u.checkConnection(context.Background()); err != nil {
+		t.Fatalf("Connection check failed: %v", err)
+	}
+	if _, err := u.getLatestRelease(context.Background()); err != nil {
+		t.Fatalf("Failed to get latest release: %v", err)
+	}
+	if _, err := u.newDownloader(0, nil).Download(context.Background(), server.URL+"/asset.zip", filepath.Join(tmpDir, "asset.zip")); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	if len(agents) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(agents))
+	}
+	for i, agent := range agents {
+		if agent != "Corp-Deployment/2.0" {
+			t.Errorf("Request %d: expected configured User-Agent, got '%s'", i, agent)
+		}
+	}
+}
+
+func TestEveryRequestCarriesUserAgent(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/releases/latest":
+			fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [{"name": "noraneko-windows-x86_64-portable.zip", "browser_download_url": %q}]}`,
+				server.URL+"/download/portable.zip")
+		case "/download/portable.zip":
+			w.Write(archive)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newPortableInstall(t, "1.0.0")
+	u := newTestUpdater(cfg, Options{Portable: true, Version: "1.0.0"}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Connection check, release lookup and download
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(requests))
+	}
+	for _, r := range requests {
+		if got := r.Header.Get("User-Agent"); got != "Noraneko-WinUpdater/1.0.0" {
+			t.Errorf("%s: expected User-Agent, got '%s'", r.URL.Path, got)
+		}
+		api := r.URL.Path != "/download/portable.zip"
+		if got := r.Header.Get("Accept"); api && got != githubAccept {
+			t.Errorf("%s: expected Accept %s, got '%s'", r.URL.Path, githubAccept, got)
+		}
+	}
+}
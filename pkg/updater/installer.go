@@ -0,0 +1,239 @@
+package updater
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// msiexec exit codes, see
+// https://learn.microsoft.com/windows/win32/msi/error-codes
+const (
+	msiSuccess               = 0
+	msiUserExit              = 1602
+	msiInstallFailure        = 1603
+	msiInstallInProgress     = 1618
+	msiPackageOpenFailed     = 1619
+	msiPackageRejected       = 1625
+	msiProductVersion        = 1638
+	msiRebootInitiated       = 1641
+	msiSuccessRebootRequired = 3010
+)
+
+// installDir returns the directory the installer should install into
+func (u *Updater) installDir() string {
+	if browserPath := u.cfg.GetBrowserPath(); browserPath != "" {
+		return filepath.Dir(browserPath)
+	}
+	return config.DefaultInstallDir()
+}
+
+// Installer types, which differ in how they are asked to write a log
+const (
+	installerMSI     = "msi"
+	installerNSIS    = "nsis"
+	installerInno    = "inno"
+	installerUnknown = ""
+)
+
+// installerScanSize is how much of a setup executable is searched for the
+// marker of its installer type
+const installerScanSize = 8 << 20
+
+// installerMarkers identify setup executables by strings they embed
+var installerMarkers = []struct {
+	kind   string
+	marker []byte
+}{
+	{installerInno, []byte("Inno Setup")},
+	{installerNSIS, []byte("Nullsoft")},
+}
+
+// detectInstaller returns the installer type of a setup file
+func detectInstaller(setupPath string) string {
+	if strings.HasSuffix(strings.ToLower(setupPath), ".msi") {
+		return installerMSI
+	}
+
+	file, err := os.Open(setupPath)
+	if err != nil {
+		return installerUnknown
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, installerScanSize))
+	if err != nil {
+		return installerUnknown
+	}
+	for _, m := range installerMarkers {
+		if bytes.Contains(data, m.marker) {
+			return m.kind
+		}
+	}
+	return installerUnknown
+}
+
+// installerLogArgs returns the arguments that make an installer write a
+// detailed log to logPath. NSIS has no command-line logging option, so
+// nil is returned for it and for unknown installers.
+func installerLogArgs(kind, logPath string) []string {
+	switch kind {
+	case installerMSI:
+		return []string{"/l*v", logPath}
+	case installerInno:
+		return []string{"/LOG=" + logPath}
+	default:
+		return nil
+	}
+}
+
+// installerLogPath returns a new log file path in the InstallerLog
+// directory, or an empty string if installer logs are disabled
+func (u *Updater) installerLogPath() (string, error) {
+	if u.cfg.InstallerLog == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(u.cfg.InstallerLog, 0755); err != nil {
+		return "", fmt.Errorf("failed to create installer log directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-install-%s.log", config.BrowserName, clock().Format("20060102-150405"))
+	return filepath.Join(u.cfg.InstallerLog, name), nil
+}
+
+// runInstaller runs the setup executable or MSI package and reports
+// whether a reboot is required to complete the installation. With
+// InstallerLog the installer's log path is kept in u.installerLog and
+// added to errors.
+func (u *Updater) runInstaller(setupPath string) (reboot bool, err error) {
+	browserDir := u.installDir()
+
+	e, err := u.installElevation(browserDir)
+	if err != nil {
+		return false, err
+	}
+	elevate := e == elevationPrompt
+	if elevate {
+		fmt.Fprintln(u.out, "Administrator rights are required, requesting elevation...")
+	}
+
+	// Ask the installer for a log if it supports one
+	kind := detectInstaller(setupPath)
+	logPath, err := u.installerLogPath()
+	if err != nil {
+		return false, err
+	}
+	logArgs := installerLogArgs(kind, logPath)
+	if logPath != "" {
+		if logArgs == nil {
+			fmt.Fprintln(os.Stderr, "Warning: this installer cannot write a log, InstallerLog is ignored")
+		} else {
+			u.installerLog = logPath
+			fmt.Fprintf(u.out, "Installer log: %s\n", logPath)
+			defer func() {
+				if err != nil {
+					err = fmt.Errorf("%w (installer log: %s)", err, logPath)
+				}
+			}()
+		}
+	}
+
+	if kind == installerMSI {
+		return u.runMsiInstaller(elevate, setupPath, browserDir, logArgs)
+	}
+
+	// Run silent installation. NSIS requires /D to come last.
+	args := append(append([]string{"/S"}, logArgs...), "/D="+browserDir)
+	code, err := runCommand(elevate, setupPath, args...)
+	if err == nil && (code == msiSuccess || isRebootExitCode(code)) {
+		return isRebootExitCode(code), nil
+	}
+
+	// Try interactive installation
+	fmt.Fprintln(u.out, "Silent installation failed, running interactive installer...")
+	args = append(append([]string{}, logArgs...), "/D="+browserDir)
+	code, err = runCommand(elevate, setupPath, args...)
+	if err != nil {
+		return false, err
+	}
+	if code != msiSuccess && !isRebootExitCode(code) {
+		return false, fmt.Errorf("installer exited with code %d", code)
+	}
+	return isRebootExitCode(code), nil
+}
+
+// runMsiInstaller installs an MSI package silently through msiexec
+func (u *Updater) runMsiInstaller(elevate bool, msiPath, installDir string, logArgs []string) (bool, error) {
+	args := append(msiexecArgs(msiPath, installDir, u.cfg.MsiInstallDirProperty), logArgs...)
+	code, err := runCommand(elevate, "msiexec.exe", args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to run msiexec: %w", err)
+	}
+	return interpretMsiExitCode(code)
+}
+
+// exitCode extracts the exit code from the error of a finished command.
+// An error is only returned if the command could not be run at all.
+func exitCode(err error) (int, error) {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return msiSuccess, nil
+}
+
+// isRebootExitCode reports whether an installer exit code signals a
+// successful installation that needs a reboot. NSIS and Inno Setup
+// installers follow the msiexec convention for this.
+func isRebootExitCode(code int) bool {
+	return code == msiSuccessRebootRequired || code == msiRebootInitiated
+}
+
+// msiexecArgs builds the msiexec arguments for a silent install. The
+// install directory is only passed if the package's property name is known.
+func msiexecArgs(msiPath, installDir, dirProperty string) []string {
+	args := []string{"/i", msiPath, "/qn", "/norestart"}
+	if dirProperty != "" && installDir != "" {
+		args = append(args, fmt.Sprintf("%s=%s", dirProperty, installDir))
+	}
+	return args
+}
+
+// interpretMsiExitCode maps an msiexec exit code to whether a reboot is
+// required and an error describing a failed installation
+func interpretMsiExitCode(code int) (bool, error) {
+	switch code {
+	case msiSuccess:
+		return false, nil
+	case msiSuccessRebootRequired, msiRebootInitiated:
+		return true, nil
+	case msiUserExit:
+		return false, fmt.Errorf("msiexec: installation cancelled by the user (%d)", code)
+	case msiInstallFailure:
+		return false, fmt.Errorf("msiexec: fatal error during installation (%d)", code)
+	case msiInstallInProgress:
+		return false, fmt.Errorf("msiexec: another installation is already in progress (%d)", code)
+	case msiPackageOpenFailed:
+		return false, fmt.Errorf("msiexec: the installation package could not be opened (%d)", code)
+	case msiPackageRejected:
+		return false, fmt.Errorf("msiexec: installation is prohibited by system policy (%d)", code)
+	case msiProductVersion:
+		return false, fmt.Errorf("msiexec: another version of this product is already installed (%d)", code)
+	default:
+		return false, fmt.Errorf("msiexec exited with code %d", code)
+	}
+}
+
+// Reboot restarts the system immediately
+func Reboot() error {
+	return exec.Command("shutdown.exe", "/r", "/t", "0").Run()
+}
@@ -0,0 +1,147 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestMsiexecArgs(t *testing.T) {
+	args := msiexecArgs(`C:\Temp\noraneko.msi`, `C:\Program Files\Noraneko`, "INSTALLDIR")
+	expected := []string{"/i", `C:\Temp\noraneko.msi`, "/qn", "/norestart", `INSTALLDIR=C:\Program Files\Noraneko`}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+
+	// A custom property name is used as is
+	args = msiexecArgs(`C:\Temp\noraneko.msi`, `D:\Apps\Noraneko`, "APPLICATIONFOLDER")
+	if args[len(args)-1] != `APPLICATIONFOLDER=D:\Apps\Noraneko` {
+		t.Errorf("Expected custom install dir property, got %v", args)
+	}
+
+	// Without a property name the package's default location is kept
+	args = msiexecArgs(`C:\Temp\noraneko.msi`, `C:\Program Files\Noraneko`, "")
+	expected = []string{"/i", `C:\Temp\noraneko.msi`, "/qn", "/norestart"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v, got %v", expected, args)
+	}
+}
+
+func TestInterpretMsiExitCode(t *testing.T) {
+	tests := []struct {
+		code   int
+		reboot bool
+		failed bool
+	}{
+		{0, false, false},
+		{3010, true, false},
+		{1641, true, false},
+		{1602, false, true},
+		{1603, false, true},
+		{1618, false, true},
+		{1619, false, true},
+		{1625, false, true},
+		{1638, false, true},
+		{42, false, true},
+	}
+
+	for _, tt := range tests {
+		reboot, err := interpretMsiExitCode(tt.code)
+		if reboot != tt.reboot {
+			t.Errorf("interpretMsiExitCode(%d) reboot = %v, expected %v", tt.code, reboot, tt.reboot)
+		}
+		if (err != nil) != tt.failed {
+			t.Errorf("interpretMsiExitCode(%d) err = %v, expected failure=%v", tt.code, err, tt.failed)
+		}
+	}
+}
+
+func TestInstallerRebootExitCodes(t *testing.T) {
+	tests := []struct {
+		code   int
+		reboot bool
+	}{
+		{0, false},
+		{3010, true},
+		{1641, true},
+		{1603, false},
+		{1, false},
+	}
+
+	for _, tt := range tests {
+		if got := isRebootExitCode(tt.code); got != tt.reboot {
+			t.Errorf("isRebootExitCode(%d) = %v, expected %v", tt.code, got, tt.reboot)
+		}
+	}
+}
+
+func TestInstallerLogArgs(t *testing.T) {
+	logPath := `C:\Logs\Noraneko-install.log`
+	tests := []struct {
+		kind     string
+		expected []string
+	}{
+		{installerMSI, []string{"/l*v", logPath}},
+		{installerInno, []string{"/LOG=" + logPath}},
+		{installerNSIS, nil},
+		{installerUnknown, nil},
+	}
+
+	for _, tt := range tests {
+		if got := installerLogArgs(tt.kind, logPath); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.kind, tt.expected, got)
+		}
+	}
+}
+
+func TestDetectInstaller(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"noraneko.msi", "\xD0\xCF\x11\xE0", installerMSI},
+		{"inno-setup.exe", "MZ\x90\x00 ... Inno Setup Setup Data (6.2.0) ...", installerInno},
+		{"nsis-setup.exe", "MZ\x90\x00 ... Nullsoft Install System v3.08 ...", installerNSIS},
+		{"other-setup.exe", "MZ\x90\x00 ... WiX Burn ...", installerUnknown},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(tmpDir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", tt.name, err)
+		}
+		if got := detectInstaller(path); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestInstallerLogPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	if p, err := u.installerLogPath(); err != nil || p != "" {
+		t.Errorf("Expected no log without InstallerLog, got %q (%v)", p, err)
+	}
+
+	orig := clock
+	clock = func() time.Time { return time.Date(2024, 5, 1, 9, 35, 12, 0, time.Local) }
+	t.Cleanup(func() { clock = orig })
+
+	u.cfg.InstallerLog = filepath.Join(tmpDir, "logs")
+	p, err := u.installerLogPath()
+	if err != nil {
+		t.Fatalf("installerLogPath failed: %v", err)
+	}
+	if expected := filepath.Join(tmpDir, "logs", "Noraneko-install-20240501-093512.log"); p != expected {
+		t.Errorf("Expected %s, got %s", expected, p)
+	}
+	if info, err := os.Stat(u.cfg.InstallerLog); err != nil || !info.IsDir() {
+		t.Errorf("Expected the log directory to be created: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// InstallResult is the outcome of one of the [Installs] in a run
+type InstallResult struct {
+	Name   string     `json:"name"`
+	Path   string     `json:"path"`
+	Result *RunResult `json:"result,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// runInstalls updates each of the [Installs] in turn, with its own path,
+// branch and portable flag. An install that fails does not stop the
+// others; the run then fails once all were tried, with the result.
+func (u *Updater) runInstalls(ctx context.Context) (*RunResult, error) {
+	result := &RunResult{StartedAt: time.Now()}
+	u.phases = nil
+
+	var updated, available int
+	var failed []string
+	for _, in := range u.cfg.Installs {
+		fmt.Fprintf(u.out, "\n=== %s (%s) ===\n", in.Name, in.Path)
+
+		// The install decides whether it is portable, not -portable
+		opts := u.opts
+		opts.Portable = in.Portable
+		sub := New(u.cfg.ForInstall(in), opts)
+		sub.apiURL, sub.checkURL, sub.webURL = u.apiURL, u.checkURL, u.webURL
+
+		entry := InstallResult{Name: in.Name, Path: in.Path}
+		r, err := sub.run(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", in.Name, err)
+			sub.logResult(fmt.Sprintf("Failed: %v", err))
+			entry.Error = err.Error()
+			failed = append(failed, in.Name)
+		} else {
+			entry.Result = r
+			if r.Updated {
+				updated++
+			}
+			if r.UpdateAvailable {
+				available++
+			}
+			result.RebootRequired = result.RebootRequired || r.RebootRequired
+		}
+		result.Installs = append(result.Installs, entry)
+	}
+
+	result.Updated = updated > 0
+	result.UpdateAvailable = available > 0
+	u.rebootRequired = result.RebootRequired
+	result.Message = fmt.Sprintf("Updated %d of %d installs", updated, len(u.cfg.Installs))
+	if len(failed) > 0 {
+		result.Message += fmt.Sprintf(", %d failed", len(failed))
+	}
+	u.logResult(result.Message)
+	result.Duration = time.Since(result.StartedAt)
+
+	if len(failed) > 0 {
+		err := fmt.Errorf("failed to update %s", strings.Join(failed, ", "))
+		result.Error = err.Error()
+		return result, err
+	}
+	return result, nil
+}
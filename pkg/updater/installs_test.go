@@ -0,0 +1,77 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestRunInstallsContinuesPastFailure(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+
+	// The first install is packaged, which fails; the second is portable
+	packagedDir := filepath.Join(cfg.ExeDir, "Packaged")
+	if err := os.MkdirAll(packagedDir, 0755); err != nil {
+		t.Fatalf("Failed to create packaged install: %v", err)
+	}
+	files := map[string]string{
+		config.BrowserExe:       "exe",
+		"application.ini":       "[App]\nVersion=1.0.0\n",
+		config.AppxManifestName: "<Package/>",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(packagedDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	cfg.Installs = []config.Install{
+		{Name: "Store", Path: filepath.Join(packagedDir, config.BrowserExe)},
+		{Name: "Portable", Path: cfg.Path, Portable: true},
+	}
+
+	u := newTestUpdater(cfg, Options{}, server)
+	result, err := u.Run()
+	if err == nil || !strings.Contains(err.Error(), "failed to update Store") {
+		t.Fatalf("Expected the run to report the failed install, got %v", err)
+	}
+	if result == nil {
+		t.Fatal("Expected a result despite the failed install")
+	}
+	if !result.Updated || result.Message != "Updated 1 of 2 installs, 1 failed" || result.Error == "" {
+		t.Errorf("Expected aggregated results, got %+v", result)
+	}
+	if len(result.Installs) != 2 {
+		t.Fatalf("Expected 2 install results, got %+v", result.Installs)
+	}
+
+	store, portable := result.Installs[0], result.Installs[1]
+	if store.Name != "Store" || !strings.Contains(store.Error, "MSIX/AppX package") || store.Result != nil {
+		t.Errorf("Expected the packaged install to fail, got %+v", store)
+	}
+	if portable.Name != "Portable" || portable.Error != "" || portable.Result == nil || !portable.Result.Updated {
+		t.Errorf("Expected the portable install to be updated, got %+v", portable)
+	}
+	if version, _ := u.getCurrentVersion(); version != "2.0.0" {
+		t.Errorf("Expected the portable install at version 2.0.0, got %s", version)
+	}
+	data, err := os.ReadFile(filepath.Join(packagedDir, "application.ini"))
+	if err != nil || !strings.Contains(string(data), "Version=1.0.0") {
+		t.Errorf("Expected the packaged install to be untouched, got %q (%v)", data, err)
+	}
+
+	// Each install logs its own result
+	if got := cfg.ForInstall(cfg.Installs[0]).LogValue("LastResult"); !strings.HasPrefix(got, "Failed: ") {
+		t.Errorf("Expected the failure in the packaged install's log, got %q", got)
+	}
+	if got := cfg.LogValue("LastResult"); got != result.Message {
+		t.Errorf("Expected the aggregated result in the log, got %q", got)
+	}
+}
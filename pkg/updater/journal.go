@@ -0,0 +1,156 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// installJournal records the files an update has copied into the install,
+// so an update interrupted by a crash, a power loss or Ctrl+C is resumed
+// rather than started over. The journal starts with a header naming the
+// release and install directory, followed by a "<sha256>  <path>" line for
+// every file copied. It is removed once the update completes.
+type installJournal struct {
+	file *os.File
+	// source maps the install-relative, slash-separated paths of the
+	// files to install to their digests
+	source Manifest
+	// done holds the files an earlier attempt copied that are still intact
+	done map[string]bool
+}
+
+// journalPath returns where the install journal is stored
+func (u *Updater) journalPath() string {
+	return filepath.Join(u.cfg.ExeDir, u.cfg.InstallFile(config.JournalName))
+}
+
+// journalHeader returns the first line of the journal of an install of
+// the current release, if any, to browserDir
+func (u *Updater) journalHeader(browserDir string) string {
+	var tag string
+	if u.release != nil {
+		tag = u.release.TagName
+	}
+	return "release\t" + tag + "\t" + filepath.Clean(browserDir)
+}
+
+// readJournal returns the header and the recorded files of the journal at
+// path. A last line cut short by an interruption is ignored.
+func readJournal(path string) (string, Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines := strings.Split(string(data), "\n")
+	lines = lines[:len(lines)-1]
+	if len(lines) == 0 {
+		return "", nil, fmt.Errorf("journal has no header")
+	}
+
+	entries := Manifest{}
+	for _, line := range lines[1:] {
+		digest, relPath, ok := strings.Cut(line, "  ")
+		if ok && len(digest) == 64 && relPath != "" {
+			entries[relPath] = digest
+		}
+	}
+	return lines[0], entries, nil
+}
+
+// interruptedInstall reports whether the journal left behind by an
+// interrupted install of the current release to browserDir exists
+func (u *Updater) interruptedInstall(browserDir string) bool {
+	header, _, err := readJournal(u.journalPath())
+	return err == nil && header == u.journalHeader(browserDir)
+}
+
+// resumeJournal returns the files an interrupted install of the current
+// release already copied to browserDir that still have the digests in
+// source. It reports false if there is no install to resume.
+func (u *Updater) resumeJournal(browserDir string, source Manifest) (map[string]bool, bool) {
+	header, entries, err := readJournal(u.journalPath())
+	if err != nil || header != u.journalHeader(browserDir) {
+		return nil, false
+	}
+
+	done := map[string]bool{}
+	for relPath, digest := range entries {
+		if source[relPath] != digest {
+			continue
+		}
+		actual, err := hashFile(longPath(filepath.Join(browserDir, filepath.FromSlash(relPath))))
+		if err == nil && actual == digest {
+			done[relPath] = true
+		}
+	}
+	return done, true
+}
+
+// createJournal starts the journal of an install of the current release to
+// browserDir, listing the files in done as copied already
+func (u *Updater) createJournal(browserDir string, source Manifest, done map[string]bool) (*installJournal, error) {
+	file, err := os.Create(u.journalPath())
+	if err != nil {
+		return nil, err
+	}
+
+	j := &installJournal{file: file, source: source, done: done}
+	if j.done == nil {
+		j.done = map[string]bool{}
+	}
+	if _, err := fmt.Fprintln(file, u.journalHeader(browserDir)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	for relPath := range j.done {
+		if err := j.write(relPath); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// completed reports whether an earlier attempt already copied the file at
+// the install-relative path relPath. A nil journal has no files.
+func (j *installJournal) completed(relPath string) bool {
+	return j != nil && j.done[filepath.ToSlash(relPath)]
+}
+
+// record notes that the file at the install-relative path relPath was
+// copied. The journal is not synced: a file recorded but lost in a power
+// failure fails the digest check when resuming and is copied again.
+func (j *installJournal) record(relPath string) error {
+	if j == nil {
+		return nil
+	}
+	return j.write(filepath.ToSlash(relPath))
+}
+
+// write appends the line of a copied file
+func (j *installJournal) write(relPath string) error {
+	digest, ok := j.source[relPath]
+	if !ok {
+		return nil
+	}
+	_, err := fmt.Fprintf(j.file, "%s  %s\n", digest, relPath)
+	return err
+}
+
+// close closes the journal file, keeping it for a later attempt
+func (j *installJournal) close() {
+	j.file.Close()
+}
+
+// removeJournal deletes the install journal after an install completed or
+// was replaced
+func (u *Updater) removeJournal() {
+	if err := os.Remove(u.journalPath()); err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove install journal: %v\n", err)
+	}
+}
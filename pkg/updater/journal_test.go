@@ -0,0 +1,177 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestRunResumesInterruptedInstall(t *testing.T) {
+	files := map[string]string{
+		"application.ini":     "[App]\nVersion=2.0.0\n",
+		"browser/omni.ja":     "omni 2.0.0",
+		config.BrowserExe:     "exe 2.0.0",
+		"defaults/prefs.js":   "prefs 2.0.0",
+		"uninstall/helper.js": "helper 2.0.0",
+	}
+	zipped := map[string]string{}
+	for name, content := range files {
+		zipped["noraneko/"+name] = content
+	}
+	server := newReleaseServer(t, "v2.0.0", makeTestZip(t, zipped))
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.BackupCount = 2
+	browserDir := filepath.Dir(cfg.Path)
+
+	// Break the run at the second file, after the first one,
+	// application.ini, is complete: a non-empty directory cannot be
+	// replaced by it
+	blocker := filepath.Join(browserDir, "browser", "omni.ja")
+	if err := os.MkdirAll(filepath.Join(blocker, "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err == nil || !strings.Contains(err.Error(), "failed to copy files") {
+		t.Fatalf("Expected the copy to fail, got %v", err)
+	}
+	if _, err := os.Stat(u.journalPath()); err != nil {
+		t.Fatalf("Expected the install journal to be kept: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(browserDir, config.BrowserExe)); string(got) != "exe" {
+		t.Fatalf("Expected the interrupted install to be mixed, got exe %q", got)
+	}
+
+	// The new version is already recorded, the retry finishes the install
+	// and copies only the missing files
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	var copied int64
+	u = newTestUpdater(cfg, Options{Portable: true, InstallProgress: func(done, total int64) { copied = total }}, server)
+	result, err := u.Run()
+	if err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if !result.Updated || !strings.HasPrefix(result.Message, "Resumed") {
+		t.Errorf("Expected the retry to resume the update, got %+v", result)
+	}
+	var want int64
+	for name, content := range files {
+		if name != "application.ini" {
+			want += int64(len(content))
+		}
+	}
+	if copied != want {
+		t.Errorf("Expected the %d bytes of the missing files to be copied, copied %d", want, copied)
+	}
+
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(browserDir, filepath.FromSlash(name)))
+		if err != nil || string(got) != content {
+			t.Errorf("Expected %s to contain %q, got %q (%v)", name, content, got, err)
+		}
+	}
+	if _, err := os.Stat(u.journalPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the install journal to be removed, got %v", err)
+	}
+	if mismatches, err := u.VerifyInstall(); err != nil || len(mismatches) != 0 {
+		t.Errorf("Expected the install to match its manifest, got %v (%v)", mismatches, err)
+	}
+
+	// The only backup is the install from before the interruption
+	backups, err := listBackups(filepath.Dir(browserDir))
+	if err != nil || len(backups) != 1 || backups[0].Version != "1.0.0" {
+		t.Fatalf("Expected a single backup of 1.0.0, got %+v (%v)", backups, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(backups[0].Path, config.BrowserExe)); string(got) != "exe" {
+		t.Errorf("Expected the backup to hold the old install, got exe %q", got)
+	}
+}
+
+func TestResumeJournal(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	browserDir := filepath.Dir(cfg.Path)
+	u := New(cfg, Options{})
+	u.release = &Release{TagName: "v2.0.0"}
+
+	write := func(name, content string) string {
+		if err := os.WriteFile(filepath.Join(browserDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		digest, err := hashFile(filepath.Join(browserDir, name))
+		if err != nil {
+			t.Fatalf("Failed to hash %s: %v", name, err)
+		}
+		return digest
+	}
+	source := Manifest{
+		"intact.txt":   write("intact.txt", "intact"),
+		"tampered.txt": write("tampered.txt", "original"),
+		"cut.txt":      write("cut.txt", "cut"),
+	}
+	write("tampered.txt", "changed after the interruption")
+
+	journal := u.journalHeader(browserDir) + "\n" +
+		source["intact.txt"] + "  intact.txt\n" +
+		source["tampered.txt"] + "  tampered.txt\n" +
+		source["cut.txt"] + "  cut.t"
+	if err := os.WriteFile(u.journalPath(), []byte(journal), 0644); err != nil {
+		t.Fatalf("Failed to write journal: %v", err)
+	}
+
+	done, ok := u.resumeJournal(browserDir, source)
+	if !ok {
+		t.Fatal("Expected the journal of the same release to be resumed")
+	}
+	if !done["intact.txt"] || done["tampered.txt"] || done["cut.txt"] {
+		t.Errorf("Expected only the intact file to be kept, got %v", done)
+	}
+
+	// Another release or install directory starts over
+	if _, ok := u.resumeJournal(filepath.Join(browserDir, "other"), source); ok {
+		t.Error("Expected the journal of another directory to be ignored")
+	}
+	u.release = &Release{TagName: "v3.0.0"}
+	if u.interruptedInstall(browserDir) {
+		t.Error("Expected the journal of another release to be ignored")
+	}
+}
+
+func TestRunCancelKeepsCopying(t *testing.T) {
+	server := newReleaseServer(t, "v2.0.0", makeTestZip(t, map[string]string{
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+		"noraneko/browser/omni.ja": "omni 2.0.0",
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+	}))
+	cfg := newPortableInstall(t, "1.0.0")
+
+	// Cancel the run while the second file is copied. The copy finishes
+	// rather than leaving a mix of both versions.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var calls int
+	kill := func(done, total int64) {
+		if calls++; calls == 2 {
+			cancel()
+		}
+	}
+	u := newTestUpdater(cfg, Options{Portable: true, InstallProgress: kill}, server)
+	if _, err := u.runWithin(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the run to succeed or be cancelled, got %v", err)
+	}
+	if calls < 2 {
+		t.Fatalf("Expected the run to reach the copy, got %d progress calls", calls)
+	}
+	if got, _ := os.ReadFile(cfg.Path); string(got) != "exe 2.0.0" {
+		t.Errorf("Expected the copy to complete, got exe %q", got)
+	}
+	if _, err := os.Stat(u.journalPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the install journal to be removed, got %v", err)
+	}
+}
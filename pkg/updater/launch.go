@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// launchTimeout limits how long the browser may run when it is launched
+// to print its version. A browser that opens a window is closed after it.
+const launchTimeout = 10 * time.Second
+
+// errNoVersionOutput is returned when the launched browser prints nothing,
+// as builds that open a window instead of printing do
+var errNoVersionOutput = errors.New("the browser printed no version, it may have opened a window instead")
+
+// launchVersionRe matches the version at the end of a line such as
+// "Mozilla Firefox 128.0.3" or "Noraneko 12.0.0-beta.1"
+var launchVersionRe = regexp.MustCompile(`(?m)(?:^|\s)(v?\d+(?:\.\d+)+\S*)\s*$`)
+
+// launchBrowser runs the browser at path with --version and returns what
+// it printed. It is a variable so tests can stub it out.
+var launchBrowser = func(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), launchTimeout)
+	defer cancel()
+
+	cmd := launchCommand(ctx, path, "--version")
+	// Child processes may hold the output pipe open after a kill
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if len(bytes.TrimSpace(out)) == 0 {
+		if err != nil && ctx.Err() == nil {
+			return "", err
+		}
+		return "", errNoVersionOutput
+	}
+	return string(out), nil
+}
+
+// parseLaunchVersion returns the version in the output of the browser's
+// --version flag
+func parseLaunchVersion(output string) (string, error) {
+	m := launchVersionRe.FindStringSubmatch(output)
+	if m == nil {
+		return "", fmt.Errorf("no version found in %q", output)
+	}
+	return normalizeVersion(m[1]), nil
+}
+
+// verifyByLaunch runs the installed browser with --version and reports an
+// error unless it prints the expected version. It returns the version
+// printed.
+func (u *Updater) verifyByLaunch(version string) (string, error) {
+	browserPath := u.cfg.GetBrowserPath()
+	if browserPath == "" {
+		return "", fmt.Errorf("browser not found")
+	}
+
+	output, err := launchBrowser(browserPath)
+	if err != nil {
+		return "", err
+	}
+	got, err := parseLaunchVersion(output)
+	if err != nil {
+		return "", err
+	}
+	if want := normalizeVersion(version); got != want {
+		return got, fmt.Errorf("%s --version reports %s, expected %s", filepath.Base(browserPath), got, want)
+	}
+	return got, nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package updater
+
+import (
+	"context"
+	"os/exec"
+)
+
+// launchCommand returns a command running the browser
+func launchCommand(ctx context.Context, path string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, path, args...)
+}
@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLaunchVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+		valid  bool
+	}{
+		{"Noraneko 12.0.1\n", "12.0.1", true},
+		{"Mozilla Firefox 128.0.3\r\n", "128.0.3", true},
+		{"Mozilla Noraneko 12.0.0-beta.1\r\n", "12.0.0", true},
+		{"12.0.1", "12.0.1", true},
+		{"Noraneko v1.2\n", "1.2", true},
+		{"[GFX1-]: startup warning\nNoraneko 12.0.1\n", "12.0.1", true},
+		{"Noraneko\n", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLaunchVersion(tt.output)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("Expected no version in %q, got %s", tt.output, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Output %q: expected %s, got %s (%v)", tt.output, tt.want, got, err)
+		}
+	}
+}
+
+// withLaunchOutput stubs out launching the browser
+func withLaunchOutput(t *testing.T, output string, err error) {
+	t.Helper()
+	orig := launchBrowser
+	launchBrowser = func(string) (string, error) { return output, err }
+	t.Cleanup(func() { launchBrowser = orig })
+}
+
+func TestVerifyByLaunch(t *testing.T) {
+	u := New(newPortableInstall(t, "2.0.0"), Options{})
+
+	withLaunchOutput(t, "Mozilla Noraneko 2.0.0\r\n", nil)
+	if got, err := u.verifyByLaunch("v2.0.0"); err != nil || got != "2.0.0" {
+		t.Errorf("Expected the launched version to match, got %s (%v)", got, err)
+	}
+
+	withLaunchOutput(t, "Mozilla Noraneko 1.9.0\r\n", nil)
+	if _, err := u.verifyByLaunch("v2.0.0"); err == nil || !strings.Contains(err.Error(), "1.9.0") {
+		t.Errorf("Expected a mismatch naming 1.9.0, got %v", err)
+	}
+
+	// A browser that opened a window instead of printing
+	withLaunchOutput(t, "", errNoVersionOutput)
+	if _, err := u.verifyByLaunch("v2.0.0"); !errors.Is(err, errNoVersionOutput) {
+		t.Errorf("Expected the missing output to be reported, got %v", err)
+	}
+}
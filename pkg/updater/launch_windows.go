@@ -0,0 +1,20 @@
+//go:build windows
+
+package updater
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// createNoWindow keeps a console window from being created for the process
+const createNoWindow = 0x08000000
+
+// launchCommand returns a command running the browser without showing a
+// console or its main window
+func launchCommand(ctx context.Context, path string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: createNoWindow}
+	return cmd
+}
@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// lockedFileAttempts is how often copyFile tries to write a file that
+	// another process holds open
+	lockedFileAttempts = 5
+
+	// lockedFileDelay is the wait after the first locked attempt, doubled
+	// before each further one
+	lockedFileDelay = 500 * time.Millisecond
+)
+
+// fileLocked reports whether an error writing a file means another
+// process holds it open, overridable for tests
+var fileLocked = isSharingViolation
+
+// copyFile copies a single file with copyFileOnce. Antivirus scanners
+// open freshly written files for a moment even when the browser is not
+// running, so a destination that is locked is tried again with a growing
+// delay before the copy fails.
+func (u *Updater) copyFile(ctx context.Context, src, dst string, progress ProgressFunc) error {
+	delay := lockedFileDelay
+	for attempt := 1; ; attempt++ {
+		err := u.copyFileOnce(ctx, src, dst, progress)
+		if err == nil || !fileLocked(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= lockedFileAttempts {
+			return fmt.Errorf("%s is locked by another process: %w", dst, err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s is locked by another process, e.g. an antivirus scan, retrying in %v...\n", dst, delay)
+		sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package updater
+
+// isSharingViolation reports false; files are only locked against writes
+// on Windows
+func isSharingViolation(err error) bool {
+	return false
+}
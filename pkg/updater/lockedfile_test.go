@@ -0,0 +1,91 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// lockDestination simulates a destination file held open by another
+// process: it is a directory, which a file cannot be renamed over, until
+// unlock removes it
+func lockDestination(t *testing.T, path string) (unlock func()) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatalf("Failed to lock %s: %v", path, err)
+	}
+	origLocked := fileLocked
+	fileLocked = func(err error) bool { return errors.Is(err, syscall.EISDIR) || errors.Is(err, syscall.EEXIST) }
+	t.Cleanup(func() { fileLocked = origLocked })
+	return func() { os.Remove(path) }
+}
+
+func TestCopyDirRetriesLockedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+
+	src := filepath.Join(tmpDir, "src")
+	dst := filepath.Join(tmpDir, "dst")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("Failed to create source dir: %v", err)
+	}
+	for _, name := range []string{"noraneko.exe", "omni.ja"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	// The scan ends after the second retry
+	unlock := lockDestination(t, filepath.Join(dst, "omni.ja"))
+	var slept []time.Duration
+	origSleep := sleep
+	sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		if len(slept) == 2 {
+			unlock()
+		}
+	}
+	t.Cleanup(func() { sleep = origSleep })
+
+	if err := u.copyDir(context.Background(), src, dst, nil); err != nil {
+		t.Fatalf("Expected the copy to succeed once the file is unlocked: %v", err)
+	}
+	if want := []time.Duration{lockedFileDelay, 2 * lockedFileDelay}; !reflect.DeepEqual(slept, want) {
+		t.Errorf("Expected waits %v, got %v", want, slept)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "omni.ja")); err != nil || string(data) != "omni.ja" {
+		t.Errorf("Expected omni.ja to be copied, got %q (%v)", data, err)
+	}
+}
+
+func TestCopyFileLockedGivesUp(t *testing.T) {
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+
+	srcFile := filepath.Join(tmpDir, "omni.ja")
+	if err := os.WriteFile(srcFile, []byte("omni"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	dstFile := filepath.Join(tmpDir, "locked.ja")
+	lockDestination(t, dstFile)
+	var waits int
+	origSleep := sleep
+	sleep = func(time.Duration) { waits++ }
+	t.Cleanup(func() { sleep = origSleep })
+
+	err := u.copyFile(context.Background(), srcFile, dstFile, nil)
+	if err == nil || !strings.Contains(err.Error(), dstFile+" is locked by another process") {
+		t.Fatalf("Expected the locked file to be reported, got %v", err)
+	}
+	if waits != lockedFileAttempts-1 {
+		t.Errorf("Expected %d waits, got %d", lockedFileAttempts-1, waits)
+	}
+}
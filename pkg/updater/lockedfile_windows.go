@@ -0,0 +1,17 @@
+//go:build windows
+
+package updater
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isSharingViolation reports whether err is Windows refusing access to a
+// file another process has open
+func isSharingViolation(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) ||
+		errors.Is(err, windows.ERROR_LOCK_VIOLATION) ||
+		errors.Is(err, windows.ERROR_ACCESS_DENIED)
+}
@@ -0,0 +1,79 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ErrAuthRequired is returned when a download is answered with a login or
+// single sign-on page instead of the asset
+var ErrAuthRequired = errors.New("authentication required")
+
+// assetHostSuffixes are hosts GitHub redirects release downloads to
+var assetHostSuffixes = []string{
+	"github.com",
+	"githubusercontent.com",
+}
+
+// loginPathWords mark a URL path as a login or single sign-on endpoint
+var loginPathWords = []string{"login", "signin", "sign-in", "sso", "saml", "oauth", "authorize", "auth"}
+
+// checkLoginWall reports ErrAuthRequired if a download response is a login
+// page rather than the asset: an HTML page, or a redirect off the asset
+// host to a login endpoint. Redirects to other hosts, such as CDNs, are
+// allowed.
+func checkLoginWall(resp *http.Response) error {
+	final := resp.Request.URL
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		if (mediaType == "text/html" || mediaType == "application/xhtml+xml") && !isHTMLName(final.Path) {
+			return fmt.Errorf("%w: %s answered with an HTML page instead of the download, the asset may require signing in", ErrAuthRequired, final.Host)
+		}
+	}
+
+	original := final
+	for r := resp.Request; r != nil; {
+		original = r.URL
+		if r.Response == nil {
+			break
+		}
+		r = r.Response.Request
+	}
+	if final.Host != original.Host && !isAssetHost(final.Hostname()) && isLoginPath(final.Path) {
+		return fmt.Errorf("%w: download was redirected to %s://%s%s", ErrAuthRequired, final.Scheme, final.Host, final.Path)
+	}
+	return nil
+}
+
+// isHTMLName reports whether a URL path names an HTML file, which is
+// served as HTML legitimately
+func isHTMLName(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".html" || ext == ".htm"
+}
+
+// isAssetHost reports whether host serves GitHub release downloads
+func isAssetHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, suffix := range assetHostSuffixes {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoginPath reports whether a path segment of p names a login endpoint
+func isLoginPath(p string) bool {
+	for _, segment := range strings.Split(strings.ToLower(p), "/") {
+		for _, word := range loginPathWords {
+			if segment == word || strings.HasPrefix(segment, word+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// newSSOServer serves a login page, an OAuth endpoint answering with JSON
+// and a CDN blob
+func newSSOServer(t *testing.T, blob []byte) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sso/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<!DOCTYPE html><html><body><form>Sign in</form></body></html>")
+	})
+	mux.HandleFunc("/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"error": "login_required"}`)
+	})
+	mux.HandleFunc("/blobs/portable", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(blob)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchFileLoginWall(t *testing.T) {
+	blob := makeTestZip(t, map[string]string{"noraneko/noraneko.exe": "exe"})
+	sso := newSSOServer(t, blob)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download/sso.zip", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, sso.URL+"/sso/login?return=/download", http.StatusFound)
+	})
+	mux.HandleFunc("/download/oauth.zip", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, sso.URL+"/oauth/authorize", http.StatusFound)
+	})
+	mux.HandleFunc("/download/cdn.zip", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, sso.URL+"/blobs/portable", http.StatusFound)
+	})
+	mux.HandleFunc("/download/page.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html>Please log in</html>")
+	})
+	origin := httptest.NewServer(mux)
+	defer origin.Close()
+
+	tests := []struct {
+		name     string
+		file     string
+		wantAuth bool
+	}{
+		{"redirect to an SSO login page", "sso.zip", true},
+		{"redirect to an OAuth endpoint", "oauth.zip", true},
+		{"HTML page on the asset host", "page.zip", true},
+		{"redirect to a CDN", "cdn.zip", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			for _, connections := range []int{1, 4} {
+				u := New(&config.Config{WorkDir: tmpDir, DownloadConnections: connections}, Options{})
+				dest := filepath.Join(tmpDir, "portable.zip")
+				_, err := u.newDownloader(0, nil).Download(context.Background(), origin.URL+"/download/"+tt.file, dest)
+				if tt.wantAuth {
+					if !errors.Is(err, ErrAuthRequired) {
+						t.Fatalf("connections=%d: expected ErrAuthRequired, got %v", connections, err)
+					}
+					if _, err := os.Stat(dest); !os.IsNotExist(err) {
+						t.Errorf("connections=%d: expected the login page not to be saved", connections)
+					}
+				} else if err != nil {
+					t.Fatalf("connections=%d: expected the download to succeed: %v", connections, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRunLoginRedirect(t *testing.T) {
+	sso := newSSOServer(t, nil)
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [{"name": "noraneko-windows-x86_64-portable.zip", "browser_download_url": %q}]}`,
+			server.URL+"/download/portable.zip")
+	})
+	mux.HandleFunc("/download/portable.zip", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, sso.URL+"/sso/login", http.StatusFound)
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := newPortableInstall(t, "1.0.0")
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	_, err := u.Run()
+	if !errors.Is(err, ErrAuthRequired) {
+		t.Fatalf("Expected ErrAuthRequired, got %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "1.0.0" {
+		t.Errorf("Expected the install to be untouched, got version %s", v)
+	}
+}
+
+func TestIsLoginPath(t *testing.T) {
+	tests := map[string]bool{
+		"/sso/login":               true,
+		"/login.php":               true,
+		"/oauth2/authorize":        true,
+		"/adfs/ls/SAML":            true,
+		"/releases/download/a.zip": false,
+		"/authors/noraneko.zip":    false,
+		"/":                        false,
+	}
+	for p, want := range tests {
+		if got := isLoginPath(p); got != want {
+			t.Errorf("isLoginPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
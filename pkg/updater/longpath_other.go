@@ -0,0 +1,8 @@
+//go:build !windows
+
+package updater
+
+// longPath returns p unchanged; only Windows limits path length to MAX_PATH
+func longPath(p string) string {
+	return p
+}
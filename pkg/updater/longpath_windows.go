@@ -0,0 +1,27 @@
+//go:build windows
+
+package updater
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the longest path that is safe for all legacy Windows
+// file APIs (CreateDirectory stops at MAX_PATH minus an 8.3 file name)
+const maxShortPath = 248
+
+// longPath returns the extended-length form (\\?\C:\... or \\?\UNC\...)
+// of a long absolute path, so extraction and copying are not limited to
+// MAX_PATH. Short, relative and already-prefixed paths are returned as is.
+func longPath(p string) string {
+	if len(p) < maxShortPath || strings.HasPrefix(p, `\\?\`) || !filepath.IsAbs(p) {
+		return p
+	}
+
+	p = filepath.Clean(p)
+	if strings.HasPrefix(p, `\\`) {
+		return `\\?\UNC\` + p[2:]
+	}
+	return `\\?\` + p
+}
@@ -0,0 +1,77 @@
+//go:build windows
+
+package updater
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestLongPath(t *testing.T) {
+	short := `C:\Program Files\Noraneko\noraneko.exe`
+	if got := longPath(short); got != short {
+		t.Errorf("Expected short path unchanged, got %s", got)
+	}
+
+	long := `C:\` + strings.Repeat(`nested\`, 40) + "file.txt"
+	if got := longPath(long); got != `\\?\`+long {
+		t.Errorf("Expected extended-length prefix, got %s", got)
+	}
+
+	unc := `\\server\share\` + strings.Repeat(`nested\`, 40) + "file.txt"
+	if got := longPath(unc); got != `\\?\UNC\server\share\`+strings.Repeat(`nested\`, 40)+"file.txt" {
+		t.Errorf("Expected UNC extended-length prefix, got %s", got)
+	}
+
+	if got := longPath(`\\?\` + long); got != `\\?\`+long {
+		t.Errorf("Expected prefixed path unchanged, got %s", got)
+	}
+}
+
+func TestUnzipLongPath(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(longPath(tmpDir))
+
+	// A synthetic entry deep enough to push the full path past MAX_PATH
+	deepName := strings.Repeat("deeply-nested-directory/", 12) + "omni.ja"
+	archive := makeTestZip(t, map[string]string{deepName: "payload"})
+	zipPath := filepath.Join(tmpDir, "deep.zip")
+	if err := os.WriteFile(zipPath, archive, 0644); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+
+	dest := filepath.Join(tmpDir, "extract")
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+	if err := u.unzip(zipPath, dest); err != nil {
+		t.Fatalf("Failed to extract deep archive: %v", err)
+	}
+
+	extracted := filepath.Join(dest, filepath.FromSlash(deepName))
+	if len(extracted) <= 260 {
+		t.Fatalf("Test path is only %d characters, expected more than 260", len(extracted))
+	}
+	data, err := os.ReadFile(longPath(extracted))
+	if err != nil {
+		t.Fatalf("Failed to read extracted file: %v", err)
+	}
+	if string(data) != "payload" {
+		t.Errorf("Expected 'payload', got '%s'", string(data))
+	}
+
+	// Copying the deep tree works as well
+	copyDest := filepath.Join(tmpDir, "copy")
+	if err := u.copyDir(context.Background(), dest, copyDest, nil); err != nil {
+		t.Fatalf("Failed to copy deep tree: %v", err)
+	}
+	if _, err := os.Stat(longPath(filepath.Join(copyDest, filepath.FromSlash(deepName)))); err != nil {
+		t.Errorf("Deep file missing after copy: %v", err)
+	}
+}
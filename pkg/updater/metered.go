@@ -0,0 +1,42 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+)
+
+// Connection cost flags reported by Windows (NLM_CONNECTION_COST)
+const (
+	costUnrestricted   = 0x1
+	costFixed          = 0x2
+	costVariable       = 0x4
+	costOverDataLimit  = 0x10000
+	costRoaming        = 0x40000
+	costNearDataLimit  = 0x80000
+	costMeteredOrLimit = costFixed | costVariable | costOverDataLimit | costRoaming | costNearDataLimit
+)
+
+// connectionCost returns the cost flags of the network connection,
+// overridable for tests
+var connectionCost = systemConnectionCost
+
+// meteredCost reports whether a connection with the cost flags is
+// metered: charged by data, roaming, or near or over a data limit. An
+// unknown cost is not metered.
+func meteredCost(cost uint32) bool {
+	return cost&costMeteredOrLimit != 0
+}
+
+// meteredDeferral reports whether SkipOnMetered defers the update of a
+// scheduled run
+func (u *Updater) meteredDeferral() bool {
+	if !u.opts.Scheduled || !u.cfg.SkipOnMetered {
+		return false
+	}
+	cost, err := connectionCost()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not read the connection cost, updating anyway: %v\n", err)
+		return false
+	}
+	return meteredCost(cost)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package updater
+
+// systemConnectionCost reports an unrestricted connection; the connection
+// cost is only read on Windows
+func systemConnectionCost() (uint32, error) {
+	return costUnrestricted, nil
+}
@@ -0,0 +1,70 @@
+package updater
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMeteredCost(t *testing.T) {
+	tests := []struct {
+		name string
+		cost uint32
+		want bool
+	}{
+		{"unknown", 0, false},
+		{"unrestricted", costUnrestricted, false},
+		{"fixed data plan", costFixed, true},
+		{"charged by data", costVariable, true},
+		{"roaming", costUnrestricted | costRoaming, true},
+		{"near data limit", costFixed | costNearDataLimit, true},
+		{"over data limit", costOverDataLimit, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := meteredCost(tt.cost); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// stubConnectionCost makes connectionCost report cost
+func stubConnectionCost(t *testing.T, cost uint32) {
+	orig := connectionCost
+	connectionCost = func() (uint32, error) { return cost, nil }
+	t.Cleanup(func() { connectionCost = orig })
+}
+
+func TestRunSkipOnMetered(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.SkipOnMetered = true
+
+	// A scheduled run on a metered connection defers the update
+	stubConnectionCost(t, costVariable)
+	u := newTestUpdater(cfg, Options{Portable: true, Scheduled: true}, server)
+	result, err := u.Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Updated || !result.UpdateAvailable || !strings.Contains(result.Message, "the connection is metered") {
+		t.Errorf("Expected the update to be deferred, got %+v", result)
+	}
+	if got := cfg.LogValue("LastResult"); got != result.Message {
+		t.Errorf("Expected the deferral to be logged, got %q", got)
+	}
+	if version, _ := u.getCurrentVersion(); version != "1.0.0" {
+		t.Errorf("Expected the install to be untouched, got version %s", version)
+	}
+
+	// On an unmetered connection it proceeds
+	stubConnectionCost(t, costUnrestricted)
+	u = newTestUpdater(cfg, Options{Portable: true, Scheduled: true}, server)
+	if result, err := u.Run(); err != nil || !result.Updated {
+		t.Fatalf("Expected a scheduled run on an unmetered connection to update, got %+v (%v)", result, err)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build windows
+
+package updater
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procCoCreateInstance = windows.NewLazySystemDLL("ole32.dll").NewProc("CoCreateInstance")
+
+var (
+	clsidNetworkListManager = windows.GUID{Data1: 0xDCB00C01, Data2: 0x570F, Data3: 0x4A9B, Data4: [8]byte{0x8D, 0x69, 0x19, 0x9F, 0xDB, 0xA5, 0x72, 0x3B}}
+	iidNetworkCostManager   = windows.GUID{Data1: 0xDCB00008, Data2: 0x570F, Data3: 0x4A9B, Data4: [8]byte{0x8D, 0x69, 0x19, 0x9F, 0xDB, 0xA5, 0x72, 0x3B}}
+)
+
+// clsctxAll creates the COM object in or out of process
+const clsctxAll = 0x17
+
+// networkCostManager is the INetworkCostManager COM interface
+type networkCostManager struct {
+	vtbl *struct {
+		QueryInterface          uintptr
+		AddRef                  uintptr
+		Release                 uintptr
+		GetCost                 uintptr
+		GetDataPlanStatus       uintptr
+		SetDestinationAddresses uintptr
+	}
+}
+
+// systemConnectionCost returns the machine-wide connection cost from the
+// Network List Manager, as shown by Settings for the active network
+func systemConnectionCost() (uint32, error) {
+	// COM is initialized for this thread only
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := windows.CoInitializeEx(0, windows.COINIT_MULTITHREADED); err != nil && err != syscall.Errno(windows.S_FALSE) {
+		return 0, fmt.Errorf("failed to initialize COM: %w", err)
+	}
+	defer windows.CoUninitialize()
+
+	var manager *networkCostManager
+	hr, _, _ := procCoCreateInstance.Call(
+		uintptr(unsafe.Pointer(&clsidNetworkListManager)), 0, clsctxAll,
+		uintptr(unsafe.Pointer(&iidNetworkCostManager)), uintptr(unsafe.Pointer(&manager)))
+	if int32(hr) < 0 {
+		return 0, fmt.Errorf("failed to create the network list manager: 0x%08X", uint32(hr))
+	}
+	defer syscall.SyscallN(manager.vtbl.Release, uintptr(unsafe.Pointer(manager)))
+
+	var cost uint32
+	hr, _, _ = syscall.SyscallN(manager.vtbl.GetCost, uintptr(unsafe.Pointer(manager)), uintptr(unsafe.Pointer(&cost)), 0)
+	if int32(hr) < 0 {
+		return 0, fmt.Errorf("failed to read the connection cost: 0x%08X", uint32(hr))
+	}
+	return cost, nil
+}
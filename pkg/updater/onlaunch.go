@@ -0,0 +1,71 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// launchCheckTimeout limits the release requests of a launch check, so a
+// slow network never holds up the browser, overridable for tests
+var launchCheckTimeout = 5 * time.Second
+
+// OnLaunch checks for an update without installing it, for a wrapper that
+// starts the browser. The release is fetched at most once per
+// CheckInterval, with the cached ETag; in between, the cached release is
+// compared with the install without any request. Failures are only
+// printed as warnings: the result then reports no update.
+func (u *Updater) OnLaunch() *RunResult {
+	result := &RunResult{StartedAt: time.Now()}
+	finish := func(message string) *RunResult {
+		result.Message = message
+		result.Duration = time.Since(result.StartedAt)
+		return result
+	}
+
+	current, err := u.getInstalledBuild()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not determine current version: %v\n", err)
+		return finish("Current version unknown")
+	}
+	result.CurrentVersion = current.Version
+
+	var release *Release
+	if u.launchCheckDue() {
+		u.cfg.LogEntry("LastLaunchCheck", clock().Format(time.RFC3339))
+
+		ctx, cancel := context.WithTimeout(context.Background(), launchCheckTimeout)
+		defer cancel()
+		if release, err = u.getLatestRelease(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: update check failed: %v\n", err)
+			return finish("Update check failed")
+		}
+	} else if _, release = u.cachedRelease(u.apiURL + "/latest"); release == nil || u.cfg.ExcludedFromStable(release.TagName) {
+		// Without a usable cached release, wait for the next check
+		return finish("No cached release")
+	}
+
+	newVersion := releaseVersion(release)
+	result.NewVersion = newVersion
+	if !u.isNewerBuild(current, release) || u.isSkipped(release) {
+		return finish("No new version found")
+	}
+
+	fmt.Fprintf(u.out, "%s %s is available (installed: %s). Run the updater to install it.\n", config.BrowserName, newVersion, current.Version)
+	result.UpdateAvailable = true
+	return finish(fmt.Sprintf("Update to %s available", newVersion))
+}
+
+// launchCheckDue reports whether the last launch check that fetched the
+// release is at least CheckInterval minutes ago
+func (u *Updater) launchCheckDue() bool {
+	last, err := time.Parse(time.RFC3339, u.cfg.LogValue("LastLaunchCheck"))
+	if err != nil {
+		return true
+	}
+	elapsed := clock().Sub(last)
+	return elapsed < 0 || elapsed >= time.Duration(u.cfg.CheckInterval)*time.Minute
+}
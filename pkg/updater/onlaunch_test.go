@@ -0,0 +1,134 @@
+package updater
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestOnLaunchCachedCheck(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.CheckInterval = 60
+
+	var requests, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v2"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		w.Write([]byte(`{"tag_name": "v2.0.0", "assets": [{"name": "noraneko-windows-x86_64-portable.zip", "size": 42}]}`))
+	}))
+	defer server.Close()
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	origClock := clock
+	clock = func() time.Time { return now }
+	t.Cleanup(func() { clock = origClock })
+
+	// The first launch fetches the release
+	u := New(cfg, Options{})
+	u.apiURL = server.URL
+	result := u.OnLaunch()
+	if !result.UpdateAvailable || result.NewVersion != "2.0.0" || result.CurrentVersion != "1.0.0" {
+		t.Errorf("Expected an update to be reported, got %+v", result)
+	}
+	if requests != 1 {
+		t.Fatalf("Expected 1 request, got %d", requests)
+	}
+	if version, _ := u.getCurrentVersion(); version != "1.0.0" {
+		t.Errorf("Expected nothing to be installed, got version %s", version)
+	}
+
+	// Launches within CheckInterval use the cached release without a request
+	now = now.Add(59 * time.Minute)
+	u = New(cfg, Options{})
+	u.apiURL = server.URL
+	result = u.OnLaunch()
+	if !result.UpdateAvailable || result.NewVersion != "2.0.0" {
+		t.Errorf("Expected the cached release to report the update, got %+v", result)
+	}
+	if requests != 1 {
+		t.Errorf("Expected no request within CheckInterval, got %d", requests)
+	}
+
+	// Once CheckInterval passed, the release is fetched again with the ETag
+	now = now.Add(time.Minute)
+	result = u.OnLaunch()
+	if requests != 2 || notModified != 1 {
+		t.Errorf("Expected a conditional request, got %d requests and %d not modified", requests, notModified)
+	}
+	if !result.UpdateAvailable {
+		t.Errorf("Expected the update to be reported from the 304 response, got %+v", result)
+	}
+
+	// A skipped version is not reported
+	cfg.SkipVersion = "2.0.0"
+	if result := u.OnLaunch(); result.UpdateAvailable {
+		t.Errorf("Expected the skipped version not to be reported, got %+v", result)
+	}
+}
+
+func TestOnLaunchFailureDoesNotBlock(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+
+	// Without a cached release, a failed check reports no update
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	u := New(cfg, Options{})
+	u.apiURL = server.URL
+	result := u.OnLaunch()
+	if result.UpdateAvailable || result.Message != "Update check failed" {
+		t.Errorf("Expected a failed check without an update, got %+v", result)
+	}
+
+	// The failed check still counts against CheckInterval, so the next
+	// launch does not wait for the network again
+	result = u.OnLaunch()
+	if result.Message != "No cached release" {
+		t.Errorf("Expected the next launch to skip the request, got %+v", result)
+	}
+}
+
+func TestOnLaunchSlowReleaseList(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.Branch = "stable"
+	cfg.StableExcludePatterns = config.DefaultStableExcludePatterns
+
+	// The latest release is a candidate, so the full list is fetched,
+	// which never answers
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest" {
+			w.Write([]byte(`{"tag_name": "v2.0.0-rc1"}`))
+			return
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	origTimeout := launchCheckTimeout
+	launchCheckTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { launchCheckTimeout = origTimeout })
+
+	u := New(cfg, Options{})
+	u.apiURL = server.URL
+	start := time.Now()
+	result := u.OnLaunch()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the launch check to give up after its timeout, took %v", elapsed)
+	}
+	if result.UpdateAvailable || result.Message != "Update check failed" {
+		t.Errorf("Expected a failed check without an update, got %+v", result)
+	}
+}
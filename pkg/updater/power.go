@@ -0,0 +1,39 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+)
+
+// powerState is the power source of the computer
+type powerState struct {
+	OnBattery bool
+
+	// Remaining battery charge in percent, -1 if unknown
+	Charge int
+}
+
+// powerStatus returns the power source of the computer, overridable for
+// tests
+var powerStatus = systemPowerStatus
+
+// lowBattery reports whether a scheduled run should defer the update on
+// this power state: running on battery with less than minCharge percent
+// left, or an unknown charge
+func lowBattery(state powerState, minCharge int) bool {
+	return state.OnBattery && state.Charge < minCharge
+}
+
+// batteryDeferral returns the power state if SkipOnBattery defers the
+// update of a scheduled run
+func (u *Updater) batteryDeferral() (powerState, bool) {
+	if !u.opts.Scheduled || !u.cfg.SkipOnBattery {
+		return powerState{}, false
+	}
+	state, err := powerStatus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not read the power status, updating anyway: %v\n", err)
+		return powerState{}, false
+	}
+	return state, lowBattery(state, u.cfg.MinBatteryCharge)
+}
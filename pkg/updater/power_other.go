@@ -0,0 +1,9 @@
+//go:build !windows
+
+package updater
+
+// systemPowerStatus reports AC power; the power source is only read on
+// Windows
+func systemPowerStatus() (powerState, error) {
+	return powerState{Charge: -1}, nil
+}
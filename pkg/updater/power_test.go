@@ -0,0 +1,79 @@
+package updater
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLowBattery(t *testing.T) {
+	tests := []struct {
+		name  string
+		state powerState
+		want  bool
+	}{
+		{"AC power", powerState{OnBattery: false, Charge: 10}, false},
+		{"AC power without battery", powerState{OnBattery: false, Charge: -1}, false},
+		{"battery above threshold", powerState{OnBattery: true, Charge: 80}, false},
+		{"battery at threshold", powerState{OnBattery: true, Charge: 50}, false},
+		{"battery below threshold", powerState{OnBattery: true, Charge: 49}, true},
+		{"battery with unknown charge", powerState{OnBattery: true, Charge: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lowBattery(tt.state, 50); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// stubPowerStatus makes powerStatus report state
+func stubPowerStatus(t *testing.T, state powerState) {
+	orig := powerStatus
+	powerStatus = func() (powerState, error) { return state, nil }
+	t.Cleanup(func() { powerStatus = orig })
+}
+
+func TestRunSkipOnBattery(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.SkipOnBattery = true
+	cfg.MinBatteryCharge = 50
+
+	// A scheduled run on a low battery defers the update
+	stubPowerStatus(t, powerState{OnBattery: true, Charge: 20})
+	u := newTestUpdater(cfg, Options{Portable: true, Scheduled: true}, server)
+	result, err := u.Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Updated || !result.UpdateAvailable || !strings.Contains(result.Message, "on battery at 20%") {
+		t.Errorf("Expected the update to be deferred, got %+v", result)
+	}
+	if got := cfg.LogValue("LastResult"); got != result.Message {
+		t.Errorf("Expected the deferral to be logged, got %q", got)
+	}
+	if version, _ := u.getCurrentVersion(); version != "1.0.0" {
+		t.Errorf("Expected the install to be untouched, got version %s", version)
+	}
+
+	// An interactive run proceeds
+	u = newTestUpdater(cfg, Options{Portable: true}, server)
+	if result, err := u.Run(); err != nil || !result.Updated {
+		t.Fatalf("Expected an interactive run to update, got %+v (%v)", result, err)
+	}
+
+	// So does a scheduled run on AC power
+	cfg = newPortableInstall(t, "1.0.0")
+	cfg.SkipOnBattery = true
+	cfg.MinBatteryCharge = 50
+	stubPowerStatus(t, powerState{Charge: 20})
+	u = newTestUpdater(cfg, Options{Portable: true, Scheduled: true}, server)
+	if result, err := u.Run(); err != nil || !result.Updated {
+		t.Fatalf("Expected a scheduled run on AC power to update, got %+v (%v)", result, err)
+	}
+}
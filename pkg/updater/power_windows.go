@@ -0,0 +1,33 @@
+//go:build windows
+
+package updater
+
+import "unsafe"
+
+var procGetSystemPowerStatus = kernel32.NewProc("GetSystemPowerStatus")
+
+// systemPowerStatusInfo is the SYSTEM_POWER_STATUS structure
+type systemPowerStatusInfo struct {
+	ACLineStatus        byte
+	BatteryFlag         byte
+	BatteryLifePercent  byte
+	SystemStatusFlag    byte
+	BatteryLifeTime     uint32
+	BatteryFullLifeTime uint32
+}
+
+// systemPowerStatus reads the power source from GetSystemPowerStatus. Only
+// a computer known to be off AC power runs on battery.
+func systemPowerStatus() (powerState, error) {
+	var info systemPowerStatusInfo
+	r, _, err := procGetSystemPowerStatus.Call(uintptr(unsafe.Pointer(&info)))
+	if r == 0 {
+		return powerState{}, err
+	}
+
+	state := powerState{OnBattery: info.ACLineStatus == 0, Charge: int(info.BatteryLifePercent)}
+	if info.BatteryLifePercent == 255 {
+		state.Charge = -1
+	}
+	return state, nil
+}
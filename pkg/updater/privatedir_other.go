@@ -0,0 +1,13 @@
+//go:build !windows
+
+package updater
+
+import "os"
+
+// makePrivateDir creates dir if needed, accessible to the owner only
+func makePrivateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(dir, 0700)
+}
@@ -0,0 +1,118 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// secondaryLimitAttempts is how often a request that hits a secondary
+	// rate limit is sent before giving up
+	secondaryLimitAttempts = 3
+
+	// secondaryLimitWait is the wait when a secondary rate limit response
+	// has no usable Retry-After header. GitHub asks for at least a minute.
+	secondaryLimitWait = time.Minute
+
+	// secondaryLimitMaxWait caps the wait asked for by Retry-After
+	secondaryLimitMaxWait = 5 * time.Minute
+
+	// secondaryLimitBodySize is how much of a 403 or 429 response body is
+	// read to tell a secondary rate limit apart
+	secondaryLimitBodySize = 64 << 10
+)
+
+// SecondaryRateLimitError is returned when GitHub keeps answering with its
+// secondary rate limit, which it applies to clients sending requests too
+// quickly, after backing off as asked
+type SecondaryRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SecondaryRateLimitError) Error() string {
+	return fmt.Sprintf("GitHub secondary rate limit exceeded (too many requests in a short time), try again in %v", e.RetryAfter)
+}
+
+// do sends a request like the HTTP client does. If GitHub answers with its
+// secondary rate limit, the request is sent again after the Retry-After
+// delay, up to secondaryLimitAttempts times, unless the request's context
+// would expire before then.
+func (u *Updater) do(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		wait, limited := secondaryRateLimit(resp)
+		if !limited {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if attempt >= secondaryLimitAttempts {
+			return nil, &SecondaryRateLimitError{RetryAfter: wait}
+		}
+		if deadline, ok := req.Context().Deadline(); ok && time.Until(deadline) < wait {
+			return nil, &SecondaryRateLimitError{RetryAfter: wait}
+		}
+
+		fmt.Fprintf(os.Stderr, "GitHub secondary rate limit hit, waiting %v before retrying...\n", wait)
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleepContext waits for d like sleep, but returns the context's error as
+// soon as ctx is done, overridable for tests
+var sleepContext = func(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// secondaryRateLimit reports whether resp is a secondary rate limit
+// response and how long to wait before the next request. Such responses
+// are a 403 or 429 whose body mentions the secondary rate limit; the
+// primary limit's "API rate limit exceeded" is not one. The body read to
+// check is put back for the caller.
+func secondaryRateLimit(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, secondaryLimitBodySize))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	if !strings.Contains(strings.ToLower(string(head)), "secondary rate limit") {
+		return 0, false
+	}
+	return retryAfter(resp.Header.Get("Retry-After")), true
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP
+// date, capped at secondaryLimitMaxWait
+func retryAfter(value string) time.Duration {
+	wait := secondaryLimitWait
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = max(time.Until(at).Round(time.Second), 0)
+	}
+	return min(wait, secondaryLimitMaxWait)
+}
@@ -0,0 +1,137 @@
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secondaryLimitBody is the message GitHub sends with a secondary rate
+// limit response
+const secondaryLimitBody = `{"message": "You have exceeded a secondary rate limit. Please wait a few minutes before you try again.", "documentation_url": "https://docs.github.com/rest/overview/rate-limits-for-the-rest-api#about-secondary-rate-limits"}`
+
+// newRateLimitedServer answers release requests with limited secondary
+// rate limit responses, then with a release
+func newRateLimitedServer(t *testing.T, limited int) (*httptest.Server, *int) {
+	t.Helper()
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= limited {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, secondaryLimitBody)
+			return
+		}
+		fmt.Fprint(w, `{"tag_name": "v2.0.0", "assets": []}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestSecondaryRateLimit(t *testing.T) {
+	var slept []time.Duration
+	orig := sleepContext
+	sleepContext = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { sleepContext = orig })
+
+	// Backing off per Retry-After gets the release
+	server, requests := newRateLimitedServer(t, 2)
+	u := newTestUpdater(newPortableInstall(t, "1.0.0"), Options{}, server)
+	release, err := u.getLatestReleaseFromAPI(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the release after backing off: %v", err)
+	}
+	if release.TagName != "v2.0.0" || *requests != 3 {
+		t.Errorf("Expected v2.0.0 after 3 requests, got %s after %d", release.TagName, *requests)
+	}
+	if len(slept) != 2 || slept[0] != 7*time.Second || slept[1] != 7*time.Second {
+		t.Errorf("Expected two waits of 7s, got %v", slept)
+	}
+
+	// A limit that persists is reported as such
+	slept = nil
+	server, requests = newRateLimitedServer(t, 10)
+	u = newTestUpdater(newPortableInstall(t, "1.0.0"), Options{}, server)
+	_, err = u.getLatestReleaseFromAPI(context.Background())
+	var limitErr *SecondaryRateLimitError
+	if !errors.As(err, &limitErr) || limitErr.RetryAfter != 7*time.Second {
+		t.Fatalf("Expected a secondary rate limit error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "secondary rate limit") || *requests != secondaryLimitAttempts {
+		t.Errorf("Expected a clear error after %d requests, got %q after %d", secondaryLimitAttempts, err, *requests)
+	}
+}
+
+func TestSecondaryRateLimitCancel(t *testing.T) {
+	server, requests := newRateLimitedServer(t, 10)
+	u := newTestUpdater(newPortableInstall(t, "1.0.0"), Options{}, server)
+
+	// Cancelling during the 7s wait returns right away
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	req, err := u.newRequest(ctx, "GET", server.URL+"/releases/latest")
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	start := time.Now()
+	if _, err := u.do(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the wait to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second || *requests != 1 {
+		t.Errorf("Expected to stop after 1 request without waiting, took %v for %d", elapsed, *requests)
+	}
+}
+
+func TestPrimaryRateLimitNotRetried(t *testing.T) {
+	var slept int
+	orig := sleepContext
+	sleepContext = func(context.Context, time.Duration) error {
+		slept++
+		return nil
+	}
+	t.Cleanup(func() { sleepContext = orig })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message": "API rate limit exceeded for 192.0.2.1."}`)
+	}))
+	defer server.Close()
+
+	u := newTestUpdater(newPortableInstall(t, "1.0.0"), Options{}, server)
+	_, err := u.getLatestReleaseFromAPI(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "API rate limit exceeded") {
+		t.Errorf("Expected the primary limit's message to reach the caller, got %v", err)
+	}
+	if slept != 0 {
+		t.Errorf("Expected the primary limit not to be retried, waited %d times", slept)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{"0", 0},
+		{"", secondaryLimitWait},
+		{"soon", secondaryLimitWait},
+		{"86400", secondaryLimitMaxWait},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := retryAfter(tt.value); got != tt.want {
+			t.Errorf("retryAfter(%q): expected %v, got %v", tt.value, tt.want, got)
+		}
+	}
+}
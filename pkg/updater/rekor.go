@@ -0,0 +1,154 @@
+package updater
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// tlogEntry is a Rekor transparency log entry of a Sigstore bundle
+type tlogEntry struct {
+	LogIndex json.Number `json:"logIndex"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	IntegratedTime   json.Number `json:"integratedTime"`
+	InclusionPromise struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	CanonicalizedBody []byte `json:"canonicalizedBody"`
+}
+
+// rekorPayload is what the signed entry timestamp of a Rekor entry signs.
+// The fields are in the order of its canonical JSON encoding.
+type rekorPayload struct {
+	Body           []byte `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// rekorEntry is the part of a Rekor entry body that ties it to a signature
+type rekorEntry struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		// dsse entries
+		PayloadHash struct {
+			Algorithm string `json:"algorithm"`
+			Value     string `json:"value"`
+		} `json:"payloadHash"`
+		Signatures []struct {
+			Verifier []byte `json:"verifier"`
+		} `json:"signatures"`
+
+		// hashedrekord entries
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// loadRekorKey reads the PEM public key of the Rekor transparency log
+func loadRekorKey(path string) (*ecdsa.PublicKey, error) {
+	if path == "" {
+		return nil, errors.New("RekorPublicKey is not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Rekor public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM public key found in %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Rekor public key: %w", err)
+	}
+	ecKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported Rekor key type %T", key)
+	}
+	return ecKey, nil
+}
+
+// verifySET checks that set is a signed entry timestamp of payload made by
+// the Rekor log with key, and returns the time it proves the entry was
+// logged at
+func verifySET(key *ecdsa.PublicKey, payload rekorPayload, set []byte) (time.Time, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	logID := sha256.Sum256(der)
+	if payload.LogID != hex.EncodeToString(logID[:]) {
+		return time.Time{}, errors.New("transparency log entry is not from the trusted Rekor log")
+	}
+
+	signed, err := json.Marshal(payload)
+	if err != nil {
+		return time.Time{}, err
+	}
+	digest := sha256.Sum256(signed)
+	if !ecdsa.VerifyASN1(key, digest[:], set) {
+		return time.Time{}, errors.New("invalid signed entry timestamp")
+	}
+	return time.Unix(payload.IntegratedTime, 0), nil
+}
+
+// loggedTime returns the time the first of entries whose signed entry
+// timestamp verifies with key and whose body matches was logged at. The
+// time of an entry is only trusted once its timestamp is verified.
+func loggedTime(entries []tlogEntry, key *ecdsa.PublicKey, matches func(*rekorEntry) bool) (time.Time, error) {
+	err := errors.New("no transparency log entry")
+	for _, entry := range entries {
+		index, indexErr := entry.LogIndex.Int64()
+		integrated, timeErr := entry.IntegratedTime.Int64()
+		if indexErr != nil || timeErr != nil {
+			err = errors.New("invalid transparency log entry")
+			continue
+		}
+		if len(entry.InclusionPromise.SignedEntryTimestamp) == 0 {
+			err = errors.New("transparency log entry has no signed entry timestamp")
+			continue
+		}
+
+		payload := rekorPayload{
+			Body:           entry.CanonicalizedBody,
+			IntegratedTime: integrated,
+			LogID:          hex.EncodeToString(entry.LogID.KeyID),
+			LogIndex:       index,
+		}
+		logged, setErr := verifySET(key, payload, entry.InclusionPromise.SignedEntryTimestamp)
+		if setErr != nil {
+			err = setErr
+			continue
+		}
+
+		var body rekorEntry
+		if json.Unmarshal(entry.CanonicalizedBody, &body) != nil || !matches(&body) {
+			err = errors.New("transparency log entry is for another signature")
+			continue
+		}
+		return logged, nil
+	}
+	return time.Time{}, err
+}
+
+// hasVerifier reports whether a PEM certificate in a Rekor entry body is
+// the DER certificate cert
+func hasVerifier(pemData []byte, cert []byte) bool {
+	certs, err := parseCertificatePEM(pemData)
+	return err == nil && bytes.Equal(certs[0], cert)
+}
@@ -0,0 +1,258 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// releasesPerPage is the page size requested from the releases API
+const releasesPerPage = 100
+
+// getReleases fetches the full release list, following the API's
+// Link: rel="next" headers for up to MaxReleasePages pages
+func (u *Updater) getReleases(ctx context.Context) ([]Release, error) {
+	maxPages := u.cfg.MaxReleasePages
+	if maxPages < 1 {
+		maxPages = 1
+	}
+
+	var releases []Release
+	url := fmt.Sprintf("%s?per_page=%d", u.apiURL, releasesPerPage)
+	for page := 1; url != ""; page++ {
+		if page > maxPages {
+			fmt.Fprintf(os.Stderr, "Warning: release list truncated after %d page(s), %d releases fetched\n", maxPages, len(releases))
+			break
+		}
+
+		pageReleases, next, err := u.getReleasePage(ctx, url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch release page %d: %w", page, err)
+		}
+		releases = append(releases, pageReleases...)
+		url = next
+	}
+
+	return releases, nil
+}
+
+// getReleasePage fetches a single page of releases and returns the URL of
+// the next page, if any
+func (u *Updater) getReleasePage(ctx context.Context, url string) ([]Release, string, error) {
+	req, err := u.newRequest(ctx, "GET", url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := u.do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, "", fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var releases []Release
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, "", fmt.Errorf("failed to decode release list: %w", err)
+	}
+
+	return releases, nextPageURL(resp.Header.Get("Link")), nil
+}
+
+// nextPageURL extracts the rel="next" target from a Link header such as
+// `<https://api.github.com/...?page=2>; rel="next", <...?page=5>; rel="last"`
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		segments := strings.Split(part, ";")
+		if len(segments) < 2 {
+			continue
+		}
+		target := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range segments[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			}
+		}
+	}
+	return ""
+}
+
+// ListReleases returns all published releases, newest first by publish
+// date. Releases published at the same time are ordered by tag, so the list
+// does not depend on the API's order. Releases excluded from the stable
+// branch are left out on it.
+func (u *Updater) ListReleases() ([]Release, error) {
+	return u.listReleases(context.Background())
+}
+
+// listReleases is ListReleases, cancelled with ctx
+func (u *Updater) listReleases(ctx context.Context) ([]Release, error) {
+	releases, err := u.getReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	published := releases[:0]
+	for _, r := range releases {
+		if !r.Draft && !u.cfg.ExcludedFromStable(r.TagName) {
+			published = append(published, r)
+		}
+	}
+	sort.SliceStable(published, func(i, j int) bool {
+		a, b := published[i], published[j]
+		if !a.PublishedAt.Equal(b.PublishedAt) {
+			return a.PublishedAt.After(b.PublishedAt)
+		}
+		return a.TagName > b.TagName
+	})
+	return published, nil
+}
+
+// ReleaseFormats are the output formats of WriteReleases
+var ReleaseFormats = []string{"table", "csv", "json"}
+
+// releaseRow is a release as listed by WriteReleases
+type releaseRow struct {
+	Tag       string `json:"tag"`
+	Version   string `json:"version"`
+	Channel   string `json:"channel"`
+	Published string `json:"published"`
+}
+
+// releaseRows returns the rows listed for releases. Versions have no
+// leading "v" and dates are UTC, empty if unknown.
+func releaseRows(releases []Release) []releaseRow {
+	rows := make([]releaseRow, 0, len(releases))
+	for i := range releases {
+		r := &releases[i]
+		row := releaseRow{Tag: r.TagName, Version: releaseVersion(r), Channel: "release"}
+		if r.Prerelease {
+			row.Channel = "prerelease"
+		}
+		if !r.PublishedAt.IsZero() {
+			row.Published = r.PublishedAt.UTC().Format("2006-01-02")
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// WriteReleases writes releases in one of ReleaseFormats: an aligned table
+// whose columns are as wide as their longest value, CSV with a header row,
+// or a JSON array
+func WriteReleases(w io.Writer, releases []Release, format string) error {
+	rows := releaseRows(releases)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"tag", "version", "channel", "published"})
+		for _, row := range rows {
+			cw.Write([]string{row.Tag, row.Version, row.Channel, row.Published})
+		}
+		cw.Flush()
+		return cw.Error()
+
+	case "table", "":
+		header := releaseRow{Tag: "TAG", Version: "VERSION", Channel: "CHANNEL", Published: "PUBLISHED"}
+		tagWidth, versionWidth := len(header.Tag), len(header.Version)
+		for _, row := range rows {
+			tagWidth = max(tagWidth, len(row.Tag))
+			versionWidth = max(versionWidth, len(row.Version))
+		}
+		for _, row := range append([]releaseRow{header}, rows...) {
+			published := row.Published
+			if published == "" {
+				published = "-"
+			}
+			if _, err := fmt.Fprintf(w, "%-*s  %-*s  %-10s  %s\n", tagWidth, row.Tag, versionWidth, row.Version, row.Channel, published); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(ReleaseFormats, ", "))
+}
+
+// latestStableRelease returns the newest published release of the full
+// list that is neither a prerelease nor excluded by StableExcludePatterns
+func (u *Updater) latestStableRelease(ctx context.Context) (*Release, error) {
+	releases, err := u.listReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range releases {
+		if !releases[i].Prerelease {
+			return &releases[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no release left on the stable branch after applying StableExcludePatterns")
+}
+
+// DumpReleaseJSON fetches the latest release like an update would and
+// prints the JSON received, indented, for bug reports. The request is
+// echoed to stderr with credentials redacted. A release read from the
+// ETag cache, the release pages or the full list is printed as decoded.
+func (u *Updater) DumpReleaseJSON(w io.Writer) error {
+	release, err := u.getLatestRelease(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get latest release: %w", err)
+	}
+	if u.releaseRequest != nil {
+		fmt.Fprint(os.Stderr, u.describeRequest(u.releaseRequest))
+	}
+
+	body := u.releaseBody
+	if body == nil {
+		fmt.Fprintln(os.Stderr, "Note: no raw API response for this release, printing the decoded release")
+		if body, err = json.Marshal(release); err != nil {
+			return err
+		}
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return fmt.Errorf("failed to format release info: %w", err)
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(w)
+	return err
+}
+
+// describeRequest returns the method, URL and headers of a request, one
+// per line, with credentials redacted
+func (u *Updater) describeRequest(req *http.Request) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL)
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(req.Header[name], ", ")
+		if name == "Authorization" || name == "Proxy-Authorization" {
+			value = redacted
+		}
+		fmt.Fprintf(&b, "%s: %s\n", name, value)
+	}
+	return u.redactSecrets(b.String())
+}
@@ -0,0 +1,320 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// newPaginatedServer serves `pages` pages of two releases each, linking
+// them with Link headers like the GitHub API
+func newPaginatedServer(t *testing.T, pages int) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			page, _ = strconv.Atoi(p)
+		}
+
+		if page < pages {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/releases?per_page=100&page=%d>; rel="next", <%s/releases?per_page=100&page=%d>; rel="last"`,
+				server.URL, page+1, server.URL, pages))
+		}
+		fmt.Fprintf(w, `[{"tag_name": "v%d.0.0"}, {"tag_name": "v%d.1.0", "draft": true}]`, page, page)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGetReleasesPagination(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	server := newPaginatedServer(t, 3)
+	cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir, MaxReleasePages: 10}
+	u := New(cfg, Options{})
+	u.apiURL = server.URL + "/releases"
+
+	releases, err := u.getReleases(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if len(releases) != 6 {
+		t.Fatalf("Expected 6 releases across 3 pages, got %d", len(releases))
+	}
+	if releases[4].TagName != "v3.0.0" {
+		t.Errorf("Expected v3.0.0 from the last page, got %s", releases[4].TagName)
+	}
+
+	// Drafts are left out of the listing
+	listed, err := u.ListReleases()
+	if err != nil {
+		t.Fatalf("Failed to list releases: %v", err)
+	}
+	if len(listed) != 3 {
+		t.Errorf("Expected 3 published releases, got %d", len(listed))
+	}
+}
+
+func TestGetReleasesPageCap(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	server := newPaginatedServer(t, 5)
+	cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir, MaxReleasePages: 2}
+	u := New(cfg, Options{})
+	u.apiURL = server.URL + "/releases"
+
+	releases, err := u.getReleases(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to get releases: %v", err)
+	}
+	if len(releases) != 4 {
+		t.Errorf("Expected the cap to stop after 2 pages (4 releases), got %d", len(releases))
+	}
+}
+
+func TestNextPageURL(t *testing.T) {
+	tests := []struct {
+		link     string
+		expected string
+	}{
+		{`<https://api.github.com/x?page=2>; rel="next", <https://api.github.com/x?page=5>; rel="last"`, "https://api.github.com/x?page=2"},
+		{`<https://api.github.com/x?page=1>; rel="prev", <https://api.github.com/x?page=1>; rel="first"`, ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := nextPageURL(tt.link); got != tt.expected {
+			t.Errorf("nextPageURL(%q) = %q, expected %q", tt.link, got, tt.expected)
+		}
+	}
+}
+
+// newMixedReleaseServer serves a latest release candidate published as a
+// regular release, and a release list mixing candidates, prereleases and
+// releases
+func newMixedReleaseServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v2.0.0-RC1"}`)
+	})
+	mux.HandleFunc("/releases", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"tag_name": "v2.0.0-RC1"},
+			{"tag_name": "v1.9.0-candidate"},
+			{"tag_name": "v1.8.0-beta.1", "prerelease": true},
+			{"tag_name": "v1.7.1", "draft": true},
+			{"tag_name": "v1.7.0-rc.2"},
+			{"tag_name": "v1.7.0"},
+			{"tag_name": "v1.6.0-rcfix"}
+		]`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStableExcludePatterns(t *testing.T) {
+	server := newMixedReleaseServer(t)
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		branch   string
+		patterns []string
+		latest   string
+		listed   []string
+	}{
+		{"stable", "stable", config.DefaultStableExcludePatterns, "v1.7.0",
+			[]string{"v1.8.0-beta.1", "v1.7.0", "v1.6.0-rcfix"}},
+		{"stable without patterns", "stable", nil, "v2.0.0-RC1",
+			[]string{"v2.0.0-RC1", "v1.9.0-candidate", "v1.8.0-beta.1", "v1.7.0-rc.2", "v1.7.0", "v1.6.0-rcfix"}},
+		{"custom pattern", "Stable", []string{`^v1\.7`}, "v2.0.0-RC1",
+			[]string{"v2.0.0-RC1", "v1.9.0-candidate", "v1.8.0-beta.1", "v1.6.0-rcfix"}},
+		{"nightly", "nightly", config.DefaultStableExcludePatterns, "v2.0.0-RC1",
+			[]string{"v2.0.0-RC1", "v1.9.0-candidate", "v1.8.0-beta.1", "v1.7.0-rc.2", "v1.7.0", "v1.6.0-rcfix"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir, MaxReleasePages: 1, Branch: tt.branch, StableExcludePatterns: tt.patterns}
+			u := New(cfg, Options{})
+			u.apiURL = server.URL + "/releases"
+
+			release, err := u.getLatestRelease(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to get the latest release: %v", err)
+			}
+			if release.TagName != tt.latest {
+				t.Errorf("Expected %s as the latest release, got %s", tt.latest, release.TagName)
+			}
+
+			releases, err := u.ListReleases()
+			if err != nil {
+				t.Fatalf("Failed to list releases: %v", err)
+			}
+			var listed []string
+			for _, r := range releases {
+				listed = append(listed, r.TagName)
+			}
+			if fmt.Sprint(listed) != fmt.Sprint(tt.listed) {
+				t.Errorf("Expected %v to be listed, got %v", tt.listed, listed)
+			}
+		})
+	}
+}
+
+func TestDumpReleaseJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	body := `{"tag_name":"v1.0.0","unknown_field":{"kept":true},"assets":[{"name":"noraneko-1.0.0-windows-x86_64-portable.zip"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		ExeDir:        tmpDir,
+		WorkDir:       tmpDir,
+		HeadersForAPI: true,
+		Headers:       map[string]string{"Authorization": "Bearer ghp_secret123", "X-Api-Key": "key-secret-456"},
+	}
+	u := New(cfg, Options{})
+	u.apiURL = server.URL
+
+	var out bytes.Buffer
+	if err := u.DumpReleaseJSON(&out); err != nil {
+		t.Fatalf("DumpReleaseJSON failed: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("Expected valid JSON, got %v:\n%s", err, out.String())
+	}
+	if got["tag_name"] != "v1.0.0" || got["unknown_field"] == nil {
+		t.Errorf("Expected the response as received, got:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "\n  \"tag_name\": \"v1.0.0\"") {
+		t.Errorf("Expected indented JSON, got:\n%s", out.String())
+	}
+
+	// The echoed request carries no credentials
+	echo := u.describeRequest(u.releaseRequest)
+	if !strings.HasPrefix(echo, "GET "+server.URL+"/latest\n") {
+		t.Errorf("Expected the request line first, got:\n%s", echo)
+	}
+	if strings.Contains(echo, "secret") || !strings.Contains(echo, "Authorization: "+redacted) {
+		t.Errorf("Expected credentials to be redacted, got:\n%s", echo)
+	}
+}
+
+func TestWriteReleases(t *testing.T) {
+	// Served out of order, with a tie and a release of unknown date
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[
+			{"tag_name": "v1.9.0", "published_at": "2024-03-01T10:00:00Z"},
+			{"tag_name": "nightly-20240501", "name": "Noraneko 2.1.0a1", "prerelease": true, "published_at": "2024-05-01T02:00:00+09:00"},
+			{"tag_name": "v2.0.0", "published_at": "2024-04-15T08:30:00Z"},
+			{"tag_name": "v2.0.0-beta.1", "prerelease": true, "published_at": "2024-04-15T08:30:00Z"},
+			{"tag_name": "v1.0.0"}
+		]`)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir, MaxReleasePages: 1, Branch: "nightly"}
+	u := New(cfg, Options{})
+	u.apiURL = server.URL + "/releases"
+	releases, err := u.ListReleases()
+	if err != nil {
+		t.Fatalf("Failed to list releases: %v", err)
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"table", `TAG               VERSION  CHANNEL     PUBLISHED
+nightly-20240501  2.1.0a1  prerelease  2024-04-30
+v2.0.0-beta.1     2.0.0    prerelease  2024-04-15
+v2.0.0            2.0.0    release     2024-04-15
+v1.9.0            1.9.0    release     2024-03-01
+v1.0.0            1.0.0    release     -
+`},
+		{"csv", `tag,version,channel,published
+nightly-20240501,2.1.0a1,prerelease,2024-04-30
+v2.0.0-beta.1,2.0.0,prerelease,2024-04-15
+v2.0.0,2.0.0,release,2024-04-15
+v1.9.0,1.9.0,release,2024-03-01
+v1.0.0,1.0.0,release,
+`},
+		{"json", `[
+  {
+    "tag": "nightly-20240501",
+    "version": "2.1.0a1",
+    "channel": "prerelease",
+    "published": "2024-04-30"
+  },
+  {
+    "tag": "v2.0.0-beta.1",
+    "version": "2.0.0",
+    "channel": "prerelease",
+    "published": "2024-04-15"
+  },
+  {
+    "tag": "v2.0.0",
+    "version": "2.0.0",
+    "channel": "release",
+    "published": "2024-04-15"
+  },
+  {
+    "tag": "v1.9.0",
+    "version": "1.9.0",
+    "channel": "release",
+    "published": "2024-03-01"
+  },
+  {
+    "tag": "v1.0.0",
+    "version": "1.0.0",
+    "channel": "release",
+    "published": ""
+  }
+]
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := WriteReleases(&out, releases, tt.format); err != nil {
+				t.Fatalf("Failed to write releases: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Unexpected %s output:\n%s\nexpected:\n%s", tt.format, out.String(), tt.expected)
+			}
+		})
+	}
+
+	if err := WriteReleases(&bytes.Buffer{}, releases, "yaml"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,84 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// RunResult describes what a call to Run did
+type RunResult struct {
+	CurrentVersion  string        `json:"current_version"`
+	NewVersion      string        `json:"new_version"`
+	FreshInstall    bool          `json:"fresh_install"`
+	UpdateAvailable bool          `json:"update_available"`
+	Updated         bool          `json:"updated"`
+	Asset           *Asset        `json:"asset,omitempty"`
+	FlavorFallback  bool          `json:"flavor_fallback,omitempty"`
+	RebootRequired  bool          `json:"reboot_required"`
+	InstallerLog    string        `json:"installer_log,omitempty"`
+	Message         string        `json:"message"`
+	Error           string        `json:"error,omitempty"`
+	StartedAt       time.Time     `json:"started_at"`
+	Duration        time.Duration `json:"duration_ns"`
+	Phases          []Phase       `json:"phases"`
+
+	// Per-install results of a run of [Installs]
+	Installs []InstallResult `json:"installs,omitempty"`
+}
+
+// Phase is one timed step of a run: connect, fetch-release, download,
+// verify, extract, install, post-check or launch-check
+type Phase struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// startPhase starts timing a phase and returns the function that ends it
+func (u *Updater) startPhase(name string) func() {
+	start := clock()
+	return func() {
+		end := clock()
+		u.phases = append(u.phases, Phase{Name: name, Start: start, End: end, Duration: end.Sub(start)})
+	}
+}
+
+// phaseSummary formats phase durations as "connect=12ms, download=1.5s"
+func phaseSummary(phases []Phase) string {
+	parts := make([]string, len(phases))
+	for i, p := range phases {
+		parts[i] = fmt.Sprintf("%s=%s", p.Name, p.Duration.Round(time.Millisecond))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Print writes a human-readable summary of the result
+func (r *RunResult) Print(w io.Writer) {
+	fmt.Fprintf(w, "Result:          %s\n", r.Message)
+	for _, in := range r.Installs {
+		if in.Error != "" {
+			fmt.Fprintf(w, "  %-15s Failed: %s\n", in.Name+":", in.Error)
+		} else {
+			fmt.Fprintf(w, "  %-15s %s\n", in.Name+":", in.Result.Message)
+		}
+	}
+	if r.Asset != nil {
+		fmt.Fprintf(w, "Asset:           %s (%d bytes)\n", r.Asset.Name, r.Asset.Size)
+	}
+	if r.FlavorFallback {
+		fmt.Fprintln(w, "Flavor:          installer, the release has no portable asset")
+	}
+	if r.RebootRequired {
+		fmt.Fprintln(w, "Reboot required: yes")
+	}
+	if r.InstallerLog != "" {
+		fmt.Fprintf(w, "Installer log:   %s\n", r.InstallerLog)
+	}
+	fmt.Fprintf(w, "Duration:        %s\n", r.Duration.Round(time.Millisecond))
+	if len(r.Phases) > 0 {
+		fmt.Fprintf(w, "Phases:          %s\n", phaseSummary(r.Phases))
+	}
+}
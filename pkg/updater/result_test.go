@@ -0,0 +1,123 @@
+package updater
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunResult(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+
+	// Check-only reports the update without installing it, and prints to
+	// Output
+	var progress bytes.Buffer
+	result, err := newTestUpdater(cfg, Options{Portable: true, CheckOnly: true, Output: &progress}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !strings.Contains(progress.String(), "New version available: 1.0.0 -> 2.0.0") {
+		t.Errorf("Expected the progress in Output, got %q", progress.String())
+	}
+	if got := cfg.LogValue("LastResult"); got != "Update to 2.0.0 available" {
+		t.Errorf("Expected the check to be logged, got %q", got)
+	}
+	if result.CurrentVersion != "1.0.0" || result.NewVersion != "2.0.0" {
+		t.Errorf("Unexpected versions %s -> %s", result.CurrentVersion, result.NewVersion)
+	}
+	if !result.UpdateAvailable || result.Updated || result.Asset != nil {
+		t.Errorf("Expected an available but not installed update, got %+v", result)
+	}
+
+	// An update records the asset it installed
+	result, err = newTestUpdater(cfg, Options{Portable: true}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !result.Updated || result.FreshInstall || result.RebootRequired {
+		t.Errorf("Expected a plain update, got %+v", result)
+	}
+	if result.Asset == nil || result.Asset.Name != "noraneko-windows-x86_64-portable.zip" {
+		t.Errorf("Expected the portable zip as asset, got %+v", result.Asset)
+	}
+	if result.Asset != nil && result.Asset.Size != int64(len(archive)) {
+		t.Errorf("Expected asset size %d, got %d", len(archive), result.Asset.Size)
+	}
+	if result.Message != "Updated from 1.0.0 to 2.0.0" {
+		t.Errorf("Unexpected message '%s'", result.Message)
+	}
+	if result.StartedAt.IsZero() || result.Duration <= 0 {
+		t.Errorf("Expected timing to be recorded, got %v after %v", result.Duration, result.StartedAt)
+	}
+
+	// Once installed there is nothing to do
+	result, err = newTestUpdater(cfg, Options{Portable: true}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.CurrentVersion != "2.0.0" || result.UpdateAvailable || result.Updated {
+		t.Errorf("Expected no update, got %+v", result)
+	}
+	if result.Message != "No new version found" {
+		t.Errorf("Unexpected message '%s'", result.Message)
+	}
+
+	var out bytes.Buffer
+	result.Print(&out)
+	if !strings.Contains(out.String(), "No new version found") {
+		t.Errorf("Expected the message in the summary, got:\n%s", out.String())
+	}
+}
+
+func TestRunResultPhases(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	downloads := 0
+	server := newChecksumReleaseServer(t, archive, &downloads)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.LogPhases = true
+	result, err := newTestUpdater(cfg, Options{Portable: true}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	expected := []string{"connect", "fetch-release", "download", "verify", "extract", "install", "post-check"}
+	var names []string
+	for _, p := range result.Phases {
+		names = append(names, p.Name)
+	}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected phases %v, got %v", expected, names)
+	}
+
+	for i, p := range result.Phases {
+		if p.End.Before(p.Start) || p.Duration != p.End.Sub(p.Start) {
+			t.Errorf("Phase %s has inconsistent timing: %+v", p.Name, p)
+		}
+		if i > 0 && p.Start.Before(result.Phases[i-1].End) {
+			t.Errorf("Phase %s starts before %s ends", p.Name, result.Phases[i-1].Name)
+		}
+	}
+
+	logged := cfg.LogValue("LastPhases")
+	if !strings.HasPrefix(logged, "connect=") || !strings.Contains(logged, "post-check=") {
+		t.Errorf("Expected the phases to be logged, got '%s'", logged)
+	}
+
+	// A run that stops early only times the phases it went through
+	result, err = newTestUpdater(cfg, Options{Portable: true}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(result.Phases) != 2 || result.Phases[1].Name != "fetch-release" {
+		t.Errorf("Expected connect and fetch-release only, got %+v", result.Phases)
+	}
+}
@@ -0,0 +1,142 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// minFreeSpace is the free space the self-test expects in WorkDir: enough
+// for a downloaded release and its extracted copy
+const minFreeSpace = 1 << 30
+
+// freeSpace returns the bytes available in a directory. It is a variable
+// so tests can stub it out.
+var freeSpace = diskFree
+
+// Check is the outcome of a single self-test check
+type Check struct {
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// SelfTestResult is the checklist printed by -selftest
+type SelfTestResult struct {
+	Checks []Check `json:"checks"`
+	Passed bool    `json:"passed"`
+}
+
+// selfTestCheck is a check to run. It returns a detail for the checklist,
+// or an error if the check failed.
+type selfTestCheck struct {
+	name     string
+	critical bool
+	run      func() (string, error)
+}
+
+// runChecks runs every check, also after failures, and collects the
+// results. The result only fails if a critical check fails.
+func runChecks(checks []selfTestCheck) *SelfTestResult {
+	result := &SelfTestResult{Passed: true}
+	for _, c := range checks {
+		detail, err := c.run()
+		check := Check{Name: c.name, Passed: err == nil, Critical: c.critical, Detail: detail}
+		if err != nil {
+			check.Detail = err.Error()
+			if c.critical {
+				result.Passed = false
+			}
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	return result
+}
+
+// SelfTest checks that the environment allows updates: GitHub is
+// reachable, WorkDir and the config directory are writable and WorkDir
+// has enough free space. A missing browser or scheduled task is reported
+// but not critical, since a first install or manual runs need neither.
+func (u *Updater) SelfTest() *SelfTestResult {
+	return runChecks([]selfTestCheck{
+		{"Network access to GitHub", true, func() (string, error) {
+			if err := u.checkConnection(context.Background()); err != nil {
+				return "", err
+			}
+			return u.checkURL, nil
+		}},
+		{"Write access to work directory", true, func() (string, error) {
+			return u.cfg.WorkDir, u.prepareWorkDir()
+		}},
+		{"Write access to config directory", true, func() (string, error) {
+			dir := filepath.Dir(u.cfg.ConfigFile)
+			return dir, checkWritable(dir)
+		}},
+		{"Free disk space", true, func() (string, error) {
+			free, err := freeSpace(u.cfg.WorkDir)
+			if err != nil {
+				return "", err
+			}
+			if free < minFreeSpace {
+				return "", fmt.Errorf("%s free in %s, %s needed", formatSize(free), u.cfg.WorkDir, formatSize(minFreeSpace))
+			}
+			return fmt.Sprintf("%s free in %s", formatSize(free), u.cfg.WorkDir), nil
+		}},
+		{"Browser installed", false, func() (string, error) {
+			build, err := u.getInstalledBuild()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%s %s", u.cfg.GetBrowserPath(), build.Version), nil
+		}},
+		{"Scheduled task", false, func() (string, error) {
+			if !scheduledTaskExists() {
+				return "", fmt.Errorf("not installed")
+			}
+			return taskName(), nil
+		}},
+	})
+}
+
+// checkWritable verifies that files can be created in dir
+func checkWritable(dir string) error {
+	probe, err := os.CreateTemp(dir, ".write-probe-*")
+	if err != nil {
+		return err
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// formatSize formats a byte count in MB
+func formatSize(n uint64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+}
+
+// Print writes the checklist. Failed checks that are not critical are
+// shown as warnings.
+func (r *SelfTestResult) Print(w io.Writer) {
+	for _, c := range r.Checks {
+		mark := "PASS"
+		if !c.Passed {
+			mark = "FAIL"
+			if !c.Critical {
+				mark = "WARN"
+			}
+		}
+		line := fmt.Sprintf("[%s] %s", mark, c.Name)
+		if c.Detail != "" {
+			line += ": " + c.Detail
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	if r.Passed {
+		fmt.Fprintln(w, "Self-test passed.")
+	} else {
+		fmt.Fprintln(w, "Self-test failed.")
+	}
+}
@@ -0,0 +1,106 @@
+package updater
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestRunChecks(t *testing.T) {
+	pass := func() (string, error) { return "ok", nil }
+	fail := func() (string, error) { return "", errors.New("broken") }
+
+	tests := []struct {
+		name     string
+		checks   []selfTestCheck
+		expected bool
+	}{
+		{"all pass", []selfTestCheck{{"a", true, pass}, {"b", false, pass}}, true},
+		{"optional failure", []selfTestCheck{{"a", true, pass}, {"b", false, fail}}, true},
+		{"critical failure", []selfTestCheck{{"a", true, fail}, {"b", false, pass}}, false},
+	}
+
+	for _, tt := range tests {
+		result := runChecks(tt.checks)
+		if result.Passed != tt.expected {
+			t.Errorf("%s: expected passed=%v", tt.name, tt.expected)
+		}
+		if len(result.Checks) != len(tt.checks) {
+			t.Errorf("%s: expected every check to run, got %d", tt.name, len(result.Checks))
+		}
+	}
+
+	result := runChecks([]selfTestCheck{{"net", true, fail}, {"task", false, fail}, {"disk", true, pass}})
+	var out bytes.Buffer
+	result.Print(&out)
+	for _, want := range []string{"[FAIL] net: broken", "[WARN] task: broken", "[PASS] disk: ok", "Self-test failed."} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected %q in output %q", want, out.String())
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.WorkDir = filepath.Join(tmpDir, "work")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	origTaskExists, origFreeSpace := scheduledTaskExists, freeSpace
+	t.Cleanup(func() { scheduledTaskExists, freeSpace = origTaskExists, origFreeSpace })
+	scheduledTaskExists = func() bool { return false }
+
+	tests := []struct {
+		name     string
+		free     uint64
+		online   bool
+		expected bool
+		failed   []string
+	}{
+		{"ready", 2 << 30, true, true, []string{"Browser installed", "Scheduled task"}},
+		{"low disk space", 100 << 20, true, false, []string{"Free disk space", "Browser installed", "Scheduled task"}},
+		{"offline", 2 << 30, false, false, []string{"Network access to GitHub", "Browser installed", "Scheduled task"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			freeSpace = func(string) (uint64, error) { return tt.free, nil }
+			u := New(cfg, Options{})
+			u.checkURL = server.URL
+			if !tt.online {
+				u.checkURL = "http://127.0.0.1:0/"
+			}
+
+			result := u.SelfTest()
+			if result.Passed != tt.expected {
+				t.Errorf("Expected passed=%v, got %+v", tt.expected, result.Checks)
+			}
+			var failed []string
+			for _, c := range result.Checks {
+				if !c.Passed {
+					failed = append(failed, c.Name)
+				}
+			}
+			if strings.Join(failed, ",") != strings.Join(tt.failed, ",") {
+				t.Errorf("Expected failed checks %v, got %v", tt.failed, failed)
+			}
+		})
+	}
+
+	// The work directory is created by the check
+	if _, err := os.Stat(cfg.WorkDir); err != nil {
+		t.Errorf("Expected the work directory to exist: %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sentinelManifest picks the PostInstallSentinels from the manifest of the
+// extracted files, before they are copied to browserDir. Sentinels the
+// OverwritePolicy keeps are left out, as are those the archive lacks.
+func (u *Updater) sentinelManifest(browserDir string, source Manifest) Manifest {
+	sentinels := Manifest{}
+	for _, relPath := range u.cfg.PostInstallSentinels {
+		digest, ok := source[relPath]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Warning: sentinel %s is not in the downloaded archive\n", relPath)
+			continue
+		}
+		if u.keepExisting(filepath.FromSlash(relPath), longPath(filepath.Join(browserDir, filepath.FromSlash(relPath)))) {
+			continue
+		}
+		sentinels[relPath] = digest
+	}
+	return sentinels
+}
+
+// checkSentinels compares the sentinel files installed in browserDir with
+// the extracted ones, catching partial copies
+func (u *Updater) checkSentinels(browserDir string, sentinels Manifest) error {
+	if len(sentinels) == 0 {
+		return nil
+	}
+	mismatches, err := verifyManifest(longPath(browserDir), sentinels, u.cfg.VerifyConcurrency, nil)
+	if err != nil {
+		return err
+	}
+	if len(mismatches) == 0 {
+		fmt.Fprintln(u.out, "Post-install check passed.")
+		return nil
+	}
+
+	problems := make([]string, len(mismatches))
+	for i, m := range mismatches {
+		if m.Actual == "" {
+			problems[i] = m.Path + " is missing"
+		} else {
+			problems[i] = m.Path + " differs from the downloaded archive"
+		}
+	}
+	return errors.New(strings.Join(problems, ", "))
+}
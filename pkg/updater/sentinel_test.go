@@ -0,0 +1,75 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPostInstallSentinels(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+		"noraneko/omni.ja":         "omni 2.0.0",
+		"noraneko/zz.txt":          "copied last",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+
+	// Matching files pass the check
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.PostInstallSentinels = []string{"omni.ja", "noraneko.exe", "missing.dll"}
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Expected the update to pass the post-install check: %v", err)
+	}
+	if _, err := os.Stat(u.journalPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the install journal to be removed, got %v", err)
+	}
+
+	// omni.ja is cut short after it was copied
+	cfg = newPortableInstall(t, "1.0.0")
+	cfg.PostInstallSentinels = []string{"omni.ja"}
+	browserDir := filepath.Dir(cfg.Path)
+	truncate := func(done, total int64) {
+		if done == total {
+			os.WriteFile(filepath.Join(browserDir, "omni.ja"), []byte("omni"), 0644)
+		}
+	}
+	u = newTestUpdater(cfg, Options{Portable: true, InstallProgress: truncate}, server)
+	_, err := u.Run()
+	if err == nil || !strings.Contains(err.Error(), "omni.ja differs from the downloaded archive") {
+		t.Fatalf("Expected the post-install check to fail, got %v", err)
+	}
+	if _, err := os.Stat(u.journalPath()); err != nil {
+		t.Fatalf("Expected the install journal to be kept: %v", err)
+	}
+
+	// The next run copies the file again
+	u = newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Expected the retry to repair the install: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(browserDir, "omni.ja")); string(got) != "omni 2.0.0" {
+		t.Errorf("Expected omni.ja to be copied again, got %q", got)
+	}
+}
+
+func TestCheckSentinelsMissing(t *testing.T) {
+	dir := t.TempDir()
+	writeInstallFiles(t, dir, map[string]string{"omni.ja": "omni"})
+	u := New(newPortableInstall(t, "1.0.0"), Options{})
+
+	source, err := hashTree(dir, 1)
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	source["browser/omni.ja"] = source["omni.ja"]
+	if err := u.checkSentinels(dir, source); err == nil || err.Error() != "browser/omni.ja is missing" {
+		t.Errorf("Expected browser/omni.ja to be reported missing, got %v", err)
+	}
+	delete(source, "browser/omni.ja")
+	if err := u.checkSentinels(dir, source); err != nil {
+		t.Errorf("Expected the check to pass, got %v", err)
+	}
+}
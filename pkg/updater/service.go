@@ -0,0 +1,115 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// serviceRequest is a control request from the service manager
+type serviceRequest int
+
+const (
+	serviceInterrogate serviceRequest = iota
+	serviceStop
+	serviceShutdown
+)
+
+// serviceState is a state reported to the service manager
+type serviceState int
+
+const (
+	serviceStartPending serviceState = iota
+	serviceRunning
+	serviceStopPending
+)
+
+// String returns the name of the state
+func (s serviceState) String() string {
+	switch s {
+	case serviceStartPending:
+		return "start pending"
+	case serviceRunning:
+		return "running"
+	case serviceStopPending:
+		return "stop pending"
+	default:
+		return fmt.Sprintf("serviceState(%d)", int(s))
+	}
+}
+
+// serviceLoop runs check once at startup and then every interval until a
+// stop or shutdown request arrives, reporting each state change. Checks
+// never overlap: a check still running when the interval ends delays the
+// next one. On stop the running check's context is cancelled and the loop
+// returns once the check has finished.
+func serviceLoop(requests <-chan serviceRequest, report func(serviceState), interval time.Duration, check func(context.Context)) {
+	report(serviceStartPending)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	running := false
+	start := func() {
+		running = true
+		go func() {
+			check(ctx)
+			done <- struct{}{}
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	report(serviceRunning)
+	start()
+	for {
+		select {
+		case req := <-requests:
+			switch req {
+			case serviceInterrogate:
+				report(serviceRunning)
+			case serviceStop, serviceShutdown:
+				report(serviceStopPending)
+				cancel()
+				if running {
+					<-done
+				}
+				return
+			}
+		case <-ticker.C:
+			if !running {
+				start()
+			}
+		case <-done:
+			running = false
+		}
+	}
+}
+
+// serviceInterval returns the time between update checks of the service
+func (u *Updater) serviceInterval() time.Duration {
+	return time.Duration(u.cfg.CheckInterval) * time.Minute
+}
+
+// serviceCheck runs one silent update check for the service. The
+// configuration is read again first, so changes take effect without
+// restarting the service. Failures are logged as the last result, since
+// the service has no console.
+func (u *Updater) serviceCheck(ctx context.Context) {
+	cfg, err := config.Load(u.cfg.ExeDir)
+	if err != nil {
+		u.logResult(fmt.Sprintf("Failed: %v", err))
+		return
+	}
+
+	opts := u.opts
+	opts.Scheduled = true
+	run := New(cfg, opts)
+	if _, err := run.runWithin(ctx); err != nil {
+		run.logResult(fmt.Sprintf("Failed: %v", err))
+	}
+}
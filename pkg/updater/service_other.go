@@ -0,0 +1,23 @@
+//go:build !windows
+
+package updater
+
+import "errors"
+
+// errServiceUnsupported is returned by the service commands outside Windows
+var errServiceUnsupported = errors.New("Windows services are only supported on Windows")
+
+// RunService is not supported outside Windows
+func (u *Updater) RunService() error {
+	return errServiceUnsupported
+}
+
+// InstallService is not supported outside Windows
+func (u *Updater) InstallService() error {
+	return errServiceUnsupported
+}
+
+// RemoveService is not supported outside Windows
+func (u *Updater) RemoveService() error {
+	return errServiceUnsupported
+}
@@ -0,0 +1,122 @@
+package updater
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stateRecorder collects the states reported by serviceLoop
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []serviceState
+}
+
+func (r *stateRecorder) report(s serviceState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.states = append(r.states, s)
+}
+
+func (r *stateRecorder) get() []serviceState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]serviceState(nil), r.states...)
+}
+
+func TestServiceLoopStop(t *testing.T) {
+	for _, req := range []serviceRequest{serviceStop, serviceShutdown} {
+		requests := make(chan serviceRequest)
+		var rec stateRecorder
+
+		// The first check blocks until the service stops
+		started := make(chan struct{})
+		var cancelled atomic.Bool
+		check := func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			cancelled.Store(true)
+		}
+
+		finished := make(chan struct{})
+		go func() {
+			serviceLoop(requests, rec.report, time.Hour, check)
+			close(finished)
+		}()
+
+		<-started
+		requests <- serviceInterrogate
+		requests <- req
+
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected request %d to stop the service", req)
+		}
+		if !cancelled.Load() {
+			t.Error("Expected the loop to wait for the cancelled check")
+		}
+		want := []serviceState{serviceStartPending, serviceRunning, serviceRunning, serviceStopPending}
+		if got := rec.get(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected states %v, got %v", want, got)
+		}
+	}
+}
+
+func TestServiceLoopInterval(t *testing.T) {
+	requests := make(chan serviceRequest)
+	var rec stateRecorder
+
+	// Checks take longer than the interval but must never overlap
+	var checks, active, overlaps int32
+	check := func(ctx context.Context) {
+		atomic.AddInt32(&checks, 1)
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(15 * time.Millisecond)
+		atomic.AddInt32(&active, -1)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		serviceLoop(requests, rec.report, 5*time.Millisecond, check)
+		close(finished)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&checks) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	requests <- serviceStop
+	<-finished
+
+	if got := atomic.LoadInt32(&checks); got < 3 {
+		t.Errorf("Expected repeated checks, got %d", got)
+	}
+	if got := atomic.LoadInt32(&overlaps); got != 0 {
+		t.Errorf("Expected no overlapping checks, got %d", got)
+	}
+	if got := atomic.LoadInt32(&active); got != 0 {
+		t.Error("Expected the last check to finish before the loop returned")
+	}
+}
+
+func TestServiceCheckLogsFailure(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	u := New(cfg, Options{})
+
+	// A stopped service cancels the check before it connects
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	u.serviceCheck(ctx)
+
+	if got := cfg.LogValue("LastResult"); !strings.HasPrefix(got, "Failed: ") {
+		t.Errorf("Expected the failed check to be logged, got '%s'", got)
+	}
+}
@@ -0,0 +1,156 @@
+//go:build windows
+
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// serviceStopTimeout is how long RemoveService waits for the service to
+// stop, and the wait hint given to the service manager while stopping
+const serviceStopTimeout = 30 * time.Second
+
+// serviceRequests maps service manager commands to control requests
+var serviceRequests = map[svc.Cmd]serviceRequest{
+	svc.Interrogate: serviceInterrogate,
+	svc.Stop:        serviceStop,
+	svc.Shutdown:    serviceShutdown,
+}
+
+// serviceStatus returns the status reported to the service manager for a
+// state
+func serviceStatus(state serviceState) svc.Status {
+	switch state {
+	case serviceRunning:
+		return svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	case serviceStopPending:
+		return svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout / time.Millisecond)}
+	default:
+		return svc.Status{State: svc.StartPending}
+	}
+}
+
+// serviceHandler runs the service loop for the service manager
+type serviceHandler struct {
+	u *Updater
+}
+
+// Execute implements svc.Handler
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	requests := make(chan serviceRequest)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case c := <-r:
+				req, ok := serviceRequests[c.Cmd]
+				if !ok {
+					continue
+				}
+				select {
+				case requests <- req:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	report := func(state serviceState) { changes <- serviceStatus(state) }
+	serviceLoop(requests, report, h.u.serviceInterval(), h.u.serviceCheck)
+	return false, 0
+}
+
+// RunService runs the updater as a Windows service, checking for updates
+// every CheckInterval minutes until the service is stopped. It must be
+// started by the service manager.
+func (u *Updater) RunService() error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return errors.New("-run-service must be started by the service manager, use -install-service to register it")
+	}
+	return svc.Run(config.ServiceName, &serviceHandler{u: u})
+}
+
+// InstallService registers this executable as an automatically started
+// Windows service running -run-service, and starts it
+func (u *Updater) InstallService() error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(config.ServiceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists, use -remove-service first", config.ServiceName)
+	}
+
+	s, err := m.CreateService(config.ServiceName, exePath, mgr.Config{
+		DisplayName: config.TaskTitle,
+		Description: fmt.Sprintf("Checks for %s updates every %d minutes", config.BrowserName, u.cfg.CheckInterval),
+		StartType:   mgr.StartAutomatic,
+	}, "-run-service")
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("service created but failed to start: %w", err)
+	}
+	return nil
+}
+
+// RemoveService stops the Windows service if it is running and removes it
+func (u *Updater) RemoveService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager (run as administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(config.ServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", config.ServiceName)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err != nil && !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return fmt.Errorf("failed to stop service: %w", err)
+	}
+	for deadline := time.Now().Add(serviceStopTimeout); err == nil && status.State != svc.Stopped; {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the service to stop")
+		}
+		time.Sleep(500 * time.Millisecond)
+		status, err = s.Query()
+	}
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to remove service: %w", err)
+	}
+	return nil
+}
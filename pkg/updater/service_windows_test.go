@@ -0,0 +1,31 @@
+//go:build windows
+
+package updater
+
+import (
+	"testing"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+func TestServiceStatus(t *testing.T) {
+	tests := []struct {
+		state   serviceState
+		want    svc.State
+		accepts svc.Accepted
+	}{
+		{serviceStartPending, svc.StartPending, 0},
+		{serviceRunning, svc.Running, svc.AcceptStop | svc.AcceptShutdown},
+		{serviceStopPending, svc.StopPending, 0},
+	}
+
+	for _, tt := range tests {
+		status := serviceStatus(tt.state)
+		if status.State != tt.want || status.Accepts != tt.accepts {
+			t.Errorf("Expected %v to report state %d accepting %d, got %+v", tt.state, tt.want, tt.accepts, status)
+		}
+	}
+	if serviceStatus(serviceStopPending).WaitHint == 0 {
+		t.Error("Expected a wait hint while stopping")
+	}
+}
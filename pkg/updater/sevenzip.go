@@ -0,0 +1,1014 @@
+package updater
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"unicode/utf16"
+
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// sevenZipSignature starts every 7z archive
+var sevenZipSignature = []byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C}
+
+// sevenZipMaxHeaderSize limits the size of the, possibly compressed,
+// archive header that is read into memory
+const sevenZipMaxHeaderSize = 64 << 20
+
+// sevenZipMaxDictSize limits the LZMA dictionary an archive may ask for.
+// 7-Zip's ultra preset uses 64 MB.
+const sevenZipMaxDictSize = 256 << 20
+
+// Property IDs of the 7z header
+const (
+	szEnd                   = 0x00
+	szHeader                = 0x01
+	szArchiveProperties     = 0x02
+	szAdditionalStreamsInfo = 0x03
+	szMainStreamsInfo       = 0x04
+	szFilesInfo             = 0x05
+	szPackInfo              = 0x06
+	szUnpackInfo            = 0x07
+	szSubStreamsInfo        = 0x08
+	szSize                  = 0x09
+	szCRC                   = 0x0A
+	szFolderInfo            = 0x0B
+	szCodersUnpackSize      = 0x0C
+	szNumUnpackStream       = 0x0D
+	szEmptyStream           = 0x0E
+	szEmptyFile             = 0x0F
+	szName                  = 0x11
+	szWinAttributes         = 0x15
+	szEncodedHeader         = 0x17
+)
+
+// IDs of the 7z coders that can be decoded
+const (
+	szCopy    = "\x00"
+	szLZMA2   = "\x21"
+	szLZMA    = "\x03\x01\x01"
+	szBCJ     = "\x03\x03\x01\x03"
+	szDeflate = "\x04\x01\x08"
+	szBZip2   = "\x04\x02\x02"
+	szAES     = "\x06\xf1\x07\x01"
+)
+
+// Windows file attributes stored in 7z archives. Archives made on Unix
+// keep the file mode in the upper 16 bits.
+const (
+	szAttributeReparsePoint = 0x400
+	szAttributeUnixMode     = 0x8000
+)
+
+// szCoder is a decompression or filter step of a folder
+type szCoder struct {
+	id            string
+	props         []byte
+	numIn, numOut int
+}
+
+// szBindPair connects the output stream out of one coder to the input
+// stream in of another
+type szBindPair struct {
+	in, out int
+}
+
+// szFolder is a group of coders that decode packed streams into one
+// output stream, which holds the content of one or more files
+type szFolder struct {
+	coders    []szCoder
+	bindPairs []szBindPair
+	// packed lists the coder input streams that read packed streams
+	packed []int
+	// firstPack is the index of the folder's first packed stream
+	firstPack int
+	// unpackSizes holds the size of every coder output stream
+	unpackSizes   []int64
+	crc           uint32
+	crcDefined    bool
+	numSubstreams int
+}
+
+// unpackSize returns the size of the folder's output
+func (f *szFolder) unpackSize() int64 {
+	if out := f.mainOut(); out >= 0 {
+		return f.unpackSizes[out]
+	}
+	return 0
+}
+
+// mainOut returns the coder output stream that is not bound to another
+// coder, the output of the folder
+func (f *szFolder) mainOut() int {
+outs:
+	for i := len(f.unpackSizes) - 1; i >= 0; i-- {
+		for _, bp := range f.bindPairs {
+			if bp.out == i {
+				continue outs
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// szStreams describes the packed streams of an archive, the folders that
+// decode them and the files, or substreams, in each folder's output
+type szStreams struct {
+	packPos   int64
+	packSizes []int64
+	folders   []*szFolder
+
+	sizes      []int64
+	crcs       []uint32
+	crcDefined []bool
+}
+
+// sevenZipFile is an entry of a 7z archive
+type sevenZipFile struct {
+	Name string
+	Dir  bool
+	Size int64
+
+	hasStream     bool
+	attrib        uint32
+	attribDefined bool
+	crc           uint32
+	crcDefined    bool
+}
+
+// Mode returns the file mode of the entry. Symbolic links are reported
+// as such, so they can be rejected.
+func (f *sevenZipFile) Mode() os.FileMode {
+	mode := os.FileMode(0644)
+	if !f.attribDefined {
+		return mode
+	}
+	if f.attrib&szAttributeUnixMode != 0 {
+		unix := f.attrib >> 16
+		mode = os.FileMode(unix & 0777)
+		if unix&0xF000 == 0xA000 {
+			mode |= os.ModeSymlink
+		}
+	}
+	if f.attrib&szAttributeReparsePoint != 0 {
+		mode |= os.ModeSymlink
+	}
+	return mode
+}
+
+// sevenZipReader reads a 7z archive. Folders of simple coder chains using
+// LZMA, LZMA2, Deflate, BZip2 and the x86 branch filter are supported;
+// encrypted archives and BCJ2 are not.
+type sevenZipReader struct {
+	r       io.ReaderAt
+	size    int64
+	streams *szStreams
+	files   []sevenZipFile
+}
+
+// openSevenZip reads the header of the 7z archive of the given size in r
+func openSevenZip(r io.ReaderAt, size int64) (*sevenZipReader, error) {
+	z := &sevenZipReader{r: r, size: size, streams: &szStreams{}}
+
+	start := make([]byte, 32)
+	if _, err := r.ReadAt(start, 0); err != nil {
+		return nil, fmt.Errorf("failed to read 7z signature header: %w", err)
+	}
+	if !bytes.HasPrefix(start, sevenZipSignature) {
+		return nil, errors.New("not a 7z archive")
+	}
+	if crc32.ChecksumIEEE(start[12:]) != binary.LittleEndian.Uint32(start[8:]) {
+		return nil, errors.New("7z signature header is damaged")
+	}
+
+	offset := binary.LittleEndian.Uint64(start[12:])
+	length := binary.LittleEndian.Uint64(start[20:])
+	if length == 0 {
+		return z, nil
+	}
+	if length > sevenZipMaxHeaderSize || offset > uint64(size) || 32+offset+length > uint64(size) {
+		return nil, errors.New("7z header is out of bounds")
+	}
+	header := make([]byte, length)
+	if _, err := r.ReadAt(header, int64(32+offset)); err != nil {
+		return nil, fmt.Errorf("failed to read 7z header: %w", err)
+	}
+	if crc32.ChecksumIEEE(header) != binary.LittleEndian.Uint32(start[28:]) {
+		return nil, errors.New("7z header is damaged")
+	}
+
+	// The header may itself be packed, possibly more than once
+	for i := 0; i < 4; i++ {
+		b := &szBuf{data: header}
+		switch b.byte() {
+		case szHeader:
+			if err := z.readHeader(b); err != nil {
+				return nil, err
+			}
+			return z, nil
+		case szEncodedHeader:
+			streams, err := readStreamsInfo(b)
+			if err != nil {
+				return nil, err
+			}
+			if header, err = z.unpackHeader(streams); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("invalid 7z header")
+		}
+	}
+	return nil, errors.New("7z header is packed too many times")
+}
+
+// unpackHeader decodes a packed header, the first folder of streams
+func (z *sevenZipReader) unpackHeader(streams *szStreams) ([]byte, error) {
+	if len(streams.folders) == 0 {
+		return nil, errors.New("packed 7z header has no data")
+	}
+	folder := streams.folders[0]
+	if folder.unpackSize() > sevenZipMaxHeaderSize {
+		return nil, errors.New("7z header is too large")
+	}
+
+	r, err := z.folderReader(streams, 0)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, folder.unpackSize())
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to unpack 7z header: %w", err)
+	}
+	if folder.crcDefined && crc32.ChecksumIEEE(header) != folder.crc {
+		return nil, errors.New("7z header is damaged")
+	}
+	return header, nil
+}
+
+// readHeader reads the properties following the header ID
+func (z *sevenZipReader) readHeader(b *szBuf) error {
+	id := b.byte()
+	if id == szArchiveProperties {
+		for b.byte() != szEnd && b.err == nil {
+			b.bytes(b.count())
+		}
+		id = b.byte()
+	}
+	if id == szAdditionalStreamsInfo {
+		return errors.New("7z archives with additional streams are not supported")
+	}
+	if id == szMainStreamsInfo {
+		streams, err := readStreamsInfo(b)
+		if err != nil {
+			return err
+		}
+		z.streams = streams
+		id = b.byte()
+	}
+	if id == szFilesInfo {
+		files, err := readFilesInfo(b)
+		if err != nil {
+			return err
+		}
+		z.files = files
+		id = b.byte()
+	}
+	if b.err != nil {
+		return b.err
+	}
+	if id != szEnd {
+		return fmt.Errorf("unexpected property %#x in 7z header", id)
+	}
+
+	// Files with content take the substreams in order
+	next := 0
+	for i := range z.files {
+		f := &z.files[i]
+		if !f.hasStream {
+			continue
+		}
+		if next >= len(z.streams.sizes) {
+			return errors.New("7z archive lists more files than streams")
+		}
+		f.Size = z.streams.sizes[next]
+		f.crc, f.crcDefined = z.streams.crcs[next], z.streams.crcDefined[next]
+		next++
+	}
+	return nil
+}
+
+// readStreamsInfo reads the pack, folder and substream information of a
+// header or packed header
+func readStreamsInfo(b *szBuf) (*szStreams, error) {
+	s := &szStreams{}
+	substreams := false
+	for {
+		switch id := b.byte(); id {
+		case szEnd:
+			if b.err != nil {
+				return nil, b.err
+			}
+			if !substreams {
+				s.readSubStreamsInfo(&szBuf{data: []byte{szEnd}})
+			}
+			return s, nil
+		case szPackInfo:
+			s.readPackInfo(b)
+		case szUnpackInfo:
+			if err := s.readUnpackInfo(b); err != nil {
+				return nil, err
+			}
+		case szSubStreamsInfo:
+			if err := s.readSubStreamsInfo(b); err != nil {
+				return nil, err
+			}
+			substreams = true
+		default:
+			if b.err != nil {
+				return nil, b.err
+			}
+			return nil, fmt.Errorf("unexpected property %#x in 7z streams info", id)
+		}
+	}
+}
+
+// readPackInfo reads the position and sizes of the packed streams
+func (s *szStreams) readPackInfo(b *szBuf) {
+	s.packPos = int64(b.number())
+	n := b.count()
+	for {
+		switch b.byte() {
+		case szSize:
+			s.packSizes = make([]int64, n)
+			for i := range s.packSizes {
+				s.packSizes[i] = int64(b.number())
+			}
+		case szCRC:
+			b.digests(n)
+		default:
+			return
+		}
+	}
+}
+
+// readUnpackInfo reads the folders and the sizes of their coder outputs
+func (s *szStreams) readUnpackInfo(b *szBuf) error {
+	if b.byte() != szFolderInfo {
+		return errors.New("invalid 7z folder info")
+	}
+	n := b.count()
+	if b.byte() != 0 {
+		return errors.New("7z archives with external folder info are not supported")
+	}
+
+	packs := 0
+	s.folders = make([]*szFolder, n)
+	for i := range s.folders {
+		f, err := readFolder(b)
+		if err != nil {
+			return err
+		}
+		f.firstPack = packs
+		packs += len(f.packed)
+		s.folders[i] = f
+	}
+	if packs > len(s.packSizes) {
+		return errors.New("7z folders use more packed streams than the archive has")
+	}
+
+	if b.byte() != szCodersUnpackSize {
+		return errors.New("invalid 7z folder info")
+	}
+	for _, f := range s.folders {
+		for i := range f.unpackSizes {
+			f.unpackSizes[i] = int64(b.number())
+		}
+	}
+
+	for {
+		switch b.byte() {
+		case szCRC:
+			defined, crcs := b.digests(n)
+			for i, f := range s.folders {
+				f.crc, f.crcDefined = crcs[i], defined[i]
+			}
+		case szEnd:
+			return b.err
+		default:
+			if b.err != nil {
+				return b.err
+			}
+			return errors.New("invalid 7z folder info")
+		}
+	}
+}
+
+// readFolder reads the coders of a folder and how they are connected
+func readFolder(b *szBuf) (*szFolder, error) {
+	f := &szFolder{}
+	numCoders := b.count()
+	if numCoders == 0 || numCoders > 64 {
+		return nil, errors.New("invalid 7z coder count")
+	}
+
+	var numIn, numOut int
+	for i := 0; i < numCoders; i++ {
+		flags := b.byte()
+		if flags&0x80 != 0 {
+			return nil, errors.New("7z alternative coders are not supported")
+		}
+		c := szCoder{id: string(b.bytes(int(flags & 0x0F))), numIn: 1, numOut: 1}
+		if flags&0x10 != 0 {
+			c.numIn, c.numOut = b.count(), b.count()
+		}
+		if flags&0x20 != 0 {
+			c.props = b.bytes(b.count())
+		}
+		numIn += c.numIn
+		numOut += c.numOut
+		f.coders = append(f.coders, c)
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if numOut == 0 || numIn < numOut-1 || numIn > 64 || numOut > 64 {
+		return nil, errors.New("invalid 7z coder streams")
+	}
+
+	for i := 0; i < numOut-1; i++ {
+		bp := szBindPair{in: b.count(), out: b.count()}
+		if bp.in >= numIn || bp.out >= numOut {
+			return nil, errors.New("invalid 7z coder binding")
+		}
+		f.bindPairs = append(f.bindPairs, bp)
+	}
+
+	numPacked := numIn - len(f.bindPairs)
+	if numPacked == 1 {
+	ins:
+		for i := 0; i < numIn; i++ {
+			for _, bp := range f.bindPairs {
+				if bp.in == i {
+					continue ins
+				}
+			}
+			f.packed = append(f.packed, i)
+			break
+		}
+	} else {
+		for i := 0; i < numPacked; i++ {
+			f.packed = append(f.packed, b.count())
+		}
+	}
+	f.unpackSizes = make([]int64, numOut)
+	return f, b.err
+}
+
+// readSubStreamsInfo reads the sizes and checksums of the files in the
+// folders. Without the information each folder holds one file.
+func (s *szStreams) readSubStreamsInfo(b *szBuf) error {
+	for _, f := range s.folders {
+		f.numSubstreams = 1
+	}
+
+	id := b.byte()
+	if id == szNumUnpackStream {
+		for _, f := range s.folders {
+			f.numSubstreams = b.count()
+		}
+		id = b.byte()
+	}
+
+	for _, f := range s.folders {
+		if f.numSubstreams == 0 {
+			continue
+		}
+		var sum int64
+		if id == szSize {
+			for i := 1; i < f.numSubstreams; i++ {
+				size := int64(b.number())
+				s.sizes = append(s.sizes, size)
+				sum += size
+			}
+		} else if f.numSubstreams > 1 {
+			return errors.New("7z substream sizes are missing")
+		}
+		if sum < 0 || sum > f.unpackSize() {
+			return errors.New("invalid 7z substream sizes")
+		}
+		s.sizes = append(s.sizes, f.unpackSize()-sum)
+	}
+	if id == szSize {
+		id = b.byte()
+	}
+
+	// Files alone in a folder with a checksum share it
+	var unknown int
+	for _, f := range s.folders {
+		known := f.numSubstreams == 1 && f.crcDefined
+		for i := 0; i < f.numSubstreams; i++ {
+			s.crcs = append(s.crcs, f.crc)
+			s.crcDefined = append(s.crcDefined, known)
+		}
+		if !known {
+			unknown += f.numSubstreams
+		}
+	}
+
+	for {
+		switch id {
+		case szCRC:
+			defined, crcs := b.digests(unknown)
+			next := 0
+			for i := range s.crcs {
+				if s.crcDefined[i] || next >= len(crcs) {
+					continue
+				}
+				s.crcs[i], s.crcDefined[i] = crcs[next], defined[next]
+				next++
+			}
+		case szEnd:
+			return b.err
+		default:
+			if b.err != nil {
+				return b.err
+			}
+			return errors.New("invalid 7z substream info")
+		}
+		id = b.byte()
+	}
+}
+
+// readFilesInfo reads the names and kinds of the archive's entries
+func readFilesInfo(b *szBuf) ([]sevenZipFile, error) {
+	files := make([]sevenZipFile, b.count())
+	var emptyStream, emptyFile []bool
+	numEmpty := 0
+
+	for {
+		prop := b.byte()
+		if prop == szEnd || b.err != nil {
+			break
+		}
+		p := &szBuf{data: b.bytes(b.count())}
+		switch prop {
+		case szEmptyStream:
+			emptyStream = p.bits(len(files))
+			numEmpty = 0
+			for _, empty := range emptyStream {
+				if empty {
+					numEmpty++
+				}
+			}
+		case szEmptyFile:
+			emptyFile = p.bits(numEmpty)
+		case szName:
+			if p.byte() != 0 {
+				return nil, errors.New("7z archives with external names are not supported")
+			}
+			names := p.data[p.pos:]
+			for i := range files {
+				var name []uint16
+				for {
+					if len(names) < 2 {
+						return nil, errors.New("7z file names are truncated")
+					}
+					c := binary.LittleEndian.Uint16(names)
+					names = names[2:]
+					if c == 0 {
+						break
+					}
+					name = append(name, c)
+				}
+				files[i].Name = string(utf16.Decode(name))
+			}
+		case szWinAttributes:
+			defined := p.definedBits(len(files))
+			if p.byte() != 0 {
+				return nil, errors.New("7z archives with external attributes are not supported")
+			}
+			for i := range files {
+				if defined[i] {
+					files[i].attrib, files[i].attribDefined = p.uint32(), true
+				}
+			}
+		}
+		if p.err != nil {
+			return nil, fmt.Errorf("invalid 7z file property %#x: %w", prop, p.err)
+		}
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	empty := 0
+	for i := range files {
+		files[i].hasStream = emptyStream == nil || !emptyStream[i]
+		if !files[i].hasStream {
+			files[i].Dir = empty >= len(emptyFile) || !emptyFile[empty]
+			empty++
+		}
+	}
+	return files, nil
+}
+
+// folderReader returns the decoded output of a folder. Only folders whose
+// coders form a chain with one packed stream are supported.
+func (z *sevenZipReader) folderReader(s *szStreams, index int) (io.Reader, error) {
+	f := s.folders[index]
+	for _, c := range f.coders {
+		if c.numIn != 1 || c.numOut != 1 {
+			return nil, fmt.Errorf("unsupported 7z coder %x", c.id)
+		}
+	}
+	if len(f.packed) != 1 {
+		return nil, errors.New("7z folders with several packed streams are not supported")
+	}
+
+	offset := 32 + s.packPos
+	for _, size := range s.packSizes[:f.firstPack] {
+		offset += size
+	}
+	packSize := s.packSizes[f.firstPack]
+	if offset < 32 || packSize < 0 || offset+packSize > z.size {
+		return nil, errors.New("7z packed stream is out of bounds")
+	}
+
+	// With one stream per coder, coder i reads input i and writes output i
+	var decode func(coder, depth int) (io.Reader, error)
+	decode = func(coder, depth int) (io.Reader, error) {
+		if depth > len(f.coders) {
+			return nil, errors.New("7z coders form a loop")
+		}
+		var in io.Reader = io.NewSectionReader(z.r, offset, packSize)
+		for _, bp := range f.bindPairs {
+			if bp.in == coder {
+				var err error
+				if in, err = decode(bp.out, depth+1); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return newCoderReader(f.coders[coder], in, f.unpackSizes[coder])
+	}
+	return decode(f.mainOut(), 0)
+}
+
+// newCoderReader returns a reader decoding in with a coder whose output
+// has the given size
+// sevenZipDictCap returns the dictionary to allocate for an LZMA or LZMA2
+// coder. A dictionary larger than the unpacked data is never used, so it is
+// shrunk to that size, and what remains is limited to sevenZipMaxDictSize.
+func sevenZipDictCap(dictSize, size int64) (int, error) {
+	dictSize = max(min(dictSize, size), lzma.MinDictCap)
+	if dictSize > sevenZipMaxDictSize {
+		return 0, fmt.Errorf("7z dictionary of %d bytes exceeds the limit of %d", dictSize, sevenZipMaxDictSize)
+	}
+	return int(dictSize), nil
+}
+
+func newCoderReader(c szCoder, in io.Reader, size int64) (io.Reader, error) {
+	var (
+		r       io.Reader
+		dictCap int
+		err     error
+	)
+	switch c.id {
+	case szCopy:
+		r = in
+	case szLZMA:
+		// The reader expects the header of .lzma files: the properties
+		// followed by the size
+		if len(c.props) != 5 {
+			return nil, errors.New("invalid 7z LZMA properties")
+		}
+		dictCap, err = sevenZipDictCap(int64(binary.LittleEndian.Uint32(c.props[1:])), size)
+		if err != nil {
+			return nil, err
+		}
+		header := append([]byte{c.props[0]}, binary.LittleEndian.AppendUint32(nil, uint32(dictCap))...)
+		header = binary.LittleEndian.AppendUint64(header, uint64(size))
+		r, err = lzma.NewReader(io.MultiReader(bytes.NewReader(header), in))
+	case szLZMA2:
+		if len(c.props) != 1 || c.props[0] > 40 {
+			return nil, errors.New("invalid 7z LZMA2 properties")
+		}
+		dictSize := int64(0xFFFFFFFF)
+		if c.props[0] < 40 {
+			dictSize = int64(2|c.props[0]&1) << (c.props[0]/2 + 11)
+		}
+		dictCap, err = sevenZipDictCap(dictSize, size)
+		if err != nil {
+			return nil, err
+		}
+		r, err = lzma.Reader2Config{DictCap: dictCap}.NewReader2(in)
+	case szDeflate:
+		r = flate.NewReader(in)
+	case szBZip2:
+		r = bzip2.NewReader(in)
+	case szBCJ:
+		r = newBCJReader(in)
+	case szAES:
+		return nil, errors.New("encrypted 7z archives are not supported")
+	default:
+		return nil, fmt.Errorf("unsupported 7z compression method %x", c.id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.LimitReader(r, size), nil
+}
+
+// extract calls fn with every entry of the archive, in order, and a reader
+// of its content. The content of files is checked against the archive's
+// checksums after fn returns.
+func (z *sevenZipReader) extract(fn func(f *sevenZipFile, r io.Reader) error) error {
+	folder, left := -1, 0
+	var folderOut io.Reader
+	for i := range z.files {
+		f := &z.files[i]
+		if !f.hasStream {
+			if err := fn(f, bytes.NewReader(nil)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for left == 0 {
+			if folder++; folder >= len(z.streams.folders) {
+				return errors.New("7z archive lists more files than streams")
+			}
+			left = z.streams.folders[folder].numSubstreams
+			if left > 0 {
+				var err error
+				if folderOut, err = z.folderReader(z.streams, folder); err != nil {
+					return err
+				}
+			}
+		}
+		left--
+
+		digest := crc32.NewIEEE()
+		content := io.TeeReader(io.LimitReader(folderOut, f.Size), digest)
+		if err := fn(f, content); err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, content); err != nil {
+			return err
+		}
+		if f.crcDefined && digest.Sum32() != f.crc {
+			return fmt.Errorf("checksum mismatch for %s in 7z archive", f.Name)
+		}
+	}
+	return nil
+}
+
+// un7z extracts a 7z archive
+func un7z(src, dest string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	z, err := openSevenZip(file, info.Size())
+	if err != nil {
+		return err
+	}
+
+	w := newArchiveWriter(dest)
+	return z.extract(func(f *sevenZipFile, r io.Reader) error {
+		if f.Dir {
+			return w.dir(f.Name)
+		}
+		return w.file(f.Name, f.Mode(), f.Size, r)
+	})
+}
+
+// szBuf reads the values of a 7z header. The first error is kept and
+// makes later reads return zero values.
+type szBuf struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// fail records err unless an error was already recorded
+func (b *szBuf) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func (b *szBuf) byte() byte {
+	if b.err != nil || b.pos >= len(b.data) {
+		b.fail(io.ErrUnexpectedEOF)
+		return 0
+	}
+	b.pos++
+	return b.data[b.pos-1]
+}
+
+func (b *szBuf) bytes(n int) []byte {
+	if b.err != nil || n < 0 || n > len(b.data)-b.pos {
+		b.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b.pos += n
+	return b.data[b.pos-n : b.pos]
+}
+
+func (b *szBuf) uint32() uint32 {
+	if data := b.bytes(4); data != nil {
+		return binary.LittleEndian.Uint32(data)
+	}
+	return 0
+}
+
+// number reads a 7z variable length number: the leading one bits of the
+// first byte count the bytes that follow
+func (b *szBuf) number() uint64 {
+	first := b.byte()
+	var value uint64
+	mask := byte(0x80)
+	for i := 0; i < 8; i++ {
+		if first&mask == 0 {
+			return value | uint64(first&(mask-1))<<(8*i)
+		}
+		value |= uint64(b.byte()) << (8 * i)
+		mask >>= 1
+	}
+	return value
+}
+
+// count reads a number of items, each of which takes at least a byte of
+// the header
+func (b *szBuf) count() int {
+	n := b.number()
+	if n > uint64(len(b.data)) {
+		b.fail(errors.New("7z header lists too many items"))
+		return 0
+	}
+	return int(n)
+}
+
+// bits reads a vector of n bits, most significant bit first
+func (b *szBuf) bits(n int) []bool {
+	data := b.bytes((n + 7) / 8)
+	bits := make([]bool, n)
+	if data == nil {
+		return bits
+	}
+	for i := range bits {
+		bits[i] = data[i/8]&(0x80>>(i%8)) != 0
+	}
+	return bits
+}
+
+// definedBits reads a bit vector preceded by a byte that is set if all
+// bits are set
+func (b *szBuf) definedBits(n int) []bool {
+	if b.byte() == 0 {
+		return b.bits(n)
+	}
+	bits := make([]bool, n)
+	for i := range bits {
+		bits[i] = true
+	}
+	return bits
+}
+
+// digests reads n CRC32 checksums, some of which may be missing
+func (b *szBuf) digests(n int) ([]bool, []uint32) {
+	defined := b.definedBits(n)
+	crcs := make([]uint32, n)
+	for i := range crcs {
+		if defined[i] {
+			crcs[i] = b.uint32()
+		}
+	}
+	return defined, crcs
+}
+
+// bcjReader reverses the x86 branch converter filter, which turns the
+// relative addresses of call and jump instructions into absolute ones
+// for better compression
+type bcjReader struct {
+	r   io.Reader
+	err error
+	buf []byte
+	// out holds the converted bytes not read yet, pending the bytes that
+	// need more input before they can be converted
+	out, pending []byte
+
+	pos, prevPos, prevMask uint32
+}
+
+func newBCJReader(r io.Reader) *bcjReader {
+	return &bcjReader{r: r, buf: make([]byte, 64<<10), prevPos: ^uint32(4)}
+}
+
+func (b *bcjReader) Read(p []byte) (int, error) {
+	for len(b.out) == 0 {
+		if b.err != nil {
+			if b.err != io.EOF || len(b.pending) == 0 {
+				return 0, b.err
+			}
+			// The last bytes cannot hold an instruction
+			b.out, b.pending = b.pending, nil
+			break
+		}
+
+		n := copy(b.buf, b.pending)
+		m, err := b.r.Read(b.buf[n:])
+		b.err = err
+		data := b.buf[:n+m]
+		done := b.convert(data)
+		b.out, b.pending = data[:done], data[done:]
+	}
+
+	n := copy(p, b.out)
+	b.out = b.out[n:]
+	return n, nil
+}
+
+// convert decodes the instructions in data, which starts at the stream
+// position pos, and returns how many bytes are final. It follows the x86
+// filter of xz.
+func (b *bcjReader) convert(data []byte) int {
+	maskAllowed := [8]bool{true, true, true, false, true, false, false, false}
+	maskBit := [8]uint32{0, 1, 2, 2, 3, 3, 3, 3}
+	msByte := func(v byte) bool { return v == 0 || v == 0xFF }
+
+	if len(data) < 5 {
+		return 0
+	}
+	if b.pos-b.prevPos > 5 {
+		b.prevPos = b.pos - 5
+	}
+
+	i := 0
+	for i <= len(data)-5 {
+		if data[i] != 0xE8 && data[i] != 0xE9 {
+			i++
+			continue
+		}
+
+		offset := b.pos + uint32(i) - b.prevPos
+		b.prevPos = b.pos + uint32(i)
+		if offset > 5 {
+			b.prevMask = 0
+		} else {
+			for j := uint32(0); j < offset; j++ {
+				b.prevMask &= 0x77
+				b.prevMask <<= 1
+			}
+		}
+
+		v := data[i+4]
+		if !msByte(v) || !maskAllowed[(b.prevMask>>1)&7] || b.prevMask>>1 >= 0x10 {
+			i++
+			b.prevMask |= 1
+			if msByte(v) {
+				b.prevMask |= 0x10
+			}
+			continue
+		}
+
+		src := binary.LittleEndian.Uint32(data[i+1:])
+		var dest uint32
+		for {
+			dest = src - (b.pos + uint32(i) + 5)
+			if b.prevMask == 0 {
+				break
+			}
+			bit := maskBit[b.prevMask>>1]
+			if !msByte(byte(dest >> (24 - bit*8))) {
+				break
+			}
+			src = dest ^ (1<<(32-bit*8) - 1)
+		}
+		dest &= 0x01FFFFFF
+		if dest&0x01000000 != 0 {
+			dest |= 0xFF000000
+		}
+		binary.LittleEndian.PutUint32(data[i+1:], dest)
+		i += 5
+		b.prevMask = 0
+	}
+
+	b.pos += uint32(i)
+	return i
+}
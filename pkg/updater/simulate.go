@@ -0,0 +1,31 @@
+package updater
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Phases of an update that -simulate-failure can make fail
+const (
+	PhaseDownload = "download"
+	PhaseChecksum = "checksum"
+	PhaseExtract  = "extract"
+	PhaseInstall  = "install"
+)
+
+// FailurePhases lists the phases accepted by -simulate-failure
+var FailurePhases = []string{PhaseDownload, PhaseChecksum, PhaseExtract, PhaseInstall}
+
+// ErrSimulatedFailure is wrapped by the errors injected with
+// Options.SimulateFailure
+var ErrSimulatedFailure = errors.New("simulated failure")
+
+// simulateFailure returns an error if the -simulate-failure test hook
+// targets phase, so the cleanup after a failed phase can be exercised
+// without a broken release
+func (u *Updater) simulateFailure(phase string) error {
+	if u.opts.SimulateFailure != phase {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrSimulatedFailure, phase)
+}
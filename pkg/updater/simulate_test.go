@@ -0,0 +1,51 @@
+package updater
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSimulateFailure(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+		"noraneko/updated.txt":     "yes",
+	})
+
+	for _, phase := range FailurePhases {
+		t.Run(phase, func(t *testing.T) {
+			server := newReleaseServer(t, "v2.0.0", archive)
+
+			cfg := newPortableInstall(t, "1.0.0")
+			cfg.WorkDir = t.TempDir()
+
+			u := newTestUpdater(cfg, Options{Portable: true, SimulateFailure: phase}, server)
+			_, err := u.Run()
+			if !errors.Is(err, ErrSimulatedFailure) {
+				t.Fatalf("Expected a simulated failure, got %v", err)
+			}
+
+			// Temporary files are cleaned up and the install is untouched
+			entries, err := os.ReadDir(cfg.WorkDir)
+			if err != nil {
+				t.Fatalf("Failed to read WorkDir: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("Expected WorkDir to be cleaned up, found %d entries", len(entries))
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(cfg.Path), "updated.txt")); err == nil {
+				t.Error("Expected the install to be left untouched")
+			}
+		})
+	}
+
+	// Without the hook the same release installs
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.WorkDir = t.TempDir()
+	if _, err := newTestUpdater(cfg, Options{Portable: true}, server).Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// stagedRecordName is the file in the staging directory describing the
+// staged update. It is written last and renamed into place, so an
+// interrupted -stage leaves none.
+const stagedRecordName = "staged.json"
+
+// stagingFolder holds the default staging directories in the user's local
+// application data
+const stagingFolder = "Noraneko-WinUpdater"
+
+// stagedUpdate is an update downloaded and verified by -stage, with the
+// attestation bundles and cosign signature files it was verified with
+type stagedUpdate struct {
+	Release      Release           `json:"release"`
+	Asset        string            `json:"asset"`
+	SHA256       string            `json:"sha256"`
+	StagedAt     time.Time         `json:"staged_at"`
+	Attestations []json.RawMessage `json:"attestations,omitempty"`
+	Signatures   map[string][]byte `json:"signatures,omitempty"`
+}
+
+// asset returns the staged asset of the release
+func (s *stagedUpdate) asset() *Asset {
+	for i := range s.Release.Assets {
+		if s.Release.Assets[i].Name == s.Asset {
+			return &s.Release.Assets[i]
+		}
+	}
+	return nil
+}
+
+// stagingDir returns the directory updates are staged in, by default in
+// the user's local application data rather than the shared temp folder.
+// Each of the [Installs] stages in a folder of its own.
+func (u *Updater) stagingDir() string {
+	if u.cfg.StagingDir != "" {
+		return filepath.Join(u.cfg.StagingDir, u.cfg.InstallName)
+	}
+	base := u.cfg.WorkDir
+	if dir, err := os.UserCacheDir(); err == nil {
+		base = filepath.Join(dir, stagingFolder)
+	}
+	return filepath.Join(base, u.cfg.InstallFile(config.BrowserName+"-Staged"))
+}
+
+// checkStagingDir rejects a StagingDir that is WorkDir, whose downloads
+// would be the staged files themselves and which staging clears
+func (u *Updater) checkStagingDir() error {
+	if strings.EqualFold(filepath.Clean(u.stagingDir()), filepath.Clean(u.cfg.WorkDir)) {
+		return fmt.Errorf("StagingDir cannot be WorkDir (%s)", u.cfg.WorkDir)
+	}
+	return nil
+}
+
+// loadStaged reads the staged update and checks that its download is
+// still intact
+func (u *Updater) loadStaged() (*stagedUpdate, error) {
+	if err := u.checkStagingDir(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(u.stagingDir(), stagedRecordName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("nothing is staged in %s, run with -stage first", u.stagingDir())
+	} else if err != nil {
+		return nil, err
+	}
+
+	var staged stagedUpdate
+	if err := json.Unmarshal(data, &staged); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", stagedRecordName, err)
+	}
+	if staged.Release.TagName == "" || staged.SHA256 == "" || staged.asset() == nil {
+		return nil, fmt.Errorf("%s is incomplete", stagedRecordName)
+	}
+
+	actual, err := hashFile(filepath.Join(u.stagingDir(), staged.Asset))
+	if err != nil {
+		return nil, err
+	}
+	if actual != staged.SHA256 {
+		return nil, fmt.Errorf("staged download %s was modified since it was staged", staged.Asset)
+	}
+	return &staged, nil
+}
+
+// stageUpdate downloads and verifies the asset of the release into the
+// staging directory, replacing an earlier staged update
+func (u *Updater) stageUpdate(ctx context.Context) (err error) {
+	if err := u.checkStagingDir(); err != nil {
+		return err
+	}
+	asset, err := u.selectAsset(ctx)
+	if err != nil {
+		return err
+	}
+	u.asset = asset
+
+	if staged, err := u.loadStaged(); err == nil && staged.Release.TagName == u.release.TagName && staged.Asset == asset.Name {
+		fmt.Fprintf(u.out, "%s is already staged.\n", asset.Name)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	downloadPath := filepath.Join(u.cfg.WorkDir, asset.Name)
+	defer func() { u.removeTemp(err, downloadPath) }()
+
+	var checksumPath string
+	checksumPath, err = u.fetchAsset(ctx, downloadPath)
+	if checksumPath != "" {
+		defer func() { u.removeTemp(err, checksumPath) }()
+	}
+	if err != nil {
+		return err
+	}
+	if err := u.verifyDownload(ctx, downloadPath); err != nil {
+		return err
+	}
+
+	digest, err := hashFile(downloadPath)
+	if err != nil {
+		return err
+	}
+
+	dir := u.stagingDir()
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clear staging directory: %w", err)
+	}
+	if err := makePrivateDir(dir); err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	if err := u.copyFile(ctx, downloadPath, filepath.Join(dir, asset.Name), nil); err != nil {
+		return fmt.Errorf("failed to stage download: %w", err)
+	}
+
+	data, err := json.MarshalIndent(stagedUpdate{
+		Release:      *u.release,
+		Asset:        asset.Name,
+		SHA256:       digest,
+		StagedAt:     clock(),
+		Attestations: u.attestations,
+		Signatures:   u.signatures,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStagedRecord(dir, data)
+}
+
+// writeStagedRecord writes the record of the staged update to a temporary
+// file in dir and renames it into place
+func writeStagedRecord(dir string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, "."+stagedRecordName+".partial-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, stagedRecordName))
+}
+
+// removeStaged removes the staged update after it was installed
+func (u *Updater) removeStaged() {
+	if err := os.RemoveAll(u.stagingDir()); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to remove the staged update: %v\n", err)
+	}
+}
@@ -0,0 +1,159 @@
+package updater
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// useTestCacheDir points the user's cache folder, which holds the default
+// staging directory, into a temporary directory
+func useTestCacheDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("LocalAppData", dir)
+	return dir
+}
+
+func TestStageThenApply(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+	cacheDir := useTestCacheDir(t)
+
+	// Staging downloads without installing
+	u := newTestUpdater(cfg, Options{Portable: true, Stage: true}, server)
+	result, err := u.Run()
+	if err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	if result.Updated || !result.UpdateAvailable || result.Message != "Staged 2.0.0" {
+		t.Errorf("Expected a staged update, got %+v", result)
+	}
+	if version, _ := u.getCurrentVersion(); version != "1.0.0" {
+		t.Errorf("Expected the install to be untouched, got version %s", version)
+	}
+	stagingDir := filepath.Join(cacheDir, stagingFolder, "Noraneko-Staged")
+	if info, err := os.Stat(stagingDir); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected a private staging directory, got %v", err)
+	}
+	for _, name := range []string{"noraneko-windows-x86_64-portable.zip", stagedRecordName} {
+		if _, err := os.Stat(filepath.Join(stagingDir, name)); err != nil {
+			t.Errorf("Expected %s to be staged: %v", name, err)
+		}
+	}
+
+	// Applying needs no network
+	server.Close()
+	u = newTestUpdater(cfg, Options{Portable: true, ApplyStaged: true}, server)
+	result, err = u.Run()
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if !result.Updated || result.NewVersion != "2.0.0" {
+		t.Errorf("Expected the staged update to be installed, got %+v", result)
+	}
+	if version, _ := u.getCurrentVersion(); version != "2.0.0" {
+		t.Errorf("Expected version 2.0.0 after applying, got %s", version)
+	}
+	if _, err := os.Stat(stagingDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the staged update to be removed, got %v", err)
+	}
+}
+
+func TestApplyStagedInvalid(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+	cfg := newPortableInstall(t, "1.0.0")
+	useTestCacheDir(t)
+
+	// Nothing staged
+	u := newTestUpdater(cfg, Options{Portable: true, ApplyStaged: true}, server)
+	if _, err := u.Run(); err == nil || !strings.Contains(err.Error(), "nothing is staged") {
+		t.Errorf("Expected apply to fail without a staged update, got %v", err)
+	}
+
+	// A staged download changed after staging
+	u = newTestUpdater(cfg, Options{Portable: true, Stage: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Stage failed: %v", err)
+	}
+	staged := filepath.Join(u.stagingDir(), "noraneko-windows-x86_64-portable.zip")
+	if err := os.WriteFile(staged, []byte("tampered"), 0644); err != nil {
+		t.Fatalf("Failed to modify staged download: %v", err)
+	}
+	u = newTestUpdater(cfg, Options{Portable: true, ApplyStaged: true}, server)
+	if _, err := u.Run(); err == nil || !strings.Contains(err.Error(), "was modified since it was staged") {
+		t.Errorf("Expected apply to reject the modified download, got %v", err)
+	}
+	if version, _ := u.getCurrentVersion(); version != "1.0.0" {
+		t.Errorf("Expected the install to be untouched, got version %s", version)
+	}
+
+	// A StagingDir that is WorkDir
+	cfg.StagingDir = cfg.WorkDir
+	u = newTestUpdater(cfg, Options{Portable: true, ApplyStaged: true}, server)
+	if _, err := u.Run(); err == nil || !strings.Contains(err.Error(), "StagingDir cannot be WorkDir") {
+		t.Errorf("Expected StagingDir=WorkDir to be rejected, got %v", err)
+	}
+}
+
+func TestApplyStagedVerifiesSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to encode public key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	cfg := &config.Config{VerifyCosign: true, CosignPublicKey: keyPath}
+	content := []byte("PK\x03\x04 test artifact")
+
+	// Staging keeps the signature it verified
+	u, path := newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".sig": signBlob(t, key, content)})
+	if err := u.verifyDownload(context.Background(), path); err != nil {
+		t.Fatalf("Expected a valid signature, got %v", err)
+	}
+	staged := &stagedUpdate{Signatures: u.signatures}
+
+	// Applying checks it again with the kept copy, not the release's
+	unused := map[string][]byte{cosignArtifact + ".sig": []byte("not fetched")}
+	u, path = newCosignUpdater(t, cfg, content, unused)
+	u.staged = staged
+	if err := u.verifyDownload(context.Background(), path); err != nil {
+		t.Errorf("Expected the staged signature to verify, got %v", err)
+	}
+
+	// and fails for a download replaced together with its record
+	u, path = newCosignUpdater(t, cfg, []byte("PK\x03\x04 replaced"), unused)
+	u.staged = staged
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "does not match the download") {
+		t.Errorf("Expected the replaced download to fail, got %v", err)
+	}
+	u, path = newCosignUpdater(t, cfg, content, map[string][]byte{cosignArtifact + ".sig": signBlob(t, key, content)})
+	u.staged = &stagedUpdate{}
+	if err := u.verifyDownload(context.Background(), path); err == nil || !strings.Contains(err.Error(), "was not staged") {
+		t.Errorf("Expected a missing staged signature to fail, got %v", err)
+	}
+}
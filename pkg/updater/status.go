@@ -0,0 +1,96 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Status summarizes the install and updater state
+type Status struct {
+	BrowserPath     string   `json:"browser_path"`
+	CurrentVersion  string   `json:"current_version"`
+	Branch          string   `json:"branch"`
+	LastRun         string   `json:"last_run"`
+	LastResult      string   `json:"last_result"`
+	RebootRequired  bool     `json:"reboot_required"`
+	ScheduledTask   bool     `json:"scheduled_task"`
+	LatestVersion   string   `json:"latest_version"`
+	UpdateAvailable bool     `json:"update_available"`
+	CheckError      string   `json:"check_error,omitempty"`
+	Policies        []string `json:"policies,omitempty"`
+}
+
+// scheduledTaskExists reports whether the scheduled task for the current
+// user is registered. It is a variable so tests can stub it out.
+var scheduledTaskExists = func() bool {
+	return exec.Command("schtasks.exe", "/Query", "/TN", taskName()).Run() == nil
+}
+
+// Status gathers the current install and updater state. Failures of the
+// update check are recorded in the result rather than returned.
+func (u *Updater) Status() *Status {
+	s := &Status{
+		BrowserPath:    u.cfg.GetBrowserPath(),
+		Branch:         u.cfg.Branch,
+		LastRun:        u.cfg.LogValue("LastRun"),
+		LastResult:     u.cfg.LogValue("LastResult"),
+		RebootRequired: u.cfg.LogValue("LastRebootRequired") == "1",
+		ScheduledTask:  scheduledTaskExists(),
+		Policies:       u.cfg.Policies,
+	}
+
+	current, err := u.getInstalledBuild()
+	if err != nil {
+		current = &installedBuild{}
+	}
+	s.CurrentVersion = current.Version
+
+	release, err := u.getLatestRelease(context.Background())
+	if err != nil {
+		s.CheckError = err.Error()
+		return s
+	}
+
+	s.LatestVersion = releaseVersion(release)
+	s.UpdateAvailable = u.isNewerBuild(current, release)
+	return s
+}
+
+// Print writes a human-readable summary of the status
+func (s *Status) Print(w io.Writer) {
+	orUnknown := func(v string) string {
+		if v == "" {
+			return "unknown"
+		}
+		return v
+	}
+
+	fmt.Fprintf(w, "Browser path:    %s\n", orUnknown(s.BrowserPath))
+	fmt.Fprintf(w, "Current version: %s\n", orUnknown(s.CurrentVersion))
+	fmt.Fprintf(w, "Branch:          %s\n", s.Branch)
+	fmt.Fprintf(w, "Last run:        %s\n", orUnknown(s.LastRun))
+	fmt.Fprintf(w, "Last result:     %s\n", orUnknown(s.LastResult))
+	if s.RebootRequired {
+		fmt.Fprintln(w, "Reboot required: yes, to complete the last update")
+	}
+	if len(s.Policies) > 0 {
+		fmt.Fprintf(w, "Policy:          %s enforced\n", strings.Join(s.Policies, ", "))
+	}
+	if s.ScheduledTask {
+		fmt.Fprintln(w, "Scheduled task:  installed")
+	} else {
+		fmt.Fprintln(w, "Scheduled task:  not installed")
+	}
+
+	switch {
+	case s.CheckError != "":
+		fmt.Fprintf(w, "Update check:    failed (%s)\n", s.CheckError)
+	case s.UpdateAvailable:
+		fmt.Fprintf(w, "Update check:    %s available\n", s.LatestVersion)
+	default:
+		fmt.Fprintf(w, "Update check:    up to date (%s)\n", s.LatestVersion)
+	}
+}
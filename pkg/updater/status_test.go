@@ -0,0 +1,126 @@
+package updater
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+func TestStatus(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Fake browser install
+	browserDir := filepath.Join(tmpDir, "Noraneko")
+	if err := os.MkdirAll(browserDir, 0755); err != nil {
+		t.Fatalf("Failed to create browser dir: %v", err)
+	}
+	browserPath := filepath.Join(browserDir, config.BrowserExe)
+	if err := os.WriteFile(browserPath, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create browser exe: %v", err)
+	}
+	appIni := "[App]\nVersion=1.2.0\n"
+	if err := os.WriteFile(filepath.Join(browserDir, "application.ini"), []byte(appIni), 0644); err != nil {
+		t.Fatalf("Failed to write application.ini: %v", err)
+	}
+
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.Path = browserPath
+	cfg.Branch = "beta"
+	cfg.LogEntry("LastRun", "2024-01-01 12:00:00")
+	cfg.LogEntry("LastResult", "No new version found")
+	cfg.LogEntry("LastRebootRequired", "1")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.3.0", "assets": []}`))
+	}))
+	defer server.Close()
+
+	origTaskExists := scheduledTaskExists
+	scheduledTaskExists = func() bool { return true }
+	defer func() { scheduledTaskExists = origTaskExists }()
+
+	u := New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL
+
+	s := u.Status()
+
+	if s.BrowserPath != browserPath {
+		t.Errorf("Expected browser path %s, got %s", browserPath, s.BrowserPath)
+	}
+	if s.CurrentVersion != "1.2.0" {
+		t.Errorf("Expected current version 1.2.0, got %s", s.CurrentVersion)
+	}
+	if s.Branch != "beta" {
+		t.Errorf("Expected branch beta, got %s", s.Branch)
+	}
+	if s.LastRun != "2024-01-01 12:00:00" {
+		t.Errorf("Expected last run '2024-01-01 12:00:00', got '%s'", s.LastRun)
+	}
+	if s.LastResult != "No new version found" {
+		t.Errorf("Expected last result 'No new version found', got '%s'", s.LastResult)
+	}
+	if !s.RebootRequired {
+		t.Error("Expected a pending reboot to be reported")
+	}
+	if !s.ScheduledTask {
+		t.Error("Expected scheduled task to be reported")
+	}
+	if s.LatestVersion != "1.3.0" {
+		t.Errorf("Expected latest version 1.3.0, got %s", s.LatestVersion)
+	}
+	if !s.UpdateAvailable {
+		t.Error("Expected an update to be available")
+	}
+
+	var out bytes.Buffer
+	s.Print(&out)
+	if !strings.Contains(out.String(), "1.3.0 available") {
+		t.Errorf("Summary missing available update:\n%s", out.String())
+	}
+}
+
+func TestStatusCheckFailure(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	origTaskExists := scheduledTaskExists
+	scheduledTaskExists = func() bool { return false }
+	defer func() { scheduledTaskExists = origTaskExists }()
+
+	u := New(cfg, Options{Version: "1.0.0"})
+	u.apiURL = server.URL
+
+	s := u.Status()
+	if s.CheckError == "" {
+		t.Error("Expected the failed update check to be recorded")
+	}
+	if s.UpdateAvailable {
+		t.Error("Expected no update to be reported when the check fails")
+	}
+}
@@ -0,0 +1,97 @@
+package updater
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// taskAction is the program a scheduled task runs
+type taskAction struct {
+	Command          string `xml:"Actions>Exec>Command"`
+	WorkingDirectory string `xml:"Actions>Exec>WorkingDirectory"`
+}
+
+// taskName returns the name of the scheduled task for the current user
+func taskName() string {
+	return fmt.Sprintf("%s (%s)", config.TaskTitle, os.Getenv("USERNAME"))
+}
+
+// queryTaskXML returns the XML definition of a scheduled task. It is a
+// variable so tests can stub it out.
+var queryTaskXML = func(name string) ([]byte, error) {
+	return exec.Command("schtasks.exe", "/Query", "/TN", name, "/XML").Output()
+}
+
+// parseTaskXML reads the action of a task definition. The definition may
+// be UTF-16 with a byte order mark, as written by schtasks.
+func parseTaskXML(data []byte) (*taskAction, error) {
+	if bytes.HasPrefix(data, []byte{0xFF, 0xFE}) {
+		units := make([]uint16, (len(data)-2)/2)
+		for i := range units {
+			units[i] = uint16(data[2+2*i]) | uint16(data[3+2*i])<<8
+		}
+		data = []byte(string(utf16.Decode(units)))
+	}
+
+	// The declaration may claim UTF-16, but the text is UTF-8 by now
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(label string, r io.Reader) (io.Reader, error) { return r, nil }
+
+	var action taskAction
+	if err := dec.Decode(&action); err != nil {
+		return nil, fmt.Errorf("failed to parse task definition: %w", err)
+	}
+	return &action, nil
+}
+
+// taskNeedsRepair reports whether a task must be recreated to run exePath.
+// A nil action means the task is missing.
+func taskNeedsRepair(action *taskAction, exePath string) bool {
+	if action == nil || action.Command == "" {
+		return true
+	}
+
+	command := strings.Trim(action.Command, `"`)
+	if !filepath.IsAbs(command) {
+		command = filepath.Join(strings.Trim(action.WorkingDirectory, `"`), command)
+	}
+	return !strings.EqualFold(filepath.Clean(command), filepath.Clean(exePath))
+}
+
+// RepairScheduledTask recreates the scheduled task if the ScheduledTask
+// setting says one should exist but it is missing or runs another
+// executable. It reports whether the task was recreated.
+func (u *Updater) RepairScheduledTask() (bool, error) {
+	if !u.cfg.ScheduledTask {
+		return false, nil
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		return false, err
+	}
+
+	var action *taskAction
+	if data, err := queryTaskXML(taskName()); err == nil {
+		if action, err = parseTaskXML(data); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}
+	if !taskNeedsRepair(action, exePath) {
+		return false, nil
+	}
+
+	if err := u.runTaskScript("ScheduledTask-Create.ps1"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
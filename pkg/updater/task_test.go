@@ -0,0 +1,79 @@
+package updater
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+const testTaskXML = `<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <Actions Context="Author">
+    <Exec>
+      <Command>Noraneko-WinUpdater.exe</Command>
+      <Arguments>-scheduled</Arguments>
+      <WorkingDirectory>C:\Tools\WinUpdater</WorkingDirectory>
+    </Exec>
+  </Actions>
+</Task>`
+
+func TestParseTaskXML(t *testing.T) {
+	// schtasks writes UTF-16 with a byte order mark
+	units := utf16.Encode([]rune(testTaskXML))
+	data := []byte{0xFF, 0xFE}
+	for _, u := range units {
+		data = binary.LittleEndian.AppendUint16(data, u)
+	}
+
+	for name, input := range map[string][]byte{"utf-8": []byte(testTaskXML), "utf-16": data} {
+		action, err := parseTaskXML(input)
+		if err != nil {
+			t.Fatalf("%s: failed to parse task: %v", name, err)
+		}
+		if action.Command != "Noraneko-WinUpdater.exe" || action.WorkingDirectory != `C:\Tools\WinUpdater` {
+			t.Errorf("%s: unexpected action %+v", name, action)
+		}
+	}
+}
+
+func TestTaskNeedsRepair(t *testing.T) {
+	exePath := filepath.Join("C:", "Tools", "WinUpdater", "Noraneko-WinUpdater.exe")
+	oldDir := filepath.Join("C:", "Old", "WinUpdater")
+	newDir := filepath.Dir(exePath)
+
+	tests := []struct {
+		name   string
+		action *taskAction
+		repair bool
+	}{
+		{"missing task", nil, true},
+		{"no command", &taskAction{}, true},
+		{"current path", &taskAction{Command: "Noraneko-WinUpdater.exe", WorkingDirectory: newDir}, false},
+		{"absolute quoted path", &taskAction{Command: `"` + exePath + `"`}, false},
+		{"old path", &taskAction{Command: "Noraneko-WinUpdater.exe", WorkingDirectory: oldDir}, true},
+		{"old absolute path", &taskAction{Command: filepath.Join(oldDir, "Noraneko-WinUpdater.exe")}, true},
+	}
+
+	for _, tt := range tests {
+		if got := taskNeedsRepair(tt.action, exePath); got != tt.repair {
+			t.Errorf("%s: expected repair=%v, got %v", tt.name, tt.repair, got)
+		}
+	}
+}
+
+func TestRepairScheduledTaskNotConfigured(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+
+	orig := queryTaskXML
+	queryTaskXML = func(name string) ([]byte, error) {
+		t.Error("Expected no task query without ScheduledTask")
+		return nil, nil
+	}
+	defer func() { queryTaskXML = orig }()
+
+	repaired, err := New(cfg, Options{}).RepairScheduledTask()
+	if err != nil || repaired {
+		t.Errorf("Expected nothing to be repaired, got %v, %v", repaired, err)
+	}
+}
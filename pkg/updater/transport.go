@@ -0,0 +1,54 @@
+package updater
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// newHTTPClient builds the HTTP client used for all requests
+func newHTTPClient(cfg *config.Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{MinVersion: cfg.TLSMinVersion()}
+
+	if cfg.PinnedCACert != "" {
+		pool, err := loadPinnedCA(cfg.PinnedCACert)
+		if err != nil {
+			// Fail closed: an empty pool rejects every server certificate
+			fmt.Fprintf(os.Stderr, "Warning: %v; TLS connections will fail\n", err)
+			pool = x509.NewCertPool()
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	// A non-nil empty TLSNextProto map keeps HTTP/2 from being negotiated
+	if cfg.DisableHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   5 * time.Minute,
+	}
+}
+
+// loadPinnedCA reads a PEM file into a certificate pool that contains only
+// its certificates
+func loadPinnedCA(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pinned CA certificate: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
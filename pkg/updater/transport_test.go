@@ -0,0 +1,175 @@
+package updater
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// writeCertPEM writes a DER certificate to a PEM file
+func writeCertPEM(t *testing.T, path string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+}
+
+// newTestCA creates a self-signed CA certificate
+func newTestCA(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Noraneko Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	return der
+}
+
+func TestPinnedCACert(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// Pinning the server's own CA allows the connection
+	serverCA := filepath.Join(tmpDir, "server-ca.pem")
+	writeCertPEM(t, serverCA, server.Certificate().Raw)
+
+	client := newHTTPClient(&config.Config{PinnedCACert: serverCA})
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSClientConfig == nil || transport.TLSClientConfig.RootCAs == nil {
+		t.Fatal("Expected the transport to use a pinned root pool")
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected request with pinned server CA to succeed: %v", err)
+	}
+	resp.Body.Close()
+
+	// Pinning an unrelated CA rejects the server
+	otherCA := filepath.Join(tmpDir, "other-ca.pem")
+	writeCertPEM(t, otherCA, newTestCA(t))
+
+	client = newHTTPClient(&config.Config{PinnedCACert: otherCA})
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected request with an unrelated pinned CA to fail")
+	}
+
+	// An unreadable pin fails closed
+	client = newHTTPClient(&config.Config{PinnedCACert: filepath.Join(tmpDir, "missing.pem")})
+	if resp, err := client.Get(server.URL); err == nil {
+		resp.Body.Close()
+		t.Error("Expected request with a missing pinned CA to fail")
+	}
+}
+
+func TestNoPinnedCACert(t *testing.T) {
+	client := newHTTPClient(&config.Config{})
+	transport := client.Transport.(*http.Transport)
+	if transport.TLSClientConfig != nil && transport.TLSClientConfig.RootCAs != nil {
+		t.Error("Expected the system root pool when no CA is pinned")
+	}
+}
+
+func TestDisableHTTP2(t *testing.T) {
+	transport := newHTTPClient(&config.Config{}).Transport.(*http.Transport)
+	if !transport.ForceAttemptHTTP2 {
+		t.Error("Expected HTTP/2 to be attempted by default")
+	}
+
+	transport = newHTTPClient(&config.Config{DisableHTTP2: true}).Transport.(*http.Transport)
+	if transport.ForceAttemptHTTP2 {
+		t.Error("Expected ForceAttemptHTTP2 to be off")
+	}
+	if transport.TLSNextProto == nil || len(transport.TLSNextProto) != 0 {
+		t.Errorf("Expected an empty TLSNextProto map, got %v", transport.TLSNextProto)
+	}
+
+	// A TLS server offering HTTP/2 is spoken to over HTTP/1.1
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	transport.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("Expected HTTP/1.1, got %s", resp.Proto)
+	}
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	tests := []struct {
+		setting string
+		want    uint16
+	}{
+		{"", tls.VersionTLS12},
+		{"1.2", tls.VersionTLS12},
+		{"1.3", tls.VersionTLS13},
+	}
+	for _, tt := range tests {
+		transport := newHTTPClient(&config.Config{MinTLSVersion: tt.setting}).Transport.(*http.Transport)
+		if transport.TLSClientConfig == nil || transport.TLSClientConfig.MinVersion != tt.want {
+			t.Errorf("MinTLSVersion %q: expected MinVersion %x, got %+v", tt.setting, tt.want, transport.TLSClientConfig)
+		}
+	}
+
+	// A server limited to TLS 1.2 is refused when 1.3 is required
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tt := range tests[1:] {
+		transport := newHTTPClient(&config.Config{MinTLSVersion: tt.setting}).Transport.(*http.Transport)
+		transport.TLSClientConfig.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if refused := err != nil; refused != (tt.want == tls.VersionTLS13) {
+			t.Errorf("MinTLSVersion %s: unexpected result against a TLS 1.2 server: %v", tt.setting, err)
+		}
+	}
+}
@@ -3,18 +3,19 @@ package updater
 
 import (
 	"archive/zip"
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
-	"regexp"
-	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
@@ -28,21 +29,120 @@ type Options struct {
 	CreateTask bool
 	RemoveTask bool
 	Version    string
+
+	// Reinstall the latest release even if it is not newer
+	ForceReinstall bool
+
+	// Install the installer in portable mode if the release has no
+	// portable asset
+	AllowFlavorFallback bool
+
+	// Remove a broken install and install the latest release in its
+	// place, even if it is not newer
+	ReinstallIfCorrupt bool
+
+	// Name or glob pattern of the release asset to use instead of the one
+	// scored best for this platform. Empty selects by score.
+	Asset string
+
+	// Called with the bytes downloaded so far, may be nil
+	Progress ProgressFunc
+
+	// Called with the bytes of a zip release copied into the install so
+	// far, may be nil
+	InstallProgress ProgressFunc
+
+	// Called after each file checked by VerifyInstall, may be nil
+	VerifyProgress FileProgressFunc
+
+	// Asked before an update is installed, nil installs without asking
+	Confirm func(current, latest string) bool
+
+	// Download and verify the update into the staging directory without
+	// installing it
+	Stage bool
+
+	// Install the update staged by an earlier run instead of the latest
+	// release, without network access
+	ApplyStaged bool
+
+	// Update phase (Phase* constants) made to fail on purpose, for testing
+	// the cleanup after failures. Empty disables the hook.
+	SimulateFailure string
+
+	// Receives the progress messages of a run, os.Stdout if nil
+	Output io.Writer
 }
 
+// ProgressFunc receives the download progress. total is 0 if the size is
+// not known.
+type ProgressFunc func(done, total int64)
+
 // Updater handles browser updates
 type Updater struct {
 	cfg     *config.Config
 	opts    Options
+	out     io.Writer
 	client  *http.Client
 	release *Release
+
+	// Asset downloaded by the current update
+	asset *Asset
+
+	// Set if asset is an installer used by AllowFlavorFallback
+	flavorFallback bool
+
+	// Broken install removed before installing, see ReinstallIfCorrupt
+	wipeDir string
+
+	// Whether an interrupted install of the release is resumed, and the
+	// journal of the install in progress
+	resuming bool
+	journal  *installJournal
+
+	// Releases API, connection check and release web page endpoints,
+	// overridable for tests
+	apiURL   string
+	checkURL string
+	webURL   string
+
+	// Temporary files kept after a failed install, see removeTemp
+	keptTemp []string
+
+	// Validated custom headers, see customHeaders
+	headers     http.Header
+	headersOnce sync.Once
+
+	// Set if the installer asked for a reboot to finish the update
+	rebootRequired bool
+
+	// Log written by the installer of the current update, see InstallerLog
+	installerLog string
+
+	// Timed phases of the current run, see startPhase
+	phases []Phase
+
+	// Request and response body of the latest release, see DumpReleaseJSON
+	releaseRequest *http.Request
+	releaseBody    []byte
+
+	// Update installed by ApplyStaged
+	staged *stagedUpdate
+
+	// Attestation bundles and cosign signature files of the download, kept
+	// by stageUpdate so ApplyStaged can verify the download again offline
+	attestations []json.RawMessage
+	signatures   map[string][]byte
 }
 
 // Release represents a GitHub release
 type Release struct {
-	TagName string  `json:"tag_name"`
-	Name    string  `json:"name"`
-	Assets  []Asset `json:"assets"`
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Prerelease  bool      `json:"prerelease"`
+	Draft       bool      `json:"draft"`
+	PublishedAt time.Time `json:"published_at"`
+	Assets      []Asset   `json:"assets"`
 }
 
 // Asset represents a release asset
@@ -50,75 +150,376 @@ type Asset struct {
 	Name               string `json:"name"`
 	BrowserDownloadURL string `json:"browser_download_url"`
 	Size               int64  `json:"size"`
+	ContentType        string `json:"content_type"`
 }
 
 // New creates a new Updater instance
 func New(cfg *config.Config, opts Options) *Updater {
-	return &Updater{
-		cfg:  cfg,
-		opts: opts,
-		client: &http.Client{
-			Timeout: 5 * time.Minute,
-		},
+	checkURL := cfg.ConnectCheckURL
+	if checkURL == "" {
+		checkURL = config.ConnectCheckURL
 	}
+
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	u := &Updater{
+		cfg:      cfg,
+		opts:     opts,
+		out:      out,
+		client:   newHTTPClient(cfg),
+		apiURL:   cfg.ReleaseAPI(),
+		checkURL: checkURL,
+	}
+	u.webURL = config.GitHubURL + "/" + u.releaseRepo()
+	return u
+}
+
+// clock returns the current time, overridable for tests
+var clock = time.Now
+
+// Run executes the update check and installation and returns what it
+// did. Progress is printed as it goes. With [Installs], each install is
+// updated in turn; if any failed, the result is returned with the error.
+// With MaxRunDuration, requests and downloads are aborted once the run
+// takes longer, so a wedged scheduled run does not overlap the next one.
+// Copying the new files into the install is finished first.
+func (u *Updater) Run() (*RunResult, error) {
+	return u.runWithin(context.Background())
 }
 
-// Run executes the update check and installation
-func (u *Updater) Run() error {
-	fmt.Printf("Noraneko WinUpdater v%s\n", u.opts.Version)
-	fmt.Println("Checking for updates...")
+// runWithin implements Run. Cancelling parent aborts the run like
+// MaxRunDuration does.
+func (u *Updater) runWithin(parent context.Context) (*RunResult, error) {
+	ctx := parent
+	if u.cfg.MaxRunDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(u.cfg.MaxRunDuration)*time.Second)
+		defer cancel()
+	}
+	startedAt := time.Now()
+	var result *RunResult
+	var err error
+	if len(u.cfg.Installs) > 0 {
+		result, err = u.runInstalls(ctx)
+	} else {
+		result, err = u.run(ctx)
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("run aborted after MaxRunDuration of %d seconds: %w", u.cfg.MaxRunDuration, err)
+	}
+	u.notifyWebhook(result, err, startedAt)
+	return result, err
+}
+
+// run implements Run
+func (u *Updater) run(ctx context.Context) (*RunResult, error) {
+	result := &RunResult{StartedAt: time.Now()}
+	u.phases = nil
+	finish := func(message string) (*RunResult, error) {
+		u.logResult(message)
+		result.Message = message
+		result.Duration = time.Since(result.StartedAt)
+		result.Phases = u.phases
+		if u.cfg.LogPhases {
+			u.cfg.LogEntry("LastPhases", phaseSummary(u.phases))
+		}
+		return result, nil
+	}
+
+	fmt.Fprintf(u.out, "Noraneko WinUpdater v%s\n", u.opts.Version)
+	if len(u.cfg.Policies) > 0 {
+		fmt.Fprintf(u.out, "Enforced by policy: %s\n", strings.Join(u.cfg.Policies, ", "))
+	}
+	fmt.Fprintln(u.out, "Checking for updates...")
+
+	// Make sure downloads have somewhere to go
+	if dir := u.workDirRedirect(); dir != "" {
+		fmt.Fprintf(os.Stderr, "Warning: WorkDir is the updater's folder and the browser is not portable, using %s instead\n", dir)
+		u.cfg.WorkDir = dir
+	}
+	if err := u.prepareWorkDir(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: cannot use WorkDir %s, using %s instead: %v\n", u.cfg.WorkDir, os.TempDir(), err)
+		u.cfg.WorkDir = os.TempDir()
+	}
 
-	// Check connection
-	if err := u.checkConnection(); err != nil {
-		return fmt.Errorf("connection check failed: %w", err)
+	// Check connection, which a staged update does not need
+	u.staged = nil
+	if !u.opts.ApplyStaged {
+		endConnect := u.startPhase("connect")
+		err := u.checkConnection(ctx)
+		endConnect()
+		if err != nil {
+			if !u.cfg.OfflineTolerant && !u.cfg.AllowHTMLFallback {
+				return nil, fmt.Errorf("connection check failed: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: connection check failed, trying anyway: %v\n", err)
+		}
+	}
+
+	// Remember an auto-detected install for later runs
+	if err := u.cfg.RememberBrowserPath(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save browser path: %v\n", err)
 	}
 
 	// Get current version
-	currentVersion, err := u.getCurrentVersion()
-	if err != nil {
-		// If we can't get the current version, this might be a fresh install
-		fmt.Printf("Could not determine current version: %v\n", err)
-		currentVersion = "0.0.0"
+	fresh := u.isFreshInstall()
+	current := &installedBuild{Version: "0.0.0"}
+	if fresh {
+		fmt.Fprintf(u.out, "No %s installation found.\n", config.BrowserName)
+	} else if build, err := u.getInstalledBuild(); err != nil {
+		fmt.Fprintf(u.out, "Could not determine current version: %v\n", err)
+	} else if build.BuildID != "" {
+		current = build
+		fmt.Fprintf(u.out, "Current version: %s (build %s)\n", build.Version, build.BuildID)
+	} else {
+		current = build
+		fmt.Fprintf(u.out, "Current version: %s\n", build.Version)
+	}
+	currentVersion := current.Version
+	result.CurrentVersion = currentVersion
+	result.FreshInstall = fresh
+
+	// Detect an install broken by an interrupted update
+	u.wipeDir = ""
+	if dir, problems := u.corruptInstall(); dir != "" {
+		fmt.Fprintf(u.out, "The install at %s is broken: %s\n", dir, strings.Join(problems, ", "))
+		if u.opts.ReinstallIfCorrupt {
+			u.wipeDir = dir
+		} else {
+			fmt.Fprintln(u.out, "Run with -reinstall-if-corrupt to replace it with a clean install.")
+		}
 	}
-	fmt.Printf("Current version: %s\n", currentVersion)
 
-	// Get latest release
-	release, err := u.getLatestRelease()
-	if err != nil {
-		return fmt.Errorf("failed to get latest release: %w", err)
+	// Get latest release, or the staged one
+	var release *Release
+	if u.opts.ApplyStaged {
+		staged, err := u.loadStaged()
+		if err != nil {
+			return nil, fmt.Errorf("no valid staged update: %w", err)
+		}
+		u.staged = staged
+		release = &staged.Release
+	} else {
+		endFetch := u.startPhase("fetch-release")
+		latest, err := u.getLatestRelease(ctx)
+		endFetch()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get latest release: %w", err)
+		}
+		release = latest
 	}
 	u.release = release
 
-	newVersion := strings.TrimPrefix(release.TagName, "v")
-	fmt.Printf("Latest version: %s\n", newVersion)
+	newVersion := releaseVersion(release)
+	if u.staged != nil {
+		fmt.Fprintf(u.out, "Staged version: %s\n", newVersion)
+	} else {
+		fmt.Fprintf(u.out, "Latest version: %s\n", newVersion)
+	}
+	result.NewVersion = newVersion
+
+	// An install of this release cut short, possibly after the new
+	// version number was written, is finished regardless of the versions
+	u.resuming = u.interruptedInstall(u.extractDir())
+
+	// Compare versions. After a branch switch the new channel's release
+	// replaces the install even if its version is lower.
+	previousBranch, switched := u.channelChanged()
+	if fresh {
+		fmt.Fprintf(u.out, "Installing %s %s\n", config.BrowserName, newVersion)
+	} else if u.resuming {
+		fmt.Fprintf(u.out, "Resuming the interrupted update to %s\n", newVersion)
+	} else if u.wipeDir != "" {
+		fmt.Fprintf(u.out, "Reinstalling %s %s\n", config.BrowserName, newVersion)
+	} else if switched && !u.isSkipped(release) {
+		fmt.Fprintf(u.out, "Branch changed from %s to %s: %s -> %s\n", previousBranch, u.cfg.Branch, currentVersion, newVersion)
+	} else if !u.isNewerBuild(current, release) {
+		if previousBranch == "" {
+			u.rememberBranch()
+		}
+		if !u.opts.ForceReinstall {
+			fmt.Fprintln(u.out, "No new version available.")
+			return finish("No new version found")
+		}
+		fmt.Fprintf(u.out, "Forcing reinstall of version %s\n", newVersion)
+	} else if u.isSkipped(release) && !u.opts.ForceReinstall {
+		fmt.Fprintf(u.out, "Version %s is skipped, waiting for a newer one.\n", newVersion)
+		return finish(fmt.Sprintf("Skipped version %s", newVersion))
+	} else {
+		fmt.Fprintf(u.out, "New version available: %s -> %s\n", currentVersion, newVersion)
+	}
+
+	if u.opts.CheckOnly {
+		fmt.Fprintln(u.out, "Check-only mode, not installing.")
+		result.UpdateAvailable = true
+		return finish(fmt.Sprintf("Update to %s available", newVersion))
+	}
 
-	// Compare versions
-	if !u.isNewerVersion(currentVersion, newVersion) {
-		fmt.Println("No new version available.")
-		u.logResult("No new version found")
-		return nil
+	// Packaged installs are read-only and updated through their package
+	if dir := u.packagedInstallDir(fresh); dir != "" {
+		return nil, fmt.Errorf("%s in %s was installed from an MSIX/AppX package, which only the Microsoft Store or App Installer can update; "+
+			"install the setup or portable release instead to use this updater", config.BrowserName, dir)
 	}
 
-	fmt.Printf("New version available: %s -> %s\n", currentVersion, newVersion)
+	// Scheduled runs do not download on a low battery or a metered
+	// connection
+	if state, deferred := u.batteryDeferral(); deferred {
+		charge := "an unknown charge"
+		if state.Charge >= 0 {
+			charge = fmt.Sprintf("%d%%", state.Charge)
+		}
+		fmt.Fprintf(u.out, "Running on battery at %s, deferring the update to the next run.\n", charge)
+		result.UpdateAvailable = true
+		return finish(fmt.Sprintf("Update to %s deferred, on battery at %s", newVersion, charge))
+	}
 
-	if u.opts.CheckOnly {
-		fmt.Println("Check-only mode, not installing.")
-		return nil
+	if u.meteredDeferral() {
+		fmt.Fprintln(u.out, "The network connection is metered, deferring the update to the next run.")
+		result.UpdateAvailable = true
+		return finish(fmt.Sprintf("Update to %s deferred, the connection is metered", newVersion))
 	}
 
-	// Download and install
-	if err := u.downloadAndInstall(); err != nil {
-		return fmt.Errorf("update failed: %w", err)
+	// Staging only downloads, which is allowed at any time
+	if u.opts.Stage {
+		if err := u.stageUpdate(ctx); err != nil {
+			return nil, fmt.Errorf("staging failed: %w", err)
+		}
+		fmt.Fprintf(u.out, "Update to %s staged, install it with -apply-staged.\n", newVersion)
+		result.UpdateAvailable = true
+		return finish(fmt.Sprintf("Staged %s", newVersion))
 	}
 
-	fmt.Println("Update completed successfully!")
-	u.logResult(fmt.Sprintf("Updated from %s to %s", currentVersion, newVersion))
-	return nil
+	// Scheduled runs only install inside the maintenance window
+	if u.opts.Scheduled && !config.InMaintenanceWindow(u.cfg.MaintenanceWindows, clock()) {
+		next := config.NextMaintenanceWindow(u.cfg.MaintenanceWindows, clock()).Format("2006-01-02 15:04")
+		fmt.Fprintf(u.out, "Outside the maintenance window, deferring the update until %s.\n", next)
+		u.cfg.LogEntry("NextMaintenanceWindow", next)
+		result.UpdateAvailable = true
+		return finish(fmt.Sprintf("Update to %s deferred until %s", newVersion, next))
+	}
+
+	if u.opts.Confirm != nil && !u.opts.Confirm(currentVersion, newVersion) {
+		fmt.Fprintln(u.out, "Update cancelled.")
+		result.UpdateAvailable = true
+		return finish(fmt.Sprintf("Update to %s cancelled", newVersion))
+	}
+
+	// Download and install. A scheduled run leaves an update blocked by
+	// the running browser to the next run.
+	if err := u.downloadAndInstall(ctx); err != nil {
+		if errors.Is(err, errBrowserRunning) && u.opts.Scheduled {
+			fmt.Fprintln(u.out, "The browser is still running, deferring the update to the next run.")
+			result.UpdateAvailable = true
+			return finish(fmt.Sprintf("Update to %s deferred, the browser is running", newVersion))
+		}
+		return nil, fmt.Errorf("update failed: %w", err)
+	}
+	u.rememberBranch()
+	if u.staged != nil {
+		u.removeStaged()
+	}
+
+	endCheck := u.startPhase("post-check")
+	err := u.checkInstalledVersion(newVersion)
+	endCheck()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+	if u.cfg.VerifyByLaunch {
+		endLaunch := u.startPhase("launch-check")
+		launched, err := u.verifyByLaunch(newVersion)
+		endLaunch()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: launch check failed: %v\n", err)
+		} else {
+			fmt.Fprintf(u.out, "The browser reports version %s.\n", launched)
+		}
+	}
+	result.UpdateAvailable = true
+	result.Updated = true
+	result.Asset = u.asset
+	result.FlavorFallback = u.flavorFallback
+	result.RebootRequired = u.rebootRequired
+	result.InstallerLog = u.installerLog
+
+	var message string
+	if u.resuming {
+		fmt.Fprintln(u.out, "Update resumed and completed successfully!")
+		message = fmt.Sprintf("Resumed the interrupted update to %s", newVersion)
+	} else if u.wipeDir != "" {
+		fmt.Fprintln(u.out, "Reinstallation completed successfully!")
+		message = fmt.Sprintf("Reinstalled %s over a broken install", newVersion)
+	} else if fresh {
+		fmt.Fprintln(u.out, "Installation completed successfully!")
+		message = fmt.Sprintf("Installed %s", newVersion)
+	} else {
+		fmt.Fprintln(u.out, "Update completed successfully!")
+		message = fmt.Sprintf("Updated from %s to %s", currentVersion, newVersion)
+	}
+	if u.rebootRequired {
+		fmt.Fprintln(u.out)
+		fmt.Fprintln(u.out, "************************************************************")
+		fmt.Fprintln(u.out, "* A reboot is required to complete the update.             *")
+		fmt.Fprintln(u.out, "************************************************************")
+	}
+	return finish(message)
+}
+
+// RebootRequired reports whether the last installation needs a reboot
+// to complete
+func (u *Updater) RebootRequired() bool {
+	return u.rebootRequired
+}
+
+// packagedInstallDir returns the folder of an installed browser that came
+// from an MSIX/AppX package, or an empty string. Portable updates and
+// fresh installs do not touch it.
+func (u *Updater) packagedInstallDir(fresh bool) string {
+	if fresh || u.isPortable() {
+		return ""
+	}
+	browserPath := u.cfg.GetBrowserPath()
+	if !config.PackagedInstall(browserPath) {
+		return ""
+	}
+	return filepath.Dir(browserPath)
+}
+
+// workDirRedirect returns the directory used instead of WorkDir when it is
+// the updater's own directory and the install is not portable, or an empty
+// string if WorkDir is used. An updater installed next to the browser, e.g.
+// in Program Files, often cannot write there, and the extracted files would
+// collide with the install.
+func (u *Updater) workDirRedirect() string {
+	if !u.cfg.RedirectWorkDir || u.isPortable() {
+		return ""
+	}
+	if !strings.EqualFold(filepath.Clean(u.cfg.WorkDir), filepath.Clean(u.cfg.ExeDir)) {
+		return ""
+	}
+	return os.TempDir()
+}
+
+// prepareWorkDir creates the working directory if it is missing and
+// verifies that files can be written to it
+func (u *Updater) prepareWorkDir() error {
+	if err := os.MkdirAll(u.cfg.WorkDir, 0755); err != nil {
+		return err
+	}
+	return checkWritable(u.cfg.WorkDir)
 }
 
 // checkConnection verifies we can reach the API
-func (u *Updater) checkConnection() error {
-	resp, err := u.client.Get(config.ConnectCheckURL)
+func (u *Updater) checkConnection(ctx context.Context) error {
+	req, err := u.newRequest(ctx, "GET", u.checkURL)
+	if err != nil {
+		return err
+	}
+
+	resp, err := u.do(req)
 	if err != nil {
 		return err
 	}
@@ -130,320 +531,443 @@ func (u *Updater) checkConnection() error {
 	return nil
 }
 
-// getCurrentVersion gets the current installed version
-func (u *Updater) getCurrentVersion() (string, error) {
-	browserPath := u.cfg.GetBrowserPath()
-	if browserPath == "" {
-		return "", fmt.Errorf("browser not found")
-	}
-
-	// For Windows, we would read the file version info
-	// For now, we'll try to find an application.ini or version file
-	browserDir := filepath.Dir(browserPath)
-	
-	// Try application.ini
-	appIniPath := filepath.Join(browserDir, "application.ini")
-	if data, err := os.ReadFile(appIniPath); err == nil {
-		re := regexp.MustCompile(`(?m)^Version=(.+)$`)
-		matches := re.FindStringSubmatch(string(data))
-		if len(matches) > 1 {
-			return strings.TrimSpace(matches[1]), nil
+// getLatestRelease fetches the latest release from GitHub. With
+// AllowHTMLFallback, the release web pages are tried if the API fails. On
+// the stable branch, a latest release excluded by StableExcludePatterns is
+// passed over for the newest one that is not.
+func (u *Updater) getLatestRelease(ctx context.Context) (*Release, error) {
+	release, err := u.getLatestReleaseFromAPI(ctx)
+	if err != nil && u.cfg.AllowHTMLFallback {
+		fmt.Fprintf(os.Stderr, "Warning: release API failed, reading the release pages instead: %v\n", err)
+		var webErr error
+		release, webErr = u.getLatestReleaseFromWeb(ctx)
+		if webErr != nil {
+			return nil, fmt.Errorf("%w (release pages: %v)", err, webErr)
 		}
+		err = nil
 	}
-
-	// Try version file
-	versionPath := filepath.Join(browserDir, "version")
-	if data, err := os.ReadFile(versionPath); err == nil {
-		return strings.TrimSpace(string(data)), nil
+	if err != nil {
+		return nil, err
 	}
 
-	return "", fmt.Errorf("could not determine version")
+	if u.cfg.ExcludedFromStable(release.TagName) {
+		fmt.Fprintf(os.Stderr, "Note: release %s is excluded from the stable branch, looking for an earlier one.\n", release.TagName)
+		u.releaseBody = nil
+		return u.latestStableRelease(ctx)
+	}
+	return release, nil
 }
 
-// getLatestRelease fetches the latest release from GitHub
-func (u *Updater) getLatestRelease() (*Release, error) {
-	url := config.ReleaseAPIURL + "/latest"
-	
-	req, err := http.NewRequest("GET", url, nil)
+// getLatestReleaseFromAPI fetches the latest release from the GitHub API
+func (u *Updater) getLatestReleaseFromAPI(ctx context.Context) (*Release, error) {
+	url := u.apiURL + "/latest"
+
+	req, err := u.newRequest(ctx, "GET", url)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "Noraneko-WinUpdater/"+u.opts.Version)
 
-	resp, err := u.client.Do(req)
+	etag, cached := u.cachedRelease(url)
+	if cached != nil {
+		req.Header.Set("If-None-Match", etag)
+	}
+	u.releaseRequest, u.releaseBody = req, nil
+
+	resp, err := u.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
 	}
 
 	var release Release
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+	if err := json.Unmarshal(body, &release); err != nil {
 		return nil, fmt.Errorf("failed to decode release info: %w", err)
 	}
+	u.releaseBody = body
+
+	if err := u.saveReleaseCache(url, resp.Header.Get("ETag"), body); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to cache release info: %v\n", err)
+	}
 
 	return &release, nil
 }
 
-// isNewerVersion compares two version strings using semantic versioning
-func (u *Updater) isNewerVersion(current, latest string) bool {
-	current = strings.TrimPrefix(current, "v")
-	latest = strings.TrimPrefix(latest, "v")
-
-	if current == "" || current == "0.0.0" {
-		return true
-	}
-
-	if latest == current {
-		return false
+// downloadAndInstall downloads and installs the update, or installs the
+// staged one
+func (u *Updater) downloadAndInstall(ctx context.Context) (err error) {
+	// Find the appropriate asset
+	var asset *Asset
+	if u.staged != nil {
+		asset = u.staged.asset()
+	} else if asset, err = u.selectAsset(ctx); err != nil {
+		return err
 	}
+	u.asset = asset
 
-	// Parse versions into parts
-	currentParts := parseVersion(current)
-	latestParts := parseVersion(latest)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// Compare each part
-	maxLen := len(currentParts)
-	if len(latestParts) > maxLen {
-		maxLen = len(latestParts)
-	}
+	// Download to temp directory, or copy the staged download there so a
+	// failed install leaves it staged
+	downloadPath := filepath.Join(u.cfg.WorkDir, asset.Name)
+	defer func() { u.removeTemp(err, downloadPath) }()
 
-	for i := 0; i < maxLen; i++ {
-		var cp, lp int
-		if i < len(currentParts) {
-			cp = currentParts[i]
+	if u.staged != nil {
+		fmt.Fprintf(u.out, "Using staged download of %s.\n", asset.Name)
+		if err := u.copyFile(ctx, filepath.Join(u.stagingDir(), asset.Name), downloadPath, nil); err != nil {
+			return fmt.Errorf("failed to copy staged download: %w", err)
 		}
-		if i < len(latestParts) {
-			lp = latestParts[i]
+	} else {
+		var checksumPath string
+		checksumPath, err = u.fetchAsset(ctx, downloadPath)
+		if checksumPath != "" {
+			defer func() { u.removeTemp(err, checksumPath) }()
 		}
-
-		if lp > cp {
-			return true
-		} else if lp < cp {
-			return false
+		if err != nil {
+			return err
 		}
 	}
+	if err := u.verifyDownload(ctx, downloadPath); err != nil {
+		return err
+	}
 
-	return false
+	// Install or extract. In portable mode the asset is only an installer
+	// after a flavor fallback or if it was named with -asset.
+	browserPath := u.cfg.GetBrowserPath()
+	isArchive := archiveFormat(asset.Name) != ""
+	if isArchive {
+		browserPath = filepath.Join(u.extractDir(), u.cfg.BrowserExeName())
+	}
+	if err := u.waitForBrowserClose(ctx, browserPath); err != nil {
+		return err
+	}
+	if isArchive {
+		fmt.Fprintln(u.out, "Extracting...")
+		return u.extractPortable(ctx, downloadPath)
+	}
+
+	fmt.Fprintln(u.out, "Installing...")
+	if err := u.simulateFailure(PhaseInstall); err != nil {
+		return err
+	}
+	if err := u.removeBrokenInstall(); err != nil {
+		return err
+	}
+	endInstall := u.startPhase("install")
+	rebootRequired, err := u.runInstaller(downloadPath)
+	endInstall()
+	if err != nil {
+		return err
+	}
+	u.rebootRequired = rebootRequired
+	u.removeJournal()
+
+	// Record the installed files for later verification
+	if browserPath := u.cfg.GetBrowserPath(); browserPath != "" {
+		if err := u.writeManifest(filepath.Dir(browserPath)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to write install manifest: %v\n", err)
+		}
+	}
+	return nil
 }
 
-// parseVersion parses a version string into integer parts
-func parseVersion(v string) []int {
-	// Remove any prerelease suffix (e.g., -beta, -alpha, -nightly)
-	if idx := strings.IndexAny(v, "-+"); idx != -1 {
-		v = v[:idx]
+// selectAsset finds the download asset of the release, see findAsset
+func (u *Updater) selectAsset(ctx context.Context) (*Asset, error) {
+	asset, err := u.findAssetWithRetry(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find download: %w", err)
+	}
+	if u.flavorFallback {
+		fmt.Fprintf(os.Stderr, "Warning: release has no portable asset, installing %s instead\n", asset.Name)
 	}
+	return asset, nil
+}
 
-	parts := strings.Split(v, ".")
-	result := make([]int, 0, len(parts))
+// fetchAsset places the asset at downloadPath, reusing the download of an
+// earlier run that verified this release's asset if its file is still
+// there. It returns the path of the checksum file for cleanup, see
+// download.
+func (u *Updater) fetchAsset(ctx context.Context, downloadPath string) (string, error) {
+	if u.reuseVerifiedDownload(ctx, downloadPath) {
+		fmt.Fprintf(u.out, "Reusing verified download of %s.\n", u.asset.Name)
+		return "", nil
+	}
+	return u.download(ctx, downloadPath)
+}
 
-	for _, p := range parts {
-		// Extract only the numeric prefix
-		numStr := ""
-		for _, c := range p {
-			if c >= '0' && c <= '9' {
-				numStr += string(c)
-			} else {
-				break
-			}
+// verifyDownload checks the build provenance, the cosign signature and the
+// installer's signing certificate of a download, as configured. A staged
+// download is checked again against the attestations and signatures kept
+// when it was staged.
+func (u *Updater) verifyDownload(ctx context.Context, downloadPath string) error {
+	if u.cfg.VerifyAttestation {
+		fmt.Fprintln(u.out, "Verifying attestation...")
+		if err := u.verifyAttestation(ctx, downloadPath); err != nil {
+			return fmt.Errorf("attestation verification failed: %w", err)
 		}
-		if numStr != "" {
-			var num int
-			fmt.Sscanf(numStr, "%d", &num)
-			result = append(result, num)
+		fmt.Fprintln(u.out, "Attestation verified.")
+	}
+	if u.cfg.VerifyCosign {
+		fmt.Fprintln(u.out, "Verifying cosign signature...")
+		if err := u.verifyCosign(ctx, downloadPath); err != nil {
+			return fmt.Errorf("cosign verification failed: %w", err)
 		}
+		fmt.Fprintln(u.out, "Cosign signature verified.")
 	}
 
-	return result
+	isArchive := archiveFormat(u.asset.Name) != ""
+	if !isArchive && (u.cfg.CheckCertExpiry || u.cfg.RequireValidCert) {
+		if err := u.checkCertExpiry(downloadPath); err != nil {
+			return fmt.Errorf("signing certificate check failed: %w", err)
+		}
+	}
+	return nil
 }
 
-// downloadAndInstall downloads and installs the update
-func (u *Updater) downloadAndInstall() error {
-	// Find the appropriate asset
-	asset, err := u.findAsset()
-	if err != nil {
-		return fmt.Errorf("failed to find download: %w", err)
+// download fetches the release asset to downloadPath and verifies it
+// against the release's checksum file, if any. It returns the path of the
+// checksum file for cleanup, or an empty string if there is none.
+func (u *Updater) download(ctx context.Context, downloadPath string) (string, error) {
+	asset := u.asset
+	fmt.Fprintf(u.out, "Downloading %s...\n", asset.Name)
+	endDownload := u.startPhase("download")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Fetch the checksum file, if available, alongside the asset
+	var (
+		wg           sync.WaitGroup
+		checksumPath string
+		checksumErr  error
+	)
+	checksumAsset := u.findChecksumAsset()
+	if checksumAsset != nil {
+		checksumPath = filepath.Join(u.cfg.WorkDir, checksumAsset.Name)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checksumErr = u.downloadChecksum(ctx, checksumAsset, checksumPath)
+		}()
 	}
 
-	fmt.Printf("Downloading %s...\n", asset.Name)
+	// Reuse or store a cached copy with the expected digest, which needs
+	// the checksum file first
+	downloader := u.newDownloader(asset.Size, u.opts.Progress)
+	if u.cfg.CacheDir != "" && checksumAsset != nil {
+		wg.Wait()
+		if checksumErr == nil {
+			if digest, err := expectedChecksum(checksumPath, asset.Name); err == nil {
+				downloader.useCache(digest)
+			}
+		}
+	}
 
-	// Download to temp directory
-	downloadPath := filepath.Join(u.cfg.WorkDir, asset.Name)
-	if err := u.downloadFile(asset.BrowserDownloadURL, downloadPath); err != nil {
-		return fmt.Errorf("download failed: %w", err)
+	cached, err := downloader.Download(ctx, asset.BrowserDownloadURL, downloadPath)
+	if cached {
+		fmt.Fprintln(u.out, "Using cached download.")
+	}
+	if err == nil {
+		err = checkMagic(downloadPath, asset.Name)
+	}
+	if err == nil {
+		err = u.simulateFailure(PhaseDownload)
+	}
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	endDownload()
+	if err != nil {
+		return checksumPath, fmt.Errorf("download failed: %w", err)
 	}
-	defer os.Remove(downloadPath)
 
 	// Verify checksum if available
-	if checksumAsset := u.findChecksumAsset(); checksumAsset != nil {
-		fmt.Println("Verifying checksum...")
-		if err := u.verifyChecksum(downloadPath, checksumAsset, asset.Name); err != nil {
-			return fmt.Errorf("checksum verification failed: %w", err)
+	if err := u.simulateFailure(PhaseChecksum); err != nil {
+		return checksumPath, fmt.Errorf("checksum verification failed: %w", err)
+	}
+	if checksumAsset != nil && checksumErr != nil {
+		if !u.cfg.ChecksumOptional {
+			return checksumPath, fmt.Errorf("checksum verification failed: failed to download checksum file: %w", checksumErr)
 		}
-		fmt.Println("Checksum verified.")
+		fmt.Fprintf(os.Stderr, "Warning: failed to download checksum file, installing without checksum verification (ChecksumOptional): %v\n", checksumErr)
+		checksumAsset = nil
 	}
-
-	// Install or extract
-	isPortable := u.cfg.IsPortable() || u.opts.Portable
-	if isPortable || strings.HasSuffix(asset.Name, ".zip") {
-		fmt.Println("Extracting...")
-		return u.extractPortable(downloadPath)
+	if checksumAsset != nil {
+		fmt.Fprintln(u.out, "Verifying checksum...")
+		endVerify := u.startPhase("verify")
+		err := u.verifyChecksum(downloadPath, checksumPath, asset.Name)
+		endVerify()
+		if err != nil {
+			return checksumPath, fmt.Errorf("checksum verification failed: %w", err)
+		}
+		fmt.Fprintln(u.out, "Checksum verified.")
+		u.recordVerifiedDownload(downloadPath, checksumPath)
 	}
-
-	fmt.Println("Installing...")
-	return u.runInstaller(downloadPath)
+	return checksumPath, nil
 }
 
-// findAsset finds the appropriate download asset for this platform
-func (u *Updater) findAsset() (*Asset, error) {
-	// Determine what we're looking for
-	isPortable := u.cfg.IsPortable() || u.opts.Portable
-	arch := "x86_64"
-	if runtime.GOARCH == "386" {
-		arch = "i686"
+// checkInstalledVersion reports an error if the install does not report
+// the version that was just installed. Installers may finish writing the
+// version files after they exit, so the check is retried
+// PostInstallRetries times, PostInstallWait seconds apart. Releases whose
+// tag holds no version, such as nightly-20240501, cannot be compared: the
+// install only has to report a version, and is read once.
+func (u *Updater) checkInstalledVersion(version string) error {
+	want := normalizeVersion(version)
+	comparable := versionNumberRe.MatchString(want)
+	retries := u.cfg.PostInstallRetries
+	if !comparable {
+		retries = 0
 	}
 
-	var suffix string
-	if isPortable {
-		suffix = fmt.Sprintf("windows-%s-portable.zip", arch)
-	} else {
-		suffix = fmt.Sprintf("windows-%s-setup.exe", arch)
+	var (
+		build *installedBuild
+		err   error
+	)
+	for attempt := 0; ; attempt++ {
+		build, err = u.getInstalledBuild()
+		if err == nil && (build.Version == want || !comparable) {
+			return nil
+		}
+		if attempt >= retries {
+			break
+		}
+		sleep(time.Duration(u.cfg.PostInstallWait) * time.Second)
 	}
 
-	// Also try alternative naming patterns
-	suffixes := []string{
-		suffix,
-		fmt.Sprintf("win64.zip"),
-		fmt.Sprintf("win64-setup.exe"),
-		fmt.Sprintf("windows.zip"),
-		fmt.Sprintf("windows-setup.exe"),
+	if err != nil {
+		return fmt.Errorf("could not read the installed version: %w", err)
 	}
+	return fmt.Errorf("installed version is %s, expected %s", build.Version, want)
+}
 
-	for _, asset := range u.release.Assets {
-		name := strings.ToLower(asset.Name)
-		for _, s := range suffixes {
-			if strings.Contains(name, strings.ToLower(s)) || strings.HasSuffix(name, strings.ToLower(s)) {
-				return &asset, nil
-			}
+// removeTemp removes temporary files after an install attempt. With
+// KeepTempOnError they are kept if the attempt failed, and their paths are
+// printed and logged for inspection. Files of a run aborted by
+// MaxRunDuration or a service stop are partial and always removed.
+func (u *Updater) removeTemp(failed error, paths ...string) {
+	aborted := errors.Is(failed, context.DeadlineExceeded) || errors.Is(failed, context.Canceled)
+	if failed == nil || !u.cfg.KeepTempOnError || aborted {
+		for _, p := range paths {
+			os.RemoveAll(p)
 		}
+		return
 	}
 
-	// If no specific match, look for any Windows executable or zip
-	for _, asset := range u.release.Assets {
-		name := strings.ToLower(asset.Name)
-		if (strings.Contains(name, "windows") || strings.Contains(name, "win")) &&
-			(strings.HasSuffix(name, ".exe") || strings.HasSuffix(name, ".zip")) {
-			return &asset, nil
-		}
+	for _, p := range paths {
+		fmt.Fprintf(os.Stderr, "Keeping %s for inspection\n", p)
 	}
-
-	return nil, fmt.Errorf("no suitable download found for this platform")
+	u.keptTemp = append(u.keptTemp, paths...)
+	u.cfg.LogEntry("KeptTempFiles", strings.Join(u.keptTemp, ";"))
 }
 
-// findChecksumAsset finds the checksum file asset
+// findChecksumAsset finds the checksum file asset: a SHA256 list, possibly
+// gzip compressed, or a JSON checksum manifest. Signatures of checksum
+// files are skipped.
 func (u *Updater) findChecksumAsset() *Asset {
 	for _, asset := range u.release.Assets {
 		name := strings.ToLower(asset.Name)
-		if strings.Contains(name, "sha256") || strings.HasSuffix(name, ".sha256") {
+		if isSignatureName(name) {
+			continue
+		}
+		if strings.Contains(name, "sha256") || strings.Contains(name, "checksum") {
 			return &asset
 		}
 	}
 	return nil
 }
 
-// downloadFile downloads a file from URL to local path
-func (u *Updater) downloadFile(url, filepath string) error {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("User-Agent", "Noraneko-WinUpdater/"+u.opts.Version)
-
-	resp, err := u.client.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// assetMagic lists the leading bytes every asset of a file type starts with
+var assetMagic = map[string][]byte{
+	".zip": []byte("PK\x03\x04"),
+	".7z":  sevenZipSignature,
+	".gz":  {0x1F, 0x8B},
+	".tgz": {0x1F, 0x8B},
+	".exe": []byte("MZ"),
+	".msi": {0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1},
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download returned status %d", resp.StatusCode)
+// checkMagic verifies that a downloaded asset starts with the magic bytes of
+// its file type, catching error pages saved in place of the asset even
+// when there is no checksum. Other file types are not checked.
+func checkMagic(path, name string) error {
+	magic, ok := assetMagic[strings.ToLower(filepath.Ext(name))]
+	if !ok {
+		return nil
 	}
 
-	out, err := os.Create(filepath)
+	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
-}
+	defer file.Close()
 
-// verifyChecksum verifies the file checksum
-func (u *Updater) verifyChecksum(filePath string, checksumAsset *Asset, fileName string) error {
-	// Download checksum file
-	checksumPath := filepath.Join(u.cfg.WorkDir, checksumAsset.Name)
-	if err := u.downloadFile(checksumAsset.BrowserDownloadURL, checksumPath); err != nil {
-		return fmt.Errorf("failed to download checksum file: %w", err)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
 	}
-	defer os.Remove(checksumPath)
+	head = head[:n]
 
-	// Read checksum file
-	data, err := os.ReadFile(checksumPath)
-	if err != nil {
-		return fmt.Errorf("failed to read checksum file: %w", err)
-	}
-
-	// Find the checksum for our file
-	expectedHash := ""
-	lines := strings.Split(string(data), "\n")
-	for _, line := range lines {
-		parts := strings.Fields(line)
-		if len(parts) >= 2 {
-			hash := parts[0]
-			name := strings.TrimPrefix(parts[1], "*")
-			if strings.EqualFold(name, fileName) || strings.HasSuffix(name, fileName) {
-				expectedHash = strings.ToLower(hash)
-				break
-			}
-		}
+	if bytes.HasPrefix(head, magic) {
+		return nil
 	}
-
-	if expectedHash == "" {
-		return fmt.Errorf("checksum for %s not found in checksum file", fileName)
+	if trimmed := bytes.TrimSpace(head); bytes.HasPrefix(trimmed, []byte("<")) {
+		return fmt.Errorf("%s is not a %s file but looks like an HTML page, possibly from a proxy or captive portal", name, filepath.Ext(name))
 	}
+	return fmt.Errorf("%s is not a valid %s file", name, filepath.Ext(name))
+}
 
-	// Calculate actual hash
-	file, err := os.Open(filePath)
+// verifyChecksum verifies the file checksum against the downloaded
+// checksum file
+func (u *Updater) verifyChecksum(filePath, checksumPath, fileName string) error {
+	expectedHash, err := expectedChecksum(checksumPath, fileName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(hasher, file); err != nil {
-		return err
-	}
+	return (&Downloader{SHA256: expectedHash}).Verify(filePath)
+}
 
-	actualHash := hex.EncodeToString(hasher.Sum(nil))
-	if actualHash != expectedHash {
-		return fmt.Errorf("checksum mismatch: expected %s, got %s", expectedHash, actualHash)
-	}
+// isFreshInstall reports whether no browser install was found at all, so
+// the update is a first install rather than an upgrade
+func (u *Updater) isFreshInstall() bool {
+	return u.cfg.GetBrowserPath() == ""
+}
 
-	return nil
+// isPortable reports whether the install is treated as portable. The
+// -portable flag is authoritative, even before a portable layout exists.
+func (u *Updater) isPortable() bool {
+	return u.opts.Portable || u.cfg.IsPortable()
 }
 
-// extractPortable extracts a portable zip archive
-func (u *Updater) extractPortable(zipPath string) error {
-	browserDir := filepath.Dir(u.cfg.GetBrowserPath())
-	if browserDir == "" {
-		browserDir = filepath.Join(u.cfg.ExeDir, config.BrowserName)
+// extractDir returns the directory a zip release is extracted to. Upgrades
+// replace the existing install, fresh installs go to Program Files unless
+// a portable layout is wanted.
+func (u *Updater) extractDir() string {
+	if u.opts.Portable || (u.isFreshInstall() && u.cfg.IsPortable()) {
+		return filepath.Join(u.cfg.ExeDir, config.BrowserName)
 	}
+	return u.installDir()
+}
+
+// extractPortable extracts a portable archive
+func (u *Updater) extractPortable(ctx context.Context, archivePath string) (err error) {
+	browserDir := u.extractDir()
 
 	// Create extract directory
 	extractDir := filepath.Join(u.cfg.WorkDir, config.BrowserName+"-Extracted")
@@ -453,36 +977,101 @@ func (u *Updater) extractPortable(zipPath string) error {
 	if err := os.MkdirAll(extractDir, 0755); err != nil {
 		return fmt.Errorf("failed to create extract directory: %w", err)
 	}
-	defer os.RemoveAll(extractDir)
+	defer func() { u.removeTemp(err, extractDir) }()
 
-	// Extract zip
-	if err := u.unzip(zipPath, extractDir); err != nil {
+	// Extract the archive
+	endExtract := u.startPhase("extract")
+	err = u.extractArchive(archivePath, extractDir)
+	endExtract()
+	if err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+	if err := u.simulateFailure(PhaseExtract); err != nil {
 		return fmt.Errorf("extraction failed: %w", err)
 	}
 
 	// Find the browser folder in the extracted content
-	entries, err := os.ReadDir(extractDir)
+	sourceDir, err := u.archiveSourceDir(extractDir)
 	if err != nil {
 		return err
 	}
 
-	sourceDir := extractDir
-	for _, entry := range entries {
-		if entry.IsDir() {
-			// Use the first directory as the source
-			sourceDir = filepath.Join(extractDir, entry.Name())
-			break
+	// The digests of the new files let an interrupted copy be resumed
+	// and become the install manifest
+	source, err := hashTree(sourceDir, u.cfg.VerifyConcurrency)
+	if err != nil {
+		return fmt.Errorf("failed to hash the extracted files: %w", err)
+	}
+
+	// Keep the previous install for -rollback. A broken install is
+	// removed instead. Both were done before an interrupted install, which
+	// continues with the files it copied intact.
+	done, resumed := u.resumeJournal(browserDir, source)
+	if resumed {
+		fmt.Fprintf(u.out, "Resuming the interrupted install: %d of %d files are already in place.\n", len(done), len(source))
+	} else if u.wipeDir != "" {
+		if err := u.removeBrokenInstall(); err != nil {
+			return err
 		}
+	} else if err := u.backupInstall(ctx, browserDir); err != nil {
+		return fmt.Errorf("failed to back up the current install: %w", err)
 	}
 
-	// Copy files to browser directory
-	if err := u.copyDir(sourceDir, browserDir); err != nil {
+	// Copy files to browser directory, recording each in the journal
+	if err := u.simulateFailure(PhaseInstall); err != nil {
+		return fmt.Errorf("failed to copy files: %w", err)
+	}
+	sentinels := u.sentinelManifest(browserDir, source)
+	u.journal, err = u.createJournal(browserDir, source, done)
+	if err != nil {
+		return fmt.Errorf("failed to create install journal: %w", err)
+	}
+	// The copy is not cancelled with the run: stopping half way would
+	// leave a mix of both versions that only the next run can repair
+	install := context.WithoutCancel(ctx)
+	endInstall := u.startPhase("install")
+	err = u.copyDir(install, sourceDir, browserDir, u.opts.InstallProgress)
+	endInstall()
+	u.journal.close()
+	u.journal = nil
+	if err != nil {
 		return fmt.Errorf("failed to copy files: %w", err)
 	}
 
+	// A file that does not match keeps the journal, so the next run
+	// copies it again
+	if err := u.checkSentinels(browserDir, sentinels); err != nil {
+		return fmt.Errorf("post-install check failed: %w", err)
+	}
+	u.removeJournal()
+
+	// Record the installed files for later verification
+	if err := u.saveManifest(source); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write install manifest: %v\n", err)
+	}
+
+	// Mark a newly created portable layout so later runs detect it
+	if u.opts.Portable && !u.cfg.IsPortable() {
+		if err := u.createPortableMarker(install); err != nil {
+			return fmt.Errorf("failed to create portable marker: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// createPortableMarker creates the portable launcher marker. The bundled
+// launcher is used if the archive shipped one, otherwise an empty marker
+// file is written.
+func (u *Updater) createPortableMarker(ctx context.Context) error {
+	marker := u.cfg.PortableMarkerPath()
+	launcher := filepath.Join(u.cfg.ExeDir, config.BrowserName, filepath.Base(marker))
+	if _, err := os.Stat(launcher); err == nil {
+		return u.copyFile(ctx, launcher, marker, nil)
+	}
+	return os.WriteFile(marker, nil, 0644)
+}
+
 // unzip extracts a zip archive
 func (u *Updater) unzip(src, dest string) error {
 	r, err := zip.OpenReader(src)
@@ -491,46 +1080,21 @@ func (u *Updater) unzip(src, dest string) error {
 	}
 	defer r.Close()
 
-	// Clean and normalize the destination path
-	dest = filepath.Clean(dest)
-
+	w := newArchiveWriter(dest)
 	for _, f := range r.File {
-		// Clean the file name from the zip to prevent path traversal
-		cleanName := filepath.Clean(f.Name)
-		if strings.HasPrefix(cleanName, "..") || filepath.IsAbs(cleanName) {
-			return fmt.Errorf("illegal file path in archive: %s", f.Name)
-		}
-
-		// Prevent ZipSlip vulnerability
-		fpath := filepath.Join(dest, cleanName)
-		if !strings.HasPrefix(filepath.Clean(fpath), dest+string(os.PathSeparator)) && filepath.Clean(fpath) != dest {
-			return fmt.Errorf("illegal file path: %s", fpath)
-		}
-
 		if f.FileInfo().IsDir() {
-			os.MkdirAll(fpath, os.ModePerm)
+			if err := w.dir(f.Name); err != nil {
+				return err
+			}
 			continue
 		}
 
-		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return err
-		}
-
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return err
-		}
-
 		rc, err := f.Open()
 		if err != nil {
-			outFile.Close()
 			return err
 		}
-
-		_, err = io.Copy(outFile, rc)
-		outFile.Close()
+		err = w.file(f.Name, f.Mode(), int64(f.UncompressedSize64), rc)
 		rc.Close()
-
 		if err != nil {
 			return err
 		}
@@ -539,75 +1103,202 @@ func (u *Updater) unzip(src, dest string) error {
 	return nil
 }
 
-// copyDir recursively copies a directory
-func (u *Updater) copyDir(src, dst string) error {
+// copyChunkSize is the number of bytes copyFile copies between checks
+// for cancellation
+const copyChunkSize = 1 << 20
+
+// copyDir recursively copies a directory. progress, if not nil, receives
+// the bytes copied so far out of all files that are copied.
+func (u *Updater) copyDir(ctx context.Context, src, dst string, progress ProgressFunc) error {
+	src, dst = longPath(src), longPath(dst)
+
+	// Size up the files to copy for the progress total
+	var total int64
+	if progress != nil {
+		err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			relPath, err := filepath.Rel(src, path)
+			if err != nil {
+				return err
+			}
+			if !u.keepExisting(relPath, longPath(filepath.Join(dst, relPath))) && !u.journal.completed(relPath) {
+				total += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var copied int64
 	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		relPath, err := filepath.Rel(src, path)
 		if err != nil {
 			return err
 		}
-		dstPath := filepath.Join(dst, relPath)
+		// Nested files may exceed MAX_PATH below roots that do not, so
+		// both paths are given the long path prefix
+		path, dstPath := longPath(path), longPath(filepath.Join(dst, relPath))
 
 		if info.IsDir() {
 			return os.MkdirAll(dstPath, info.Mode())
 		}
 
-		return u.copyFile(path, dstPath)
+		if u.keepExisting(relPath, dstPath) || u.journal.completed(relPath) {
+			return nil
+		}
+
+		var fileProgress ProgressFunc
+		if progress != nil {
+			fileProgress = func(done, _ int64) { progress(copied+done, total) }
+		}
+		if err := u.copyFile(ctx, path, dstPath, fileProgress); err != nil {
+			return err
+		}
+		copied += info.Size()
+		return u.journal.record(relPath)
 	})
 }
 
-// copyFile copies a single file
-func (u *Updater) copyFile(src, dst string) error {
+// keepExisting reports whether the OverwritePolicy keeps the file already
+// installed at dstPath. relPath is the file's path within the install.
+func (u *Updater) keepExisting(relPath, dstPath string) bool {
+	if _, err := os.Stat(dstPath); err != nil {
+		return false
+	}
+
+	switch u.cfg.OverwritePolicy {
+	case config.OverwriteSkipExisting:
+		return true
+	case config.OverwriteSkipListed:
+		return isPreserved(relPath, u.cfg.PreserveFiles)
+	default:
+		return false
+	}
+}
+
+// isPreserved reports whether relPath or one of its parent directories
+// matches a PreserveFiles pattern. Matching is case-insensitive and uses
+// forward slashes.
+func isPreserved(relPath string, patterns []string) bool {
+	name := strings.ToLower(filepath.ToSlash(relPath))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(filepath.ToSlash(pattern))
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyFileOnce copies a single file in chunks of copyChunkSize, stopping
+// with the context's error if it is cancelled between chunks. progress, if
+// not nil, receives the bytes of this file copied so far. The file is
+// copied next to dst and renamed over it once complete, so a cancelled
+// copy leaves the installed file as it was.
+func (u *Updater) copyFileOnce(ctx context.Context, src, dst string, progress ProgressFunc) (err error) {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
+	info, err := sourceFile.Stat()
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
-
-	_, err = io.Copy(destFile, sourceFile)
-	return err
-}
 
-// runInstaller runs the setup executable
-func (u *Updater) runInstaller(setupPath string) error {
-	browserDir := filepath.Dir(u.cfg.GetBrowserPath())
-	if browserDir == "" {
-		browserDir = filepath.Join(os.Getenv("ProgramFiles"), config.BrowserName)
+	destFile, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".partial-*")
+	if err != nil {
+		return err
 	}
+	defer func() {
+		if cerr := destFile.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chmod(destFile.Name(), info.Mode().Perm())
+		}
+		if err == nil {
+			err = os.Rename(destFile.Name(), dst)
+		}
+		if err != nil {
+			os.Remove(destFile.Name())
+		}
+	}()
 
-	// Run silent installation
-	cmd := exec.Command(setupPath, "/S", "/D="+browserDir)
-	if err := cmd.Run(); err != nil {
-		// Try interactive installation
-		fmt.Println("Silent installation failed, running interactive installer...")
-		cmd = exec.Command(setupPath, "/D="+browserDir)
-		return cmd.Run()
-	}
+	var done int64
+	buf := make([]byte, copyChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-	return nil
+		n, rerr := sourceFile.Read(buf)
+		if n > 0 {
+			if _, err := destFile.Write(buf[:n]); err != nil {
+				return err
+			}
+			done += int64(n)
+			if progress != nil {
+				progress(done, info.Size())
+			}
+		}
+		if rerr == io.EOF {
+			return nil
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
 }
 
-// HandleScheduledTask creates or removes a scheduled task
+// HandleScheduledTask creates or removes a scheduled task and records in
+// the ScheduledTask setting whether one should exist
 func (u *Updater) HandleScheduledTask() error {
-	var scriptName string
+	var scriptName, want string
 	if u.opts.CreateTask {
-		scriptName = "ScheduledTask-Create.ps1"
+		scriptName, want = "ScheduledTask-Create.ps1", "1"
 	} else if u.opts.RemoveTask {
-		scriptName = "ScheduledTask-Remove.ps1"
+		scriptName, want = "ScheduledTask-Remove.ps1", "0"
 	} else {
 		return nil
 	}
 
+	// A policy may require or forbid the task
+	enforced := u.cfg.Enforced("ScheduledTask")
+	if enforced && u.cfg.ScheduledTask != u.opts.CreateTask {
+		return fmt.Errorf("ScheduledTask is enforced by policy")
+	}
+
+	if err := u.runTaskScript(scriptName); err != nil {
+		return err
+	}
+	if enforced {
+		return nil
+	}
+	if err := u.cfg.SetSetting("ScheduledTask", want); err != nil {
+		return err
+	}
+	u.cfg.ScheduledTask = u.opts.CreateTask
+	return nil
+}
+
+// runTaskScript runs one of the scheduled task scripts shipped next to the
+// updater
+func (u *Updater) runTaskScript(scriptName string) error {
 	scriptPath := filepath.Join(u.cfg.ExeDir, scriptName)
 	if _, err := os.Stat(scriptPath); os.IsNotExist(err) {
 		return fmt.Errorf("scheduled task script not found: %s", scriptPath)
@@ -624,4 +1315,9 @@ func (u *Updater) logResult(result string) {
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	u.cfg.LogEntry("LastRun", timestamp)
 	u.cfg.LogEntry("LastResult", result)
+	if u.rebootRequired {
+		u.cfg.LogEntry("LastRebootRequired", "1")
+	} else {
+		u.cfg.LogEntry("LastRebootRequired", "0")
+	}
 }
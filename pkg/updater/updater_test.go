@@ -1,9 +1,18 @@
 package updater
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
 )
@@ -40,6 +49,15 @@ func TestNew(t *testing.T) {
 	if u.opts.Version != "1.0.0" {
 		t.Errorf("Expected version 1.0.0, got %s", u.opts.Version)
 	}
+
+	if u.apiURL != config.ReleaseAPIURL {
+		t.Errorf("Expected official releases API, got %s", u.apiURL)
+	}
+
+	cfg.ReleaseRepo = "someone/noraneko-fork"
+	if u := New(cfg, opts); u.apiURL != "https://api.github.com/repos/someone/noraneko-fork/releases" {
+		t.Errorf("Expected the fork's releases API, got %s", u.apiURL)
+	}
 }
 
 func TestIsNewerVersion(t *testing.T) {
@@ -141,7 +159,7 @@ func TestCopyFile(t *testing.T) {
 
 	// Copy file
 	dstFile := filepath.Join(tmpDir, "dest.txt")
-	if err := u.copyFile(srcFile, dstFile); err != nil {
+	if err := u.copyFile(context.Background(), srcFile, dstFile, nil); err != nil {
 		t.Fatalf("Failed to copy file: %v", err)
 	}
 
@@ -156,6 +174,99 @@ func TestCopyFile(t *testing.T) {
 	}
 }
 
+func TestCopyFileCancel(t *testing.T) {
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+
+	srcFile := filepath.Join(tmpDir, "omni.ja")
+	if err := os.WriteFile(srcFile, bytes.Repeat([]byte("x"), 3*copyChunkSize), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	// Cancelling after the first chunk stops the copy before the next one
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var chunks int
+	dstFile := filepath.Join(tmpDir, "copy.ja")
+	err := u.copyFile(ctx, srcFile, dstFile, func(done, total int64) {
+		chunks++
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if chunks != 1 {
+		t.Errorf("Expected the copy to stop after 1 chunk, got %d", chunks)
+	}
+	if _, err := os.Stat(dstFile); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial copy to be removed, got %v", err)
+	}
+
+	// An installed file is left as it was
+	if err := os.WriteFile(dstFile, []byte("installed"), 0644); err != nil {
+		t.Fatalf("Failed to write installed file: %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	err = u.copyFile(ctx, srcFile, dstFile, func(done, total int64) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if data, err := os.ReadFile(dstFile); err != nil || string(data) != "installed" {
+		t.Errorf("Expected the installed file to be kept, got %q (%v)", data, err)
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 2 {
+		t.Errorf("Expected no partial file to be left, got %d entries", len(entries))
+	}
+}
+
+func TestCopyDirProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: tmpDir}, Options{})
+
+	src := filepath.Join(tmpDir, "src")
+	sizes := map[string]int{
+		"noraneko.exe":      1000,
+		"omni.ja":           2*copyChunkSize + 10,
+		"browser/omni.ja":   copyChunkSize,
+		"defaults/empty.js": 0,
+	}
+	var total int64
+	for name, size := range sizes {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(p, bytes.Repeat([]byte("x"), size), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		total += int64(size)
+	}
+
+	var calls int
+	var lastDone int64
+	err := u.copyDir(context.Background(), src, filepath.Join(tmpDir, "dst"), func(done, got int64) {
+		calls++
+		if got != total {
+			t.Errorf("Expected total %d, got %d", total, got)
+		}
+		if done < lastDone {
+			t.Errorf("Progress went backwards: %d after %d", done, lastDone)
+		}
+		lastDone = done
+	})
+	if err != nil {
+		t.Fatalf("copyDir failed: %v", err)
+	}
+	if lastDone != total {
+		t.Errorf("Expected final progress %d, got %d", total, lastDone)
+	}
+	// One report per chunk: 1 + 3 + 1
+	if calls != 5 {
+		t.Errorf("Expected 5 progress reports, got %d", calls)
+	}
+}
+
 func TestFindAsset(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "noraneko-test")
 	if err != nil {
@@ -247,3 +358,904 @@ func TestFindChecksumAsset(t *testing.T) {
 		t.Fatal("Checksum asset with .sha256 extension not found")
 	}
 }
+
+// makeTestZip builds a zip archive containing the given files
+func makeTestZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s to zip: %v", name, err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatalf("Failed to write %s to zip: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to finish zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// newReleaseServer serves a connection check endpoint, a latest release
+// with the given tag and a portable zip asset
+func newReleaseServer(t *testing.T, tag string, archive []byte) *httptest.Server {
+	t.Helper()
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": %q, "assets": [{"name": "noraneko-windows-x86_64-portable.zip", "browser_download_url": %q, "size": %d}]}`,
+			tag, server.URL+"/download/portable.zip", len(archive))
+	})
+	mux.HandleFunc("/download/portable.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newPortableInstall creates a portable browser install reporting the given
+// version and returns its config
+func newPortableInstall(t *testing.T, version string) *config.Config {
+	t.Helper()
+
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	browserDir := filepath.Join(tmpDir, config.BrowserName)
+	if err := os.MkdirAll(browserDir, 0755); err != nil {
+		t.Fatalf("Failed to create browser dir: %v", err)
+	}
+	browserPath := filepath.Join(browserDir, config.BrowserExe)
+	if err := os.WriteFile(browserPath, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create browser exe: %v", err)
+	}
+	appIni := fmt.Sprintf("[App]\nVersion=%s\n", version)
+	if err := os.WriteFile(filepath.Join(browserDir, "application.ini"), []byte(appIni), 0644); err != nil {
+		t.Fatalf("Failed to write application.ini: %v", err)
+	}
+
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.Path = browserPath
+	cfg.WorkDir = filepath.Join(tmpDir, "work")
+	if err := os.MkdirAll(cfg.WorkDir, 0755); err != nil {
+		t.Fatalf("Failed to create work dir: %v", err)
+	}
+	return cfg
+}
+
+// newTestUpdater returns an Updater talking to the given test server
+func newTestUpdater(cfg *config.Config, opts Options, server *httptest.Server) *Updater {
+	u := New(cfg, opts)
+	u.apiURL = server.URL + "/releases"
+	u.checkURL = server.URL + "/"
+	return u
+}
+
+func TestRunForceReinstall(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=1.0.0\n",
+		"noraneko/reinstalled.txt": "yes",
+	})
+	server := newReleaseServer(t, "v1.0.0", archive)
+
+	// Without the flag, equal versions mean nothing is installed
+	cfg := newPortableInstall(t, "1.0.0")
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	marker := filepath.Join(filepath.Dir(cfg.Path), "reinstalled.txt")
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected no install when versions are equal")
+	}
+
+	// With the flag, the install runs anyway
+	u = newTestUpdater(cfg, Options{Portable: true, ForceReinstall: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Expected forced reinstall to install files: %v", err)
+	}
+}
+
+func TestRunPortableBootstrap(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "exe",
+		"noraneko/application.ini": "[App]\nVersion=1.0.0\n",
+	})
+	server := newReleaseServer(t, "v1.0.0", archive)
+
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.IsPortable() {
+		t.Fatal("Expected no portable layout before the first run")
+	}
+
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	browserPath := filepath.Join(tmpDir, config.BrowserName, config.BrowserExe)
+	if _, err := os.Stat(browserPath); err != nil {
+		t.Errorf("Expected browser extracted into the portable layout: %v", err)
+	}
+	if !cfg.IsPortable() {
+		t.Error("Expected the portable marker to be created")
+	}
+	if got := cfg.GetBrowserPath(); got != browserPath {
+		t.Errorf("Expected later runs to detect %s, got '%s'", browserPath, got)
+	}
+}
+
+func TestExtractPortableIgnoresInstalledPathWithFlag(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+
+	// Point Path at an unrelated install; -portable must not touch it
+	otherDir, err := os.MkdirTemp("", "noraneko-other")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(otherDir)
+	cfg.Path = filepath.Join(otherDir, config.BrowserExe)
+	os.WriteFile(cfg.Path, []byte("exe"), 0644)
+
+	archive := makeTestZip(t, map[string]string{"noraneko/new.txt": "new"})
+	zipPath := filepath.Join(cfg.WorkDir, "portable.zip")
+	if err := os.WriteFile(zipPath, archive, 0644); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+
+	u := New(cfg, Options{Portable: true})
+	if err := u.extractPortable(context.Background(), zipPath); err != nil {
+		t.Fatalf("Extraction failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.ExeDir, config.BrowserName, "new.txt")); err != nil {
+		t.Errorf("Expected extraction into ExeDir/%s: %v", config.BrowserName, err)
+	}
+	if _, err := os.Stat(filepath.Join(otherDir, "new.txt")); err == nil {
+		t.Error("Expected the configured install to be left alone")
+	}
+}
+
+func TestRunOfflineTolerant(t *testing.T) {
+	server := newReleaseServer(t, "v1.0.0", nil)
+
+	// A check endpoint that always fails, while the API still works
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "blocked", http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.ConnectCheckURL = failing.URL
+
+	u := New(cfg, Options{})
+	u.apiURL = server.URL + "/releases"
+	if _, err := u.Run(); err == nil {
+		t.Error("Expected a failed connection check to abort the run")
+	}
+
+	cfg.OfflineTolerant = true
+	u = New(cfg, Options{})
+	u.apiURL = server.URL + "/releases"
+	if _, err := u.Run(); err != nil {
+		t.Errorf("Expected the tolerant run to proceed to the API, got: %v", err)
+	}
+	if got := cfg.LogValue("LastResult"); got != "No new version found" {
+		t.Errorf("Expected the release check to run, got last result '%s'", got)
+	}
+}
+
+func TestRunConfirmAndProgress(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+
+	// A declined confirmation leaves the install untouched
+	cfg := newPortableInstall(t, "1.0.0")
+	u := newTestUpdater(cfg, Options{
+		Portable: true,
+		Confirm:  func(current, latest string) bool { return false },
+	}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "1.0.0" {
+		t.Errorf("Expected version 1.0.0 after declining, got %s", v)
+	}
+
+	// An accepted confirmation installs and reports progress
+	var asked string
+	var lastDone, lastTotal int64
+	u = newTestUpdater(cfg, Options{
+		Portable: true,
+		Confirm: func(current, latest string) bool {
+			asked = current + "->" + latest
+			return true
+		},
+		Progress: func(done, total int64) { lastDone, lastTotal = done, total },
+	}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if asked != "1.0.0->2.0.0" {
+		t.Errorf("Expected confirmation for 1.0.0->2.0.0, got %q", asked)
+	}
+	if lastTotal != int64(len(archive)) || lastDone != lastTotal {
+		t.Errorf("Expected final progress %d/%d, got %d/%d", len(archive), len(archive), lastDone, lastTotal)
+	}
+	if v, _ := u.getCurrentVersion(); v != "2.0.0" {
+		t.Errorf("Expected version 2.0.0 after install, got %s", v)
+	}
+}
+
+func TestRunSkipVersion(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+
+	// The skipped version is not installed
+	cfg := newPortableInstall(t, "1.0.0")
+	if err := cfg.SetSkipVersion("v2.0.0"); err != nil {
+		t.Fatalf("Failed to skip version: %v", err)
+	}
+	u := newTestUpdater(cfg, Options{Portable: true}, newReleaseServer(t, "v2.0.0", archive))
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "1.0.0" {
+		t.Errorf("Expected skipped version not to be installed, got %s", v)
+	}
+	if got := cfg.LogValue("LastResult"); got != "Skipped version 2.0.0" {
+		t.Errorf("Expected skip to be logged, got '%s'", got)
+	}
+
+	// A newer release is still offered
+	newer := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "newer exe",
+		"noraneko/application.ini": "[App]\nVersion=2.1.0\n",
+	})
+	u = newTestUpdater(cfg, Options{Portable: true}, newReleaseServer(t, "v2.1.0", newer))
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "2.1.0" {
+		t.Errorf("Expected newer version to be installed, got %s", v)
+	}
+}
+
+func TestRunUnskipVersion(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	if err := cfg.SetSkipVersion("2.0.0"); err != nil {
+		t.Fatalf("Failed to skip version: %v", err)
+	}
+	if err := cfg.SetSkipVersion(""); err != nil {
+		t.Fatalf("Failed to unskip version: %v", err)
+	}
+
+	// The cleared setting is persisted
+	reloaded, err := config.Load(cfg.ExeDir)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if reloaded.SkipVersion != "" {
+		t.Errorf("Expected skipped version to be cleared, got '%s'", reloaded.SkipVersion)
+	}
+
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "2.0.0" {
+		t.Errorf("Expected unskipped version to be installed, got %s", v)
+	}
+}
+
+func TestCopyDirOverwritePolicy(t *testing.T) {
+	tests := []struct {
+		policy    string
+		preserved []string
+	}{
+		{config.OverwriteAll, nil},
+		{config.OverwriteSkipExisting, []string{"noraneko.exe", "distribution/policies.json", "defaults/pref/custom.js"}},
+		{config.OverwriteSkipListed, []string{"distribution/policies.json", "defaults/pref/custom.js"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			src := filepath.Join(tmpDir, "src")
+			dst := filepath.Join(tmpDir, "dst")
+
+			files := []string{"noraneko.exe", "distribution/policies.json", "defaults/pref/custom.js"}
+			for _, name := range files {
+				for _, dir := range []string{src, dst} {
+					p := filepath.Join(dir, filepath.FromSlash(name))
+					if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+						t.Fatalf("Failed to create dir: %v", err)
+					}
+					if err := os.WriteFile(p, []byte(filepath.Base(dir)), 0644); err != nil {
+						t.Fatalf("Failed to write file: %v", err)
+					}
+				}
+			}
+			// New files are always copied
+			if err := os.WriteFile(filepath.Join(src, "new.txt"), []byte("src"), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			cfg := &config.Config{
+				ExeDir:          tmpDir,
+				WorkDir:         tmpDir,
+				OverwritePolicy: tt.policy,
+				PreserveFiles:   []string{"Distribution/policies.json", "defaults/pref"},
+			}
+			u := New(cfg, Options{})
+			if err := u.copyDir(context.Background(), src, dst, nil); err != nil {
+				t.Fatalf("copyDir failed: %v", err)
+			}
+
+			kept := map[string]bool{}
+			for _, name := range tt.preserved {
+				kept[name] = true
+			}
+			for _, name := range append(files, "new.txt") {
+				data, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+				if err != nil {
+					t.Fatalf("Failed to read %s: %v", name, err)
+				}
+				expected := "src"
+				if kept[name] {
+					expected = "dst"
+				}
+				if string(data) != expected {
+					t.Errorf("%s: expected content from %s, got %s", name, expected, data)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareWorkDirCreatesMissing(t *testing.T) {
+	tmpDir := t.TempDir()
+	workDir := filepath.Join(tmpDir, "missing", "work")
+
+	u := New(&config.Config{ExeDir: tmpDir, WorkDir: workDir}, Options{})
+	if err := u.prepareWorkDir(); err != nil {
+		t.Fatalf("prepareWorkDir failed: %v", err)
+	}
+	if info, err := os.Stat(workDir); err != nil || !info.IsDir() {
+		t.Fatalf("Expected WorkDir to be created: %v", err)
+	}
+
+	// The write probe is cleaned up
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		t.Fatalf("Failed to read WorkDir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty WorkDir, found %d entries", len(entries))
+	}
+}
+
+func TestRunFallsBackFromUnusableWorkDir(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+
+	// A file where the directory should be cannot be used
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.WorkDir = filepath.Join(cfg.ExeDir, "not-a-dir")
+	if err := os.WriteFile(cfg.WorkDir, []byte("file"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if cfg.WorkDir != os.TempDir() {
+		t.Errorf("Expected fallback to %s, got %s", os.TempDir(), cfg.WorkDir)
+	}
+	if v, _ := u.getCurrentVersion(); v != "2.0.0" {
+		t.Errorf("Expected update to succeed from the fallback WorkDir, got %s", v)
+	}
+}
+
+func TestRunRefusesPackagedInstall(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "exe 2.0.0",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	browserDir := filepath.Dir(cfg.Path)
+	if err := os.WriteFile(filepath.Join(browserDir, config.AppxManifestName), []byte("<Package/>"), 0644); err != nil {
+		t.Fatalf("Failed to write package manifest: %v", err)
+	}
+
+	// Checking still reports the update
+	u := newTestUpdater(cfg, Options{CheckOnly: true}, server)
+	if result, err := u.Run(); err != nil || !result.UpdateAvailable {
+		t.Fatalf("Expected the check to report an update, got %+v (%v)", result, err)
+	}
+
+	u = newTestUpdater(cfg, Options{}, server)
+	_, err := u.Run()
+	if err == nil || !strings.Contains(err.Error(), "MSIX/AppX package") {
+		t.Fatalf("Expected the packaged install to be refused, got %v", err)
+	}
+	if version, _ := u.getCurrentVersion(); version != "1.0.0" {
+		t.Errorf("Expected the install to be untouched, got version %s", version)
+	}
+
+	// A portable update installs next to the updater instead
+	u = newTestUpdater(cfg, Options{Portable: true}, server)
+	if dir := u.packagedInstallDir(false); dir != "" {
+		t.Errorf("Expected portable updates to be allowed, got %s", dir)
+	}
+}
+
+func TestWorkDirRedirect(t *testing.T) {
+	tmpDir := t.TempDir()
+	other := filepath.Join(tmpDir, "work")
+
+	tests := []struct {
+		name     string
+		workDir  string
+		redirect bool
+		portable bool
+		marker   bool
+		expected string
+	}{
+		{"installed, WorkDir is the updater's folder", tmpDir, true, false, false, os.TempDir()},
+		{"installed, trailing separator", tmpDir + string(filepath.Separator), true, false, false, os.TempDir()},
+		{"installed, other WorkDir", other, true, false, false, ""},
+		{"redirect disabled", tmpDir, false, false, false, ""},
+		{"portable flag", tmpDir, true, true, false, ""},
+		{"portable layout", tmpDir, true, false, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{ExeDir: tmpDir, WorkDir: tt.workDir, RedirectWorkDir: tt.redirect}
+			os.Remove(cfg.PortableMarkerPath())
+			if tt.marker {
+				if err := os.WriteFile(cfg.PortableMarkerPath(), nil, 0644); err != nil {
+					t.Fatalf("Failed to create portable marker: %v", err)
+				}
+			}
+			u := New(cfg, Options{Portable: tt.portable})
+			if got := u.workDirRedirect(); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFreshInstallVersusUpgrade(t *testing.T) {
+	withArch(t, "amd64")
+
+	release := &Release{
+		TagName: "v2.0.0",
+		Assets: []Asset{
+			{Name: "noraneko-2.0.0-windows-x86_64-portable.zip"},
+			{Name: "noraneko-2.0.0-windows-x86_64-setup.exe"},
+		},
+	}
+
+	// Creates the browser executable in dir
+	installAt := func(t *testing.T, dir string) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create browser dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, config.BrowserExe), []byte("exe"), 0644); err != nil {
+			t.Fatalf("Failed to create browser exe: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		portable  bool
+		setup     func(t *testing.T, cfg *config.Config)
+		fresh     bool
+		asset     string
+		targetDir func(cfg *config.Config) string
+	}{
+		{
+			name:      "fresh install",
+			fresh:     true,
+			asset:     "noraneko-2.0.0-windows-x86_64-setup.exe",
+			targetDir: func(*config.Config) string { return config.DefaultInstallDir() },
+		},
+		{
+			name:      "fresh portable install",
+			portable:  true,
+			fresh:     true,
+			asset:     "noraneko-2.0.0-windows-x86_64-portable.zip",
+			targetDir: func(cfg *config.Config) string { return filepath.Join(cfg.ExeDir, config.BrowserName) },
+		},
+		{
+			name: "upgrade installed",
+			setup: func(t *testing.T, cfg *config.Config) {
+				installAt(t, config.DefaultInstallDir())
+			},
+			asset:     "noraneko-2.0.0-windows-x86_64-setup.exe",
+			targetDir: func(*config.Config) string { return config.DefaultInstallDir() },
+		},
+		{
+			name: "upgrade portable",
+			setup: func(t *testing.T, cfg *config.Config) {
+				installAt(t, filepath.Join(cfg.ExeDir, config.BrowserName))
+				if err := os.WriteFile(cfg.PortableMarkerPath(), nil, 0644); err != nil {
+					t.Fatalf("Failed to create portable marker: %v", err)
+				}
+			},
+			asset:     "noraneko-2.0.0-windows-x86_64-portable.zip",
+			targetDir: func(cfg *config.Config) string { return filepath.Join(cfg.ExeDir, config.BrowserName) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			t.Setenv("ProgramFiles", filepath.Join(tmpDir, "Program Files"))
+
+			cfg := &config.Config{ExeDir: filepath.Join(tmpDir, "updater"), WorkDir: tmpDir}
+			if tt.setup != nil {
+				tt.setup(t, cfg)
+			}
+
+			u := New(cfg, Options{Portable: tt.portable})
+			u.release = release
+
+			if u.isFreshInstall() != tt.fresh {
+				t.Errorf("Expected fresh install %v", tt.fresh)
+			}
+			asset, err := u.findAsset()
+			if err != nil {
+				t.Fatalf("Failed to find asset: %v", err)
+			}
+			if asset.Name != tt.asset {
+				t.Errorf("Expected asset %s, got %s", tt.asset, asset.Name)
+			}
+
+			if target := u.extractDir(); target != tt.targetDir(cfg) {
+				t.Errorf("Expected target %s, got %s", tt.targetDir(cfg), target)
+			}
+		})
+	}
+}
+
+func TestRunFreshInstall(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+
+	tmpDir := t.TempDir()
+	t.Setenv("ProgramFiles", filepath.Join(tmpDir, "Program Files"))
+
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.WorkDir = filepath.Join(tmpDir, "work")
+
+	u := newTestUpdater(cfg, Options{}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// Without an install or -portable, the release goes to Program Files
+	installed := filepath.Join(config.DefaultInstallDir(), config.BrowserExe)
+	if _, err := os.Stat(installed); err != nil {
+		t.Errorf("Expected a fresh install in Program Files: %v", err)
+	}
+	if got := cfg.LogValue("LastResult"); got != "Installed 2.0.0" {
+		t.Errorf("Expected fresh install to be logged, got '%s'", got)
+	}
+}
+
+func TestKeepTempOnError(t *testing.T) {
+	valid := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+
+	tests := []struct {
+		name    string
+		archive []byte
+		keep    bool
+		fails   bool
+		kept    bool
+	}{
+		{"failure kept", []byte("PK\x03\x04 truncated zip"), true, true, true},
+		{"failure cleaned", []byte("PK\x03\x04 truncated zip"), false, true, false},
+		{"success cleaned", valid, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newReleaseServer(t, "v2.0.0", tt.archive)
+
+			cfg := newPortableInstall(t, "1.0.0")
+			cfg.WorkDir = t.TempDir()
+			cfg.KeepTempOnError = tt.keep
+
+			u := newTestUpdater(cfg, Options{Portable: true}, server)
+			_, err := u.Run()
+			if (err != nil) != tt.fails {
+				t.Fatalf("Unexpected Run result: %v", err)
+			}
+
+			entries, err := os.ReadDir(cfg.WorkDir)
+			if err != nil {
+				t.Fatalf("Failed to read WorkDir: %v", err)
+			}
+			if tt.kept {
+				names := map[string]bool{}
+				for _, e := range entries {
+					names[e.Name()] = true
+				}
+				if !names["noraneko-windows-x86_64-portable.zip"] || !names[config.BrowserName+"-Extracted"] {
+					t.Errorf("Expected the download and extract dir to be kept, found %v", names)
+				}
+				if !strings.Contains(cfg.LogValue("KeptTempFiles"), "noraneko-windows-x86_64-portable.zip") {
+					t.Errorf("Expected kept files to be logged, got '%s'", cfg.LogValue("KeptTempFiles"))
+				}
+			} else if len(entries) != 0 {
+				t.Errorf("Expected WorkDir to be cleaned up, found %d entries", len(entries))
+			}
+		})
+	}
+}
+
+func TestRunMaxRunDuration(t *testing.T) {
+	// The download sends a few bytes and then stalls
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name": "v2.0.0", "assets": [{"name": "noraneko-windows-x86_64-portable.zip", "browser_download_url": %q}]}`,
+			server.URL+"/download/portable.zip")
+	})
+	mux.HandleFunc("/download/portable.zip", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("PK\x03\x04"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(30 * time.Second):
+		}
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.WorkDir = t.TempDir()
+	cfg.MaxRunDuration = 1
+	cfg.KeepTempOnError = true
+
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	start := time.Now()
+	_, err := u.Run()
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "MaxRunDuration") {
+		t.Fatalf("Expected Run to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected Run to abort at the deadline, took %v", elapsed)
+	}
+
+	// The partial download is removed despite KeepTempOnError
+	entries, err := os.ReadDir(cfg.WorkDir)
+	if err != nil {
+		t.Fatalf("Failed to read WorkDir: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected WorkDir to be cleaned up, found %d entries", len(entries))
+	}
+}
+
+func TestRunChannelSwitchDowngrade(t *testing.T) {
+	stable := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "stable exe",
+		"noraneko/application.ini": "[App]\nVersion=128.0\n",
+	})
+	server := newReleaseServer(t, "v128.0", stable)
+
+	// The first run records the branch of the nightly install
+	cfg := newPortableInstall(t, "130.0")
+	cfg.Branch = "nightly"
+	u := newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "130.0" {
+		t.Fatalf("Expected no downgrade on the same branch, got %s", v)
+	}
+	if got := cfg.LogValue("InstalledBranch"); got != "nightly" {
+		t.Fatalf("Expected installed branch nightly, got '%s'", got)
+	}
+
+	// Switching to stable installs its lower version
+	cfg.Branch = "stable"
+	u = newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "128.0" {
+		t.Errorf("Expected the stable release after the switch, got %s", v)
+	}
+	if got := cfg.LogValue("InstalledBranch"); got != "stable" {
+		t.Errorf("Expected installed branch stable, got '%s'", got)
+	}
+
+	// Later runs on the new branch compare versions again
+	u = newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if got := cfg.LogValue("LastResult"); got != "No new version found" {
+		t.Errorf("Expected no update after the switch, got '%s'", got)
+	}
+}
+
+func TestRunChannelSwitchDeclined(t *testing.T) {
+	stable := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "stable exe",
+		"noraneko/application.ini": "[App]\nVersion=128.0\n",
+	})
+
+	cfg := newPortableInstall(t, "130.0")
+	if err := cfg.LogEntry("InstalledBranch", "nightly"); err != nil {
+		t.Fatalf("Failed to log branch: %v", err)
+	}
+	cfg.Branch = "stable"
+
+	// Declining keeps the old branch recorded, so the switch is offered again
+	decline := func(current, latest string) bool { return false }
+	u := newTestUpdater(cfg, Options{Portable: true, Confirm: decline}, newReleaseServer(t, "v128.0", stable))
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if v, _ := u.getCurrentVersion(); v != "130.0" {
+		t.Errorf("Expected nothing to be installed, got %s", v)
+	}
+	if got := cfg.LogValue("InstalledBranch"); got != "nightly" {
+		t.Errorf("Expected installed branch to stay nightly, got '%s'", got)
+	}
+}
+
+func TestRunMaintenanceWindow(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	server := newReleaseServer(t, "v2.0.0", archive)
+
+	windows, err := config.ParseMaintenanceWindows("Sat-Sun")
+	if err != nil {
+		t.Fatalf("Failed to parse window: %v", err)
+	}
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.MaintenanceWindows = windows
+
+	orig := clock
+	t.Cleanup(func() { clock = orig })
+
+	// A scheduled run on Wednesday 2024-06-05 defers the update
+	clock = func() time.Time { return time.Date(2024, 6, 5, 12, 0, 0, 0, time.Local) }
+	result, err := newTestUpdater(cfg, Options{Portable: true, Scheduled: true}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if result.Updated || !result.UpdateAvailable {
+		t.Errorf("Expected the update to be deferred, got %+v", result)
+	}
+	if got := cfg.LogValue("NextMaintenanceWindow"); got != "2024-06-08 00:00" {
+		t.Errorf("Expected next window on Saturday, got '%s'", got)
+	}
+
+	// Interactive runs ignore the window
+	result, err = newTestUpdater(cfg, Options{Portable: true, CheckOnly: true}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if strings.Contains(result.Message, "deferred") {
+		t.Errorf("Expected interactive runs not to be deferred, got '%s'", result.Message)
+	}
+
+	// Inside the window on Sunday the update is installed
+	clock = func() time.Time { return time.Date(2024, 6, 9, 12, 0, 0, 0, time.Local) }
+	result, err = newTestUpdater(cfg, Options{Portable: true, Scheduled: true}, server).Run()
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !result.Updated {
+		t.Errorf("Expected the update inside the window, got %+v", result)
+	}
+}
+
+func TestCheckInstalledVersionWaitsForInstaller(t *testing.T) {
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.PostInstallWait = 5
+	cfg.PostInstallRetries = 3
+	appIni := filepath.Join(filepath.Dir(cfg.Path), "application.ini")
+
+	// The installer finishes writing the version after the second wait
+	var waits []time.Duration
+	orig := sleep
+	sleep = func(d time.Duration) {
+		waits = append(waits, d)
+		if len(waits) == 2 {
+			os.WriteFile(appIni, []byte("[App]\nVersion=2.0.0\n"), 0644)
+		}
+	}
+	t.Cleanup(func() { sleep = orig })
+
+	u := New(cfg, Options{})
+	if err := u.checkInstalledVersion("v2.0.0"); err != nil {
+		t.Fatalf("Expected the delayed version to be found: %v", err)
+	}
+	if len(waits) != 2 || waits[0] != 5*time.Second {
+		t.Errorf("Expected 2 waits of 5s, got %v", waits)
+	}
+
+	// An install that never reports the version gives up after the retries
+	waits = nil
+	if err := u.checkInstalledVersion("v3.0.0"); err == nil || !strings.Contains(err.Error(), "expected 3.0.0") {
+		t.Errorf("Expected a version mismatch error, got %v", err)
+	}
+	if len(waits) != 3 {
+		t.Errorf("Expected 3 retries, got %d", len(waits))
+	}
+
+	// Tags without a version are not compared or retried
+	waits = nil
+	if err := u.checkInstalledVersion("nightly-20240501"); err != nil {
+		t.Errorf("Expected a tag without a version to pass, got %v", err)
+	}
+	if len(waits) != 0 {
+		t.Errorf("Expected no retries for a tag without a version, got %v", waits)
+	}
+}
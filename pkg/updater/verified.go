@@ -0,0 +1,65 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// recordVerifiedDownload remembers the release, asset and digest of a
+// download that passed checksum verification, so a later run retrying a
+// failed install can use the file instead of downloading it again
+func (u *Updater) recordVerifiedDownload(downloadPath, checksumPath string) {
+	digest, err := expectedChecksum(checksumPath, u.asset.Name)
+	if err != nil {
+		return
+	}
+
+	entries := [][2]string{
+		{"VerifiedTag", u.release.TagName},
+		{"VerifiedAsset", u.asset.Name},
+		{"VerifiedSHA256", digest},
+		{"VerifiedPath", downloadPath},
+	}
+	for _, e := range entries {
+		if err := u.cfg.CacheEntry(e[0], e[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record verified download: %v\n", err)
+			return
+		}
+	}
+}
+
+// reuseVerifiedDownload places the recorded verified download at
+// downloadPath if it belongs to the release and asset being installed and
+// a kept or cached copy still has the recorded digest. It reports whether
+// the download can be skipped.
+func (u *Updater) reuseVerifiedDownload(ctx context.Context, downloadPath string) bool {
+	digest := u.cfg.CacheValue("VerifiedSHA256")
+	if digest == "" || u.cfg.CacheValue("VerifiedTag") != u.release.TagName ||
+		u.cfg.CacheValue("VerifiedAsset") != u.asset.Name {
+		return false
+	}
+
+	// The file kept by KeepTempOnError, or the download cache entry
+	candidates := []string{u.cfg.CacheValue("VerifiedPath")}
+	if u.cfg.CacheDir != "" {
+		candidates = append(candidates, filepath.Join(u.cfg.CacheDir, digest))
+	}
+
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if actual, err := hashFile(path); err != nil || actual != digest {
+			continue
+		}
+		if filepath.Clean(path) == filepath.Clean(downloadPath) {
+			return true
+		}
+		if err := u.copyFile(ctx, path, downloadPath, nil); err == nil {
+			return true
+		}
+	}
+	return false
+}
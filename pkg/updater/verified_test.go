@@ -0,0 +1,104 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReuseVerifiedDownload(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+	sum := sha256.Sum256(archive)
+	digest := hex.EncodeToString(sum[:])
+
+	downloads := 0
+	server := newChecksumReleaseServer(t, archive, &downloads)
+
+	cfg := newPortableInstall(t, "1.0.0")
+	cfg.WorkDir = t.TempDir()
+	cfg.KeepTempOnError = true
+	keptPath := filepath.Join(cfg.WorkDir, "noraneko-windows-x86_64-portable.zip")
+
+	// The download is verified and recorded, then the install fails
+	u := newTestUpdater(cfg, Options{Portable: true, SimulateFailure: PhaseInstall}, server)
+	if _, err := u.Run(); err == nil {
+		t.Fatal("Expected the simulated install failure")
+	}
+	if downloads != 1 {
+		t.Fatalf("Expected 1 download, got %d", downloads)
+	}
+	if cfg.CacheValue("VerifiedTag") != "v2.0.0" || cfg.CacheValue("VerifiedSHA256") != digest ||
+		cfg.CacheValue("VerifiedPath") != keptPath {
+		t.Fatalf("Expected the verified download to be recorded, got tag %q digest %q path %q",
+			cfg.CacheValue("VerifiedTag"), cfg.CacheValue("VerifiedSHA256"), cfg.CacheValue("VerifiedPath"))
+	}
+
+	// A retry installs the kept file without downloading it again
+	u = newTestUpdater(cfg, Options{Portable: true}, server)
+	if _, err := u.Run(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if downloads != 1 {
+		t.Errorf("Expected the verified download to be reused, got %d downloads", downloads)
+	}
+	if v, _ := u.getCurrentVersion(); v != "2.0.0" {
+		t.Errorf("Expected the reused download to be installed, got %s", v)
+	}
+}
+
+func TestReuseVerifiedDownloadRejected(t *testing.T) {
+	archive := makeTestZip(t, map[string]string{
+		"noraneko/noraneko.exe":    "new exe",
+		"noraneko/application.ini": "[App]\nVersion=2.0.0\n",
+	})
+
+	tests := []struct {
+		name   string
+		modify func(t *testing.T, keptPath string)
+	}{
+		{"tampered file", func(t *testing.T, keptPath string) {
+			if err := os.WriteFile(keptPath, []byte("PK\x03\x04 tampered"), 0644); err != nil {
+				t.Fatalf("Failed to tamper with the kept file: %v", err)
+			}
+		}},
+		{"missing file", func(t *testing.T, keptPath string) {
+			if err := os.Remove(keptPath); err != nil {
+				t.Fatalf("Failed to remove the kept file: %v", err)
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downloads := 0
+			server := newChecksumReleaseServer(t, archive, &downloads)
+
+			cfg := newPortableInstall(t, "1.0.0")
+			cfg.WorkDir = t.TempDir()
+			cfg.KeepTempOnError = true
+
+			u := newTestUpdater(cfg, Options{Portable: true, SimulateFailure: PhaseInstall}, server)
+			if _, err := u.Run(); err == nil {
+				t.Fatal("Expected the simulated install failure")
+			}
+			tt.modify(t, filepath.Join(cfg.WorkDir, "noraneko-windows-x86_64-portable.zip"))
+
+			// The release is downloaded and verified again
+			u = newTestUpdater(cfg, Options{Portable: true}, server)
+			if _, err := u.Run(); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+			if downloads != 2 {
+				t.Errorf("Expected the asset to be downloaded again, got %d downloads", downloads)
+			}
+			if v, _ := u.getCurrentVersion(); v != "2.0.0" {
+				t.Errorf("Expected the update to be installed, got %s", v)
+			}
+		})
+	}
+}
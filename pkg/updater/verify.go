@@ -0,0 +1,221 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// Manifest maps install-relative, slash-separated file paths to their
+// SHA256 digests
+type Manifest map[string]string
+
+// Mismatch describes a file whose contents differ from the manifest
+type Mismatch struct {
+	Path     string `json:"path"`
+	Expected string `json:"expected"`
+	// Actual is empty if the file is missing
+	Actual string `json:"actual"`
+}
+
+// FileProgressFunc receives the number of files processed so far out of
+// total, and the install-relative path of the last one
+type FileProgressFunc func(done, total int, path string)
+
+// hashJob is a single file to hash within a tree
+type hashJob struct {
+	relPath string
+	path    string
+}
+
+// hashResult is the outcome of hashing a single file
+type hashResult struct {
+	relPath string
+	digest  string
+	err     error
+}
+
+// hashFile returns the SHA256 digest of a file, streaming its contents
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// hashFiles hashes the given files using a pool of workers and returns the
+// results in no particular order. progress, if not nil, is called after
+// each file from the calling goroutine.
+func hashFiles(jobs []hashJob, workers int, progress FileProgressFunc) []hashResult {
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobCh := make(chan hashJob)
+	resultCh := make(chan hashResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				digest, err := hashFile(job.path)
+				resultCh <- hashResult{relPath: job.relPath, digest: digest, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		for _, job := range jobs {
+			jobCh <- job
+		}
+		close(jobCh)
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	results := make([]hashResult, 0, len(jobs))
+	for r := range resultCh {
+		results = append(results, r)
+		if progress != nil {
+			progress(len(results), len(jobs), r.relPath)
+		}
+	}
+	return results
+}
+
+// hashTree builds a manifest of every regular file below dir
+func hashTree(dir string, workers int) (Manifest, error) {
+	var jobs []hashJob
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, hashJob{relPath: filepath.ToSlash(relPath), path: path})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(Manifest, len(jobs))
+	for _, r := range hashFiles(jobs, workers, nil) {
+		if r.err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", r.relPath, r.err)
+		}
+		manifest[r.relPath] = r.digest
+	}
+	return manifest, nil
+}
+
+// verifyManifest hashes the files listed in the manifest below dir and
+// returns the mismatches sorted by path. Files are handed out in path
+// order and results are checked in path order, so the outcome, including
+// which error is returned, does not depend on worker scheduling.
+func verifyManifest(dir string, manifest Manifest, workers int, progress FileProgressFunc) ([]Mismatch, error) {
+	jobs := make([]hashJob, 0, len(manifest))
+	for relPath := range manifest {
+		jobs = append(jobs, hashJob{relPath: relPath, path: filepath.Join(dir, filepath.FromSlash(relPath))})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].relPath < jobs[j].relPath
+	})
+
+	results := hashFiles(jobs, workers, progress)
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].relPath < results[j].relPath
+	})
+
+	var mismatches []Mismatch
+	for _, r := range results {
+		expected := manifest[r.relPath]
+		switch {
+		case errors.Is(r.err, fs.ErrNotExist):
+			mismatches = append(mismatches, Mismatch{Path: r.relPath, Expected: expected})
+		case r.err != nil:
+			return nil, fmt.Errorf("failed to hash %s: %w", r.relPath, r.err)
+		case r.digest != expected:
+			mismatches = append(mismatches, Mismatch{Path: r.relPath, Expected: expected, Actual: r.digest})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// manifestPath returns where the install manifest is stored
+func (u *Updater) manifestPath() string {
+	return filepath.Join(u.cfg.ExeDir, u.cfg.InstallFile(config.ManifestName))
+}
+
+// writeManifest records the digests of the files in dir as the expected
+// state of the install
+func (u *Updater) writeManifest(dir string) error {
+	manifest, err := hashTree(dir, u.cfg.VerifyConcurrency)
+	if err != nil {
+		return err
+	}
+	return u.saveManifest(manifest)
+}
+
+// saveManifest stores manifest as the expected state of the install
+func (u *Updater) saveManifest(manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(u.manifestPath(), data, 0644)
+}
+
+// loadManifest reads the manifest stored by saveManifest
+func (u *Updater) loadManifest() (Manifest, error) {
+	data, err := os.ReadFile(u.manifestPath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read install manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse install manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// VerifyInstall compares the installed files against the manifest recorded
+// at install time and returns the mismatches sorted by path
+func (u *Updater) VerifyInstall() ([]Mismatch, error) {
+	browserPath := u.cfg.GetBrowserPath()
+	if browserPath == "" {
+		return nil, fmt.Errorf("browser not found")
+	}
+
+	manifest, err := u.loadManifest()
+	if err != nil {
+		return nil, err
+	}
+	return verifyManifest(filepath.Dir(browserPath), manifest, u.cfg.VerifyConcurrency, u.opts.VerifyProgress)
+}
@@ -0,0 +1,199 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// makeFixtureTree creates a directory tree of small files for hashing
+func makeFixtureTree(t testing.TB, dir string, count int) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("dir%d", i%5), fmt.Sprintf("file%03d.txt", i))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create fixture dir: %v", err)
+		}
+		if err := os.WriteFile(path, testPayload(1024+i), 0644); err != nil {
+			t.Fatalf("Failed to write fixture file: %v", err)
+		}
+	}
+}
+
+func TestVerifyManifestConcurrentMatchesSerial(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	makeFixtureTree(t, tmpDir, 50)
+
+	manifest, err := hashTree(tmpDir, 1)
+	if err != nil {
+		t.Fatalf("Failed to hash tree: %v", err)
+	}
+	if len(manifest) != 50 {
+		t.Fatalf("Expected 50 manifest entries, got %d", len(manifest))
+	}
+
+	concurrentManifest, err := hashTree(tmpDir, 8)
+	if err != nil {
+		t.Fatalf("Failed to hash tree concurrently: %v", err)
+	}
+	if !reflect.DeepEqual(manifest, concurrentManifest) {
+		t.Error("Concurrent manifest differs from serial manifest")
+	}
+
+	// Damage the install: modify two files and remove one
+	os.WriteFile(filepath.Join(tmpDir, "dir3", "file033.txt"), []byte("tampered"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "dir0", "file010.txt"), []byte("tampered"), 0644)
+	os.Remove(filepath.Join(tmpDir, "dir1", "file001.txt"))
+
+	serial, err := verifyManifest(tmpDir, manifest, 1, nil)
+	if err != nil {
+		t.Fatalf("Serial verification failed: %v", err)
+	}
+
+	expectedPaths := []string{"dir0/file010.txt", "dir1/file001.txt", "dir3/file033.txt"}
+	var paths []string
+	for _, m := range serial {
+		paths = append(paths, m.Path)
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("Expected mismatches %v, got %v", expectedPaths, paths)
+	}
+	if serial[1].Actual != "" {
+		t.Error("Expected missing file to have an empty actual digest")
+	}
+
+	for _, workers := range []int{2, 4, 16} {
+		concurrent, err := verifyManifest(tmpDir, manifest, workers, nil)
+		if err != nil {
+			t.Fatalf("Concurrent verification with %d workers failed: %v", workers, err)
+		}
+		if !reflect.DeepEqual(serial, concurrent) {
+			t.Errorf("Verification with %d workers differs from serial result", workers)
+		}
+	}
+}
+
+func TestVerifyInstall(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	browserDir := filepath.Join(tmpDir, config.BrowserName)
+	makeFixtureTree(t, browserDir, 10)
+	browserPath := filepath.Join(browserDir, config.BrowserExe)
+	if err := os.WriteFile(browserPath, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create browser exe: %v", err)
+	}
+
+	cfg := &config.Config{
+		Path:              browserPath,
+		ExeDir:            tmpDir,
+		WorkDir:           tmpDir,
+		VerifyConcurrency: 4,
+	}
+	u := New(cfg, Options{})
+
+	if err := u.writeManifest(browserDir); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	mismatches, err := u.VerifyInstall()
+	if err != nil {
+		t.Fatalf("Failed to verify install: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("Expected a clean install, got %v", mismatches)
+	}
+
+	os.WriteFile(browserPath, []byte("corrupt"), 0644)
+	mismatches, err = u.VerifyInstall()
+	if err != nil {
+		t.Fatalf("Failed to verify install: %v", err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Path != config.BrowserExe {
+		t.Errorf("Expected %s to mismatch, got %v", config.BrowserExe, mismatches)
+	}
+}
+
+func TestVerifyManifestProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	makeFixtureTree(t, tmpDir, 40)
+	manifest, err := hashTree(tmpDir, 1)
+	if err != nil {
+		t.Fatalf("Failed to hash tree: %v", err)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, "dir2", "file007.txt"), []byte("tampered"), 0644)
+	os.Remove(filepath.Join(tmpDir, "dir4", "file019.txt"))
+	os.WriteFile(filepath.Join(tmpDir, "dir0", "file035.txt"), []byte("tampered"), 0644)
+
+	var first []Mismatch
+	for run := 0; run < 5; run++ {
+		var calls []int
+		seen := map[string]bool{}
+		mismatches, err := verifyManifest(tmpDir, manifest, 8, func(done, total int, path string) {
+			if total != len(manifest) {
+				t.Errorf("Expected total %d, got %d", len(manifest), total)
+			}
+			calls = append(calls, done)
+			seen[path] = true
+		})
+		if err != nil {
+			t.Fatalf("Verification failed: %v", err)
+		}
+
+		// One call per file, counting up to the total
+		if len(calls) != len(manifest) || len(seen) != len(manifest) {
+			t.Fatalf("Expected %d progress calls for distinct files, got %d calls for %d files", len(manifest), len(calls), len(seen))
+		}
+		for i, done := range calls {
+			if done != i+1 {
+				t.Fatalf("Expected progress %d at call %d, got %d", i+1, i, done)
+			}
+		}
+
+		if run == 0 {
+			first = mismatches
+			if len(first) != 3 {
+				t.Fatalf("Expected 3 mismatches, got %v", first)
+			}
+		} else if !reflect.DeepEqual(first, mismatches) {
+			t.Errorf("Run %d reported %v, first run reported %v", run, mismatches, first)
+		}
+	}
+}
+
+func BenchmarkVerifyManifest(b *testing.B) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-bench")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	makeFixtureTree(b, tmpDir, 200)
+	manifest, err := hashTree(tmpDir, 1)
+	if err != nil {
+		b.Fatalf("Failed to hash tree: %v", err)
+	}
+
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := verifyManifest(tmpDir, manifest, workers, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+var (
+	iniVersionRe     = regexp.MustCompile(`(?m)^Version=(.+)$`)
+	iniBuildIDRe     = regexp.MustCompile(`(?m)^BuildID=(\d+)`)
+	iniMilestoneRe   = regexp.MustCompile(`(?m)^Milestone=(.+)$`)
+	iniLastVersionRe = regexp.MustCompile(`(?m)^LastVersion=(.+)$`)
+	iniPlatformDirRe = regexp.MustCompile(`(?m)^LastPlatformDir=(.+)$`)
+	versionNumberRe  = regexp.MustCompile(`^\d+(\.\d+)*`)
+	releaseBuildIDRe = regexp.MustCompile(`(?:^|[^0-9])(\d{14})(?:[^0-9]|$)`)
+	releaseVersionRe = regexp.MustCompile(`(?:^|[^0-9A-Za-z])v?(\d+(?:\.\d+)+(?:[a-z]+\d*)?)(?:[^0-9A-Za-z]|$)`)
+)
+
+// installedBuild describes the version of an installed browser
+type installedBuild struct {
+	// Normalized numeric version, e.g. "128.0" for "128.0a1"
+	Version string
+
+	// Raw version string as written by the browser
+	RawVersion string
+
+	// 14-digit build timestamp, e.g. "20240501093512"
+	BuildID string
+}
+
+// getCurrentVersion gets the current installed version
+func (u *Updater) getCurrentVersion() (string, error) {
+	build, err := u.getInstalledBuild()
+	if err != nil {
+		return "", err
+	}
+	return build.Version, nil
+}
+
+// getInstalledBuild reads the version and build ID of the installed browser.
+// application.ini is preferred, with platform.ini and the profile's
+// compatibility.ini as fallbacks; a build ID missing from the chosen source
+// is taken from the others when they report the same version.
+func (u *Updater) getInstalledBuild() (*installedBuild, error) {
+	browserPath := u.cfg.GetBrowserPath()
+	if browserPath == "" {
+		return nil, fmt.Errorf("browser not found")
+	}
+
+	// For Windows, we would read the file version info
+	// For now, we'll try to find an application.ini or version file
+	browserDir := filepath.Dir(browserPath)
+
+	var candidates []*installedBuild
+
+	// Try application.ini
+	appIniPath := filepath.Join(browserDir, "application.ini")
+	if data, err := os.ReadFile(appIniPath); err == nil {
+		candidates = append(candidates, parseApplicationIni(string(data)))
+	}
+
+	// Try platform.ini
+	platformIniPath := filepath.Join(browserDir, "platform.ini")
+	if data, err := os.ReadFile(platformIniPath); err == nil {
+		candidates = append(candidates, parsePlatformIni(string(data)))
+	}
+
+	// Try compatibility.ini of profiles last used with this install
+	for _, profileDir := range u.profileDirs() {
+		data, err := os.ReadFile(filepath.Join(profileDir, "compatibility.ini"))
+		if err != nil {
+			continue
+		}
+		build, platformDir := parseCompatibilityIni(string(data))
+		if platformDir != "" && !strings.EqualFold(filepath.Clean(platformDir), filepath.Clean(browserDir)) {
+			continue
+		}
+		candidates = append(candidates, build)
+	}
+
+	var result *installedBuild
+	for _, c := range candidates {
+		if c == nil {
+			continue
+		}
+		if result == nil {
+			result = c
+			continue
+		}
+		if result.BuildID == "" && c.BuildID != "" && c.Version == result.Version {
+			result.BuildID = c.BuildID
+		}
+	}
+	if result != nil {
+		return result, nil
+	}
+
+	// Try version file
+	versionPath := filepath.Join(browserDir, "version")
+	if data, err := os.ReadFile(versionPath); err == nil {
+		raw := strings.TrimSpace(string(data))
+		return &installedBuild{Version: normalizeVersion(raw), RawVersion: raw}, nil
+	}
+
+	return nil, fmt.Errorf("could not determine version")
+}
+
+// profileDirs returns the browser profile directories that may contain a
+// compatibility.ini, for both portable and installed layouts
+func (u *Updater) profileDirs() []string {
+	roots := []string{filepath.Join(u.cfg.ExeDir, "Profiles")}
+	if appData := os.Getenv("APPDATA"); appData != "" {
+		roots = append(roots, filepath.Join(appData, config.BrowserName, "Profiles"))
+	}
+
+	var dirs []string
+	for _, root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, filepath.Join(root, entry.Name()))
+			}
+		}
+	}
+	return dirs
+}
+
+// parseApplicationIni extracts the version and build ID from the contents
+// of application.ini. It returns nil if no version is present.
+func parseApplicationIni(data string) *installedBuild {
+	matches := iniVersionRe.FindStringSubmatch(data)
+	if len(matches) < 2 {
+		return nil
+	}
+
+	raw := strings.TrimSpace(matches[1])
+	build := &installedBuild{Version: normalizeVersion(raw), RawVersion: raw}
+	if m := iniBuildIDRe.FindStringSubmatch(data); len(m) > 1 {
+		build.BuildID = m[1]
+	}
+	return build
+}
+
+// parsePlatformIni extracts the version and build ID from the contents of
+// platform.ini. It returns nil if no milestone is present.
+func parsePlatformIni(data string) *installedBuild {
+	matches := iniMilestoneRe.FindStringSubmatch(data)
+	if len(matches) < 2 {
+		return nil
+	}
+
+	raw := strings.TrimSpace(matches[1])
+	build := &installedBuild{Version: normalizeVersion(raw), RawVersion: raw}
+	if m := iniBuildIDRe.FindStringSubmatch(data); len(m) > 1 {
+		build.BuildID = m[1]
+	}
+	return build
+}
+
+// parseCompatibilityIni extracts the version and build ID from the contents
+// of a profile's compatibility.ini, along with the install directory that
+// last used the profile. LastVersion has the form
+// "128.0a1_20240501093512/20240501093512".
+func parseCompatibilityIni(data string) (*installedBuild, string) {
+	platformDir := ""
+	if m := iniPlatformDirRe.FindStringSubmatch(data); len(m) > 1 {
+		platformDir = strings.TrimSpace(m[1])
+	}
+
+	matches := iniLastVersionRe.FindStringSubmatch(data)
+	if len(matches) < 2 {
+		return nil, platformDir
+	}
+
+	value := strings.TrimSpace(matches[1])
+	if idx := strings.Index(value, "/"); idx != -1 {
+		value = value[:idx]
+	}
+	raw, buildID, _ := strings.Cut(value, "_")
+
+	build := &installedBuild{Version: normalizeVersion(raw), RawVersion: raw}
+	if len(buildID) == 14 {
+		build.BuildID = buildID
+	}
+	return build, platformDir
+}
+
+// normalizeVersion strips channel suffixes from a Firefox-style version, so
+// "128.0a1", "128.0b3", "128.0nightly" and "v128.0" all become "128.0"
+func normalizeVersion(v string) string {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if m := versionNumberRe.FindString(v); m != "" {
+		return m
+	}
+	return v
+}
+
+// isSkipped reports whether the release is the version configured in
+// SkipVersion. Tags are compared exactly, ignoring a leading "v" and case,
+// so skipping one nightly does not skip later builds of the same version.
+func (u *Updater) isSkipped(release *Release) bool {
+	skip := strings.TrimPrefix(strings.TrimSpace(u.cfg.SkipVersion), "v")
+	if skip == "" {
+		return false
+	}
+	tag := strings.TrimPrefix(release.TagName, "v")
+	if strings.EqualFold(skip, tag) {
+		return true
+	}
+
+	// Tags without a version, such as nightly-20240501, can also be skipped
+	// by the version shown for them
+	return !releaseVersionRe.MatchString(tag) && strings.EqualFold(skip, releaseVersion(release))
+}
+
+// channelChanged reports whether Branch differs from the branch the
+// installed build came from, so the new channel's release is installed even
+// if its version is lower. It returns the previous branch.
+func (u *Updater) channelChanged() (string, bool) {
+	installed := u.cfg.LogValue("InstalledBranch")
+	if installed == "" || strings.EqualFold(installed, u.cfg.Branch) {
+		return installed, false
+	}
+	return installed, true
+}
+
+// rememberBranch records the branch of the installed build for
+// channelChanged
+func (u *Updater) rememberBranch() {
+	if err := u.cfg.LogEntry("InstalledBranch", u.cfg.Branch); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to save installed branch: %v\n", err)
+	}
+}
+
+// releaseBuildID returns the 14-digit build ID embedded in a release's tag,
+// name or asset names, or an empty string if there is none
+func releaseBuildID(release *Release) string {
+	candidates := []string{release.TagName, release.Name}
+	for _, asset := range release.Assets {
+		candidates = append(candidates, asset.Name)
+	}
+
+	for _, c := range candidates {
+		if m := releaseBuildIDRe.FindStringSubmatch(c); len(m) > 1 {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// releaseVersion returns the version of a release. It is taken from the
+// first of the tag, the name and the asset names that contains one, so tags
+// such as "nightly-20240501" with the version only in the name still
+// compare correctly. Date-based tags are used as they are. If no version is
+// found the tag is returned without its leading "v".
+func releaseVersion(release *Release) string {
+	tag := strings.TrimPrefix(strings.TrimSpace(release.TagName), "v")
+	if dateVersionRe.MatchString(tag) {
+		return tag
+	}
+
+	candidates := []string{release.TagName, release.Name}
+	for _, asset := range release.Assets {
+		candidates = append(candidates, asset.Name)
+	}
+
+	for _, c := range candidates {
+		if m := releaseVersionRe.FindStringSubmatch(c); len(m) > 1 {
+			return m[1]
+		}
+	}
+	return tag
+}
+
+// isNewerBuild reports whether the release is newer than the installed
+// build. Same-version nightly rebuilds are told apart by their build ID.
+func (u *Updater) isNewerBuild(current *installedBuild, release *Release) bool {
+	latest := releaseVersion(release)
+	if u.isNewerVersion(current.Version, latest) {
+		return true
+	}
+
+	if current.BuildID == "" || normalizeVersion(latest) != current.Version {
+		return false
+	}
+
+	latestBuildID := releaseBuildID(release)
+	return latestBuildID != "" && latestBuildID > current.BuildID
+}
+
+// isNewerVersion reports whether latest is newer than current, using the
+// comparator of the configured or detected versioning scheme
+func (u *Updater) isNewerVersion(current, latest string) bool {
+	current = strings.TrimPrefix(current, "v")
+	latest = strings.TrimPrefix(latest, "v")
+
+	if current == "" || current == "0.0.0" {
+		return true
+	}
+
+	if latest == current {
+		return false
+	}
+
+	c := comparatorFor(u.cfg.VersionScheme, u.cfg.Branch, latest)
+	return c.Compare(latest, current) > 0
+}
+
+// parseVersion parses a version string into integer parts
+func parseVersion(v string) []int {
+	// Remove any prerelease suffix (e.g., -beta, -alpha, -nightly)
+	if idx := strings.IndexAny(v, "-+"); idx != -1 {
+		v = v[:idx]
+	}
+
+	parts := strings.Split(v, ".")
+	result := make([]int, 0, len(parts))
+
+	for _, p := range parts {
+		// Extract only the numeric prefix
+		numStr := ""
+		for _, c := range p {
+			if c >= '0' && c <= '9' {
+				numStr += string(c)
+			} else {
+				break
+			}
+		}
+		if numStr != "" {
+			var num int
+			fmt.Sscanf(numStr, "%d", &num)
+			result = append(result, num)
+		}
+	}
+
+	return result
+}
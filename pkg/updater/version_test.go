@@ -0,0 +1,345 @@
+package updater
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+const nightlyApplicationIni = `#### MOZ_APP_NAME
+[App]
+Vendor=Noraneko
+Name=Noraneko
+RemotingName=noraneko
+CodeName=Noraneko
+Version=128.0a1
+BuildID=20240501093512
+SourceRepository=https://github.com/f3liz-dev/noraneko-runtime
+SourceStamp=0123456789abcdef
+ID={ec8030f7-c20a-464f-9b0e-13a3a9e97384}
+
+[Gecko]
+MinVersion=128.0a1
+MaxVersion=128.0a1
+
+[XRE]
+EnableProfileMigrator=1
+`
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"128.0a1", "128.0"},
+		{"128.0b3", "128.0"},
+		{"128.0nightly", "128.0"},
+		{"128.0.1esr", "128.0.1"},
+		{"v1.2.3", "1.2.3"},
+		{"1.0.0-beta", "1.0.0"},
+		{" 128.0 ", "128.0"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeVersion(tt.input); got != tt.expected {
+			t.Errorf("normalizeVersion(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseApplicationIni(t *testing.T) {
+	build := parseApplicationIni(nightlyApplicationIni)
+	if build == nil {
+		t.Fatal("Expected a build from application.ini")
+	}
+
+	if build.Version != "128.0" {
+		t.Errorf("Expected version 128.0, got %s", build.Version)
+	}
+	if build.RawVersion != "128.0a1" {
+		t.Errorf("Expected raw version 128.0a1, got %s", build.RawVersion)
+	}
+	if build.BuildID != "20240501093512" {
+		t.Errorf("Expected build ID 20240501093512, got %s", build.BuildID)
+	}
+
+	// CRLF line endings, as written on Windows
+	crlf := "[App]\r\nVersion=128.0nightly\r\nBuildID=20240601000000\r\n"
+	build = parseApplicationIni(crlf)
+	if build == nil || build.Version != "128.0" || build.BuildID != "20240601000000" {
+		t.Errorf("Failed to parse CRLF application.ini: %+v", build)
+	}
+
+	if parseApplicationIni("[App]\nName=Noraneko\n") != nil {
+		t.Error("Expected nil for application.ini without a version")
+	}
+}
+
+func TestGetCurrentVersionNormalized(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	browserPath := filepath.Join(tmpDir, config.BrowserExe)
+	if err := os.WriteFile(browserPath, []byte("exe"), 0644); err != nil {
+		t.Fatalf("Failed to create browser exe: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "application.ini"), []byte(nightlyApplicationIni), 0644); err != nil {
+		t.Fatalf("Failed to write application.ini: %v", err)
+	}
+
+	cfg := &config.Config{
+		Path:    browserPath,
+		ExeDir:  tmpDir,
+		WorkDir: tmpDir,
+	}
+	u := New(cfg, Options{})
+
+	version, err := u.getCurrentVersion()
+	if err != nil {
+		t.Fatalf("Failed to get current version: %v", err)
+	}
+	if version != "128.0" {
+		t.Errorf("Expected version 128.0, got %s", version)
+	}
+}
+
+func TestGetCurrentVersionPathForms(t *testing.T) {
+	cfg := newPortableInstall(t, "1.2.0")
+	exe := cfg.Path
+	browserDir := filepath.Dir(exe)
+
+	// The executable, the install folder and the folder with a trailing
+	// separator all read the install's version
+	for _, path := range []string{exe, browserDir, browserDir + string(filepath.Separator)} {
+		cfg.Path = path
+		u := New(cfg, Options{})
+		version, err := u.getCurrentVersion()
+		if err != nil {
+			t.Fatalf("Failed to get the version for Path %s: %v", path, err)
+		}
+		if version != "1.2.0" {
+			t.Errorf("Expected version 1.2.0 for Path %s, got %s", path, version)
+		}
+		if got := cfg.GetBrowserPath(); got != exe {
+			t.Errorf("Expected Path %s to resolve to %s, got %s", path, exe, got)
+		}
+	}
+}
+
+func TestIsNewerBuild(t *testing.T) {
+	u := New(&config.Config{}, Options{})
+	current := parseApplicationIni(nightlyApplicationIni)
+
+	tests := []struct {
+		name     string
+		release  *Release
+		expected bool
+	}{
+		{"newer version", &Release{TagName: "v129.0a1"}, true},
+		{"older version", &Release{TagName: "v127.0"}, false},
+		{"same version without build ID", &Release{TagName: "v128.0a1"}, false},
+		{"same version newer rebuild", &Release{TagName: "v128.0a1-20240502010101"}, true},
+		{"same version same build", &Release{TagName: "v128.0a1-20240501093512"}, false},
+		{"same version older build", &Release{TagName: "v128.0a1-20240430000000"}, false},
+		{"build ID in asset name", &Release{
+			TagName: "v128.0a1",
+			Assets:  []Asset{{Name: "noraneko-128.0a1.en-US.win64-20240503000000.zip"}},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		if got := u.isNewerBuild(current, tt.release); got != tt.expected {
+			t.Errorf("%s: isNewerBuild = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestReleaseVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		release  *Release
+		expected string
+	}{
+		{"tag with v", &Release{TagName: "v128.0a1", Name: "Noraneko 127.0"}, "128.0a1"},
+		{"tag without v", &Release{TagName: "128.0a1", Name: "Noraneko v127.0"}, "128.0a1"},
+		{"tag with suffix", &Release{TagName: "v1.2.0+nightly"}, "1.2.0"},
+		{"version only in name", &Release{TagName: "nightly-20240501", Name: "Noraneko v128.0a1"}, "128.0a1"},
+		{"version only in asset", &Release{
+			TagName: "nightly",
+			Name:    "Nightly build",
+			Assets: []Asset{
+				{Name: "SHA256SUMS"},
+				{Name: "noraneko-128.0a1.en-US.win64.zip"},
+				{Name: "noraneko-127.0.en-US.win64.zip"},
+			},
+		}, "128.0a1"},
+		{"date tag", &Release{TagName: "20240501", Name: "Noraneko 128.0a1"}, "20240501"},
+		{"no version", &Release{TagName: "vnightly", Name: "Nightly build"}, "nightly"},
+	}
+
+	for _, tt := range tests {
+		if got := releaseVersion(tt.release); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestIsSkippedVersionFromName(t *testing.T) {
+	u := New(&config.Config{SkipVersion: "128.0a1"}, Options{})
+	if !u.isSkipped(&Release{TagName: "nightly-20240501", Name: "Noraneko v128.0a1"}) {
+		t.Error("Expected a tag without a version to be skipped by its name's version")
+	}
+	if u.isSkipped(&Release{TagName: "v128.0a1-20240502010101"}) {
+		t.Error("Expected a rebuild with a different tag not to be skipped")
+	}
+}
+
+// newVersionFixture creates a fake browser install in a temp directory and
+// returns an Updater pointing at it along with the browser directory
+func newVersionFixture(t *testing.T, files map[string]string) (*Updater, string) {
+	t.Helper()
+
+	tmpDir, err := os.MkdirTemp("", "noraneko-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	browserDir := filepath.Join(tmpDir, config.BrowserName)
+	files[config.BrowserExe] = "exe"
+	for name, content := range files {
+		path := filepath.Join(browserDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create fixture dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write fixture %s: %v", name, err)
+		}
+	}
+
+	cfg := &config.Config{
+		Path:    filepath.Join(browserDir, config.BrowserExe),
+		ExeDir:  browserDir,
+		WorkDir: tmpDir,
+	}
+	return New(cfg, Options{}), browserDir
+}
+
+func TestGetInstalledBuildPlatformIni(t *testing.T) {
+	u, _ := newVersionFixture(t, map[string]string{
+		"application.ini": "[App]\nName=Noraneko\n",
+		"platform.ini":    "[Build]\nBuildID=20240501093512\nMilestone=128.0a1\n",
+	})
+
+	build, err := u.getInstalledBuild()
+	if err != nil {
+		t.Fatalf("Failed to get installed build: %v", err)
+	}
+	if build.Version != "128.0" || build.BuildID != "20240501093512" {
+		t.Errorf("Expected 128.0 build 20240501093512, got %s build %s", build.Version, build.BuildID)
+	}
+}
+
+func TestGetInstalledBuildPrefersSpecificBuildID(t *testing.T) {
+	u, _ := newVersionFixture(t, map[string]string{
+		"application.ini": "[App]\nVersion=128.0a1\n",
+		"platform.ini":    "[Build]\nBuildID=20240501093512\nMilestone=128.0a1\n",
+	})
+
+	build, err := u.getInstalledBuild()
+	if err != nil {
+		t.Fatalf("Failed to get installed build: %v", err)
+	}
+	if build.RawVersion != "128.0a1" {
+		t.Errorf("Expected version from application.ini, got %s", build.RawVersion)
+	}
+	if build.BuildID != "20240501093512" {
+		t.Errorf("Expected build ID from platform.ini, got '%s'", build.BuildID)
+	}
+}
+
+func TestGetInstalledBuildCompatibilityIni(t *testing.T) {
+	u, browserDir := newVersionFixture(t, map[string]string{})
+
+	compat := "[Compatibility]\n" +
+		"LastVersion=128.0a1_20240501093512/20240501093512\n" +
+		"LastOSABI=WINNT_x86_64-msvc\n" +
+		"LastPlatformDir=" + browserDir + "\n" +
+		"LastAppDir=" + filepath.Join(browserDir, "browser") + "\n"
+	profileDir := filepath.Join(u.cfg.ExeDir, "Profiles", "Default")
+	if err := os.MkdirAll(profileDir, 0755); err != nil {
+		t.Fatalf("Failed to create profile dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(profileDir, "compatibility.ini"), []byte(compat), 0644); err != nil {
+		t.Fatalf("Failed to write compatibility.ini: %v", err)
+	}
+
+	build, err := u.getInstalledBuild()
+	if err != nil {
+		t.Fatalf("Failed to get installed build: %v", err)
+	}
+	if build.Version != "128.0" || build.BuildID != "20240501093512" {
+		t.Errorf("Expected 128.0 build 20240501093512, got %s build %s", build.Version, build.BuildID)
+	}
+}
+
+func TestGetInstalledBuildIgnoresForeignProfile(t *testing.T) {
+	u, _ := newVersionFixture(t, map[string]string{})
+
+	compat := "[Compatibility]\n" +
+		"LastVersion=127.0_20240401000000/20240401000000\n" +
+		"LastPlatformDir=" + filepath.Join(os.TempDir(), "SomeOtherInstall") + "\n"
+	profileDir := filepath.Join(u.cfg.ExeDir, "Profiles", "Default")
+	if err := os.MkdirAll(profileDir, 0755); err != nil {
+		t.Fatalf("Failed to create profile dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(profileDir, "compatibility.ini"), []byte(compat), 0644); err != nil {
+		t.Fatalf("Failed to write compatibility.ini: %v", err)
+	}
+
+	if _, err := u.getInstalledBuild(); err == nil {
+		t.Error("Expected no version from a profile used by another install")
+	}
+}
+
+func TestGetCurrentVersionCustomExe(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("ProgramFiles", filepath.Join(tmpDir, "ProgramFiles"))
+
+	// A portable install whose executable was renamed
+	browserDir := filepath.Join(tmpDir, config.BrowserName)
+	writeInstallFiles(t, browserDir, map[string]string{
+		"nora.exe":        "exe",
+		"application.ini": nightlyApplicationIni,
+	})
+	configContent := "[Settings]\nAutoSavePath=0\nBrowserExe=nora.exe\n"
+	if err := os.WriteFile(filepath.Join(tmpDir, config.ConfigFileName), []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	cfg, err := config.Load(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	u := New(cfg, Options{})
+
+	if got, want := cfg.GetBrowserPath(), filepath.Join(browserDir, "nora.exe"); got != want {
+		t.Errorf("Expected the browser at %s, got %s", want, got)
+	}
+	version, err := u.getCurrentVersion()
+	if err != nil {
+		t.Fatalf("Failed to get current version: %v", err)
+	}
+	if version != "128.0" {
+		t.Errorf("Expected version 128.0, got %s", version)
+	}
+
+	// The install is not taken for a broken one without noraneko.exe
+	if dir, problems := u.corruptInstall(); dir != "" {
+		t.Errorf("Expected a healthy install, got %v", problems)
+	}
+}
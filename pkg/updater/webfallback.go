@@ -0,0 +1,188 @@
+package updater
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// releaseDownloadRe matches asset download links on a GitHub release page
+var releaseDownloadRe = regexp.MustCompile(`href="([^"]*/releases/download/[^"]+)"`)
+
+// prereleaseLabelRe matches the label GitHub puts on the page of a
+// prerelease
+var prereleaseLabelRe = regexp.MustCompile(`class="Label Label--warning[^"]*"[^>]*>\s*Pre-release\s*<`)
+
+// atomFeed is the subset of a GitHub releases.atom feed that is read
+type atomFeed struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+// atomEntry is a single release in the feed
+type atomEntry struct {
+	Title   string    `xml:"title"`
+	Updated time.Time `xml:"updated"`
+	Links   []struct {
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+}
+
+// getLatestReleaseFromWeb reads the latest release from the GitHub web
+// pages instead of the API. Like the API, it takes the newest entry of the
+// releases.atom feed that is not a prerelease, which only its release page
+// tells, and it passes over releases excluded from the stable branch. The
+// assets come from the release's expanded assets fragment, and their sizes
+// from HEAD requests, as the fragment has none.
+func (u *Updater) getLatestReleaseFromWeb(ctx context.Context) (*Release, error) {
+	feed, err := u.fetchPage(ctx, u.webURL+"/releases.atom")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release feed: %w", err)
+	}
+	releases, err := parseReleaseFeed(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	var release *Release
+	for i := range releases {
+		if u.cfg.ExcludedFromStable(releases[i].TagName) {
+			continue
+		}
+		page, err := u.fetchPage(ctx, u.webURL+"/releases/tag/"+url.PathEscape(releases[i].TagName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch release page: %w", err)
+		}
+		if !prereleaseLabelRe.Match(page) {
+			release = &releases[i]
+			break
+		}
+	}
+	if release == nil {
+		return nil, fmt.Errorf("no release in release feed that is not a prerelease or excluded from the stable branch")
+	}
+
+	page, err := u.fetchPage(ctx, u.webURL+"/releases/expanded_assets/"+url.PathEscape(release.TagName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch release assets: %w", err)
+	}
+	base, err := url.Parse(u.webURL)
+	if err != nil {
+		return nil, err
+	}
+	release.Assets = parseReleaseAssets(page, base, release.TagName)
+	for i := range release.Assets {
+		asset := &release.Assets[i]
+		if asset.Size, err = u.fetchSize(ctx, asset.BrowserDownloadURL); err != nil {
+			return nil, fmt.Errorf("failed to get the size of %s: %w", asset.Name, err)
+		}
+	}
+	return release, nil
+}
+
+// fetchPage downloads a web page
+func (u *Updater) fetchPage(ctx context.Context, pageURL string) ([]byte, error) {
+	req, err := u.newRequest(ctx, "GET", pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := u.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", pageURL, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// fetchSize returns the Content-Length of a download, from a HEAD request
+func (u *Updater) fetchSize(ctx context.Context, downloadURL string) (int64, error) {
+	req, err := u.newRequest(ctx, "HEAD", downloadURL)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := u.do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%s returned status %d", downloadURL, resp.StatusCode)
+	}
+	if resp.ContentLength <= 0 {
+		return 0, fmt.Errorf("%s has no Content-Length", downloadURL)
+	}
+	return resp.ContentLength, nil
+}
+
+// parseReleaseFeed returns the releases of a releases.atom feed, newest
+// first and without assets. The tag is taken from the entry's
+// /releases/tag/ link.
+func parseReleaseFeed(data []byte) ([]Release, error) {
+	var feed atomFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		return nil, fmt.Errorf("failed to parse release feed: %w", err)
+	}
+
+	var releases []Release
+	for _, entry := range feed.Entries {
+		for _, link := range entry.Links {
+			_, tag, ok := strings.Cut(link.Href, "/releases/tag/")
+			if !ok || tag == "" {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(tag); err == nil {
+				tag = unescaped
+			}
+			releases = append(releases, Release{
+				TagName:     tag,
+				Name:        strings.TrimSpace(entry.Title),
+				PublishedAt: entry.Updated,
+			})
+			break
+		}
+	}
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no release found in release feed")
+	}
+	return releases, nil
+}
+
+// parseReleaseAssets extracts the download links of tag's assets from a
+// release page, resolving them against base
+func parseReleaseAssets(data []byte, base *url.URL, tag string) []Asset {
+	marker := "/releases/download/" + tag + "/"
+
+	var assets []Asset
+	seen := map[string]bool{}
+	for _, match := range releaseDownloadRe.FindAllSubmatch(data, -1) {
+		href := strings.ReplaceAll(string(match[1]), "&amp;", "&")
+		ref, err := url.Parse(href)
+		if err != nil || !strings.Contains(ref.Path, marker) {
+			continue
+		}
+		link := base.ResolveReference(ref).String()
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+
+		assets = append(assets, Asset{
+			Name:               path.Base(ref.Path),
+			BrowserDownloadURL: link,
+		})
+	}
+	return assets
+}
@@ -0,0 +1,167 @@
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+// releaseFeedFixture is a trimmed releases.atom feed as served by GitHub
+const releaseFeedFixture = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" xml:lang="en-US">
+  <id>tag:github.com,2008:https://github.com/f3liz-dev/noraneko-runtime/releases</id>
+  <link type="text/html" rel="alternate" href="https://github.com/f3liz-dev/noraneko-runtime/releases"/>
+  <title>Release notes from noraneko-runtime</title>
+  <updated>2024-05-02T09:35:12Z</updated>
+  <entry>
+    <id>tag:github.com,2008:Repository/1/v1.2.0+nightly</id>
+    <updated>2024-05-02T09:35:12Z</updated>
+    <link rel="alternate" type="text/html" href="https://github.com/f3liz-dev/noraneko-runtime/releases/tag/v1.2.0%2Bnightly"/>
+    <title>Noraneko 1.2.0 </title>
+    <content type="html">&lt;p&gt;Nightly build&lt;/p&gt;</content>
+  </entry>
+  <entry>
+    <id>tag:github.com,2008:Repository/1/v1.1.0</id>
+    <updated>2024-04-01T08:00:00Z</updated>
+    <link rel="alternate" type="text/html" href="https://github.com/f3liz-dev/noraneko-runtime/releases/tag/v1.1.0"/>
+    <title>Noraneko 1.1.0</title>
+  </entry>
+</feed>`
+
+// expandedAssetsFixture is a trimmed expanded_assets fragment of a release
+// page
+const expandedAssetsFixture = `<div data-view-component="true" class="Box Box--condensed mt-3">
+  <ul data-view-component="true">
+    <li class="Box-row d-flex flex-column flex-md-row">
+      <a href="/f3liz-dev/noraneko-runtime/releases/download/v1.2.0%2Bnightly/noraneko-windows-x86_64-portable.zip" rel="nofollow" data-turbo="false" class="Truncate">
+        <span class="Truncate-text text-bold">noraneko-windows-x86_64-portable.zip</span>
+      </a>
+    </li>
+    <li class="Box-row d-flex flex-column flex-md-row">
+      <a href="/f3liz-dev/noraneko-runtime/releases/download/v1.2.0%2Bnightly/SHA256SUMS" rel="nofollow" data-turbo="false" class="Truncate">
+        <span class="Truncate-text text-bold">SHA256SUMS</span>
+      </a>
+      <a href="/f3liz-dev/noraneko-runtime/releases/download/v1.2.0%2Bnightly/SHA256SUMS" class="d-none">Download</a>
+    </li>
+    <li class="Box-row d-flex flex-column flex-md-row">
+      <a href="/f3liz-dev/noraneko-runtime/archive/refs/tags/v1.2.0+nightly.zip" rel="nofollow" class="Truncate">Source code (zip)</a>
+    </li>
+    <li class="Box-row d-flex flex-column flex-md-row">
+      <a href="/f3liz-dev/noraneko-runtime/releases/download/v1.1.0/stale.zip" class="Truncate">stale.zip</a>
+    </li>
+  </ul>
+</div>`
+
+func TestParseReleaseFeedAndAssets(t *testing.T) {
+	releases, err := parseReleaseFeed([]byte(releaseFeedFixture))
+	if err != nil {
+		t.Fatalf("parseReleaseFeed failed: %v", err)
+	}
+	if len(releases) != 2 || releases[1].TagName != "v1.1.0" {
+		t.Fatalf("Expected both releases of the feed, got %+v", releases)
+	}
+	release := &releases[0]
+
+	base, _ := url.Parse("https://github.com/f3liz-dev/noraneko-runtime")
+	release.Assets = parseReleaseAssets([]byte(expandedAssetsFixture), base, release.TagName)
+
+	download := "https://github.com/f3liz-dev/noraneko-runtime/releases/download/v1.2.0%2Bnightly/"
+	expected := &Release{
+		TagName:     "v1.2.0+nightly",
+		Name:        "Noraneko 1.2.0",
+		PublishedAt: time.Date(2024, 5, 2, 9, 35, 12, 0, time.UTC),
+		Assets: []Asset{
+			{Name: "noraneko-windows-x86_64-portable.zip", BrowserDownloadURL: download + "noraneko-windows-x86_64-portable.zip"},
+			{Name: "SHA256SUMS", BrowserDownloadURL: download + "SHA256SUMS"},
+		},
+	}
+	if !reflect.DeepEqual(release, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, release)
+	}
+}
+
+func TestParseReleaseFeedEmpty(t *testing.T) {
+	if _, err := parseReleaseFeed([]byte(`<feed xmlns="http://www.w3.org/2005/Atom"></feed>`)); err == nil {
+		t.Error("Expected an error for a feed without releases")
+	}
+	if _, err := parseReleaseFeed([]byte("<html>blocked</html")); err == nil {
+		t.Error("Expected an error for a page that is not a feed")
+	}
+}
+
+// prereleasePageFixture is the part of a prerelease's page that marks it
+const prereleasePageFixture = `<div class="d-flex flex-items-center">
+  <h1 data-view-component="true" class="d-inline mr-3">Noraneko 1.2.0</h1>
+  <span data-view-component="true" class="Label Label--warning Label--large v-align-text-bottom d-none d-md-inline-block">Pre-release</span>
+</div>`
+
+func TestGetLatestReleaseHTMLFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "blocked by policy", http.StatusForbidden)
+	})
+	mux.HandleFunc("/web/releases.atom", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(releaseFeedFixture))
+	})
+	mux.HandleFunc("/web/releases/tag/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/v1.2.0+nightly") {
+			w.Write([]byte(prereleasePageFixture))
+			return
+		}
+		w.Write([]byte("<h1>Noraneko 1.1.0</h1>"))
+	})
+	mux.HandleFunc("/web/releases/expanded_assets/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/v1.1.0") {
+			http.NotFound(w, r)
+			return
+		}
+		fragment := strings.NewReplacer("/f3liz-dev/noraneko-runtime/", "/web/", "v1.2.0%2Bnightly", "v1.1.0", "v1.1.0", "v1.0.0").Replace(expandedAssetsFixture)
+		w.Write([]byte(fragment))
+	})
+	mux.HandleFunc("/web/releases/download/v1.1.0/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(path.Base(r.URL.Path)))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	cfg := &config.Config{ExeDir: tmpDir, WorkDir: tmpDir}
+	u := newTestUpdater(cfg, Options{}, server)
+	u.webURL = server.URL + "/web"
+
+	// Without the setting the API error is returned
+	if _, err := u.getLatestRelease(context.Background()); err == nil {
+		t.Fatal("Expected the blocked API to fail without AllowHTMLFallback")
+	}
+
+	cfg.AllowHTMLFallback = true
+	release, err := u.getLatestRelease(context.Background())
+	if err != nil {
+		t.Fatalf("Expected the fallback to succeed: %v", err)
+	}
+	// The newer prerelease is passed over, as by the API
+	if release.TagName != "v1.1.0" || len(release.Assets) != 2 {
+		t.Fatalf("Unexpected release %+v", release)
+	}
+	if want := server.URL + "/web/releases/download/v1.1.0/SHA256SUMS"; release.Assets[1].BrowserDownloadURL != want {
+		t.Errorf("Expected asset URL %s, got %s", want, release.Assets[1].BrowserDownloadURL)
+	}
+	if size := release.Assets[1].Size; size != int64(len("SHA256SUMS")) {
+		t.Errorf("Expected the asset size from a HEAD request, got %d", size)
+	}
+
+	// Nothing is left once the stable branch excludes the release
+	cfg.Branch = "stable"
+	cfg.StableExcludePatterns = []string{`^v1\.1\.`}
+	if _, err := u.getLatestRelease(context.Background()); err == nil {
+		t.Error("Expected an error when every release is excluded")
+	}
+}
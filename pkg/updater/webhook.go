@@ -0,0 +1,150 @@
+package updater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/f3liz-dev/noraneko-winupdater/pkg/config"
+)
+
+const (
+	// webhookAttempts is how often a webhook notification is tried
+	webhookAttempts = 3
+
+	// webhookRetryDelay is the wait between webhook attempts
+	webhookRetryDelay = 5 * time.Second
+
+	// webhookTimeout limits each webhook request
+	webhookTimeout = 10 * time.Second
+)
+
+// redacted replaces secrets in webhook payloads
+const redacted = "REDACTED"
+
+var (
+	// urlUserinfoRe matches the credentials of a URL
+	urlUserinfoRe = regexp.MustCompile(`(://)[^/@\s"]+@`)
+
+	// secretParamRe matches URL query parameters that carry credentials,
+	// such as the tokens of signed download URLs
+	secretParamRe = regexp.MustCompile(`(?i)([?&](?:[a-z0-9_-]*token|sig|signature|x-amz-signature|x-amz-credential|key|api_key|secret|password|auth)=)[^&\s"]*`)
+)
+
+// redactSecrets removes credentials from text sent to the webhook: URL
+// userinfo, credential query parameters and the values of the configured
+// [Headers], which may hold tokens for mirrors or gateways
+func (u *Updater) redactSecrets(text string) string {
+	text = urlUserinfoRe.ReplaceAllString(text, "${1}"+redacted+"@")
+	text = secretParamRe.ReplaceAllString(text, "${1}"+redacted)
+	for _, value := range u.cfg.Headers {
+		if len(value) >= 8 && !strings.ContainsAny(value, `"\`) {
+			text = strings.ReplaceAll(text, value, redacted)
+		}
+	}
+	return text
+}
+
+// webhookPayload returns the JSON sent to WebhookURL for a run. A failed
+// run has no result, so one is made from the error and the phases done.
+// A run of [Installs] keeps its result, which lists the failed installs.
+func (u *Updater) webhookPayload(result *RunResult, runErr error, startedAt time.Time) ([]byte, error) {
+	if runErr != nil && result == nil {
+		result = &RunResult{
+			Asset:     u.asset,
+			Message:   "Failed: " + runErr.Error(),
+			Error:     runErr.Error(),
+			StartedAt: startedAt,
+			Duration:  time.Since(startedAt),
+			Phases:    u.phases,
+		}
+	}
+
+	// URLs keep their & unescaped so their query parameters can be matched
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(result); err != nil {
+		return nil, err
+	}
+
+	// Redacting may not break the JSON: secrets are replaced by a plain
+	// word, and quotes or backslashes are never part of a match
+	return []byte(u.redactSecrets(buf.String())), nil
+}
+
+// webhookEvent returns the Webhook event of a run: a failure, an update
+// found or installed, or no update
+func webhookEvent(result *RunResult, runErr error) string {
+	switch {
+	case runErr != nil:
+		return config.WebhookFailure
+	case result != nil && (result.Updated || result.UpdateAvailable):
+		return config.WebhookUpdate
+	}
+	return config.WebhookNoUpdate
+}
+
+// notifyWebhook POSTs the result of a run to WebhookURL if its event is
+// one of WebhookEvents, retrying failed requests. Failures are only
+// printed as warnings, they never change the outcome of the run.
+func (u *Updater) notifyWebhook(result *RunResult, runErr error, startedAt time.Time) {
+	if u.cfg.WebhookURL == "" || !slices.Contains(u.cfg.WebhookEvents, webhookEvent(result, runErr)) {
+		return
+	}
+
+	payload, err := u.webhookPayload(result, runErr, startedAt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to encode webhook payload: %v\n", err)
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := u.postWebhook(payload)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= webhookAttempts {
+			fmt.Fprintf(os.Stderr, "Warning: webhook notification failed: %v\n", err)
+			return
+		}
+		sleep(webhookRetryDelay)
+	}
+}
+
+// postWebhook sends one webhook request. It reports whether a failure is
+// worth retrying: network errors, rate limits and server errors are.
+func (u *Updater) postWebhook(payload []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	// The configured [Headers] are meant for downloads and are not sent
+	req, err := http.NewRequestWithContext(ctx, "POST", u.cfg.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", u.userAgent())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+}